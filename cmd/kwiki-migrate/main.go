@@ -0,0 +1,72 @@
+// Command kwiki-migrate imports existing Markdown wiki directories into another storage backend.
+//
+// Usage:
+//
+//	kwiki-migrate -config config.yaml -from ./data/wikis -to sqlite -db ./data/kwiki.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/storage"
+)
+
+func main() {
+	configPath := flag.String("config", "config.yaml", "configuration file")
+	from := flag.String("from", "", "Markdown wiki directory to import (default <data_dir>/wikis)")
+	to := flag.String("to", storage.BackendSQLite, "target storage backend (sqlite or file)")
+	dbPath := flag.String("db", "", "SQLite database path (default from config or <data_dir>/kwiki.db)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Printf("Using default configuration: %v", err)
+		cfg = config.Default()
+	}
+
+	dataDir := cfg.Server.DataDir
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	if *from == "" {
+		*from = filepath.Join(dataDir, "wikis")
+	}
+	if *dbPath == "" {
+		*dbPath = cfg.Server.DatabasePath
+	}
+	if *to == storage.BackendMarkdown {
+		log.Fatal("Target backend must differ from the Markdown source")
+	}
+
+	if _, err := os.Stat(*from); err != nil {
+		log.Fatalf("Source directory %s is not accessible: %v", *from, err)
+	}
+
+	dst, err := storage.Open(*to, dataDir, *dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open target storage: %v", err)
+	}
+	if closer, ok := dst.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	result, err := storage.Migrate(storage.NewMarkdownStorage(*from), dst)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	fmt.Printf("Migrated %d wikis, %d log entries, %d chat messages from %s to %s\n",
+		result.Wikis, result.Logs, result.Chat, *from, *to)
+	if len(result.Failed) > 0 {
+		fmt.Printf("Failed wikis (%d):\n", len(result.Failed))
+		for _, id := range result.Failed {
+			fmt.Printf("  %s\n", id)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/stcn52/kwiki/internal/auth"
+	"github.com/stcn52/kwiki/internal/storage"
+)
+
+// runToken creates an API token. By default it prints the token and the
+// auth.tokens entry for config.yaml; with -store it saves the token in storage.
+func runToken(args []string) error {
+	fs, configPath := newFlagSet("token")
+	name := fs.String("name", "", "token name (required)")
+	scopeList := fs.String("scopes", "read", "comma separated scopes: read, generate, admin")
+	store := fs.Bool("store", false, "save the token in the configured storage instead of printing a config entry")
+	expires := fs.Int("expires", 0, "days until the token expires, 0 for never (-store only)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *name == "" {
+		fs.Usage()
+		return errors.New("-name is required")
+	}
+	scopes, err := auth.ParseScopes(strings.Split(*scopeList, ","))
+	if err != nil {
+		return err
+	}
+
+	if !*store {
+		secret, err := auth.NewToken()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token: %s\n\n", secret)
+		fmt.Println("Add to config.yaml:")
+		fmt.Println("auth:")
+		fmt.Println("  tokens:")
+		fmt.Printf("    - name: %q\n", *name)
+		fmt.Printf("      hash: %q\n", auth.HashToken(secret))
+		fmt.Printf("      scopes: [%s]\n", strings.Join(strings.Split(*scopeList, ","), ", "))
+		return nil
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	st, closeStore, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	tokenStore, ok := st.(storage.TokenStorage)
+	if !ok {
+		return fmt.Errorf("storage backend %q cannot store API tokens", cfg.Server.StorageBackend)
+	}
+	tokens, err := auth.NewTokenAuthenticator(nil, tokenStore)
+	if err != nil {
+		return err
+	}
+	secret, token, err := tokens.Create(*name, scopes, time.Duration(*expires)*24*time.Hour, "cli")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Token: %s\n", secret)
+	fmt.Printf("ID:    %s (revoke with DELETE /api/tokens/%s)\n", token.ID, token.ID)
+	return nil
+}
+
+// runPasswd prints the auth.users entry for config.yaml with a bcrypt password hash
+func runPasswd(args []string) error {
+	fs, _ := newFlagSet("passwd")
+	scopeList := fs.String("scopes", "read", "comma separated scopes: read, generate, admin")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one username")
+	}
+	if _, err := auth.ParseScopes(strings.Split(*scopeList, ",")); err != nil {
+		return err
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Add to config.yaml:")
+	fmt.Println("auth:")
+	fmt.Println("  users:")
+	fmt.Printf("    - username: %q\n", positional[0])
+	fmt.Printf("      password_hash: %q\n", hash)
+	fmt.Printf("      scopes: [%s]\n", strings.Join(strings.Split(*scopeList, ","), ", "))
+	return nil
+}
+
+// readPassword reads a password from the terminal without echo, or a line from piped stdin
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if len(password) == 0 {
+		return "", errors.New("empty password")
+	}
+	return string(password), nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/stcn52/kwiki/internal/export"
+	"github.com/stcn52/kwiki/internal/server"
+	"github.com/stcn52/kwiki/internal/storage"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// runServe starts the HTTP server
+func runServe(args []string) error {
+	fs, configPath := newFlagSet("serve")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	srv, err := server.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	return srv.Start()
+}
+
+// runExport writes a stored wiki to a file or stdout
+func runExport(args []string) error {
+	fs, configPath := newFlagSet("export")
+	format := fs.String("format", string(models.ExportFormatMarkdown), "export format: markdown, json or html")
+	output := fs.String("o", "", "output file, '-' for stdout (default <title>-wiki.<ext>)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one wiki id")
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	store, closeStore, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	wiki, err := store.LoadWiki(positional[0])
+	if err != nil {
+		return err
+	}
+
+	result, err := export.Render(wiki, models.ExportFormat(*format))
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err := os.Stdout.Write(result.Content)
+		return err
+	}
+	path := *output
+	if path == "" {
+		path = result.Filename
+	}
+	if err := os.WriteFile(path, result.Content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s to %s\n", wiki.ID, path)
+	return nil
+}
+
+// runList prints the stored wikis as a table
+func runList(args []string) error {
+	fs, configPath := newFlagSet("list")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	store, closeStore, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	// Summaries avoid loading page content when the backend supports it
+	var wikis []*models.Wiki
+	if querier, ok := store.(storage.WikiQuerier); ok {
+		wikis, err = querier.ListWikiSummaries()
+	} else {
+		var all map[string]*models.Wiki
+		all, err = store.LoadAllWikis()
+		for _, wiki := range all {
+			wikis = append(wikis, wiki)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list wikis: %w", err)
+	}
+
+	sort.Slice(wikis, func(i, j int) bool { return wikis[i].ID < wikis[j].ID })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE\tSTATUS\tLANGUAGES\tUPDATED")
+	for _, wiki := range wikis {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			wiki.ID, wiki.Title, wiki.Status, strings.Join(wiki.Languages, ","), wiki.UpdatedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// runDelete removes a wiki from storage
+func runDelete(args []string) error {
+	fs, configPath := newFlagSet("delete")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one wiki id")
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	store, closeStore, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if err := store.DeleteWiki(positional[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %s\n", positional[0])
+	return nil
+}
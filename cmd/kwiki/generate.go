@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/stcn52/kwiki/internal/ai"
+	"github.com/stcn52/kwiki/internal/generator"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// progressBarWidth is the number of cells in the terminal progress bar
+const progressBarWidth = 30
+
+// runGenerate generates a wiki in the foreground and saves it to the configured storage
+func runGenerate(args []string) error {
+	fs, configPath := newFlagSet("generate")
+	languages := fs.String("lang", "", "comma-separated languages to generate, the first is the primary language (default from .kwiki.yaml, else zh)")
+	provider := fs.String("provider", "", "AI provider (default from config)")
+	model := fs.String("model", "", "model name (default from the provider config)")
+	title := fs.String("title", "", "wiki title (default derived from the repository)")
+	ref := fs.String("ref", "", "branch, tag or commit SHA to document (default branch when empty)")
+	token := fs.String("token", "", "access token for private repositories")
+	templates := fs.String("templates", "", "comma-separated prompt templates to generate pages from, e.g. readme,api-reference (default all)")
+	planOutline := fs.Bool("plan", false, "let the model plan the page outline from the analyzed code structure")
+	modulePages := fs.Bool("modules", false, "add a reference page per analyzed module below the API reference")
+	verbose := fs.Bool("v", false, "print generator logs instead of a progress bar")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one repository url or local path")
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	// The CLI clones with the operator's own SSH agent and keys
+	cfg.Repository.AmbientSSH = true
+	store, closeStore, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	req := models.GenerationRequest{
+		RepositoryURL: positional[0],
+		Ref:           *ref,
+		AccessToken:   *token,
+		Title:         *title,
+		Settings: models.WikiSettings{
+			AIProvider:     *provider,
+			Model:          *model,
+			EnableDiagrams: cfg.Generator.EnableDiagrams,
+			EnableRAG:      cfg.Generator.EnableRAG,
+			PlanOutline:    *planOutline,
+			ModulePages:    *modulePages,
+		},
+	}
+	for _, lang := range strings.Split(*languages, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			req.Languages = append(req.Languages, lang)
+		}
+	}
+	for _, name := range strings.Split(*templates, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			req.Settings.Templates = append(req.Settings.Templates, name)
+		}
+	}
+	// Without -lang the repository's .kwiki.yaml decides, zh when it has none
+	req.PrimaryLanguage = "zh"
+	if len(req.Languages) > 0 {
+		req.PrimaryLanguage = req.Languages[0]
+	}
+	req.Settings.Language = req.PrimaryLanguage
+
+	// Same defaults as the HTTP handler
+	if req.Settings.AIProvider == "" {
+		req.Settings.AIProvider = cfg.AI.DefaultProvider
+	}
+	if req.Settings.Model == "" {
+		if providerConfig, exists := cfg.AI.Providers[req.Settings.AIProvider]; exists {
+			req.Settings.Model = providerConfig.Model
+		}
+	}
+
+	if !*verbose {
+		// Generator logs would break the progress bar, the structured logs are still stored
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	aiManager := ai.NewProviderManagerFromConfig(cfg)
+	p, exists := aiManager.GetProvider(req.Settings.AIProvider)
+	if !exists || p == nil || !p.IsAvailable() {
+		return fmt.Errorf("AI provider %q is not available, check the API key in the config", req.Settings.AIProvider)
+	}
+
+	wikiGen := generator.New(cfg, aiManager)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	display := &progressDisplay{out: os.Stderr, verbose: *verbose}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var logs []models.WikiLogEntry
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		progressCh := wikiGen.GetProgressChannel()
+		logCh := wikiGen.GetLogChannel()
+		for {
+			select {
+			case progress := <-progressCh:
+				display.update(progress)
+			case entry := <-logCh:
+				logs = append(logs, entry)
+				display.log(entry)
+			case <-done:
+				// Drain what the generator sent before it returned
+				for {
+					select {
+					case progress := <-progressCh:
+						display.update(progress)
+					case entry := <-logCh:
+						logs = append(logs, entry)
+						display.log(entry)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	wiki, genErr := wikiGen.GenerateWikiSync(ctx, req)
+	close(done)
+	wg.Wait()
+	display.finish()
+
+	if wiki != nil {
+		if err := store.SaveWiki(wiki); err != nil {
+			return fmt.Errorf("failed to save wiki: %w", err)
+		}
+		if err := store.SaveLogs(wiki.ID, logs); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save generation logs: %v\n", err)
+		}
+	}
+	if genErr != nil {
+		return genErr
+	}
+
+	fmt.Fprintf(os.Stderr, "Generated %s: %d pages in %s\n", wiki.ID, len(wiki.Pages), time.Since(start).Round(time.Second))
+	fmt.Println(wiki.ID)
+	return nil
+}
+
+// progressDisplay renders generation progress on a terminal
+type progressDisplay struct {
+	out     io.Writer
+	verbose bool
+	drawn   bool
+}
+
+// update redraws the progress bar in place
+func (d *progressDisplay) update(progress models.GenerationProgress) {
+	if d.verbose {
+		fmt.Fprintf(d.out, "[%3d%%] %s: %s\n", progress.Progress, progress.CurrentStep, progress.Message)
+		return
+	}
+
+	percent := progress.Progress
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	filled := percent * progressBarWidth / 100
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	message := progress.CurrentStep
+	if progress.Message != "" {
+		message += ": " + progress.Message
+	}
+	if runes := []rune(message); len(runes) > 60 {
+		message = string(runes[:57]) + "..."
+	}
+	// \033[K clears the rest of a longer previous line
+	fmt.Fprintf(d.out, "\r[%s] %3d%% %s\033[K", bar, percent, message)
+	d.drawn = true
+}
+
+// log prints warnings and errors above the progress bar
+func (d *progressDisplay) log(entry models.WikiLogEntry) {
+	if entry.Level != models.LogLevelWarning && entry.Level != models.LogLevelError {
+		return
+	}
+	if d.drawn {
+		fmt.Fprint(d.out, "\r\033[K")
+	}
+	message := entry.Message
+	if entry.Error != "" {
+		message += ": " + entry.Error
+	}
+	fmt.Fprintf(d.out, "%s %s\n", strings.ToUpper(string(entry.Level)), message)
+}
+
+// finish ends the progress line
+func (d *progressDisplay) finish() {
+	if d.drawn && !d.verbose {
+		fmt.Fprintln(d.out)
+	}
+}
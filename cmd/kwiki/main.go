@@ -0,0 +1,170 @@
+// Command kwiki runs the KWiki web server and provides headless commands that
+// work directly against the configured storage.
+//
+// Usage:
+//
+//	kwiki [serve]                          start the web server (default)
+//	kwiki generate <repo-url|path> [flags] generate a wiki with terminal progress
+//	kwiki export <wiki-id> -format html    export a stored wiki
+//	kwiki list                             list stored wikis
+//	kwiki delete <wiki-id>                 delete a stored wiki
+//	kwiki token -name ci -scopes generate  create an API token
+//	kwiki passwd <username>                hash a web UI password
+//	kwiki version                          print build information
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/storage"
+)
+
+// Build information, set via -ldflags by the Makefile
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	GitCommit = "unknown"
+)
+
+// command is a kwiki subcommand
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "serve", usage: "serve [-config file]", summary: "Start the web server", run: runServe},
+		{name: "generate", usage: "generate <repo-url|path> [flags]", summary: "Generate a wiki without starting the server", run: runGenerate},
+		{name: "export", usage: "export <wiki-id> [-format markdown|json|html] [-o file]", summary: "Export a stored wiki", run: runExport},
+		{name: "list", usage: "list [-config file]", summary: "List stored wikis", run: runList},
+		{name: "delete", usage: "delete <wiki-id> [-config file]", summary: "Delete a stored wiki", run: runDelete},
+		{name: "token", usage: "token -name <name> [-scopes read,generate,admin] [-store] [-expires days]", summary: "Create an API token", run: runToken},
+		{name: "passwd", usage: "passwd <username> [-scopes read,generate,admin]", summary: "Hash a web UI password for config.yaml", run: runPasswd},
+		{name: "version", usage: "version", summary: "Print build information", run: runVersion},
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+
+	// Without a subcommand (or with only flags) behave like the old server binary
+	name := "serve"
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					return
+				}
+				fmt.Fprintf(os.Stderr, "kwiki %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "kwiki: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// usage prints the list of subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: kwiki <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'kwiki <command> -h' for command flags.")
+}
+
+// newFlagSet creates the flag set for a subcommand with the shared -config flag
+func newFlagSet(cmd string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("kwiki "+cmd, flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "configuration file")
+	for _, c := range commands {
+		if c.name == cmd {
+			usage := c.usage
+			fs.Usage = func() {
+				fmt.Fprintf(fs.Output(), "Usage: kwiki %s\n\nFlags:\n", usage)
+				fs.PrintDefaults()
+			}
+		}
+	}
+	return fs, configPath
+}
+
+// parseArgs parses flags that may appear before or after positional arguments,
+// e.g. "kwiki export <id> -format html"
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// loadConfig loads the configuration file, falling back to the defaults when it is missing
+func loadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("Config file %s not found, using default configuration", path)
+			return config.Default(), nil
+		}
+		return nil, fmt.Errorf("failed to load config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// openStorage opens the storage backend configured in cfg, the same one the server uses
+func openStorage(cfg *config.Config) (storage.Storage, func(), error) {
+	dataDir := cfg.Server.DataDir
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+
+	store, err := storage.Open(cfg.Server.StorageBackend, dataDir, cfg.Server.DatabasePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+
+	closeFn := func() {}
+	if closer, ok := store.(interface{ Close() error }); ok {
+		closeFn = func() { closer.Close() }
+	}
+	return store, closeFn, nil
+}
+
+// runVersion prints build information
+func runVersion(args []string) error {
+	fmt.Printf("kwiki %s (commit %s, built %s)\n", Version, GitCommit, BuildTime)
+	return nil
+}
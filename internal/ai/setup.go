@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"log"
+	"os"
+
+	"github.com/stcn52/kwiki/internal/config"
+)
+
+// NewProviderManagerFromConfig creates a provider manager with every provider
+// configured in cfg registered. It is shared by the server and the CLI.
+func NewProviderManagerFromConfig(cfg *config.Config) *ProviderManager {
+	aiManager := NewProviderManager()
+
+	if openaiKey := cfg.AI.Providers["openai"].APIKey; openaiKey != "" {
+		aiManager.RegisterProvider("openai", NewOpenAIProvider(openaiKey, cfg.AI.Providers["openai"].BaseURL))
+	}
+
+	if geminiKey := cfg.AI.Providers["gemini"].APIKey; geminiKey != "" {
+		aiManager.RegisterProvider("gemini", NewGeminiProvider(geminiKey))
+	}
+
+	if deepseekConfig, exists := cfg.AI.Providers["deepseek"]; exists {
+		if deepseekConfig.APIKey != "" {
+			aiManager.RegisterProvider("deepseek", NewDeepSeekProvider(deepseekConfig.APIKey))
+		} else {
+			log.Printf("DeepSeek provider found but API key is empty")
+		}
+	}
+
+	// Always register Ollama provider (it will check availability)
+	ollamaHost := os.Getenv("OLLAMA_HOST")
+	if ollamaHost == "" {
+		// Use base_url from config if OLLAMA_HOST is not set
+		if ollamaConfig, exists := cfg.AI.Providers["ollama"]; exists && ollamaConfig.BaseURL != "" {
+			ollamaHost = ollamaConfig.BaseURL
+		}
+	}
+	aiManager.RegisterProvider("ollama", NewOllamaProvider(ollamaHost))
+
+	aiManager.SetDefaultProvider(cfg.AI.DefaultProvider)
+	return aiManager
+}
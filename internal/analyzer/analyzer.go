@@ -4,16 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
-	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-
 	"github.com/stcn52/kwiki/internal/config"
 	"github.com/stcn52/kwiki/pkg/models"
 	"github.com/stcn52/kwiki/pkg/utils"
@@ -22,57 +18,60 @@ import (
 // CodeAnalyzer handles repository analysis
 type CodeAnalyzer struct {
 	config *config.Config
+	cache  *CloneCache
 }
 
 // New creates a new code analyzer
 func New(cfg *config.Config) *CodeAnalyzer {
 	return &CodeAnalyzer{
 		config: cfg,
+		cache:  sharedCloneCache(cfg.Repository),
 	}
 }
 
-// AnalyzeRepository clones and analyzes a repository
-func (ca *CodeAnalyzer) AnalyzeRepository(ctx context.Context, repoURL, branch, accessToken string) (*models.Repository, error) {
-	// Parse repository URL
-	parsedURL, err := url.Parse(repoURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid repository URL: %w", err)
+// AnalyzeRepository clones and analyzes a repository at ref (branch, tag or
+// commit SHA, empty for the default branch). Local paths and file:// URLs are
+// analyzed in place.
+func (ca *CodeAnalyzer) AnalyzeRepository(ctx context.Context, repoURL, ref, accessToken string) (*models.Repository, error) {
+	if dir, ok := LocalPath(repoURL); ok {
+		return ca.AnalyzeLocalDirectory(ctx, dir)
 	}
 
-	// Extract owner and repo name
-	pathParts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		return nil, fmt.Errorf("invalid repository URL format")
+	// Parse repository URL (HTTPS, SSH or scp-like, nested groups allowed)
+	remote, err := utils.ParseRepositoryURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
 	}
-
-	owner := pathParts[0]
-	repoName := strings.TrimSuffix(pathParts[1], ".git")
-	provider := ca.detectProvider(parsedURL.Host)
+	provider := ca.detectProvider(remote.Host)
 
 	// Create repository model
 	repo := &models.Repository{
 		ID:        utils.GenerateID(),
 		URL:       repoURL,
-		Name:      repoName,
-		Owner:     owner,
+		Name:      remote.Name,
+		Owner:     remote.Owner,
 		Provider:  provider,
-		Branch:    branch,
+		Branch:    ref,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if branch == "" {
+	if ref == "" {
 		repo.Branch = "main" // Default branch
 	}
 
-	// Clone repository
-	localPath := filepath.Join(ca.config.Repository.CloneDir, repo.ID)
-	repo.LocalPath = localPath
+	auth, err := ca.cloneAuth(remote, provider, accessToken)
+	if err != nil {
+		return nil, err
+	}
 
-	err = ca.cloneRepository(repoURL, localPath, repo.Branch, accessToken)
+	// Check out from the clone cache, the mirror is fetched instead of re-cloned
+	checkout, err := ca.cache.Checkout(ctx, repoURL, ref, auth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to clone repository: %w", err)
 	}
+	repo.LocalPath = checkout.Dir
+	repo.CommitSHA = checkout.CommitSHA
 
 	// Analyze repository structure
 	err = ca.analyzeRepoStructure(repo)
@@ -83,41 +82,6 @@ func (ca *CodeAnalyzer) AnalyzeRepository(ctx context.Context, repoURL, branch,
 	return repo, nil
 }
 
-// cloneRepository clones a Git repository
-func (ca *CodeAnalyzer) cloneRepository(repoURL, localPath, branch, accessToken string) error {
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(localPath, 0755); err != nil {
-		return err
-	}
-
-	// Prepare clone options
-	cloneOptions := &git.CloneOptions{
-		URL:      repoURL,
-		Progress: os.Stdout,
-	}
-
-	if branch != "" {
-		cloneOptions.ReferenceName = plumbing.ReferenceName("refs/heads/" + branch)
-		cloneOptions.SingleBranch = true
-	}
-
-	// Add authentication if access token is provided
-	if accessToken != "" {
-		cloneOptions.Auth = &http.BasicAuth{
-			Username: "token", // Can be anything for token auth
-			Password: accessToken,
-		}
-	}
-
-	// Clone the repository
-	_, err := git.PlainClone(localPath, false, cloneOptions)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // analyzeRepoStructure analyzes the structure of the cloned repository
 func (ca *CodeAnalyzer) analyzeRepoStructure(repo *models.Repository) error {
 	var totalSize int64
@@ -146,6 +110,9 @@ func (ca *CodeAnalyzer) analyzeRepoStructure(repo *models.Repository) error {
 
 			totalSize += info.Size()
 			fileCount++
+			if err := ca.checkLimits(fileCount, totalSize); err != nil {
+				return err
+			}
 
 			// Detect language by file extension
 			ext := strings.ToLower(filepath.Ext(path))
@@ -164,11 +131,17 @@ func (ca *CodeAnalyzer) analyzeRepoStructure(repo *models.Repository) error {
 	repo.Size = totalSize
 	repo.FileCount = fileCount
 
-	// Extract top languages
+	// Extract top languages, most used first
 	var languages []string
 	for lang := range languageCount {
 		languages = append(languages, lang)
 	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languageCount[languages[i]] != languageCount[languages[j]] {
+			return languageCount[languages[i]] > languageCount[languages[j]]
+		}
+		return languages[i] < languages[j]
+	})
 	repo.Languages = languages
 
 	// Try to read README for description
@@ -177,6 +150,17 @@ func (ca *CodeAnalyzer) analyzeRepoStructure(repo *models.Repository) error {
 	return nil
 }
 
+// checkLimits enforces repository.max_files and max_repo_size, zero disables a limit
+func (ca *CodeAnalyzer) checkLimits(fileCount int, totalSize int64) error {
+	if limit := ca.config.Repository.MaxFiles; limit > 0 && fileCount > limit {
+		return fmt.Errorf("more than %d files: %w", limit, ErrRepositoryTooLarge)
+	}
+	if limit := ca.config.Repository.MaxRepoSize; limit > 0 && totalSize > limit {
+		return fmt.Errorf("larger than %d bytes: %w", limit, ErrRepositoryTooLarge)
+	}
+	return nil
+}
+
 // AnalyzeCodeStructure analyzes the code structure of a repository
 func (ca *CodeAnalyzer) AnalyzeCodeStructure(ctx context.Context, repo *models.Repository) (*models.CodeStructure, error) {
 	structure := &models.CodeStructure{
@@ -291,8 +275,14 @@ func (ca *CodeAnalyzer) shouldInclude(path string) bool {
 	return false
 }
 
-// detectProvider detects the Git provider from hostname
+// detectProvider detects the Git provider from hostname. Self-hosted hosts
+// listed in repository.git_hosts take precedence over name heuristics.
 func (ca *CodeAnalyzer) detectProvider(host string) string {
+	host = strings.ToLower(host)
+	if provider, ok := ca.config.Repository.GitHosts[host]; ok && provider != "" {
+		return strings.ToLower(provider)
+	}
+
 	switch {
 	case strings.Contains(host, "github"):
 		return "github"
@@ -300,8 +290,12 @@ func (ca *CodeAnalyzer) detectProvider(host string) string {
 		return "gitlab"
 	case strings.Contains(host, "bitbucket"):
 		return "bitbucket"
+	case strings.Contains(host, "gitea"), host == "codeberg.org":
+		return "gitea"
+	case strings.Contains(host, "gogs"):
+		return "gogs"
 	default:
-		return "unknown"
+		return "git"
 	}
 }
 
@@ -456,8 +450,15 @@ func (ca *CodeAnalyzer) analyzeModules(files []models.FileInfo) ([]models.Module
 		moduleMap[dir] = append(moduleMap[dir], file)
 	}
 
-	// Create modules
-	for dirPath, moduleFiles := range moduleMap {
+	// Create modules in path order so that summaries of the structure are stable
+	dirPaths := make([]string, 0, len(moduleMap))
+	for dirPath := range moduleMap {
+		dirPaths = append(dirPaths, dirPath)
+	}
+	sort.Strings(dirPaths)
+
+	for _, dirPath := range dirPaths {
+		moduleFiles := moduleMap[dirPath]
 		module := models.Module{
 			Name:     filepath.Base(dirPath),
 			Path:     dirPath,
@@ -470,10 +471,19 @@ func (ca *CodeAnalyzer) analyzeModules(files []models.FileInfo) ([]models.Module
 
 			// Extract functions and classes (simplified)
 			fileFunctions, fileClasses := ca.extractCodeElements(file)
+			for i := range fileFunctions {
+				fileFunctions[i].Module = module.Name
+				module.Functions = append(module.Functions, fileFunctions[i].Name)
+			}
+			for i := range fileClasses {
+				fileClasses[i].Module = module.Name
+				module.Classes = append(module.Classes, fileClasses[i].Name)
+			}
 			functions = append(functions, fileFunctions...)
 			classes = append(classes, fileClasses...)
 		}
 
+		attachMethods(functions[len(functions)-len(module.Functions):], classes[len(classes)-len(module.Classes):])
 		module.LineCount = totalLines
 		modules = append(modules, module)
 	}
@@ -520,12 +530,16 @@ func (ca *CodeAnalyzer) extractCodeElements(file models.FileInfo) ([]models.Func
 		// Extract functions (very basic pattern matching)
 		if ca.isFunctionDeclaration(line, file.Language) {
 			fn := models.Function{
-				Name:      ca.extractFunctionName(line, file.Language),
-				File:      file.Path,
-				StartLine: i + 1,
-				Language:  file.Language,
-				Signature: line,
-				IsPublic:  ca.isPublicFunction(line, file.Language),
+				Name:        ca.extractFunctionName(line, file.Language),
+				File:        file.Path,
+				StartLine:   i + 1,
+				Language:    file.Language,
+				Signature:   declarationSignature(line),
+				Description: docComment(lines, i),
+				IsPublic:    ca.isPublicFunction(line, file.Language),
+			}
+			if file.Language == "Go" {
+				fn.Receiver = goReceiverType(line)
 			}
 			functions = append(functions, fn)
 		}
@@ -533,11 +547,13 @@ func (ca *CodeAnalyzer) extractCodeElements(file models.FileInfo) ([]models.Func
 		// Extract classes (very basic pattern matching)
 		if ca.isClassDeclaration(line, file.Language) {
 			class := models.Class{
-				Name:      ca.extractClassName(line, file.Language),
-				File:      file.Path,
-				StartLine: i + 1,
-				Language:  file.Language,
-				IsPublic:  ca.isPublicClass(line, file.Language),
+				Name:        ca.extractClassName(line, file.Language),
+				File:        file.Path,
+				StartLine:   i + 1,
+				Language:    file.Language,
+				Signature:   declarationSignature(line),
+				Description: docComment(lines, i),
+				IsPublic:    ca.isPublicClass(line, file.Language),
 			}
 			classes = append(classes, class)
 		}
@@ -546,11 +562,72 @@ func (ca *CodeAnalyzer) extractCodeElements(file models.FileInfo) ([]models.Func
 	return functions, classes
 }
 
+// declarationSignature returns a declaration line without its body, e.g.
+// "func Open(path string) (*DB, error)" for "func Open(path string) (*DB, error) {"
+func declarationSignature(line string) string {
+	if idx := strings.Index(line, " {"); idx > 0 {
+		line = line[:idx]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(line, "{"))
+}
+
+// docComment returns the // comment lines directly above lines[index], joined into one paragraph
+func docComment(lines []string, index int) string {
+	start := index
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "//") {
+		start--
+	}
+	parts := make([]string, 0, index-start)
+	for _, line := range lines[start:index] {
+		if text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "//")); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// goReceiverType returns the receiver type of a Go method declaration, e.g.
+// Server for "func (s *Server) Start() error", and "" for plain functions
+func goReceiverType(line string) string {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, "func"))
+	if !strings.HasPrefix(rest, "(") {
+		return ""
+	}
+	end := strings.Index(rest, ")")
+	if end < 0 {
+		return ""
+	}
+	fields := strings.Fields(rest[1:end])
+	if len(fields) == 0 {
+		return ""
+	}
+	receiver := strings.TrimPrefix(fields[len(fields)-1], "*")
+	if idx := strings.Index(receiver, "["); idx > 0 {
+		receiver = receiver[:idx]
+	}
+	return receiver
+}
+
+// attachMethods adds the methods of a module to the types they belong to
+func attachMethods(functions []models.Function, classes []models.Class) {
+	for _, fn := range functions {
+		if fn.Receiver == "" {
+			continue
+		}
+		for i := range classes {
+			if classes[i].Name == fn.Receiver {
+				classes[i].Methods = append(classes[i].Methods, fn)
+				break
+			}
+		}
+	}
+}
+
 // Helper functions for code element extraction (simplified implementations)
 func (ca *CodeAnalyzer) isFunctionDeclaration(line, language string) bool {
 	switch language {
 	case "Go":
-		return strings.Contains(line, "func ")
+		return strings.HasPrefix(line, "func ")
 	case "Python":
 		return strings.Contains(line, "def ")
 	case "JavaScript", "TypeScript":
@@ -566,7 +643,7 @@ func (ca *CodeAnalyzer) isFunctionDeclaration(line, language string) bool {
 func (ca *CodeAnalyzer) isClassDeclaration(line, language string) bool {
 	switch language {
 	case "Go":
-		return strings.Contains(line, "type ") && strings.Contains(line, "struct")
+		return strings.HasPrefix(line, "type ") && (strings.Contains(line, "struct") || strings.Contains(line, "interface"))
 	case "Python":
 		return strings.Contains(line, "class ")
 	case "JavaScript", "TypeScript":
@@ -580,12 +657,16 @@ func (ca *CodeAnalyzer) isClassDeclaration(line, language string) bool {
 
 func (ca *CodeAnalyzer) extractFunctionName(line, language string) string {
 	// Simplified name extraction
+	if language == "Go" && goReceiverType(line) != "" {
+		// Skip the receiver of a method: func (s *Server) Start() error
+		line = "func " + line[strings.Index(line, ")")+1:]
+	}
 	words := strings.Fields(line)
 	for i, word := range words {
 		if word == "func" || word == "def" || word == "function" {
 			if i+1 < len(words) {
 				name := words[i+1]
-				if idx := strings.Index(name, "("); idx > 0 {
+				if idx := strings.IndexAny(name, "(["); idx > 0 {
 					return name[:idx]
 				}
 				return name
@@ -602,7 +683,7 @@ func (ca *CodeAnalyzer) extractClassName(line, language string) string {
 		if word == "class" || word == "type" {
 			if i+1 < len(words) {
 				name := words[i+1]
-				if idx := strings.Index(name, " "); idx > 0 {
+				if idx := strings.IndexAny(name, "[{"); idx > 0 {
 					return name[:idx]
 				}
 				return name
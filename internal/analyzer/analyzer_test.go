@@ -0,0 +1,95 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+const testGoSource = `package server
+
+// Server serves the wiki.
+type Server struct {
+	addr string
+}
+
+// Handler handles one request.
+type Handler interface {
+	Serve() error
+}
+
+// NewServer creates a server
+// listening on addr.
+func NewServer(addr string) *Server { return &Server{addr: addr} }
+
+// Start starts the server.
+func (s *Server) Start() error {
+	go func() {}()
+	return nil
+}
+
+func (s *Server) stop() {}
+
+func Map[T any](items []T) []T {
+	return items
+}
+`
+
+func TestAnalyzeModules(t *testing.T) {
+	ca := New(config.Default())
+	modules, functions, classes := ca.analyzeModules([]models.FileInfo{
+		{Path: "server/server.go", Language: "Go", Content: testGoSource},
+	})
+
+	if len(modules) != 1 || modules[0].Path != "server" {
+		t.Fatalf("modules = %+v", modules)
+	}
+
+	byName := make(map[string]models.Function)
+	for _, fn := range functions {
+		byName[fn.Name] = fn
+	}
+	if len(functions) != 4 {
+		t.Errorf("functions = %+v", functions)
+	}
+	if fn := byName["NewServer"]; fn.Signature != "func NewServer(addr string) *Server" ||
+		fn.Description != "NewServer creates a server listening on addr." || fn.Receiver != "" || !fn.IsPublic {
+		t.Errorf("NewServer = %+v", fn)
+	}
+	if fn := byName["Start"]; fn.Signature != "func (s *Server) Start() error" || fn.Receiver != "Server" || !fn.IsPublic {
+		t.Errorf("Start = %+v", fn)
+	}
+	if fn := byName["stop"]; fn.Receiver != "Server" || fn.IsPublic {
+		t.Errorf("stop = %+v", fn)
+	}
+	if fn := byName["Map"]; fn.Signature != "func Map[T any](items []T) []T" {
+		t.Errorf("Map = %+v", fn)
+	}
+
+	if len(classes) != 2 || classes[0].Name != "Server" || classes[1].Name != "Handler" {
+		t.Fatalf("classes = %+v", classes)
+	}
+	if classes[0].Signature != "type Server struct" || classes[0].Description != "Server serves the wiki." ||
+		len(classes[0].Methods) != 2 || classes[0].Methods[0].Name != "Start" {
+		t.Errorf("Server = %+v", classes[0])
+	}
+	if classes[1].Signature != "type Handler interface" {
+		t.Errorf("Handler = %+v", classes[1])
+	}
+}
+
+func TestCloneAuthRequiresConfiguredSSHKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "/nonexistent/agent.sock")
+	t.Setenv("HOME", t.TempDir())
+	remote, err := utils.ParseRepositoryURL("git@github.com:example/private.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := New(config.Default())
+	if auth, err := ca.cloneAuth(remote, "github", ""); err == nil || auth != nil {
+		t.Errorf("cloneAuth without ssh_key_path = %v, %v, want an error", auth, err)
+	}
+}
@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// defaultSSHKeys are tried in order with ambient_ssh when no SSH agent is running
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// cloneAuth returns the go-git auth method for a remote. SSH remotes use the
+// configured key, or with repository.ambient_ssh the SSH agent or a default key
+// in ~/.ssh; HTTP(S) remotes use the access token when one is given.
+func (ca *CodeAnalyzer) cloneAuth(remote *utils.RepositoryURL, provider, accessToken string) (transport.AuthMethod, error) {
+	if !remote.IsSSH() {
+		if accessToken == "" {
+			return nil, nil
+		}
+		return &http.BasicAuth{
+			Username: tokenUsername(provider),
+			Password: accessToken,
+		}, nil
+	}
+
+	user := remote.User
+	if user == "" {
+		user = ssh.DefaultUsername
+	}
+
+	if keyPath := ca.config.Repository.SSHKeyPath; keyPath != "" {
+		auth, err := ssh.NewPublicKeysFromFile(user, keyPath, ca.config.Repository.SSHKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", keyPath, err)
+		}
+		return auth, nil
+	}
+
+	// The server's own identity is only used when explicitly enabled
+	if !ca.config.Repository.AmbientSSH {
+		return nil, fmt.Errorf("no SSH credentials for %s: set repository.ssh_key_path", remote.Host)
+	}
+
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		if auth, err := ssh.NewSSHAgentAuth(user); err == nil {
+			return auth, nil
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range defaultSSHKeys {
+			keyPath := filepath.Join(home, ".ssh", name)
+			if _, err := os.Stat(keyPath); err != nil {
+				continue
+			}
+			if auth, err := ssh.NewPublicKeysFromFile(user, keyPath, ca.config.Repository.SSHKeyPassphrase); err == nil {
+				return auth, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no SSH credentials for %s: set repository.ssh_key_path or start an SSH agent", remote.Host)
+}
+
+// tokenUsername returns the HTTP basic auth user name a host expects for access tokens
+func tokenUsername(provider string) string {
+	switch provider {
+	case "gitlab":
+		return "oauth2"
+	case "bitbucket":
+		return "x-token-auth"
+	default:
+		return "token" // GitHub, Gitea and Gogs accept any user name with a token
+	}
+}
@@ -0,0 +1,477 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// ErrRepositoryTooLarge is returned when a checkout exceeds repository.max_repo_size or max_files
+var ErrRepositoryTooLarge = errors.New("repository exceeds configured limits")
+
+const (
+	mirrorsDirName   = "mirrors"
+	checkoutsDirName = "checkouts"
+	// checkoutMarker marks a complete checkout; its mtime records the last use for LRU eviction
+	checkoutMarker = ".kwiki-checkout"
+	// tempDirPrefix marks checkouts still being written, removed on startup
+	tempDirPrefix = ".tmp-"
+)
+
+// CloneCache keeps one bare mirror per repository under <clone_dir>/mirrors and
+// a history-less checkout per resolved commit under <clone_dir>/checkouts.
+// Mirrors are fetched instead of re-cloned, and the least recently used
+// entries are evicted once the cache grows beyond repository.cache_max_size.
+type CloneCache struct {
+	dir      string
+	maxBytes int64
+	maxSize  int64
+	maxFiles int
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// Checkout is a repository checked out at a single commit
+type Checkout struct {
+	Dir       string
+	CommitSHA string
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = make(map[string]*CloneCache)
+)
+
+// sharedCloneCache returns the process-wide cache for the configured clone directory,
+// so concurrent analyzers share the per-repository locks
+func sharedCloneCache(cfg config.RepositoryConfig) *CloneCache {
+	dir := cfg.CloneDir
+	if dir == "" {
+		dir = "./repos"
+	}
+	abs, err := filepath.Abs(dir)
+	if err == nil {
+		dir = abs
+	}
+
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	if cache, ok := caches[dir]; ok {
+		return cache
+	}
+	cache := NewCloneCache(dir, cfg.CacheMaxSize, cfg.MaxRepoSize, cfg.MaxFiles)
+	caches[dir] = cache
+	return cache
+}
+
+// NewCloneCache creates a clone cache in dir. maxBytes bounds the whole cache,
+// maxSize and maxFiles bound a single checkout; zero disables a limit.
+// Checkouts left half-written by an earlier process are removed.
+func NewCloneCache(dir string, maxBytes, maxSize int64, maxFiles int) *CloneCache {
+	cache := &CloneCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		locks:    make(map[string]*sync.Mutex),
+	}
+	cache.removeTempDirs()
+	return cache
+}
+
+// repoLock returns the lock serializing fetches and checkouts of one repository
+func (cc *CloneCache) repoLock(key string) *sync.Mutex {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	lock, ok := cc.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		cc.locks[key] = lock
+	}
+	return lock
+}
+
+// cacheKey maps a repository URL to a directory name; HTTPS and SSH remotes of
+// the same repository share a mirror. URLs whose path would not stay a plain
+// relative path are named after their hash.
+func cacheKey(repoURL string) string {
+	if remote, err := utils.ParseRepositoryURL(repoURL); err == nil {
+		if key := remote.PackagePath(); filepath.IsLocal(filepath.FromSlash(key)) {
+			return key
+		}
+	}
+	return "unknown/" + utils.HashString(repoURL)
+}
+
+// cachePath joins elem to the cache directory and fails unless the result is
+// inside it, so nothing outside the cache is ever written or removed
+func (cc *CloneCache) cachePath(elem ...string) (string, error) {
+	path := filepath.Join(append([]string{cc.dir}, elem...)...)
+	if rel, err := filepath.Rel(cc.dir, path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("cache path %s is outside %s", path, cc.dir)
+	}
+	return path, nil
+}
+
+// Checkout returns a checkout of repoURL at ref (branch, tag or commit SHA, empty
+// for the default branch). The mirror is cloned on first use and fetched on
+// later calls; existing checkouts of the same commit are reused.
+func (cc *CloneCache) Checkout(ctx context.Context, repoURL, ref string, auth transport.AuthMethod) (*Checkout, error) {
+	key := cacheKey(repoURL)
+	lock := cc.repoLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	repo, err := cc.syncMirror(ctx, key, repoURL, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := ref
+	if revision == "" {
+		revision = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", revision, ErrRefNotFound)
+	}
+
+	dir, err := cc.cachePath(checkoutsDirName, filepath.FromSlash(key), hash.String())
+	if err != nil {
+		return nil, err
+	}
+	checkout := &Checkout{Dir: dir, CommitSHA: hash.String()}
+	if _, err := os.Stat(filepath.Join(checkout.Dir, checkoutMarker)); err == nil {
+		touch(filepath.Join(checkout.Dir, checkoutMarker))
+		return checkout, nil
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	if err := cc.writeTree(commit, checkout.Dir); err != nil {
+		return nil, err
+	}
+	log.Printf("Checked out %s at %s", key, hash.String()[:12])
+
+	// Evict with this repository still locked, so its new checkout is never removed
+	cc.evict(key)
+	return checkout, nil
+}
+
+// ReadFile reads a single file of repoURL at ref from the mirror without
+// checking the tree out. Missing files return an error wrapping fs.ErrNotExist.
+func (cc *CloneCache) ReadFile(ctx context.Context, repoURL, ref, name string, auth transport.AuthMethod) ([]byte, error) {
+	key := cacheKey(repoURL)
+	lock := cc.repoLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	repo, err := cc.syncMirror(ctx, key, repoURL, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := ref
+	if revision == "" {
+		revision = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", revision, ErrRefNotFound)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+
+	file, err := commit.File(name)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return []byte(content), nil
+}
+
+// syncMirror clones the bare mirror of a repository or fetches it if it exists
+func (cc *CloneCache) syncMirror(ctx context.Context, key, repoURL string, auth transport.AuthMethod) (*git.Repository, error) {
+	mirrorDir, err := cc.cachePath(mirrorsDirName, filepath.FromSlash(key)+".git")
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := git.PlainOpen(mirrorDir)
+	if err != nil {
+		// Missing or broken mirror, clone it again
+		os.RemoveAll(mirrorDir)
+		if err := os.MkdirAll(filepath.Dir(mirrorDir), 0755); err != nil {
+			return nil, err
+		}
+		repo, err = git.PlainCloneContext(ctx, mirrorDir, true, &git.CloneOptions{
+			URL:    repoURL,
+			Auth:   auth,
+			Mirror: true,
+			Tags:   git.AllTags,
+		})
+		if err != nil {
+			os.RemoveAll(mirrorDir)
+			return nil, fmt.Errorf("failed to clone %s: %w", repoURL, err)
+		}
+		touch(mirrorDir)
+		return repo, nil
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteURL: repoURL,
+		Auth:      auth,
+		RefSpecs:  []gitconfig.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"},
+		Tags:      git.AllTags,
+		Force:     true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("failed to fetch %s: %w", repoURL, err)
+	}
+	touch(mirrorDir)
+	return repo, nil
+}
+
+// writeTree writes the files of a commit to dir without any git history. The
+// size and file limits are checked before anything is written.
+func (cc *CloneCache) writeTree(commit *object.Commit, dir string) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	var files int
+	var size int64
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files++
+		size += f.Size
+		if cc.maxFiles > 0 && files > cc.maxFiles {
+			return fmt.Errorf("more than %d files: %w", cc.maxFiles, ErrRepositoryTooLarge)
+		}
+		if cc.maxSize > 0 && size > cc.maxSize {
+			return fmt.Errorf("larger than %d bytes: %w", cc.maxSize, ErrRepositoryTooLarge)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), tempDirPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		// Submodules and symlinks are not needed for analysis; never write outside the checkout
+		if f.Mode == filemode.Submodule || f.Mode == filemode.Symlink || !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return nil
+		}
+		return writeBlob(f, filepath.Join(tmpDir, filepath.FromSlash(f.Name)))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write checkout: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, checkoutMarker), []byte(commit.Hash.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+// writeBlob writes one file of a tree
+func writeBlob(f *object.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cacheEntry is an evictable mirror or checkout
+type cacheEntry struct {
+	key      string
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// evict removes least recently used checkouts and mirrors until the cache fits
+// in maxBytes. Repositories locked by another analysis are skipped; current is
+// locked by the caller and only its older checkouts may go.
+func (cc *CloneCache) evict(current string) {
+	if cc.maxBytes <= 0 {
+		return
+	}
+
+	entries := cc.entries()
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	if total <= cc.maxBytes {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].lastUsed.Before(entries[j].lastUsed) })
+
+	// Locks taken here are held until eviction finishes; busy repositories are skipped
+	locked := make(map[string]bool)
+	defer func() {
+		for key := range locked {
+			cc.repoLock(key).Unlock()
+		}
+	}()
+
+	now := time.Now()
+	for _, entry := range entries {
+		if total <= cc.maxBytes {
+			break
+		}
+		if entry.key == current {
+			// The caller holds this lock; keep the mirror and anything used just now
+			if strings.HasSuffix(entry.path, ".git") || now.Sub(entry.lastUsed) < time.Minute {
+				continue
+			}
+		} else if !locked[entry.key] {
+			if !cc.repoLock(entry.key).TryLock() {
+				continue
+			}
+			locked[entry.key] = true
+		}
+
+		if err := os.RemoveAll(entry.path); err != nil {
+			log.Printf("Warning: failed to evict %s: %v", entry.path, err)
+			continue
+		}
+		log.Printf("Evicted %s from clone cache (%d bytes)", entry.path, entry.size)
+		total -= entry.size
+	}
+}
+
+// entries lists all mirrors and checkouts in the cache
+func (cc *CloneCache) entries() []cacheEntry {
+	var entries []cacheEntry
+
+	mirrorsDir := filepath.Join(cc.dir, mirrorsDirName)
+	filepath.WalkDir(mirrorsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || !strings.HasSuffix(path, ".git") {
+			return nil
+		}
+		rel, _ := filepath.Rel(mirrorsDir, path)
+		entries = append(entries, newCacheEntry(strings.TrimSuffix(filepath.ToSlash(rel), ".git"), path, path))
+		return filepath.SkipDir
+	})
+
+	checkoutsDir := filepath.Join(cc.dir, checkoutsDirName)
+	filepath.WalkDir(checkoutsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		marker := filepath.Join(path, checkoutMarker)
+		if _, err := os.Stat(marker); err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(checkoutsDir, filepath.Dir(path))
+		entries = append(entries, newCacheEntry(filepath.ToSlash(rel), path, marker))
+		return filepath.SkipDir
+	})
+
+	return entries
+}
+
+// newCacheEntry measures a cache directory; stamp is the file whose mtime records the last use
+func newCacheEntry(key, path, stamp string) cacheEntry {
+	entry := cacheEntry{key: key, path: path, size: dirSize(path)}
+	if info, err := os.Stat(stamp); err == nil {
+		entry.lastUsed = info.ModTime()
+	}
+	return entry
+}
+
+// removeTempDirs deletes checkouts interrupted by a crash
+func (cc *CloneCache) removeTempDirs() {
+	filepath.WalkDir(filepath.Join(cc.dir, checkoutsDirName), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), tempDirPrefix) {
+			os.RemoveAll(path)
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, checkoutMarker)); err == nil {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// dirSize returns the total size of the files under path
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// touch records a use of a cache entry for LRU eviction
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
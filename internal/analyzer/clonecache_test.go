@@ -0,0 +1,154 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitFile writes a file into a work tree and commits it
+func commitFile(t *testing.T, repo *git.Repository, dir, name, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add(name); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := worktree.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "kwiki", Email: "kwiki@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func TestCloneCache(t *testing.T) {
+	// go-git's file transport runs git-upload-pack
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+
+	srcDir := t.TempDir()
+	src, err := git.PlainInit(srcDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitFile(t, src, srcDir, "main.go", "package main\n")
+	if _, err := src.CreateTag("v1.0.0", plumbing.NewHash(first), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCloneCache(filepath.Join(t.TempDir(), "repos"), 0, 0, 0)
+	ctx := context.Background()
+
+	checkout, err := cache.Checkout(ctx, srcDir, "", nil)
+	if err != nil {
+		t.Fatalf("Checkout(HEAD): %v", err)
+	}
+	if checkout.CommitSHA != first {
+		t.Errorf("CommitSHA = %s, want %s", checkout.CommitSHA, first)
+	}
+	if _, err := os.Stat(filepath.Join(checkout.Dir, "main.go")); err != nil {
+		t.Errorf("main.go not checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(checkout.Dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("checkout should not contain git history")
+	}
+
+	// A new commit is fetched into the existing mirror; the tag still resolves to the old commit
+	second := commitFile(t, src, srcDir, "util.go", "package main\n")
+	head, err := cache.Checkout(ctx, srcDir, "", nil)
+	if err != nil {
+		t.Fatalf("Checkout after fetch: %v", err)
+	}
+	if head.CommitSHA != second {
+		t.Errorf("CommitSHA after fetch = %s, want %s", head.CommitSHA, second)
+	}
+	tagged, err := cache.Checkout(ctx, srcDir, "v1.0.0", nil)
+	if err != nil {
+		t.Fatalf("Checkout(v1.0.0): %v", err)
+	}
+	if tagged.Dir != checkout.Dir {
+		t.Errorf("tag checkout = %s, want reuse of %s", tagged.Dir, checkout.Dir)
+	}
+	if _, err := cache.Checkout(ctx, srcDir, "missing", nil); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("Checkout(missing) error = %v, want ErrRefNotFound", err)
+	}
+
+	mirrors, _ := filepath.Glob(filepath.Join(cache.dir, mirrorsDirName, "unknown", "*.git"))
+	if len(mirrors) != 1 {
+		t.Errorf("mirrors = %v, want exactly one", mirrors)
+	}
+
+	// File limit is enforced before anything is written
+	limited := NewCloneCache(filepath.Join(t.TempDir(), "repos"), 0, 0, 1)
+	if _, err := limited.Checkout(ctx, srcDir, "", nil); !errors.Is(err, ErrRepositoryTooLarge) {
+		t.Errorf("Checkout over max_files error = %v, want ErrRepositoryTooLarge", err)
+	}
+
+	// With a tiny budget the older checkout is evicted, the one just written stays
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(checkout.Dir, checkoutMarker), old, old)
+	cache.maxBytes = 1
+	third := commitFile(t, src, srcDir, "extra.go", "package main\n")
+	latest, err := cache.Checkout(ctx, srcDir, "", nil)
+	if err != nil {
+		t.Fatalf("Checkout with eviction: %v", err)
+	}
+	if latest.CommitSHA != third {
+		t.Errorf("CommitSHA = %s, want %s", latest.CommitSHA, third)
+	}
+	if _, err := os.Stat(checkout.Dir); !os.IsNotExist(err) {
+		t.Errorf("least recently used checkout was not evicted")
+	}
+	if _, err := os.Stat(latest.Dir); err != nil {
+		t.Errorf("current checkout was evicted: %v", err)
+	}
+}
+
+// TestCloneCacheStaysInDir a URL with ".." segments must not name a mirror outside
+// the cache, which would be removed when it fails to open as a repository
+func TestCloneCacheStaysInDir(t *testing.T) {
+	root := t.TempDir()
+	victim := filepath.Join(root, "x.git")
+	if err := os.MkdirAll(victim, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(victim, "keep"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCloneCache(filepath.Join(root, "repos"), 0, 0, 0)
+	repoURL := "https://evil.invalid/a/../../../../x"
+	if key := cacheKey(repoURL); !filepath.IsLocal(filepath.FromSlash(key)) {
+		t.Errorf("cacheKey(%q) = %q", repoURL, key)
+	}
+
+	// A canceled context fails the clone without any network access
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.Checkout(ctx, repoURL, "", nil); err == nil {
+		t.Fatal("Checkout succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(victim, "keep")); err != nil {
+		t.Errorf("directory outside the cache was removed: %v", err)
+	}
+
+	if _, err := cache.cachePath(mirrorsDirName, "a/../../../x.git"); err == nil {
+		t.Error("cachePath accepted a path outside the cache")
+	}
+}
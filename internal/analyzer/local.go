@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// ProviderLocal is the provider of repositories read from the local filesystem
+const ProviderLocal = "local"
+
+// LocalPath reports whether repoURL refers to a local directory and returns its
+// absolute path. Both plain paths (absolute, ./relative, ~/home) and file:// URLs
+// are accepted; anything with another scheme or scp-like git syntax is remote.
+func LocalPath(repoURL string) (string, bool) {
+	repoURL = strings.TrimSpace(repoURL)
+	if repoURL == "" {
+		return "", false
+	}
+
+	var path string
+	switch {
+	case strings.HasPrefix(repoURL, "file://"):
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return "", false
+		}
+		path = filepath.FromSlash(parsed.Path)
+	case strings.Contains(repoURL, "://"), strings.HasPrefix(repoURL, "git@"):
+		return "", false
+	case filepath.IsAbs(repoURL), repoURL == ".", repoURL == "..",
+		strings.HasPrefix(repoURL, "./"), strings.HasPrefix(repoURL, "../"),
+		strings.HasPrefix(repoURL, `.\`), strings.HasPrefix(repoURL, `..\`):
+		path = repoURL
+	case strings.HasPrefix(repoURL, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		path = filepath.Join(home, repoURL[2:])
+	default:
+		// Bare relative paths such as "myproject" only count when the directory exists,
+		// otherwise "github.com/owner/repo" would be treated as a path
+		info, err := os.Stat(repoURL)
+		if err != nil || !info.IsDir() {
+			return "", false
+		}
+		path = repoURL
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	return abs, true
+}
+
+// ReadModulePath returns the module path declared in dir/go.mod, or "" if there is none
+func ReadModulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(data)
+}
+
+// AnalyzeLocalDirectory analyzes a directory in place without cloning it
+func (ca *CodeAnalyzer) AnalyzeLocalDirectory(ctx context.Context, dir string) (*models.Repository, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("local repository %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("local repository %s is not a directory", dir)
+	}
+
+	name := filepath.Base(dir)
+	owner := ""
+	if modulePath := ReadModulePath(dir); modulePath != "" {
+		name = modulePath[strings.LastIndex(modulePath, "/")+1:]
+		if parts := strings.Split(modulePath, "/"); len(parts) >= 2 {
+			owner = parts[len(parts)-2]
+		}
+	}
+
+	repo := &models.Repository{
+		ID:        utils.GenerateID(),
+		URL:       "file://" + filepath.ToSlash(dir),
+		Name:      name,
+		Owner:     owner,
+		Provider:  ProviderLocal,
+		LocalPath: dir,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if sha, err := resolveLocalRef(dir, ""); err == nil {
+		repo.CommitSHA = sha
+	}
+
+	if err := ca.analyzeRepoStructure(repo); err != nil {
+		return nil, fmt.Errorf("failed to analyze repository structure: %w", err)
+	}
+	return repo, nil
+}
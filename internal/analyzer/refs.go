@@ -0,0 +1,120 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// ErrRefNotFound is returned when a branch, tag or commit does not exist
+var ErrRefNotFound = errors.New("ref not found")
+
+// ResolveRef resolves a branch, tag or commit SHA to a full commit SHA. An
+// empty ref resolves the default branch (HEAD). Remote repositories are queried
+// with ls-remote, so nothing is cloned. Local directories that are not git
+// repositories resolve to "" when no ref is requested.
+func (ca *CodeAnalyzer) ResolveRef(ctx context.Context, repoURL, ref, accessToken string) (string, error) {
+	if dir, ok := LocalPath(repoURL); ok {
+		return resolveLocalRef(dir, ref)
+	}
+
+	remote, err := utils.ParseRepositoryURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL: %w", err)
+	}
+	auth, err := ca.cloneAuth(remote, ca.detectProvider(remote.Host), accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	lister := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repoURL},
+	})
+	refs, err := lister.ListContext(ctx, &git.ListOptions{Auth: auth, PeelingOption: git.AppendPeeled})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote refs: %w", err)
+	}
+
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, r := range refs {
+		byName[r.Name()] = r
+	}
+
+	if ref == "" {
+		head, ok := byName[plumbing.HEAD]
+		if !ok {
+			return "", fmt.Errorf("remote has no HEAD: %w", ErrRefNotFound)
+		}
+		if head.Type() == plumbing.SymbolicReference {
+			if head, ok = byName[head.Target()]; !ok {
+				return "", fmt.Errorf("remote HEAD target missing: %w", ErrRefNotFound)
+			}
+		}
+		return head.Hash().String(), nil
+	}
+
+	// Annotated tags are peeled to the commit they point to
+	for _, name := range []string{"refs/tags/" + ref + "^{}", "refs/tags/" + ref, "refs/heads/" + ref, ref} {
+		if r, ok := byName[plumbing.ReferenceName(name)]; ok && r.Type() == plumbing.HashReference {
+			return r.Hash().String(), nil
+		}
+	}
+
+	if IsCommitSHA(ref) {
+		ref = strings.ToLower(ref)
+		if len(ref) == 40 {
+			return ref, nil
+		}
+		// Abbreviated SHAs can only be expanded if a ref points at them
+		for _, r := range refs {
+			if strings.HasPrefix(r.Hash().String(), ref) {
+				return r.Hash().String(), nil
+			}
+		}
+		return "", fmt.Errorf("abbreviated commit %s cannot be resolved remotely, use the full SHA: %w", ref, ErrRefNotFound)
+	}
+
+	return "", fmt.Errorf("%s: %w", ref, ErrRefNotFound)
+}
+
+// resolveLocalRef resolves a ref in a local git working copy
+func resolveLocalRef(dir, ref string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) && ref == "" {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to open git repository %s: %w", dir, err)
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, ErrRefNotFound)
+	}
+	return hash.String(), nil
+}
+
+// IsCommitSHA reports whether ref looks like a full or abbreviated commit SHA
+func IsCommitSHA(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
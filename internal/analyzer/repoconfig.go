@@ -0,0 +1,183 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// RepoConfigFile is the per-repository configuration read from the repository root
+const RepoConfigFile = ".kwiki.yaml"
+
+// RepoConfig is the .kwiki.yaml of a repository. It lets repository owners
+// control how their documentation is generated without touching the server:
+// its settings are merged over the server defaults, while settings given
+// explicitly in a generation request still win.
+type RepoConfig struct {
+	// Pages lists the prompt templates to generate pages from, e.g. [readme, api-reference]
+	Pages []string `yaml:"pages"`
+	// Prompts are custom prompts keyed by "*", page type or template name,
+	// appended to the template prompt; a "<key>:replace" entry replaces it
+	Prompts map[string]string `yaml:"prompts"`
+	// Variables are exposed to templates and prompts as {{.Vars.name}}
+	Variables map[string]string `yaml:"variables"`
+	// Include and Exclude are path patterns added to repository.include_patterns and exclude_patterns
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// Glossary maps project terms to their meaning, so that pages use them consistently
+	Glossary map[string]string `yaml:"glossary"`
+	// Audience and Tone describe who the docs are written for and how, e.g. "plugin authors", "concise"
+	Audience string `yaml:"audience"`
+	Tone     string `yaml:"tone"`
+	// Languages to generate when the request names none, the first is the primary language
+	Languages []string `yaml:"languages"`
+	// Diagrams are Mermaid diagrams added to the wiki as written
+	Diagrams []RepoDiagram `yaml:"diagrams"`
+	// PlanOutline lets the model plan the page outline from the analyzed code structure
+	PlanOutline bool `yaml:"plan_outline"`
+	// ModulePages adds a reference page per module below the API reference
+	ModulePages bool `yaml:"module_pages"`
+}
+
+// RepoDiagram is a diagram pinned in .kwiki.yaml
+type RepoDiagram struct {
+	Title       string `yaml:"title"`
+	Type        string `yaml:"type"` // flowchart, sequence, class, ...; flowchart when empty
+	Description string `yaml:"description"`
+	Page        string `yaml:"page"`    // template name of the page the diagram belongs to, e.g. architecture
+	Content     string `yaml:"content"` // Mermaid syntax
+}
+
+// ParseRepoConfig parses and validates a .kwiki.yaml. Unknown keys are
+// rejected so that typos do not go unnoticed.
+func ParseRepoConfig(data []byte) (*RepoConfig, error) {
+	var rc RepoConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %w", RepoConfigFile, err)
+	}
+
+	for i, page := range rc.Pages {
+		rc.Pages[i] = strings.TrimSuffix(strings.TrimSpace(page), ".md")
+		if rc.Pages[i] == "" {
+			return nil, fmt.Errorf("invalid %s: pages[%d] is empty", RepoConfigFile, i)
+		}
+	}
+	for i, lang := range rc.Languages {
+		rc.Languages[i] = strings.TrimSpace(lang)
+		if rc.Languages[i] == "" {
+			return nil, fmt.Errorf("invalid %s: languages[%d] is empty", RepoConfigFile, i)
+		}
+	}
+	for i, diagram := range rc.Diagrams {
+		if strings.TrimSpace(diagram.Title) == "" || strings.TrimSpace(diagram.Content) == "" {
+			return nil, fmt.Errorf("invalid %s: diagrams[%d] needs a title and content", RepoConfigFile, i)
+		}
+	}
+	return &rc, nil
+}
+
+// LoadRepoConfig reads the .kwiki.yaml of a repository at ref. Local
+// directories are read in place, remote repositories from the clone cache
+// mirror without a checkout. It returns nil when the repository has none.
+func (ca *CodeAnalyzer) LoadRepoConfig(ctx context.Context, repoURL, ref, accessToken string) (*RepoConfig, error) {
+	var data []byte
+	var err error
+	if dir, ok := LocalPath(repoURL); ok {
+		data, err = os.ReadFile(filepath.Join(dir, RepoConfigFile))
+	} else {
+		remote, parseErr := utils.ParseRepositoryURL(repoURL)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid repository URL: %w", parseErr)
+		}
+		auth, authErr := ca.cloneAuth(remote, ca.detectProvider(remote.Host), accessToken)
+		if authErr != nil {
+			return nil, authErr
+		}
+		data, err = ca.cache.ReadFile(ctx, repoURL, ref, RepoConfigFile, auth)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", RepoConfigFile, err)
+	}
+	return ParseRepoConfig(data)
+}
+
+// ApplySettings merges the repository configuration into settings. Values
+// already set in settings take precedence; patterns are combined.
+func (rc *RepoConfig) ApplySettings(settings *models.WikiSettings) {
+	if len(settings.Templates) == 0 {
+		settings.Templates = append([]string(nil), rc.Pages...)
+	}
+	settings.CustomPrompts = mergeStrings(rc.Prompts, settings.CustomPrompts)
+	settings.Variables = mergeStrings(rc.Variables, settings.Variables)
+	settings.Glossary = mergeStrings(rc.Glossary, settings.Glossary)
+	if settings.Audience == "" {
+		settings.Audience = rc.Audience
+	}
+	if settings.Tone == "" {
+		settings.Tone = rc.Tone
+	}
+	settings.PlanOutline = settings.PlanOutline || rc.PlanOutline
+	settings.ModulePages = settings.ModulePages || rc.ModulePages
+	settings.IncludePatterns = appendMissing(settings.IncludePatterns, rc.Include...)
+	settings.ExcludePatterns = appendMissing(settings.ExcludePatterns, rc.Exclude...)
+}
+
+// RepositoryConfig returns base with the include and exclude patterns of
+// settings applied: exclusions are added to the defaults, inclusions replace them.
+func RepositoryConfig(base config.RepositoryConfig, settings models.WikiSettings) config.RepositoryConfig {
+	merged := base
+	merged.ExcludePatterns = appendMissing(append([]string(nil), base.ExcludePatterns...), settings.ExcludePatterns...)
+	if len(settings.IncludePatterns) > 0 {
+		merged.IncludePatterns = append([]string(nil), settings.IncludePatterns...)
+	}
+	return merged
+}
+
+// mergeStrings returns the entries of base overridden by those of override
+func mergeStrings(base, override map[string]string) map[string]string {
+	if len(base) == 0 {
+		return override
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// appendMissing appends the values not yet in list
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
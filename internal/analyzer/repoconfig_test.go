@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+const testRepoConfig = `pages: [readme, api-reference.md]
+prompts:
+  api: Document every exported function.
+include: ["*.go"]
+exclude: [testdata]
+glossary:
+  wiki: A generated documentation site
+audience: plugin authors
+tone: concise
+languages: [en, zh]
+diagrams:
+  - title: Request flow
+    page: architecture
+    content: |
+      flowchart LR
+        A --> B
+`
+
+func TestParseRepoConfig(t *testing.T) {
+	rc, err := ParseRepoConfig([]byte(testRepoConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rc.Pages, ",") != "readme,api-reference" || rc.Audience != "plugin authors" ||
+		len(rc.Languages) != 2 || len(rc.Diagrams) != 1 || rc.Diagrams[0].Page != "architecture" {
+		t.Errorf("parsed config = %+v", rc)
+	}
+
+	if rc, err := ParseRepoConfig(nil); err != nil || rc == nil {
+		t.Errorf("empty file: %+v, %v", rc, err)
+	}
+	for name, data := range map[string]string{
+		"unknown key":       "page: [readme]\n",
+		"diagram content":   "diagrams:\n  - title: Empty\n",
+		"empty language":    "languages: [en, '']\n",
+		"not a mapping":     "- readme\n",
+		"wrong value types": "pages: readme\n",
+	} {
+		if _, err := ParseRepoConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRepoConfigMerge(t *testing.T) {
+	rc, err := ParseRepoConfig([]byte(testRepoConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Explicit request settings win over the repository configuration
+	settings := models.WikiSettings{
+		Tone:            "friendly",
+		CustomPrompts:   map[string]string{"api": "from request"},
+		ExcludePatterns: []string{"vendor"},
+	}
+	rc.ApplySettings(&settings)
+	if strings.Join(settings.Templates, ",") != "readme,api-reference" || settings.Tone != "friendly" ||
+		settings.Audience != "plugin authors" || settings.CustomPrompts["api"] != "from request" ||
+		settings.Glossary["wiki"] == "" || strings.Join(settings.ExcludePatterns, ",") != "vendor,testdata" {
+		t.Errorf("merged settings = %+v", settings)
+	}
+
+	base := config.RepositoryConfig{ExcludePatterns: []string{".git", "vendor"}, IncludePatterns: []string{"*.md"}, MaxFiles: 10}
+	merged := RepositoryConfig(base, settings)
+	if strings.Join(merged.ExcludePatterns, ",") != ".git,vendor,testdata" ||
+		strings.Join(merged.IncludePatterns, ",") != "*.go" || merged.MaxFiles != 10 {
+		t.Errorf("merged repository config = %+v", merged)
+	}
+	if len(base.ExcludePatterns) != 2 || base.IncludePatterns[0] != "*.md" {
+		t.Errorf("base config modified: %+v", base)
+	}
+}
+
+func TestLoadRepoConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Repository.CloneDir = t.TempDir()
+	ca := New(cfg)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	if rc, err := ca.LoadRepoConfig(ctx, dir, "", ""); rc != nil || err != nil {
+		t.Errorf("directory without %s: %+v, %v", RepoConfigFile, rc, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, RepoConfigFile), []byte(testRepoConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := ca.LoadRepoConfig(ctx, dir, "", "")
+	if err != nil || rc == nil || rc.Tone != "concise" {
+		t.Fatalf("local config = %+v, %v", rc, err)
+	}
+
+	// Remote repositories are read from the mirror at the requested commit
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	src, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitFile(t, src, dir, "main.go", "package main\n")
+	second := commitFile(t, src, dir, RepoConfigFile, "tone: formal\n")
+
+	if _, err := ca.cache.ReadFile(ctx, dir, first, RepoConfigFile, nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile before the file was committed: %v, want fs.ErrNotExist", err)
+	}
+	data, err := ca.cache.ReadFile(ctx, dir, second, RepoConfigFile, nil)
+	if err != nil || string(data) != "tone: formal\n" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package auth authenticates requests to the HTTP API and web UI. Requests are
+// authenticated by a chain of Authenticators (API tokens, web sessions) into a
+// Principal carrying scopes; routes then require a scope. Web UI sessions are
+// started by a password login or by OpenID Connect single sign-on.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Scope is a permission granted to a principal. Scopes are ordered: admin
+// includes generate, generate includes read.
+type Scope string
+
+const (
+	ScopeRead     Scope = "read"     // View wikis, search and chat history
+	ScopeGenerate Scope = "generate" // Everything that spends AI credits: generation, chat, refresh
+	ScopeAdmin    Scope = "admin"    // Owner of every wiki, manage tokens
+)
+
+// scopeLevel orders scopes, unknown scopes grant nothing
+var scopeLevel = map[Scope]int{
+	ScopeRead:     1,
+	ScopeGenerate: 2,
+	ScopeAdmin:    3,
+}
+
+// ErrInvalidCredentials is returned when a request carries credentials that are wrong or expired
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is an authenticated caller
+type Principal struct {
+	Name        string   `json:"name"`                   // Matched against wiki owners and members, "oidc:<username>" for single sign-on users
+	DisplayName string   `json:"display_name,omitempty"` // Username as the identity provider reports it
+	Method      string   `json:"method"`                 // token, session
+	Scopes      []Scope  `json:"scopes"`
+	Groups      []string `json:"groups,omitempty"` // Matched against "group:<name>" wiki members
+}
+
+// Has reports whether the principal was granted scope, directly or through a higher scope
+func (p *Principal) Has(scope Scope) bool {
+	if p == nil {
+		return false
+	}
+	for _, granted := range p.Scopes {
+		if scopeLevel[granted] >= scopeLevel[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates a request. It returns (nil, nil) when the
+// request carries no credentials it understands, so that the next
+// authenticator can try, and ErrInvalidCredentials when they are wrong.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries authenticators in order and returns the first principal found
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, authenticator := range c {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+	return nil, nil
+}
+
+// ParseScopes validates scope names
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(names))
+	for _, name := range names {
+		scope := Scope(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := scopeLevel[scope]; !ok {
+			return nil, fmt.Errorf("unknown scope %q (want read, generate or admin)", name)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// tokenPrefix makes kwiki tokens recognizable, e.g. by secret scanners
+const tokenPrefix = "kwiki_"
+
+// NewToken returns a new random API token
+func NewToken() (string, error) {
+	return randomString(tokenPrefix, 32)
+}
+
+// HashToken returns the hex encoded SHA-256 hash under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns prefix followed by n random bytes, base64url encoded
+func randomString(prefix string, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/storage"
+)
+
+func TestPrincipalHas(t *testing.T) {
+	generator := &Principal{Scopes: []Scope{ScopeGenerate}}
+	if !generator.Has(ScopeRead) || !generator.Has(ScopeGenerate) || generator.Has(ScopeAdmin) {
+		t.Errorf("generate scope should include read but not admin")
+	}
+	var anonymous *Principal
+	if anonymous.Has(ScopeRead) {
+		t.Errorf("nil principal has no scopes")
+	}
+	if _, err := ParseScopes([]string{"read", "owner"}); err == nil {
+		t.Errorf("ParseScopes accepted an unknown scope")
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	store := storage.NewMarkdownStorage(filepath.Join(t.TempDir(), "wikis"))
+	tokens, err := NewTokenAuthenticator([]config.APITokenConfig{
+		{Name: "ci", Hash: HashToken("static-secret"), Scopes: []string{"generate"}},
+	}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(header, value string) (*Principal, error) {
+		r := httptest.NewRequest(http.MethodGet, "/api/wikis", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return tokens.Authenticate(r)
+	}
+
+	if p, err := request("", ""); p != nil || err != nil {
+		t.Errorf("no credentials = (%v, %v), want (nil, nil)", p, err)
+	}
+	if p, err := request("Authorization", "Bearer static-secret"); err != nil || p.Name != "ci" || !p.Has(ScopeGenerate) {
+		t.Errorf("static token = (%v, %v)", p, err)
+	}
+	if _, err := request("Authorization", "Bearer wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong token error = %v, want ErrInvalidCredentials", err)
+	}
+
+	secret, token, err := tokens.Create("bot", []Scope{ScopeRead}, time.Hour, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := request("X-API-Key", secret); err != nil || p.Name != "bot" || p.Has(ScopeGenerate) {
+		t.Errorf("stored token = (%v, %v)", p, err)
+	}
+
+	// Tokens survive a restart, revoked tokens stop working
+	reloaded, err := NewTokenAuthenticator(nil, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.List()) != 1 || reloaded.List()[0].Hash != "" {
+		t.Errorf("List() = %+v, want one token without hash", reloaded.List())
+	}
+	if err := tokens.Revoke(token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := request("X-API-Key", secret); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("revoked token error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := NewUsers([]config.UserConfig{{Username: "alice", PasswordHash: hash, Scopes: []string{"admin"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Verify("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password error = %v", err)
+	}
+	principal, err := users.Verify("Alice", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := NewSessionManager(time.Hour, false)
+	w := httptest.NewRecorder()
+	if err := sessions.Login(w, principal); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v, want one HttpOnly session cookie", cookies)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	if p, err := sessions.Authenticate(r); err != nil || p == nil || p.Method != "session" || !p.Has(ScopeAdmin) {
+		t.Errorf("session = (%v, %v)", p, err)
+	}
+
+	sessions.Logout(httptest.NewRecorder(), r)
+	if p, _ := sessions.Authenticate(r); p != nil {
+		t.Errorf("session still valid after logout")
+	}
+}
@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/stcn52/kwiki/internal/config"
+)
+
+const (
+	// oidcLoginTimeout is how long a started login waits for the provider callback
+	oidcLoginTimeout = 10 * time.Minute
+	// maxPendingLogins bounds the logins waiting for their callback; beyond it
+	// the oldest is dropped, so that unauthenticated requests cannot grow the map
+	maxPendingLogins = 1000
+)
+
+// OIDC signs web UI users in through an OpenID Connect provider using the
+// authorization code flow with PKCE. ID token claims are mapped to scopes by
+// the configured role mappings, and the groups claim becomes Principal.Groups.
+type OIDC struct {
+	cfg           config.OIDCConfig
+	client        *http.Client
+	defaultScopes []Scope
+	mappings      [][]Scope // scopes of cfg.RoleMappings, by index
+
+	mu         sync.Mutex
+	discovered *oidc.Provider
+	verifier   *oidc.IDTokenVerifier
+
+	pendingMu sync.Mutex
+	pending   map[string]*oidcLogin // by state
+}
+
+// oidcLogin is a login started by AuthCodeURL that waits for the callback
+type oidcLogin struct {
+	verifier string
+	nonce    string
+	next     string
+	expires  time.Time
+}
+
+// NewOIDC validates the configuration. The provider metadata is fetched on
+// first use, so that kwiki starts while the provider is unreachable. client
+// may be nil.
+func NewOIDC(cfg config.OIDCConfig, client *http.Client) (*OIDC, error) {
+	// The issuer must equal the one the provider reports, including a trailing slash
+	cfg.Issuer = strings.TrimSpace(cfg.Issuer)
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client_id and redirect_url are required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	o := &OIDC{
+		cfg:     cfg,
+		client:  client,
+		pending: make(map[string]*oidcLogin),
+	}
+	if len(cfg.DefaultScopes) > 0 {
+		scopes, err := ParseScopes(cfg.DefaultScopes)
+		if err != nil {
+			return nil, fmt.Errorf("oidc default_scopes: %w", err)
+		}
+		o.defaultScopes = scopes
+	}
+	for i, mapping := range cfg.RoleMappings {
+		if mapping.Claim == "" {
+			return nil, fmt.Errorf("oidc role mapping %d: claim is required", i)
+		}
+		scopes, err := ParseScopes(mapping.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("oidc role mapping %d (%s=%s): %w", i, mapping.Claim, mapping.Value, err)
+		}
+		o.mappings = append(o.mappings, scopes)
+	}
+	return o, nil
+}
+
+// AuthCodeURL starts a login. It returns the provider URL to send the browser
+// to and the state that the callback must carry; next is where the browser
+// goes after the login.
+func (o *OIDC) AuthCodeURL(ctx context.Context, next string) (authURL, state string, err error) {
+	conf, err := o.oauthConfig(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err = randomString("", 24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString("", 24)
+	if err != nil {
+		return "", "", err
+	}
+	login := &oidcLogin{
+		verifier: oauth2.GenerateVerifier(),
+		nonce:    nonce,
+		next:     next,
+		expires:  time.Now().Add(oidcLoginTimeout),
+	}
+
+	o.pendingMu.Lock()
+	o.prunePending()
+	o.pending[state] = login
+	o.pendingMu.Unlock()
+
+	authURL = conf.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(login.verifier),
+		oauth2.SetAuthURLParam("nonce", nonce))
+	return authURL, state, nil
+}
+
+// prunePending removes expired logins and, at maxPendingLogins, the oldest
+// one; the caller must hold pendingMu
+func (o *OIDC) prunePending() {
+	now := time.Now()
+	oldest := ""
+	for state, pending := range o.pending {
+		if now.After(pending.expires) {
+			delete(o.pending, state)
+			continue
+		}
+		if oldest == "" || pending.expires.Before(o.pending[oldest].expires) {
+			oldest = state
+		}
+	}
+	if len(o.pending) >= maxPendingLogins {
+		delete(o.pending, oldest)
+	}
+}
+
+// Exchange completes a login started by AuthCodeURL: it redeems the
+// authorization code, verifies the ID token and maps its claims. It returns
+// the principal and the next URL given to AuthCodeURL.
+func (o *OIDC) Exchange(ctx context.Context, state, code string) (*Principal, string, error) {
+	o.pendingMu.Lock()
+	login, ok := o.pending[state]
+	delete(o.pending, state)
+	o.pendingMu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, "", errors.New("oidc: unknown or expired login")
+	}
+
+	conf, err := o.oauthConfig(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := conf.Exchange(context.WithValue(ctx, oauth2.HTTPClient, o.client), code,
+		oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, "", fmt.Errorf("oidc: failed to redeem authorization code: %w", err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, "", errors.New("oidc: token response has no id_token")
+	}
+
+	claims, err := o.verifyIDToken(ctx, rawIDToken, login.nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	principal, err := o.principal(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return principal, login.next, nil
+}
+
+// oauthConfig returns the OAuth2 client configuration for the provider endpoints
+func (o *OIDC) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	provider, err := o.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  o.cfg.RedirectURL,
+		Scopes:       o.cfg.Scopes,
+	}, nil
+}
+
+// provider fetches the provider metadata once. The signing keys are fetched
+// by go-oidc when a token is verified and refetched when the provider rotates them.
+func (o *OIDC) provider(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovered != nil {
+		return o.discovered, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, o.client), o.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: failed to discover provider: %w", err)
+	}
+	o.discovered = provider
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: o.cfg.ClientID})
+	return provider, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and returns its claims
+func (o *OIDC) verifyIDToken(ctx context.Context, raw, nonce string) (map[string]interface{}, error) {
+	if _, err := o.provider(ctx); err != nil {
+		return nil, err
+	}
+	token, err := o.verifier.Verify(oidc.ClientContext(ctx, o.client), raw)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid ID token: %w", err)
+	}
+	if token.Nonce != nonce {
+		return nil, errors.New("oidc: ID token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc: malformed ID token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// oidcNamePrefix keeps single sign-on users apart from local users and tokens
+// of the same name, so an identity provider cannot claim their wiki roles
+const oidcNamePrefix = "oidc:"
+
+// principal maps ID token claims to a principal
+func (o *OIDC) principal(claims map[string]interface{}) (*Principal, error) {
+	var name string
+	for _, claim := range []string{o.cfg.UsernameClaim, "preferred_username", "email", "sub"} {
+		if value, _ := claims[claim].(string); claim != "" && value != "" {
+			name = value
+			break
+		}
+	}
+	if name == "" {
+		return nil, errors.New("oidc: ID token does not name the user")
+	}
+
+	scopes := append([]Scope(nil), o.defaultScopes...)
+	for i, mapping := range o.cfg.RoleMappings {
+		if claimMatches(claims[mapping.Claim], mapping.Value) {
+			scopes = append(scopes, o.mappings[i]...)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("oidc: user %s was not granted any scope", name)
+	}
+
+	return &Principal{
+		Name:        oidcNamePrefix + name,
+		DisplayName: name,
+		Method:      "oidc",
+		Scopes:      scopes,
+		Groups:      stringsClaim(claims[o.cfg.GroupsClaim]),
+	}, nil
+}
+
+// claimMatches reports whether a claim, or any element of a list claim, equals value
+func claimMatches(claim interface{}, value string) bool {
+	if b, ok := claim.(bool); ok {
+		return fmt.Sprint(b) == value
+	}
+	for _, s := range stringsClaim(claim) {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringsClaim returns a string or list of strings claim as a slice
+func stringsClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
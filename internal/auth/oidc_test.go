@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stcn52/kwiki/internal/auth/oidctest"
+	"github.com/stcn52/kwiki/internal/config"
+)
+
+func newTestOIDC(t *testing.T, provider *oidctest.Provider) *OIDC {
+	t.Helper()
+	o, err := NewOIDC(config.OIDCConfig{
+		Issuer:        provider.URL,
+		ClientID:      provider.ClientID,
+		ClientSecret:  provider.ClientSecret,
+		RedirectURL:   "http://kwiki.test/auth/oidc/callback",
+		DefaultScopes: []string{"read"},
+		RoleMappings: []config.OIDCRoleMapping{
+			{Claim: "groups", Value: "kwiki-admins", Scopes: []string{"admin"}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// login runs the browser side of the authorization code flow and returns the callback's state and code
+func login(t *testing.T, o *OIDC, next string) (state, code string) {
+	t.Helper()
+	authURL, state, err := o.AuthCodeURL(context.Background(), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize did not redirect: %s", resp.Status)
+	}
+	if !strings.HasPrefix(callback.String(), "http://kwiki.test/auth/oidc/callback?") || callback.Query().Get("state") != state {
+		t.Fatalf("callback = %s, want redirect URL with state %s", callback, state)
+	}
+	return state, callback.Query().Get("code")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := oidctest.New("kwiki", "client-secret")
+	defer provider.Close()
+	provider.SetClaims(map[string]interface{}{
+		"sub":                "u-1",
+		"preferred_username": "alice",
+		"groups":             []string{"kwiki-admins", "backend"},
+	})
+	o := newTestOIDC(t, provider)
+	ctx := context.Background()
+
+	state, code := login(t, o, "/wiki/x")
+	principal, next, err := o.Exchange(ctx, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Name != "oidc:alice" || principal.DisplayName != "alice" || !principal.Has(ScopeAdmin) || next != "/wiki/x" {
+		t.Errorf("principal = %+v, next = %s", principal, next)
+	}
+	if len(principal.Groups) != 2 || principal.Groups[1] != "backend" {
+		t.Errorf("groups = %v, want the groups claim", principal.Groups)
+	}
+
+	// Logins are single use
+	if _, _, err := o.Exchange(ctx, state, code); err == nil {
+		t.Error("state accepted twice")
+	}
+
+	// Users without a mapped role get the default scopes
+	provider.SetClaims(map[string]interface{}{"sub": "u-2", "email": "bob@example.com"})
+	state, code = login(t, o, "/")
+	principal, _, err = o.Exchange(ctx, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Name != "oidc:bob@example.com" || !principal.Has(ScopeRead) || principal.Has(ScopeGenerate) {
+		t.Errorf("principal = %+v, want read-only bob@example.com", principal)
+	}
+}
+
+func TestOIDCRejectsUnmappedUsers(t *testing.T) {
+	provider := oidctest.New("kwiki", "")
+	defer provider.Close()
+	o, err := NewOIDC(config.OIDCConfig{
+		Issuer:       provider.URL,
+		ClientID:     "kwiki",
+		RedirectURL:  "http://kwiki.test/auth/oidc/callback",
+		RoleMappings: []config.OIDCRoleMapping{{Claim: "email_verified", Value: "true", Scopes: []string{"read"}}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider.SetClaims(map[string]interface{}{"sub": "u-3", "email_verified": false})
+	state, code := login(t, o, "/")
+	if _, _, err := o.Exchange(context.Background(), state, code); err == nil || !strings.Contains(err.Error(), "not granted any scope") {
+		t.Errorf("Exchange() error = %v, want no scope granted", err)
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	provider := oidctest.New("kwiki", "client-secret")
+	defer provider.Close()
+	o := newTestOIDC(t, provider)
+	ctx := context.Background()
+
+	if _, err := o.verifyIDToken(ctx, provider.IDToken("n", map[string]interface{}{"sub": "u"}), "n"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	valid := provider.IDToken("n", nil)
+	tests := map[string]string{
+		"wrong nonce":    provider.IDToken("other", nil),
+		"wrong audience": provider.IDToken("n", map[string]interface{}{"aud": "someone-else"}),
+		"wrong issuer":   provider.IDToken("n", map[string]interface{}{"iss": "https://evil.example.com"}),
+		"expired":        provider.IDToken("n", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+		"tampered":       valid[:strings.LastIndex(valid, ".")] + ".AAAA",
+		"unknown key":    strings.Replace(valid, strings.Split(valid, ".")[0], "eyJhbGciOiJSUzI1NiIsImtpZCI6Im90aGVyIn0", 1),
+	}
+	for name, token := range tests {
+		if _, err := o.verifyIDToken(ctx, token, "n"); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestOIDCPendingLoginsAreBounded(t *testing.T) {
+	provider := oidctest.New("kwiki", "client-secret")
+	defer provider.Close()
+	o := newTestOIDC(t, provider)
+	ctx := context.Background()
+
+	_, first, err := o.AuthCodeURL(ctx, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxPendingLogins; i++ {
+		if _, _, err := o.AuthCodeURL(ctx, "/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(o.pending) != maxPendingLogins {
+		t.Errorf("%d pending logins, want at most %d", len(o.pending), maxPendingLogins)
+	}
+	if _, ok := o.pending[first]; ok {
+		t.Error("oldest login kept beyond the limit")
+	}
+}
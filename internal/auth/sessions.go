@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/stcn52/kwiki/internal/config"
+)
+
+// SessionCookie is the name of the web UI session cookie
+const SessionCookie = "kwiki_session"
+
+// session is a logged in web UI user
+type session struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// SessionManager keeps web UI sessions in memory; sessions end when the server restarts
+type SessionManager struct {
+	ttl    time.Duration
+	secure bool
+
+	mu       sync.Mutex
+	sessions map[string]*session // session ID -> session
+}
+
+// NewSessionManager creates a session manager. secure marks cookies HTTPS only.
+func NewSessionManager(ttl time.Duration, secure bool) *SessionManager {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &SessionManager{
+		ttl:      ttl,
+		secure:   secure,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Authenticate implements Authenticator using the session cookie
+func (sm *SessionManager) Authenticate(r *http.Request) (*Principal, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	s, ok := sm.sessions[cookie.Value]
+	if !ok {
+		return nil, nil // Stale cookie, e.g. after a restart: treat as anonymous
+	}
+	if time.Now().After(s.expires) {
+		delete(sm.sessions, cookie.Value)
+		return nil, nil
+	}
+	return s.principal, nil
+}
+
+// Login starts a session for principal and sets the session cookie
+func (sm *SessionManager) Login(w http.ResponseWriter, principal *Principal) error {
+	id, err := randomString("", 32)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expires := now.Add(sm.ttl)
+
+	p := *principal
+	p.Method = "session"
+
+	sm.mu.Lock()
+	for sid, s := range sm.sessions {
+		if now.After(s.expires) {
+			delete(sm.sessions, sid)
+		}
+	}
+	sm.sessions[id] = &session{principal: &p, expires: expires}
+	sm.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   sm.secure,
+		SameSite: http.SameSiteLaxMode, // Not sent on cross-site POSTs
+	})
+	return nil
+}
+
+// Logout ends the session of the request, if any, and clears the cookie
+func (sm *SessionManager) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		sm.mu.Lock()
+		delete(sm.sessions, cookie.Value)
+		sm.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   sm.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Users verifies web UI passwords against bcrypt hashes from the configuration
+type Users struct {
+	users map[string]config.UserConfig
+}
+
+// NewUsers validates the configured users
+func NewUsers(users []config.UserConfig) (*Users, error) {
+	u := &Users{users: make(map[string]config.UserConfig, len(users))}
+	for i, user := range users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("auth user %d: username is required", i)
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("auth user %s: password_hash must be a bcrypt hash: %w", user.Username, err)
+		}
+		if _, err := ParseScopes(user.Scopes); err != nil {
+			return nil, fmt.Errorf("auth user %s: %w", user.Username, err)
+		}
+		u.users[strings.ToLower(user.Username)] = user
+	}
+	return u, nil
+}
+
+// Verify checks a username and password and returns the user's principal
+func (u *Users) Verify(username, password string) (*Principal, error) {
+	user, ok := u.users[strings.ToLower(username)]
+	if !ok {
+		// Compare anyway so that unknown users take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	scopes, _ := ParseScopes(user.Scopes)
+	return &Principal{Name: user.Username, Method: "password", Scopes: scopes, Groups: user.Groups}, nil
+}
+
+// HashPassword returns the bcrypt hash of a password for UserConfig.PasswordHash
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// dummyHash is compared against for unknown users
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("kwiki"), bcrypt.DefaultCost)
+	return hash
+})
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/storage"
+	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// lastUsedInterval limits how often the last use time of a stored token is written
+const lastUsedInterval = time.Minute
+
+// TokenAuthenticator authenticates "Authorization: Bearer <token>" and
+// "X-API-Key: <token>" headers against static tokens from the configuration
+// and tokens persisted in storage. Tokens are looked up by their SHA-256 hash.
+type TokenAuthenticator struct {
+	static map[string]*Principal // hash -> principal
+
+	store  storage.TokenStorage // nil if the backend cannot persist tokens
+	mu     sync.RWMutex
+	stored map[string]*models.APIToken // hash -> token
+}
+
+// NewTokenAuthenticator loads the configured and stored tokens. store may be nil.
+func NewTokenAuthenticator(tokens []config.APITokenConfig, store storage.TokenStorage) (*TokenAuthenticator, error) {
+	ta := &TokenAuthenticator{
+		static: make(map[string]*Principal),
+		store:  store,
+		stored: make(map[string]*models.APIToken),
+	}
+
+	for i, token := range tokens {
+		hash := strings.ToLower(strings.TrimSpace(token.Hash))
+		if len(hash) != 64 {
+			return nil, fmt.Errorf("auth token %d (%s): hash must be a hex encoded SHA-256", i, token.Name)
+		}
+		scopes, err := ParseScopes(token.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("auth token %d (%s): %w", i, token.Name, err)
+		}
+		name := token.Name
+		if name == "" {
+			name = fmt.Sprintf("token-%d", i)
+		}
+		ta.static[hash] = &Principal{Name: name, Method: "token", Scopes: scopes, Groups: token.Groups}
+	}
+
+	if store != nil {
+		stored, err := store.LoadTokens()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load API tokens: %w", err)
+		}
+		for i := range stored {
+			ta.stored[stored[i].Hash] = &stored[i]
+		}
+	}
+	return ta, nil
+}
+
+// Authenticate implements Authenticator
+func (ta *TokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, nil
+	}
+	hash := HashToken(token)
+
+	if principal, ok := ta.static[hash]; ok {
+		return principal, nil
+	}
+
+	ta.mu.RLock()
+	stored, ok := ta.stored[hash]
+	ta.mu.RUnlock()
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if stored.ExpiresAt != nil && now.After(*stored.ExpiresAt) {
+		return nil, ErrInvalidCredentials
+	}
+	scopes, err := ParseScopes(stored.Scopes)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	ta.touch(hash, now)
+
+	return &Principal{Name: stored.Name, Method: "token", Scopes: scopes}, nil
+}
+
+// touch records the last use of a stored token, at most once per lastUsedInterval
+func (ta *TokenAuthenticator) touch(hash string, now time.Time) {
+	ta.mu.Lock()
+	stored, ok := ta.stored[hash]
+	if !ok || (stored.LastUsedAt != nil && now.Sub(*stored.LastUsedAt) < lastUsedInterval) {
+		ta.mu.Unlock()
+		return
+	}
+	updated := *stored
+	updated.LastUsedAt = &now
+	ta.stored[hash] = &updated
+	ta.mu.Unlock()
+
+	if err := ta.store.SaveToken(&updated); err != nil {
+		log.Printf("Warning: Failed to record token use: %v", err)
+	}
+}
+
+// Create creates and stores a new token. The returned secret is not stored and cannot be recovered.
+func (ta *TokenAuthenticator) Create(name string, scopes []Scope, ttl time.Duration, createdBy string) (string, *models.APIToken, error) {
+	if ta.store == nil {
+		return "", nil, fmt.Errorf("storage backend does not support API tokens")
+	}
+
+	secret, err := NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := &models.APIToken{
+		ID:        utils.GenerateID(),
+		Name:      name,
+		Hash:      HashToken(secret),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	for _, scope := range scopes {
+		token.Scopes = append(token.Scopes, string(scope))
+	}
+	if ttl > 0 {
+		expires := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	if err := ta.store.SaveToken(token); err != nil {
+		return "", nil, err
+	}
+
+	ta.mu.Lock()
+	ta.stored[token.Hash] = token
+	ta.mu.Unlock()
+	return secret, token, nil
+}
+
+// List returns the stored tokens without their hashes
+func (ta *TokenAuthenticator) List() []models.APIToken {
+	ta.mu.RLock()
+	defer ta.mu.RUnlock()
+
+	tokens := make([]models.APIToken, 0, len(ta.stored))
+	for _, token := range ta.stored {
+		t := *token
+		t.Hash = ""
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// Revoke deletes a stored token
+func (ta *TokenAuthenticator) Revoke(id string) error {
+	if ta.store == nil {
+		return fmt.Errorf("token %s: %w", id, storage.ErrTokenNotFound)
+	}
+	if err := ta.store.DeleteToken(id); err != nil {
+		return err
+	}
+
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	for hash, token := range ta.stored {
+		if token.ID == id {
+			delete(ta.stored, hash)
+		}
+	}
+	return nil
+}
+
+// bearerToken extracts an API token from the Authorization or X-API-Key header
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
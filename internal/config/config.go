@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 
@@ -13,6 +15,9 @@ type Config struct {
 	AI         AIConfig         `yaml:"ai"`
 	Repository RepositoryConfig `yaml:"repository"`
 	Generator  GeneratorConfig  `yaml:"generator"`
+	Webhooks   WebhookConfig    `yaml:"webhooks"`
+	Refresh    RefreshConfig    `yaml:"refresh"`
+	Auth       AuthConfig       `yaml:"auth"`
 }
 
 // ServerConfig contains server-related configuration
@@ -24,6 +29,45 @@ type ServerConfig struct {
 	DataDir     string `yaml:"data_dir"`
 	EnableCORS  bool   `yaml:"enable_cors"`
 	MaxFileSize int64  `yaml:"max_file_size"`
+
+	// CORSOrigins lists the origins allowed to call the API cross-origin when
+	// EnableCORS is set; "*" allows any origin (without credentials)
+	CORSOrigins []string `yaml:"cors_origins"`
+
+	// StorageBackend selects the wiki store: markdown (default), sqlite or file
+	StorageBackend string `yaml:"storage_backend"`
+	// DatabasePath is the SQLite database file, defaults to <data_dir>/kwiki.db
+	DatabasePath string `yaml:"database_path"`
+
+	// OIDC enables single sign-on for the web UI; requires auth.enabled
+	OIDC OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig configures OpenID Connect login (authorization code flow with PKCE)
+type OIDCConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Issuer       string `yaml:"issuer"` // e.g. https://accounts.google.com
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"` // empty for public clients
+	// RedirectURL is the callback registered at the provider, e.g. https://wiki.example.com/auth/oidc/callback
+	RedirectURL string `yaml:"redirect_url"`
+	// Scopes requested from the provider, defaults to openid, profile and email
+	Scopes []string `yaml:"scopes"`
+	// UsernameClaim names the user, defaults to preferred_username, then email, then sub
+	UsernameClaim string `yaml:"username_claim"`
+	// GroupsClaim lists the user's groups, which wikis can grant roles to; defaults to groups
+	GroupsClaim string `yaml:"groups_claim"`
+	// DefaultScopes are granted to everyone who signs in; leave empty to only admit mapped users
+	DefaultScopes []string `yaml:"default_scopes"`
+	// RoleMappings grant scopes to users whose claims match
+	RoleMappings []OIDCRoleMapping `yaml:"role_mappings"`
+}
+
+// OIDCRoleMapping grants scopes when an ID token claim has a value
+type OIDCRoleMapping struct {
+	Claim  string   `yaml:"claim"` // e.g. groups, roles, email
+	Value  string   `yaml:"value"` // compared with the claim or each element of a list claim
+	Scopes []string `yaml:"scopes"`
 }
 
 // AIConfig contains AI provider configuration
@@ -49,6 +93,23 @@ type RepositoryConfig struct {
 	ExcludePatterns []string `yaml:"exclude_patterns"`
 	IncludePatterns []string `yaml:"include_patterns"`
 	MaxFiles        int      `yaml:"max_files"`
+	// CacheMaxSize bounds the clone cache (mirrors and checkouts) in bytes,
+	// least recently used entries are evicted beyond it. Zero disables eviction.
+	CacheMaxSize int64 `yaml:"cache_max_size"`
+	// AllowLocalPaths lets HTTP clients generate wikis from directories on the
+	// server. The CLI always allows local paths.
+	AllowLocalPaths bool `yaml:"allow_local_paths"`
+	// GitHosts maps self-hosted git host names to their provider type
+	// (github, gitlab, gitea, gogs or bitbucket), e.g. git.example.com: gitea
+	GitHosts map[string]string `yaml:"git_hosts"`
+	// SSHKeyPath is the private key used for SSH remotes
+	SSHKeyPath       string `yaml:"ssh_key_path"`
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase"`
+	// AmbientSSH lets SSH remotes fall back to the server's SSH agent and
+	// ~/.ssh keys when no ssh_key_path is set. Off by default: API clients
+	// could otherwise clone any repository the server's identity can read.
+	// The CLI always uses the operator's own credentials.
+	AmbientSSH bool `yaml:"ambient_ssh"`
 }
 
 // GeneratorConfig contains documentation generation configuration
@@ -59,6 +120,61 @@ type GeneratorConfig struct {
 	ChunkSize      int    `yaml:"chunk_size"`
 	ChunkOverlap   int    `yaml:"chunk_overlap"`
 	MaxConcurrency int    `yaml:"max_concurrency"`
+	// TemplateWatchInterval is the number of seconds between checks of the
+	// prompt templates for changes made on disk, 0 disables reloading
+	TemplateWatchInterval int `yaml:"template_watch_interval"`
+}
+
+// WebhookConfig contains push webhook configuration
+type WebhookConfig struct {
+	// Secret verifies webhooks of repositories without an entry in Secrets
+	Secret string `yaml:"secret"`
+	// Secrets maps package paths (e.g. github.com/owner/repo) to their webhook secret
+	Secrets map[string]string `yaml:"secrets"`
+	// DebounceSeconds delays regeneration so that a burst of pushes triggers one run
+	DebounceSeconds int `yaml:"debounce_seconds"`
+}
+
+// RefreshConfig contains configuration of the scheduled wiki refresh
+type RefreshConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CheckInterval is how often (in seconds) the scheduler looks for due wikis
+	CheckInterval int `yaml:"check_interval"`
+	// JitterSeconds spreads runs by a random delay so that wikis with the same schedule don't refresh at once
+	JitterSeconds int `yaml:"jitter_seconds"`
+	// MaxConcurrent caps the number of wikis checked or regenerated by the scheduler at the same time
+	MaxConcurrent int `yaml:"max_concurrent"`
+}
+
+// AuthConfig contains authentication configuration of the HTTP API and web UI
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AnonymousRead lets unauthenticated clients use routes that only need the read scope
+	AnonymousRead bool `yaml:"anonymous_read"`
+	// Tokens are static API tokens; only the SHA-256 hash is configured
+	Tokens []APITokenConfig `yaml:"tokens"`
+	// Users can log in to the web UI with a password
+	Users []UserConfig `yaml:"users"`
+	// SessionTTL is the lifetime of a web UI session in hours
+	SessionTTL int `yaml:"session_ttl"`
+	// SecureCookie marks the session cookie as HTTPS only
+	SecureCookie bool `yaml:"secure_cookie"`
+}
+
+// APITokenConfig is a static API token
+type APITokenConfig struct {
+	Name   string   `yaml:"name"`
+	Hash   string   `yaml:"hash"` // hex encoded SHA-256 of the token, see "kwiki token"
+	Scopes []string `yaml:"scopes"`
+	Groups []string `yaml:"groups,omitempty"` // Groups for wiki access, e.g. "group:backend" members
+}
+
+// UserConfig is a web UI user
+type UserConfig struct {
+	Username     string   `yaml:"username"`
+	PasswordHash string   `yaml:"password_hash"` // bcrypt hash, see "kwiki passwd"
+	Scopes       []string `yaml:"scopes"`
+	Groups       []string `yaml:"groups,omitempty"` // Groups for wiki access, e.g. "group:backend" members
 }
 
 // Load loads configuration from a YAML file
@@ -95,6 +211,8 @@ func Default() *Config {
 			DataDir:     "./data",
 			EnableCORS:  true,
 			MaxFileSize: 100 * 1024 * 1024, // 100MB
+
+			StorageBackend: "markdown",
 		},
 		AI: AIConfig{
 			DefaultProvider: "ollama",
@@ -122,8 +240,9 @@ func Default() *Config {
 			},
 		},
 		Repository: RepositoryConfig{
-			CloneDir:    "./repos",
-			MaxRepoSize: 500 * 1024 * 1024, // 500MB
+			CloneDir:     "./repos",
+			MaxRepoSize:  500 * 1024 * 1024,      // 500MB
+			CacheMaxSize: 5 * 1024 * 1024 * 1024, // 5GB
 			ExcludePatterns: []string{
 				"node_modules",
 				".git",
@@ -163,6 +282,20 @@ func Default() *Config {
 			ChunkSize:      1000,
 			ChunkOverlap:   200,
 			MaxConcurrency: 5,
+
+			TemplateWatchInterval: 2,
+		},
+		Webhooks: WebhookConfig{
+			DebounceSeconds: 60,
+		},
+		Refresh: RefreshConfig{
+			Enabled:       true,
+			CheckInterval: 60,
+			JitterSeconds: 300,
+			MaxConcurrent: 2,
+		},
+		Auth: AuthConfig{
+			SessionTTL: 24,
 		},
 	}
 
@@ -182,6 +315,32 @@ func (c *Config) overrideWithEnv() {
 		c.Server.Host = host
 	}
 
+	if backend := os.Getenv("STORAGE_BACKEND"); backend != "" {
+		c.Server.StorageBackend = backend
+	}
+
+	if keyPath := os.Getenv("KWIKI_SSH_KEY"); keyPath != "" {
+		c.Repository.SSHKeyPath = keyPath
+	}
+
+	if secret := os.Getenv("KWIKI_WEBHOOK_SECRET"); secret != "" {
+		c.Webhooks.Secret = secret
+	}
+
+	if secret := os.Getenv("KWIKI_OIDC_CLIENT_SECRET"); secret != "" {
+		c.Server.OIDC.ClientSecret = secret
+	}
+
+	// A plain admin token from the environment, hashed like configured tokens
+	if token := os.Getenv("KWIKI_ADMIN_TOKEN"); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		c.Auth.Tokens = append(c.Auth.Tokens, APITokenConfig{
+			Name:   "env:KWIKI_ADMIN_TOKEN",
+			Hash:   hex.EncodeToString(sum[:]),
+			Scopes: []string{"admin"},
+		})
+	}
+
 	// AI provider API keys
 	if openaiKey := os.Getenv("OPENAI_API_KEY"); openaiKey != "" {
 		if provider, exists := c.AI.Providers["openai"]; exists {
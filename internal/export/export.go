@@ -0,0 +1,176 @@
+// Package export renders wikis into downloadable formats. It is shared by the
+// HTTP server and the command-line tool.
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// ErrUnsupportedFormat is returned by Render for unknown formats
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// Result is a rendered export
+type Result struct {
+	Content     []byte
+	Filename    string
+	ContentType string
+}
+
+// Formats lists the formats supported by Render
+var Formats = []models.ExportFormat{models.ExportFormatMarkdown, models.ExportFormatJSON, models.ExportFormatHTML}
+
+// Render renders a wiki in the given format
+func Render(wiki *models.Wiki, format models.ExportFormat) (*Result, error) {
+	switch format {
+	case models.ExportFormatMarkdown:
+		return renderMarkdown(wiki), nil
+	case models.ExportFormatJSON:
+		return renderJSON(wiki)
+	case models.ExportFormatHTML:
+		return renderHTML(wiki), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// Filename returns the download file name for a wiki export
+func Filename(wiki *models.Wiki, ext string) string {
+	return fmt.Sprintf("%s-wiki.%s", strings.ReplaceAll(wiki.Title, " ", "-"), ext)
+}
+
+// exportMarkdown exports wiki as markdown
+func renderMarkdown(wiki *models.Wiki) *Result {
+	var content strings.Builder
+
+	// Write title and description
+	content.WriteString(fmt.Sprintf("# %s\n\n", wiki.Title))
+	if wiki.Description != "" {
+		content.WriteString(fmt.Sprintf("%s\n\n", wiki.Description))
+	}
+
+	// Write table of contents
+	content.WriteString("## Table of Contents\n\n")
+	for _, page := range wiki.Pages {
+		content.WriteString(fmt.Sprintf("- [%s](#%s)\n", page.Title, strings.ToLower(strings.ReplaceAll(page.Title, " ", "-"))))
+	}
+	content.WriteString("\n")
+
+	// Write pages
+	for _, page := range wiki.Pages {
+		content.WriteString(fmt.Sprintf("## %s\n\n", page.Title))
+		content.WriteString(fmt.Sprintf("%s\n\n", page.Content))
+	}
+
+	// Write diagrams
+	if len(wiki.Diagrams) > 0 {
+		content.WriteString("## Diagrams\n\n")
+		for _, diagram := range wiki.Diagrams {
+			content.WriteString(fmt.Sprintf("### %s\n\n", diagram.Title))
+			if diagram.Description != "" {
+				content.WriteString(fmt.Sprintf("%s\n\n", diagram.Description))
+			}
+			content.WriteString("```mermaid\n")
+			content.WriteString(diagram.Content)
+			content.WriteString("\n```\n\n")
+		}
+	}
+
+	return &Result{
+		Content:     []byte(content.String()),
+		Filename:    Filename(wiki, "md"),
+		ContentType: "text/markdown",
+	}
+}
+
+// renderJSON exports wiki as JSON
+func renderJSON(wiki *models.Wiki) (*Result, error) {
+	data, err := json.MarshalIndent(wiki, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal wiki: %w", err)
+	}
+	return &Result{
+		Content:     data,
+		Filename:    Filename(wiki, "json"),
+		ContentType: "application/json; charset=utf-8",
+	}, nil
+}
+
+// exportHTML exports wiki as HTML
+func renderHTML(wiki *models.Wiki) *Result {
+	var content strings.Builder
+
+	// HTML header
+	content.WriteString(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>` + wiki.Title + `</title>
+    <script src="https://cdn.jsdelivr.net/npm/mermaid/dist/mermaid.min.js"></script>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
+        h1, h2, h3 { color: #333; }
+        pre { background: #f5f5f5; padding: 15px; border-radius: 5px; overflow-x: auto; }
+        code { background: #f5f5f5; padding: 2px 4px; border-radius: 3px; }
+        .mermaid { text-align: center; }
+    </style>
+</head>
+<body>`)
+
+	// Title and description
+	content.WriteString(fmt.Sprintf("<h1>%s</h1>", wiki.Title))
+	if wiki.Description != "" {
+		content.WriteString(fmt.Sprintf("<p>%s</p>", wiki.Description))
+	}
+
+	// Table of contents
+	content.WriteString("<h2>Table of Contents</h2><ul>")
+	for _, page := range wiki.Pages {
+		anchor := strings.ToLower(strings.ReplaceAll(page.Title, " ", "-"))
+		content.WriteString(fmt.Sprintf(`<li><a href="#%s">%s</a></li>`, anchor, page.Title))
+	}
+	content.WriteString("</ul>")
+
+	// Pages (convert markdown to HTML - simplified)
+	for _, page := range wiki.Pages {
+		anchor := strings.ToLower(strings.ReplaceAll(page.Title, " ", "-"))
+		content.WriteString(fmt.Sprintf(`<h2 id="%s">%s</h2>`, anchor, page.Title))
+
+		// Simple markdown to HTML conversion
+		htmlContent := strings.ReplaceAll(page.Content, "\n", "<br>")
+		htmlContent = strings.ReplaceAll(htmlContent, "**", "<strong>")
+		htmlContent = strings.ReplaceAll(htmlContent, "**", "</strong>")
+		content.WriteString(fmt.Sprintf("<div>%s</div>", htmlContent))
+	}
+
+	// Diagrams
+	if len(wiki.Diagrams) > 0 {
+		content.WriteString("<h2>Diagrams</h2>")
+		for _, diagram := range wiki.Diagrams {
+			content.WriteString(fmt.Sprintf("<h3>%s</h3>", diagram.Title))
+			if diagram.Description != "" {
+				content.WriteString(fmt.Sprintf("<p>%s</p>", diagram.Description))
+			}
+			content.WriteString(fmt.Sprintf(`<div class="mermaid">%s</div>`, diagram.Content))
+		}
+	}
+
+	// HTML footer
+	content.WriteString(`
+    <script>
+        mermaid.initialize({ startOnLoad: true });
+    </script>
+</body>
+</html>`)
+
+	return &Result{
+		Content:     []byte(content.String()),
+		Filename:    Filename(wiki, "html"),
+		ContentType: "text/html",
+	}
+}
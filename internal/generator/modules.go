@@ -0,0 +1,338 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// 模块参考页面使用的模板
+const modulePageTemplate = "module-reference"
+
+const (
+	modulePageLimit        = 50  // 最多生成的模块和类型参考页面数
+	moduleDeclarationLimit = 100 // 每个模块列出的导出函数和类型数
+	typePageMethods        = 5   // 导出方法达到该数量的类型单独生成类型页面
+)
+
+// addModulePlans 为代码结构中有导出声明的模块规划参考页面，作为API参考页面的子页面插入到其后；
+// 导出方法较多的类型再单独规划类型页面，作为模块页面的子页面。
+// 没有API参考页面时模块页面作为顶层页面追加到最后，模板缺失时记录警告并保持原规划
+func (wg *WikiGenerator) addModulePlans(wiki *models.Wiki, plans []PagePlan, structure *models.CodeStructure, language string) []PagePlan {
+	tmpl, err := wg.templateManager.LoadTemplateWithMetadata(language, modulePageTemplate)
+	if err != nil {
+		log.Printf("加载模块参考模板失败: %v", err)
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:  wiki.ID,
+			Level:   models.LogLevelWarning,
+			Step:    models.LogStepGenerate,
+			Message: fmt.Sprintf("没有模块参考模板 (%s)，不生成模块页面", language),
+			Error:   err.Error(),
+		})
+		return plans
+	}
+
+	modules := referenceModules(structure)
+	if len(modules) == 0 {
+		return plans
+	}
+
+	// 模块页面挂在第一个API参考页面下，插入到该页面已有的子页面之后
+	parent, at := -1, len(plans)
+	for i, plan := range plans {
+		if plan.Type == models.PageTypeAPI {
+			parent, at = i, subtreeEnd(plans, i)
+			break
+		}
+	}
+	var parentPlan *PagePlan
+	if parent >= 0 {
+		parentPlan = &plans[parent]
+	}
+	references := modulePagePlans(modules, language, tmpl, parentPlan, pageIDs(plans))
+
+	typePages := 0
+	for _, ref := range references {
+		if ref.Type == models.PageTypeClass {
+			typePages++
+			continue
+		}
+		if parentPlan != nil {
+			parentPlan.Children = append(parentPlan.Children, ref.ID)
+			parentPlan.Page.Children = append(parentPlan.Page.Children, ref.Title)
+			parentPlan.Page.Links = append(parentPlan.Page.Links, PageLink{ID: ref.ID, Title: ref.Title})
+		}
+	}
+
+	result := make([]PagePlan, 0, len(plans)+len(references))
+	result = append(result, plans[:at]...)
+	result = append(result, references...)
+	result = append(result, plans[at:]...)
+	for i := range result {
+		result[i].Order = i
+	}
+
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:  wiki.ID,
+		Level:   models.LogLevelInfo,
+		Step:    models.LogStepGenerate,
+		Message: fmt.Sprintf("模块参考页面 (%s): %d 个模块, %d 个类型", language, len(references)-typePages, typePages),
+	})
+	return result
+}
+
+// modulePagePlans 把模块转换为页面规划：每个模块一个页面，方法较多的类型紧跟在所属模块之后。
+// 页面之间互相链接：模块页面链接父页面、类型页面和前后相邻的模块，类型页面链接所属模块。
+// 声明列表和相关链接作为页面结尾原样写入，不依赖模型复述签名
+func modulePagePlans(modules []ModuleData, language string, tmpl *TemplateInfo, parent *PagePlan, used map[string]bool) []PagePlan {
+	zh := strings.HasPrefix(language, "zh")
+	uniqueKey := func(slug string) string {
+		key := slug
+		for n := 2; used[models.PageID(key, language)]; n++ {
+			key = fmt.Sprintf("%s-%d", slug, n)
+		}
+		used[models.PageID(key, language)] = true
+		return key
+	}
+
+	// 先分配所有模块页面的ID，以便链接前后相邻的模块
+	moduleKeys := make([]string, len(modules))
+	moduleIDs := make([]string, len(modules))
+	for i, module := range modules {
+		moduleKeys[i] = uniqueKey("module-" + outlineSlug(module.Path))
+		moduleIDs[i] = models.PageID(moduleKeys[i], language)
+	}
+
+	var parentLink []PageLink
+	parentID, parentTitle := "", ""
+	if parent != nil {
+		parentID, parentTitle = parent.ID, parent.Title
+		parentLink = []PageLink{{ID: parent.ID, Title: parent.Title}}
+	}
+
+	var plans []PagePlan
+	pages := len(modules)
+	for i, module := range modules {
+		plan := PagePlan{
+			ID:       moduleIDs[i],
+			Key:      moduleKeys[i],
+			Title:    module.Path,
+			Type:     models.PageTypeModule,
+			Template: tmpl,
+			ParentID: parentID,
+			Page: PageData{
+				Title:       module.Path,
+				Type:        string(models.PageTypeModule),
+				Description: module.Description,
+				Parent:      parentTitle,
+			},
+		}
+
+		// 方法较多的类型单独成页，模块页面只保留其声明并链接过去
+		var typePlans []PagePlan
+		var typeLinks []PageLink
+		for _, t := range module.Types {
+			if len(t.Methods) < typePageMethods || pages >= modulePageLimit {
+				continue
+			}
+			pages++
+			title := fmt.Sprintf("%s.%s", module.Name, t.Name)
+			typeModule := module
+			typeModule.Functions = nil
+			typeModule.Types = []TypeData{t}
+			typeKey := uniqueKey("type-" + outlineSlug(module.Path+"-"+t.Name))
+			typePlans = append(typePlans, PagePlan{
+				ID:       models.PageID(typeKey, language),
+				Key:      typeKey,
+				Title:    title,
+				Type:     models.PageTypeClass,
+				Template: tmpl,
+				ParentID: plan.ID,
+				Page: PageData{
+					Title:       title,
+					Type:        string(models.PageTypeClass),
+					Description: t.Description,
+					Parent:      module.Path,
+					Links:       []PageLink{{ID: plan.ID, Title: module.Path}},
+				},
+				Modules: []ModuleData{typeModule},
+			})
+			typeLinks = append(typeLinks, PageLink{ID: typePlans[len(typePlans)-1].ID, Title: title})
+		}
+
+		links := append([]PageLink(nil), parentLink...)
+		links = append(links, typeLinks...)
+		if i > 0 {
+			links = append(links, PageLink{ID: moduleIDs[i-1], Title: modules[i-1].Path})
+		}
+		if i+1 < len(modules) {
+			links = append(links, PageLink{ID: moduleIDs[i+1], Title: modules[i+1].Path})
+		}
+		plan.Page.Links = links
+		plan.Modules = []ModuleData{module}
+		plan.Footer = referenceFooter(module, links, zh)
+		for _, typePlan := range typePlans {
+			plan.Children = append(plan.Children, typePlan.ID)
+			plan.Page.Children = append(plan.Page.Children, typePlan.Title)
+		}
+
+		plans = append(plans, plan)
+		for _, typePlan := range typePlans {
+			typePlan.Footer = referenceFooter(typePlan.Modules[0], typePlan.Page.Links, zh)
+			plans = append(plans, typePlan)
+		}
+	}
+	return plans
+}
+
+// referenceModules 从代码结构中收集有导出声明的模块：包级函数、类型及其导出方法，签名来自分析器。
+// 模块超过页面数上限时只保留代码行数最多的模块，仍按路径排序
+func referenceModules(structure *models.CodeStructure) []ModuleData {
+	type entry struct {
+		data  ModuleData
+		lines int
+		count int
+	}
+	entries := make(map[string]*entry, len(structure.Modules))
+	for _, module := range structure.Modules {
+		entries[module.Path] = &entry{
+			data: ModuleData{
+				Name:        module.Name,
+				Path:        module.Path,
+				Language:    module.Language,
+				Description: module.Description,
+			},
+			lines: module.LineCount,
+		}
+	}
+
+	for _, fn := range structure.Functions {
+		e, ok := entries[moduleDir(fn.File)]
+		if !ok || !fn.IsPublic || fn.Receiver != "" || e.count >= moduleDeclarationLimit {
+			continue
+		}
+		e.data.Functions = append(e.data.Functions, functionData(fn))
+		e.count++
+	}
+	for _, class := range structure.Classes {
+		e, ok := entries[moduleDir(class.File)]
+		if !ok || !class.IsPublic || e.count >= moduleDeclarationLimit {
+			continue
+		}
+		t := TypeData{
+			Name:        class.Name,
+			Signature:   class.Signature,
+			Description: class.Description,
+		}
+		for _, method := range class.Methods {
+			if method.IsPublic {
+				t.Methods = append(t.Methods, functionData(method))
+			}
+		}
+		e.data.Types = append(e.data.Types, t)
+		e.count++
+	}
+
+	var selected []*entry
+	for _, module := range structure.Modules {
+		if e := entries[module.Path]; e.count > 0 {
+			selected = append(selected, e)
+		}
+	}
+	if len(selected) > modulePageLimit {
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].lines > selected[j].lines })
+		selected = selected[:modulePageLimit]
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].data.Path < selected[j].data.Path })
+
+	modules := make([]ModuleData, len(selected))
+	for i, e := range selected {
+		modules[i] = e.data
+	}
+	return modules
+}
+
+// functionData 把分析出的函数转换为模板数据
+func functionData(fn models.Function) FunctionData {
+	return FunctionData{
+		Name:        fn.Name,
+		Signature:   fn.Signature,
+		Description: fn.Description,
+	}
+}
+
+// referenceFooter 生成参考页面的结尾：模块中全部导出声明的签名和相关页面的链接
+func referenceFooter(module ModuleData, links []PageLink, zh bool) string {
+	var b strings.Builder
+	if zh {
+		b.WriteString("## 声明\n\n")
+	} else {
+		b.WriteString("## Declarations\n\n")
+	}
+	fmt.Fprintf(&b, "```%s\n", codeFence(module.Language))
+	for _, t := range module.Types {
+		b.WriteString(declaration(t.Signature, t.Name) + "\n")
+		for _, method := range t.Methods {
+			b.WriteString(declaration(method.Signature, method.Name) + "\n")
+		}
+	}
+	for _, fn := range module.Functions {
+		b.WriteString(declaration(fn.Signature, fn.Name) + "\n")
+	}
+	b.WriteString("```\n")
+
+	if len(links) > 0 {
+		if zh {
+			b.WriteString("\n## 相关页面\n\n")
+		} else {
+			b.WriteString("\n## See Also\n\n")
+		}
+		for _, link := range links {
+			fmt.Fprintf(&b, "- %s\n", link.Markdown())
+		}
+	}
+	return b.String()
+}
+
+// declaration 返回声明的签名，分析器没有签名时使用名称
+func declaration(signature, name string) string {
+	if signature != "" {
+		return signature
+	}
+	return name
+}
+
+// codeFence 返回代码块的语言标记
+func codeFence(language string) string {
+	switch language {
+	case "C#":
+		return "csharp"
+	case "C++":
+		return "cpp"
+	default:
+		return strings.ToLower(language)
+	}
+}
+
+// subtreeEnd 返回规划中第 index 个页面及其所有子孙页面之后的位置，规划按深度优先排列
+func subtreeEnd(plans []PagePlan, index int) int {
+	inside := map[string]bool{plans[index].ID: true}
+	end := index + 1
+	for end < len(plans) && inside[plans[end].ParentID] {
+		inside[plans[end].ID] = true
+		end++
+	}
+	return end
+}
+
+// pageIDs 返回规划中已使用的页面ID
+func pageIDs(plans []PagePlan) map[string]bool {
+	ids := make(map[string]bool, len(plans))
+	for _, plan := range plans {
+		ids[plan.ID] = true
+	}
+	return ids
+}
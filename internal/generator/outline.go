@@ -0,0 +1,517 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stcn52/kwiki/internal/analyzer"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// 大纲规划使用的模板
+const (
+	outlinePlanTemplate = "outline-plan"
+	outlinePageTemplate = "outline-page"
+)
+
+const (
+	outlineMaxPages      = 60 // 大纲最多的页面数（含章节）
+	outlineMaxDepth      = 2  // 章节以下最多的页面层数
+	outlineAttempts      = 2  // 大纲校验失败时带着错误重新规划的次数
+	outlineModuleLimit   = 80 // 提示词中最多列出的模块数，按代码行数取最大的
+	outlineExportedLimit = 8  // 每个模块在摘要中列出的导出名称数
+	outlineFunctionLimit = 20 // 页面提示词中每个模块列出的函数数
+)
+
+// outlinePageTypes 大纲中允许的页面类型
+var outlinePageTypes = []models.PageType{
+	models.PageTypeOverview,
+	models.PageTypeArchitecture,
+	models.PageTypeAPI,
+	models.PageTypeModule,
+	models.PageTypeGuide,
+	models.PageTypeTutorial,
+	models.PageTypeReference,
+}
+
+// Outline 是模型根据代码结构规划的wiki大纲
+type Outline struct {
+	Sections []OutlineSection `json:"sections"`
+}
+
+// OutlineSection 大纲中的章节，章节本身生成一个概览页面，其页面作为子页面
+type OutlineSection struct {
+	Slug        string        `json:"slug"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Pages       []OutlinePage `json:"pages"`
+}
+
+// OutlinePage 大纲中的页面，可以包含子页面
+type OutlinePage struct {
+	Slug        string        `json:"slug"`
+	Title       string        `json:"title"`
+	Type        string        `json:"type"`
+	Description string        `json:"description"`
+	Modules     []string      `json:"modules"`
+	Children    []OutlinePage `json:"children,omitempty"`
+}
+
+// OutlinePromptData 渲染大纲规划模板的数据
+type OutlinePromptData struct {
+	TemplateData
+	Structure string // 代码结构摘要
+	MinPages  int
+	MaxPages  int
+	PageTypes string
+}
+
+// repositoryOutline 启用AI大纲且有代码结构时，请模型按主语言规划一次大纲，各语言共用。
+// 规划失败时记录警告并返回nil，各语言退回模板规划
+func (wg *WikiGenerator) repositoryOutline(ctx context.Context, wiki *models.Wiki, repoInfo *RepositoryInfo, structure *models.CodeStructure, language string, settings models.WikiSettings) *Outline {
+	if !settings.PlanOutline || structure == nil {
+		return nil
+	}
+	outline, err := wg.planOutline(ctx, wiki, repoInfo, structure, language, settings)
+	if err != nil {
+		log.Printf("AI规划大纲失败，使用模板规划: %v", err)
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:  wiki.ID,
+			Level:   models.LogLevelWarning,
+			Step:    models.LogStepGenerate,
+			Message: fmt.Sprintf("AI规划大纲失败 (%s)，使用模板规划", language),
+			Error:   err.Error(),
+		})
+		return nil
+	}
+	return outline
+}
+
+// pagePlans 返回指定语言的页面规划。有AI规划的大纲时按大纲展开，页面标识和层级在各语言之间相同；
+// 没有大纲时使用模板规划；启用模块页面时再加入模块和类型参考页面
+func (wg *WikiGenerator) pagePlans(wiki *models.Wiki, structure *models.CodeStructure, outline *Outline, language string, settings models.WikiSettings) ([]PagePlan, error) {
+	var plans []PagePlan
+	if outline != nil {
+		tmpl, err := wg.templateManager.LoadTemplateWithMetadata(language, outlinePageTemplate)
+		if err != nil {
+			log.Printf("加载大纲页面模板失败，使用模板规划: %v", err)
+			wg.sendLog(models.WikiLogEntry{
+				WikiID:  wiki.ID,
+				Level:   models.LogLevelWarning,
+				Step:    models.LogStepGenerate,
+				Message: fmt.Sprintf("加载大纲页面模板失败 (%s)，使用模板规划", language),
+				Error:   err.Error(),
+			})
+		} else {
+			plans = outlinePlans(outline, language, tmpl, outlineModules(structure))
+			// 大纲的标题是主语言的，其他语言的页面标题取自生成内容的一级标题
+			if language != wiki.Language {
+				for i := range plans {
+					plans[i].TitleFromContent = true
+				}
+			}
+		}
+	}
+	if plans == nil {
+		var err error
+		if plans, err = wg.planRepositoryPages(language, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	if settings.ModulePages && structure != nil {
+		plans = wg.addModulePlans(wiki, plans, structure, language)
+	}
+	return plans, nil
+}
+
+// planOutline 请模型根据代码结构规划大纲并校验。
+// 大纲不符合要求时把错误反馈给模型重新规划
+func (wg *WikiGenerator) planOutline(ctx context.Context, wiki *models.Wiki, repoInfo *RepositoryInfo, structure *models.CodeStructure, language string, settings models.WikiSettings) (*Outline, error) {
+	planTmpl, err := wg.templateManager.LoadTemplateWithMetadata(language, outlinePlanTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := outlineModules(structure)
+	minPages, maxPages := outlinePageRange(len(structure.Modules))
+	pageTypes := make([]string, len(outlinePageTypes))
+	for i, t := range outlinePageTypes {
+		pageTypes[i] = string(t)
+	}
+	data := OutlinePromptData{
+		TemplateData: repositoryTemplateData(repoInfo, language, settings),
+		Structure:    summarizeStructure(structure),
+		MinPages:     minPages,
+		MaxPages:     maxPages,
+		PageTypes:    strings.Join(pageTypes, ", "),
+	}
+	var promptBuilder strings.Builder
+	if err := planTmpl.Template.Execute(&promptBuilder, data); err != nil {
+		return nil, fmt.Errorf("渲染模板 %s 失败: %w", planTmpl.Name, err)
+	}
+	// 大纲规划不是页面，只适用以模板名为键的自定义提示词
+	prompt, err := applyCustomPrompts(promptBuilder.String(), settings.CustomPrompts, []string{outlinePlanTemplate}, data)
+	if err != nil {
+		return nil, err
+	}
+	prompt += wg.templateManager.LanguageInstruction(planTmpl, language) + writingGuidelines(settings, language)
+
+	var lastErr error
+	for attempt := 1; attempt <= outlineAttempts; attempt++ {
+		attemptPrompt := prompt
+		if lastErr != nil {
+			attemptPrompt += fmt.Sprintf("\n\nThe previous outline was rejected: %v\nReturn a corrected outline as JSON only.", lastErr)
+		}
+
+		start := time.Now()
+		content, stats, err := wg.generateContentWithAIStats(ctx, attemptPrompt, settings)
+		if err != nil {
+			return nil, fmt.Errorf("AI规划大纲失败: %w", err)
+		}
+		wiki.Metadata.TokensUsed += stats.TokensUsed
+
+		outline, err := parseOutline(content)
+		if err == nil {
+			err = validateOutline(outline, modules, minPages, maxPages)
+		}
+		if err == nil {
+			wg.sendLog(models.WikiLogEntry{
+				WikiID:     wiki.ID,
+				Level:      models.LogLevelSuccess,
+				Step:       models.LogStepGenerate,
+				Message:    fmt.Sprintf("AI规划大纲完成 (%s): %d 个章节, %d 个页面", language, len(outline.Sections), outlinePageCount(outline)),
+				Duration:   time.Since(start).Round(time.Millisecond).String(),
+				TokensUsed: stats.TokensUsed,
+			})
+			return outline, nil
+		}
+
+		lastErr = err
+		log.Printf("大纲校验失败 (尝试 %d/%d): %v", attempt, outlineAttempts, err)
+	}
+	return nil, lastErr
+}
+
+// parseOutline 从模型回复中解析JSON大纲，容忍前后的说明文字和Markdown代码块
+func parseOutline(content string) (*Outline, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("回复中没有JSON大纲")
+	}
+
+	var outline Outline
+	if err := json.Unmarshal([]byte(content[start:end+1]), &outline); err != nil {
+		return nil, fmt.Errorf("大纲不是有效的JSON: %w", err)
+	}
+	return &outline, nil
+}
+
+// validateOutline 按大纲格式校验并规范化大纲：标题必填，slug唯一，类型、模块、层级和页面数符合要求。
+// 缺少的slug由标题生成，缺少的类型使用guide
+func validateOutline(outline *Outline, modules map[string]ModuleData, minPages, maxPages int) error {
+	var problems []string
+	slugs := make(map[string]bool)
+	count := 0
+
+	checkSlug := func(slug *string, title, where string) {
+		if *slug = outlineSlug(*slug); *slug == "" {
+			*slug = outlineSlug(title)
+		}
+		switch {
+		case *slug == "":
+			problems = append(problems, fmt.Sprintf("%s: slug必须是小写英文标识", where))
+		case slugs[*slug]:
+			problems = append(problems, fmt.Sprintf("%s: slug %q 重复", where, *slug))
+		}
+		slugs[*slug] = true
+	}
+
+	var checkPages func(pages []OutlinePage, depth int, where string)
+	checkPages = func(pages []OutlinePage, depth int, where string) {
+		for i := range pages {
+			page := &pages[i]
+			pageWhere := fmt.Sprintf("%s.pages[%d]", where, i)
+			if depth > 1 {
+				pageWhere = fmt.Sprintf("%s.children[%d]", where, i)
+			}
+			count++
+
+			if strings.TrimSpace(page.Title) == "" {
+				problems = append(problems, fmt.Sprintf("%s: 缺少title", pageWhere))
+			}
+			checkSlug(&page.Slug, page.Title, pageWhere)
+			if page.Type == "" {
+				page.Type = string(models.PageTypeGuide)
+			}
+			if !validOutlinePageType(page.Type) {
+				problems = append(problems, fmt.Sprintf("%s: 未知的type %q", pageWhere, page.Type))
+			}
+			for _, module := range page.Modules {
+				if _, ok := modules[module]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: 代码结构中没有模块 %q", pageWhere, module))
+				}
+			}
+			if len(page.Children) > 0 {
+				if depth >= outlineMaxDepth {
+					problems = append(problems, fmt.Sprintf("%s: 子页面超过 %d 层", pageWhere, outlineMaxDepth))
+				}
+				checkPages(page.Children, depth+1, pageWhere)
+			}
+		}
+	}
+
+	if len(outline.Sections) == 0 {
+		problems = append(problems, "sections不能为空")
+	}
+	for i := range outline.Sections {
+		section := &outline.Sections[i]
+		where := fmt.Sprintf("sections[%d]", i)
+		count++
+
+		if strings.TrimSpace(section.Title) == "" {
+			problems = append(problems, fmt.Sprintf("%s: 缺少title", where))
+		}
+		checkSlug(&section.Slug, section.Title, where)
+		if len(section.Pages) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: 章节没有页面", where))
+		}
+		checkPages(section.Pages, 1, where)
+	}
+
+	if len(outline.Sections) > 0 && (count < minPages || count > maxPages) {
+		problems = append(problems, fmt.Sprintf("共 %d 个页面，应为 %d 到 %d 个", count, minPages, maxPages))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("大纲不符合要求: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// outlinePlans 把校验过的大纲按深度优先的顺序展开为页面规划，章节作为其页面的父页面
+func outlinePlans(outline *Outline, language string, tmpl *TemplateInfo, modules map[string]ModuleData) []PagePlan {
+	var plans []PagePlan
+	var addPages func(pages []OutlinePage, parent *PagePlan) []string
+	addPages = func(pages []OutlinePage, parent *PagePlan) []string {
+		ids := make([]string, 0, len(pages))
+		for _, page := range pages {
+			plan := PagePlan{
+				ID:       models.PageID(page.Slug, language),
+				Key:      page.Slug,
+				Title:    page.Title,
+				Type:     models.PageType(page.Type),
+				Order:    len(plans),
+				Template: tmpl,
+				ParentID: parent.ID,
+				Page: PageData{
+					Title:       page.Title,
+					Type:        page.Type,
+					Description: page.Description,
+					Parent:      parent.Title,
+				},
+			}
+			for _, path := range page.Modules {
+				plan.Modules = append(plan.Modules, modules[path])
+			}
+			for _, child := range page.Children {
+				plan.Page.Children = append(plan.Page.Children, child.Title)
+			}
+
+			index := len(plans)
+			plans = append(plans, plan)
+			ids = append(ids, plan.ID)
+			plans[index].Children = addPages(page.Children, &plan)
+		}
+		return ids
+	}
+
+	for _, section := range outline.Sections {
+		plan := PagePlan{
+			ID:       models.PageID(section.Slug, language),
+			Key:      section.Slug,
+			Title:    section.Title,
+			Type:     models.PageTypeOverview,
+			Order:    len(plans),
+			Template: tmpl,
+			Page: PageData{
+				Title:       section.Title,
+				Type:        string(models.PageTypeOverview),
+				Description: section.Description,
+			},
+		}
+		for _, page := range section.Pages {
+			plan.Page.Children = append(plan.Page.Children, page.Title)
+		}
+
+		index := len(plans)
+		plans = append(plans, plan)
+		plans[index].Children = addPages(section.Pages, &plan)
+	}
+	return plans
+}
+
+// outlinePageCount 返回大纲展开后的页面数（含章节）
+func outlinePageCount(outline *Outline) int {
+	var count func(pages []OutlinePage) int
+	count = func(pages []OutlinePage) int {
+		n := len(pages)
+		for _, page := range pages {
+			n += count(page.Children)
+		}
+		return n
+	}
+
+	n := len(outline.Sections)
+	for _, section := range outline.Sections {
+		n += count(section.Pages)
+	}
+	return n
+}
+
+// outlinePageRange 根据模块数量给出大纲的页面数范围，大项目需要更多页面
+func outlinePageRange(moduleCount int) (int, int) {
+	minPages := 3 + moduleCount/4
+	if minPages > 15 {
+		minPages = 15
+	}
+	maxPages := 8 + moduleCount
+	if maxPages > outlineMaxPages {
+		maxPages = outlineMaxPages
+	}
+	return minPages, maxPages
+}
+
+// outlineModules 把代码结构中的模块按路径转换为模板数据，函数带上分析出的签名
+func outlineModules(structure *models.CodeStructure) map[string]ModuleData {
+	modules := make(map[string]ModuleData, len(structure.Modules))
+	for _, module := range structure.Modules {
+		modules[module.Path] = ModuleData{
+			Name:        module.Name,
+			Path:        module.Path,
+			Language:    module.Language,
+			Description: module.Description,
+		}
+	}
+	for _, fn := range structure.Functions {
+		module, ok := modules[moduleDir(fn.File)]
+		if !ok || !fn.IsPublic || len(module.Functions) >= outlineFunctionLimit {
+			continue
+		}
+		module.Functions = append(module.Functions, FunctionData{
+			Name:        fn.Name,
+			Signature:   fn.Signature,
+			Description: fn.Description,
+		})
+		modules[module.Path] = module
+	}
+	return modules
+}
+
+// summarizeStructure 生成提示词中的代码结构摘要：总体统计、依赖和各模块的规模与导出名称
+func summarizeStructure(structure *models.CodeStructure) string {
+	var b strings.Builder
+	metrics := structure.Metrics
+	fmt.Fprintf(&b, "- Files: %d, lines: %d, functions: %d, types: %d\n",
+		len(structure.Files), metrics.TotalLines, len(structure.Functions), len(structure.Classes))
+
+	if len(structure.Dependencies) > 0 {
+		names := make([]string, 0, len(structure.Dependencies))
+		for i, dep := range structure.Dependencies {
+			if i >= 30 {
+				break
+			}
+			names = append(names, dep.Name)
+		}
+		fmt.Fprintf(&b, "- Dependencies: %s\n", strings.Join(names, ", "))
+	}
+
+	fileCount := make(map[string]int)
+	for _, file := range structure.Files {
+		fileCount[moduleDir(file.Path)]++
+	}
+	exported := make(map[string][]string)
+	for _, fn := range structure.Functions {
+		if dir := moduleDir(fn.File); fn.IsPublic && len(exported[dir]) < outlineExportedLimit {
+			exported[dir] = append(exported[dir], fn.Name)
+		}
+	}
+	for _, class := range structure.Classes {
+		if dir := moduleDir(class.File); class.IsPublic && len(exported[dir]) < outlineExportedLimit {
+			exported[dir] = append(exported[dir], class.Name)
+		}
+	}
+
+	// 模块过多时只列出代码行数最多的模块，仍按路径排序
+	modules := append([]models.Module(nil), structure.Modules...)
+	if len(modules) > outlineModuleLimit {
+		sort.SliceStable(modules, func(i, j int) bool { return modules[i].LineCount > modules[j].LineCount })
+		modules = modules[:outlineModuleLimit]
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
+
+	fmt.Fprintf(&b, "- Modules (%d of %d):\n", len(modules), len(structure.Modules))
+	for _, module := range modules {
+		fmt.Fprintf(&b, "  - %s (%s, %d files, %d lines)", module.Path, module.Language, fileCount[module.Path], module.LineCount)
+		if names := exported[module.Path]; len(names) > 0 {
+			fmt.Fprintf(&b, ": %s", strings.Join(names, ", "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// moduleDir 返回文件所属模块的路径，与分析器的模块划分一致（根目录为root）
+func moduleDir(file string) string {
+	dir := filepath.Dir(file)
+	if dir == "." {
+		return "root"
+	}
+	return dir
+}
+
+// outlineSlug 把slug规范化为小写字母、数字和连字符，无法规范化时返回空
+func outlineSlug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// validOutlinePageType 判断页面类型是否允许在大纲中使用
+func validOutlinePageType(pageType string) bool {
+	for _, t := range outlinePageTypes {
+		if string(t) == pageType {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeCodeStructure 检出仓库并分析代码结构，settings 中的包含/排除规则合并到 repository 配置
+func (wg *WikiGenerator) analyzeCodeStructure(ctx context.Context, req models.GenerationRequest, ref string) (*models.CodeStructure, error) {
+	cfg := *wg.config
+	cfg.Repository = analyzer.RepositoryConfig(wg.config.Repository, req.Settings)
+	ca := analyzer.New(&cfg)
+
+	repo, err := ca.AnalyzeRepository(ctx, req.RepositoryURL, ref, req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return ca.AnalyzeCodeStructure(ctx, repo)
+}
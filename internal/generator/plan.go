@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// PagePlan 描述一个待生成的页面：页面ID、标题、类型、顺序以及生成提示词所用的模板。
+// AI规划的大纲和模块参考页面还包含页面层级、页面说明和页面覆盖的模块
+type PagePlan struct {
+	ID       string // models.PageID(Key, 语言)
+	Key      string // 页面在各语言之间共享的标识，如模板名或大纲slug
+	Title    string
+	Type     models.PageType
+	Order    int
+	Template *TemplateInfo
+	ParentID string
+	Children []string
+	Page     PageData
+	Modules  []ModuleData
+	Footer   string // 原样追加到生成内容之后的Markdown，如模块页面的声明列表和相关链接
+
+	TitleFromContent bool // 页面标题取自生成内容的一级标题，如沿用主语言大纲的其他语言页面
+}
+
+// planRepositoryPages 根据模板集为指定语言规划仓库页面。
+// 页面列表、顺序和提示词都来自模板的front matter；settings.Templates 非空时只使用其中列出的模板
+func (wg *WikiGenerator) planRepositoryPages(language string, settings models.WikiSettings) ([]PagePlan, error) {
+	templates, err := wg.templateManager.GetTemplatesWithMetadata(language)
+	if err != nil {
+		return nil, fmt.Errorf("获取模板列表失败: %w", err)
+	}
+
+	selected := make(map[string]bool, len(settings.Templates))
+	for _, name := range settings.Templates {
+		selected[strings.TrimSuffix(strings.TrimSpace(name), ".md")] = true
+	}
+
+	var plans []PagePlan
+	for _, tmpl := range templates {
+		// 模板系统文档、大纲规划和模块参考专用的模板不属于仓库文档
+		switch tmpl.Metadata.Category {
+		case TemplateCategoryTemplateDocs, TemplateCategoryOutline, TemplateCategoryModule:
+			continue
+		}
+		if len(settings.Templates) > 0 && !selected[tmpl.Name] {
+			continue
+		}
+		delete(selected, tmpl.Name)
+
+		title := tmpl.Metadata.Title
+		if title == "" || title == "Untitled" {
+			title = tmpl.Name
+		}
+		plans = append(plans, PagePlan{
+			ID:       models.PageID(tmpl.Name, language),
+			Key:      tmpl.Name,
+			Title:    title,
+			Type:     wg.getPageType(tmpl.Metadata.Type),
+			Order:    tmpl.Metadata.Order,
+			Template: tmpl,
+		})
+	}
+
+	if len(selected) > 0 {
+		missing := make([]string, 0, len(selected))
+		for name := range selected {
+			missing = append(missing, name)
+		}
+		return nil, fmt.Errorf("语言 %s 没有模板: %s", language, strings.Join(missing, ", "))
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("语言 %s 没有可用于仓库文档的模板", language)
+	}
+	return plans, nil
+}
+
+// repositoryTemplateData 准备渲染仓库页面模板的数据
+func repositoryTemplateData(repoInfo *RepositoryInfo, language string, settings models.WikiSettings) TemplateData {
+	return TemplateData{
+		ProjectName:     repoInfo.Name,
+		Description:     repoInfo.Description,
+		PrimaryLanguage: repoInfo.Language,
+		Language:        language,
+		Modules:         append([]ModuleData{}, repoInfo.Modules...),
+		RepositoryURL:   repoInfo.URL,
+		Framework:       repoInfo.Framework,
+		Ref:             repoInfo.Ref,
+		CommitSHA:       repoInfo.CommitSHA,
+		Vars:            settings.Variables,
+	}
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/stcn52/kwiki/internal/analyzer"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+const (
+	// 作用于所有页面的自定义提示词的键，生成请求中的 custom_prompts 也合并到该键
+	customPromptAll = "*"
+	// 自定义提示词的键带该后缀时替换模板渲染的提示词，否则追加到其后
+	customPromptReplace = ":replace"
+)
+
+// applyCustomPrompts 按设置中的自定义提示词调整模板渲染出的提示词。
+// keys 为页面适用的键，按从泛到专排列：*、页面类型、模板名。
+// 带 :replace 后缀的键替换提示词，越专的键优先；其余键的值按 keys 的顺序追加，相同的内容只追加一次。
+// 自定义提示词本身也是模板，用页面的数据渲染，可以引用 {{.Vars.xxx}} 和模板函数
+func applyCustomPrompts(prompt string, prompts map[string]string, keys []string, data interface{}) (string, error) {
+	if len(prompts) == 0 {
+		return prompt, nil
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i] + customPromptReplace
+		if text, ok := prompts[key]; ok && strings.TrimSpace(text) != "" {
+			rendered, err := renderCustomPrompt(key, text, data)
+			if err != nil {
+				return "", err
+			}
+			prompt = rendered
+			break
+		}
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		text := strings.TrimSpace(prompts[key])
+		if seen[key] || text == "" {
+			continue
+		}
+		seen[key] = true
+		rendered, err := renderCustomPrompt(key, text, data)
+		if err != nil {
+			return "", err
+		}
+		prompt = strings.TrimRight(prompt, "\n") + "\n\n" + rendered + "\n"
+	}
+	return prompt, nil
+}
+
+// renderCustomPrompt 用页面数据渲染一条自定义提示词
+func renderCustomPrompt(key, text string, data interface{}) (string, error) {
+	tmpl, err := template.New("prompts." + key).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("自定义提示词 %s 无效: %w", key, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("渲染自定义提示词 %s 失败: %w", key, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// pagePromptKeys 返回页面适用的自定义提示词键
+func pagePromptKeys(pageType, templateName string) []string {
+	return []string{customPromptAll, pageType, templateName}
+}
+
+// requestPrompts 把生成请求中的 custom_prompts 依次追加到设置的 * 键，返回新的映射，不修改请求中的设置
+func requestPrompts(settings map[string]string, prompts []string) map[string]string {
+	var extra []string
+	for _, prompt := range prompts {
+		if prompt = strings.TrimSpace(prompt); prompt != "" {
+			extra = append(extra, prompt)
+		}
+	}
+	if len(extra) == 0 {
+		return settings
+	}
+
+	merged := make(map[string]string, len(settings)+1)
+	for k, v := range settings {
+		merged[k] = v
+	}
+	if all := strings.TrimSpace(merged[customPromptAll]); all != "" {
+		extra = append([]string{all}, extra...)
+	}
+	merged[customPromptAll] = strings.Join(extra, "\n\n")
+	return merged
+}
+
+// prepareRequest 规范化生成请求：本地目录统一为绝对路径，避免依赖当前工作目录；
+// 请求中的 custom_prompts 合并到设置中随wiki保存，生成时只需读取设置
+func prepareRequest(req models.GenerationRequest) models.GenerationRequest {
+	if dir, ok := analyzer.LocalPath(req.RepositoryURL); ok {
+		req.RepositoryURL = dir
+	}
+	req.Settings.CustomPrompts = requestPrompts(req.Settings.CustomPrompts, req.CustomPrompts)
+	req.CustomPrompts = nil
+	return req
+}
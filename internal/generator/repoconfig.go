@@ -0,0 +1,147 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stcn52/kwiki/internal/analyzer"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// applyRepoConfig 读取仓库根目录的 .kwiki.yaml 并合并到生成请求和wiki：
+// 页面、提示词、包含/排除规则、术语表、读者和语气合并到设置（请求中显式指定的优先），
+// 请求未指定语言时使用其中的语言，固定的图表直接加入wiki。
+// 合并前的请求设置记录在 wiki.Metadata.RequestSettings，重新生成时不会沿用上次合并的值。
+// 读取或解析失败时记录警告并按原设置继续生成
+func (wg *WikiGenerator) applyRepoConfig(ctx context.Context, wiki *models.Wiki, req *models.GenerationRequest, ref string) {
+	requested := req.Settings
+	requested.IncludePatterns = append([]string(nil), req.Settings.IncludePatterns...)
+	requested.ExcludePatterns = append([]string(nil), req.Settings.ExcludePatterns...)
+	wiki.Metadata.RequestSettings = &requested
+
+	rc, err := analyzer.New(wg.config).LoadRepoConfig(ctx, req.RepositoryURL, ref, req.AccessToken)
+	if err != nil {
+		log.Printf("读取 %s 失败: %v", analyzer.RepoConfigFile, err)
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:  wiki.ID,
+			Level:   models.LogLevelWarning,
+			Step:    models.LogStepAnalyze,
+			Message: fmt.Sprintf("忽略仓库配置 %s", analyzer.RepoConfigFile),
+			Error:   err.Error(),
+		})
+	}
+
+	if rc != nil {
+		rc.ApplySettings(&req.Settings)
+		if len(req.Languages) == 0 && len(rc.Languages) > 0 {
+			req.Languages = append([]string(nil), rc.Languages...)
+			req.PrimaryLanguage = rc.Languages[0]
+			req.Settings.Language = req.PrimaryLanguage
+			wiki.Metadata.RepoConfigLanguages = true
+		}
+	}
+
+	// 请求和仓库配置都未指定语言时只生成主语言
+	if len(req.Languages) == 0 {
+		primary := req.PrimaryLanguage
+		if primary == "" {
+			primary = "en" // 默认英文
+		}
+		req.Languages = []string{primary}
+	}
+	if req.PrimaryLanguage == "" {
+		req.PrimaryLanguage = req.Languages[0]
+	}
+
+	wiki.Settings = req.Settings
+	wiki.Language = req.PrimaryLanguage
+	wiki.Languages = req.Languages
+	wiki.Metadata.Languages = req.Languages
+
+	if rc == nil {
+		return
+	}
+	for i, d := range rc.Diagrams {
+		wiki.Diagrams = append(wiki.Diagrams, pinnedDiagram(i, d, req.PrimaryLanguage))
+	}
+	wiki.Metadata.DiagramsGenerated = len(wiki.Diagrams)
+
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:  wiki.ID,
+		Level:   models.LogLevelInfo,
+		Step:    models.LogStepAnalyze,
+		Message: fmt.Sprintf("已应用仓库配置 %s", analyzer.RepoConfigFile),
+		Details: fmt.Sprintf("pages=%s languages=%s glossary=%d diagrams=%d",
+			strings.Join(rc.Pages, ","), strings.Join(req.Languages, ","), len(rc.Glossary), len(rc.Diagrams)),
+	})
+}
+
+// pinnedDiagram 把 .kwiki.yaml 中固定的图表转换为wiki图表，关联到主语言的对应页面
+func pinnedDiagram(index int, d analyzer.RepoDiagram, language string) models.WikiDiagram {
+	diagramType := models.DiagramType(d.Type)
+	if diagramType == "" {
+		diagramType = models.DiagramTypeFlowchart
+	}
+	diagram := models.WikiDiagram{
+		ID:          fmt.Sprintf("pinned_%d", index+1),
+		Title:       d.Title,
+		Type:        diagramType,
+		Content:     strings.TrimSpace(d.Content),
+		Description: d.Description,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if d.Page != "" {
+		diagram.PageID = models.PageID(strings.TrimSuffix(d.Page, ".md"), language)
+	}
+	return diagram
+}
+
+// writingGuidelines 把设置中的读者、语气和术语表转换为追加到提示词末尾的写作要求，都未设置时返回空
+func writingGuidelines(settings models.WikiSettings, language string) string {
+	if settings.Audience == "" && settings.Tone == "" && len(settings.Glossary) == 0 {
+		return ""
+	}
+
+	zh := strings.HasPrefix(language, "zh")
+	var b strings.Builder
+	if zh {
+		b.WriteString("\n\n## 写作要求\n")
+	} else {
+		b.WriteString("\n\n## Writing Guidelines\n")
+	}
+	if settings.Audience != "" {
+		if zh {
+			fmt.Fprintf(&b, "- 目标读者: %s\n", settings.Audience)
+		} else {
+			fmt.Fprintf(&b, "- Audience: %s\n", settings.Audience)
+		}
+	}
+	if settings.Tone != "" {
+		if zh {
+			fmt.Fprintf(&b, "- 语气: %s\n", settings.Tone)
+		} else {
+			fmt.Fprintf(&b, "- Tone: %s\n", settings.Tone)
+		}
+	}
+	if len(settings.Glossary) > 0 {
+		if zh {
+			b.WriteString("- 术语表（请一致地使用这些术语）:\n")
+		} else {
+			b.WriteString("- Glossary (use these terms consistently):\n")
+		}
+		terms := make([]string, 0, len(settings.Glossary))
+		for term := range settings.Glossary {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		for _, term := range terms {
+			fmt.Fprintf(&b, "  - %s: %s\n", term, settings.Glossary[term])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// templateFuncs are available to prompt templates, custom prompts included,
+// in addition to the text/template builtins. Their last argument is the piped
+// value, e.g. {{.Description | truncate 80}} or {{.Page.Children | join ", "}}.
+var templateFuncs = template.FuncMap{
+	"truncate": truncate,
+	"join":     join,
+	"indent":   indent,
+	"code":     codeBlock,
+}
+
+// maxIndent bounds indent, so a template cannot inflate its output with huge indents
+const maxIndent = 64
+
+// truncate shortens s to at most n characters, ending it with … when cut.
+// n of 0 leaves s unchanged.
+func truncate(n int, s string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("truncate: negative length %d", n)
+	}
+	if n == 0 || utf8.RuneCountInString(s) <= n {
+		return s, nil
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…", nil
+}
+
+// join joins the elements of a slice with sep, formatting non-strings with fmt
+func join(sep string, items interface{}) (string, error) {
+	if list, ok := items.([]string); ok {
+		return strings.Join(list, sep), nil
+	}
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", items)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// indent prefixes every non-empty line of s with n spaces, at most maxIndent
+func indent(n int, s string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("indent: negative width %d", n)
+	}
+	if n > maxIndent {
+		n = maxIndent
+	}
+	prefix := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// codeBlock wraps s in a fenced code block for language, e.g. {{code "go" .Signature}}.
+// The fence is made longer than any backtick run in s.
+func codeBlock(language, s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, codeFence(language), strings.TrimRight(s, "\n"), fence)
+}
@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// templateSetFile is the configuration of the template set, in the template directory
+const templateSetFile = "config.yaml"
+
+// defaultFallbackLanguage is used when config.yaml names no fallback language
+const defaultFallbackLanguage = "en"
+
+// templateSetConfig is the part of config.yaml the template manager reads
+type templateSetConfig struct {
+	Templates struct {
+		Languages yaml.Node `yaml:"languages"` // Mapping of code to name, in display order
+		Defaults  struct {
+			FallbackLanguage string `yaml:"fallback_language"`
+		} `yaml:"defaults"`
+	} `yaml:"templates"`
+}
+
+// templateLanguages are the supported languages and the fallback language of a template set
+type templateLanguages struct {
+	codes    []string
+	names    map[string]string
+	fallback string
+}
+
+// loadTemplateLanguages reads the languages of the template set from
+// config.yaml, falling back to models.SupportedLanguages and English when the
+// file is missing or invalid
+func loadTemplateLanguages(templateDir string) templateLanguages {
+	languages := templateLanguages{
+		codes:    []string{"en", "zh", "ja", "ko", "es", "fr", "de", "ru", "pt", "it"},
+		names:    models.SupportedLanguages,
+		fallback: defaultFallbackLanguage,
+	}
+
+	data, err := os.ReadFile(filepath.Join(templateDir, templateSetFile))
+	if err != nil {
+		return languages
+	}
+	var cfg templateSetConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		log.Printf("解析模板配置 %s 失败: %v", templateSetFile, err)
+		return languages
+	}
+
+	if fallback := strings.TrimSpace(cfg.Templates.Defaults.FallbackLanguage); fallback != "" {
+		languages.fallback = fallback
+	}
+	node := cfg.Templates.Languages
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		languages.codes = nil
+		languages.names = make(map[string]string, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			code := node.Content[i].Value
+			languages.codes = append(languages.codes, code)
+			languages.names[code] = node.Content[i+1].Value
+		}
+	}
+	return languages
+}
+
+// FallbackChain returns the languages whose templates are tried for language,
+// in order: the language itself, its base language for regional codes
+// (pt-BR → pt) and the fallback language of config.yaml
+func (tm *TemplateManager) FallbackChain(language string) []string {
+	candidates := []string{language}
+	if base, _, ok := strings.Cut(strings.ReplaceAll(language, "_", "-"), "-"); ok {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, tm.languages.fallback)
+
+	var chain []string
+	for _, candidate := range candidates {
+		if templateNamePattern.MatchString(candidate) && !containsString(chain, candidate) {
+			chain = append(chain, candidate)
+		}
+	}
+	return chain
+}
+
+// LanguageInstruction returns the instruction appended to the prompt of a
+// template written in another language than the one requested, so that the
+// model answers in language; it is empty when the template is in language
+func (tm *TemplateManager) LanguageInstruction(tmpl *TemplateInfo, language string) string {
+	if tmpl == nil || tmpl.Language == "" || tmpl.Language == language {
+		return ""
+	}
+	return fmt.Sprintf("\n\n## Output Language\n\n"+
+		"The instructions above are written in %s, but the documentation is for %s readers. "+
+		"Write the entire response in %s (%s), including headings, descriptions and diagram labels. "+
+		"Keep code, identifiers, file paths, commands and link targets unchanged.\n",
+		tm.languageName(tmpl.Language), tm.languageName(language), tm.languageName(language), language)
+}
+
+// languageName returns the display name of a language code, the code itself when unknown
+func (tm *TemplateManager) languageName(code string) string {
+	if name, ok := tm.languages.names[code]; ok {
+		return name
+	}
+	if name, ok := models.SupportedLanguages[code]; ok {
+		return name
+	}
+	return code
+}
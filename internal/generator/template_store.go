@@ -0,0 +1,447 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// ErrTemplateExists is returned when creating a template that already exists
+var ErrTemplateExists = errors.New("template already exists")
+
+// ErrSampleTooLarge is returned when a sample render exceeds sampleRenderLimit
+var ErrSampleTooLarge = errors.New("rendered template is too large")
+
+// Limits of a sample render. text/template cannot be interrupted, so the work
+// a render can do is bounded by its data, its integer ranges and its output.
+const (
+	sampleRenderLimit = 1 << 20  // output bytes, far above any real prompt
+	sampleDataLimit   = 64 << 10 // bytes of JSON merged over the sample data
+	sampleRangeLimit  = 1000     // largest integer a template may range over or assign
+)
+
+// templateNamePattern restricts template and language names to safe file names
+var templateNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// TemplateFile describes a template file on disk
+type TemplateFile struct {
+	Name     string           `json:"name"`
+	Language string           `json:"language"`
+	Metadata TemplateMetadata `json:"metadata"`
+	Content  string           `json:"content,omitempty"` // The whole file, front matter included
+	ModTime  time.Time        `json:"mod_time"`
+	Problems []string         `json:"problems,omitempty"` // Validation problems, empty when valid
+}
+
+// templateStamp identifies a version of a template file
+type templateStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch polls the template directory every interval and drops added, changed
+// and removed templates from the cache, so that the next generation uses the
+// files as they are on disk. Changed templates are validated and problems are
+// logged. It returns when ctx is done.
+func (tm *TemplateManager) Watch(ctx context.Context, interval time.Duration) {
+	snapshot := tm.scanTemplateFiles()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := tm.scanTemplateFiles()
+		var changed []string
+		for key, stamp := range current {
+			if old, ok := snapshot[key]; !ok || old != stamp {
+				changed = append(changed, key)
+			}
+		}
+		for key := range snapshot {
+			if _, ok := current[key]; !ok {
+				changed = append(changed, key)
+			}
+		}
+		snapshot = current
+		sort.Strings(changed)
+
+		for _, key := range changed {
+			language, name, _ := strings.Cut(key, "/")
+			tm.invalidate(language, name)
+			if _, ok := current[key]; !ok {
+				log.Printf("模板已删除: %s", key)
+				continue
+			}
+			file, err := tm.ReadTemplate(language, name)
+			switch {
+			case err != nil:
+				log.Printf("读取模板 %s 失败: %v", key, err)
+			case len(file.Problems) > 0:
+				log.Printf("模板 %s 已修改但无效: %s", key, strings.Join(file.Problems, "; "))
+			default:
+				log.Printf("模板已重新加载: %s", key)
+			}
+		}
+	}
+}
+
+// scanTemplateFiles returns the modification stamp of every template, keyed by language/name
+func (tm *TemplateManager) scanTemplateFiles() map[string]templateStamp {
+	stamps := make(map[string]templateStamp)
+	languages, err := os.ReadDir(tm.config.TemplateDir)
+	if err != nil {
+		return stamps
+	}
+	for _, language := range languages {
+		if !language.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(tm.config.TemplateDir, language.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			key := language.Name() + "/" + strings.TrimSuffix(entry.Name(), ".md")
+			stamps[key] = templateStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// invalidate drops a template from the cache
+func (tm *TemplateManager) invalidate(language, name string) {
+	tm.mu.Lock()
+	delete(tm.cache, language+"/"+name)
+	tm.mu.Unlock()
+}
+
+// ListTemplates returns the templates of a language, or of all languages when
+// language is empty, sorted by language and order, with their validation problems
+func (tm *TemplateManager) ListTemplates(language string) ([]TemplateFile, error) {
+	if language != "" && !templateNamePattern.MatchString(language) {
+		return nil, fmt.Errorf("invalid language %q", language)
+	}
+
+	var files []TemplateFile
+	for key := range tm.scanTemplateFiles() {
+		lang, name, _ := strings.Cut(key, "/")
+		if language != "" && lang != language {
+			continue
+		}
+		file, err := tm.ReadTemplate(lang, name)
+		if err != nil {
+			return nil, err
+		}
+		file.Content = ""
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Language != files[j].Language {
+			return files[i].Language < files[j].Language
+		}
+		if files[i].Metadata.Order != files[j].Metadata.Order {
+			return files[i].Metadata.Order < files[j].Metadata.Order
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// ReadTemplate reads a template file without falling back to English. A
+// missing template wraps fs.ErrNotExist.
+func (tm *TemplateManager) ReadTemplate(language, name string) (*TemplateFile, error) {
+	path, err := tm.templatePath(language, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s/%s: %w", language, name, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s/%s: %w", language, name, err)
+	}
+
+	file := &TemplateFile{
+		Name:     name,
+		Language: language,
+		Content:  string(data),
+		ModTime:  info.ModTime(),
+	}
+	file.Metadata, _, _ = tm.parseFrontMatter(string(data))
+	var invalid *TemplateValidationError
+	if err := tm.ValidateTemplate(name, file.Content); errors.As(err, &invalid) {
+		file.Problems = invalid.Problems
+	}
+	return file, nil
+}
+
+// SaveTemplate validates and writes a template. With create set it fails
+// with ErrTemplateExists when the template exists, otherwise it fails with
+// fs.ErrNotExist when it does not. Invalid templates are rejected with a
+// *TemplateValidationError and leave the file untouched.
+func (tm *TemplateManager) SaveTemplate(language, name, content string, create bool) error {
+	path, err := tm.templatePath(language, name)
+	if err != nil {
+		return err
+	}
+	_, statErr := os.Stat(path)
+	switch {
+	case create && statErr == nil:
+		return fmt.Errorf("%s/%s: %w", language, name, ErrTemplateExists)
+	case !create && errors.Is(statErr, fs.ErrNotExist):
+		return fmt.Errorf("template %s/%s: %w", language, name, fs.ErrNotExist)
+	}
+
+	if err := tm.ValidateTemplate(name, content); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create template directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write template %s/%s: %w", language, name, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write template %s/%s: %w", language, name, err)
+	}
+	tm.invalidate(language, name)
+	log.Printf("模板已保存: %s/%s", language, name)
+	return nil
+}
+
+// RenderSample renders a template with sample data, without calling the AI,
+// to preview the prompt it produces. content replaces the saved template when
+// not empty, and data is JSON merged over the sample data. The output is capped
+// at sampleRenderLimit, and the render gives up when ctx is done.
+func (tm *TemplateManager) RenderSample(ctx context.Context, language, name, content string, data []byte) (string, error) {
+	if content == "" {
+		file, err := tm.ReadTemplate(language, name)
+		if err != nil {
+			return "", err
+		}
+		content = file.Content
+	}
+
+	metadata, body, err := tm.parseFrontMatter(content)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	for _, t := range tmpl.Templates() {
+		if err := checkSampleNumbers(t.Tree.Root); err != nil {
+			return "", err
+		}
+	}
+
+	sample, err := tm.sampleData(name, metadata, language)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > sampleDataLimit {
+		return "", fmt.Errorf("sample data is larger than %d bytes: %w", sampleDataLimit, ErrSampleTooLarge)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, sample); err != nil {
+			return "", fmt.Errorf("invalid sample data: %w", err)
+		}
+	}
+
+	// text/template cannot be interrupted; the writer stops templates that keep
+	// writing, and a loop that writes nothing is abandoned when ctx is done
+	w := &sampleWriter{ctx: ctx, limit: sampleRenderLimit}
+	done := make(chan error, 1)
+	go func() { done <- tmpl.Execute(w, sample) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", fmt.Errorf("failed to execute template: %w", err)
+		}
+		return w.buf.String(), nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("failed to execute template: %w", ctx.Err())
+	}
+}
+
+// checkSampleNumbers rejects integer constants above sampleRangeLimit, so that
+// neither {{range 1000000000}} nor a variable holding such a number can keep a
+// render busy; ranges over the data are bounded by sampleDataLimit
+func checkSampleNumbers(node parse.Node) error {
+	var err error
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		if err != nil || node == nil || reflect.ValueOf(node).IsNil() {
+			return
+		}
+		switch n := node.(type) {
+		case *parse.NumberNode:
+			if n.IsInt && (n.Int64 > sampleRangeLimit || n.Int64 < -sampleRangeLimit) ||
+				n.IsUint && n.Uint64 > sampleRangeLimit {
+				err = fmt.Errorf("number %s is larger than %d: %w", n.Text, sampleRangeLimit, ErrSampleTooLarge)
+			}
+		case *parse.ListNode:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(node)
+	return err
+}
+
+// sampleWriter collects a sample render, failing past limit bytes or once ctx is done
+type sampleWriter struct {
+	ctx   context.Context
+	limit int
+	buf   strings.Builder
+}
+
+func (w *sampleWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, ErrSampleTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+// sampleData returns a pointer to sample data of the type the template is rendered with
+func (tm *TemplateManager) sampleData(name string, metadata TemplateMetadata, language string) (interface{}, error) {
+	switch templateDataType(name, metadata) {
+	case reflect.TypeOf(TemplateDocumentationData{}):
+		data, err := tm.ScanTemplateDirectory()
+		if err != nil {
+			return nil, err
+		}
+		data.Language = language
+		return data, nil
+	case reflect.TypeOf(OutlinePromptData{}):
+		return &OutlinePromptData{
+			TemplateData: sampleTemplateData(language),
+			Structure: "- Files: 42, lines: 6810, functions: 230, types: 48\n" +
+				"- Dependencies: github.com/gin-gonic/gin, gopkg.in/yaml.v3\n" +
+				"- Modules (2 of 2):\n" +
+				"  - cmd/example (Go, 1 files, 120 lines): main\n" +
+				"  - internal/server (Go, 6 files, 1850 lines): Server, New, Start\n",
+			MinPages:  4,
+			MaxPages:  10,
+			PageTypes: "overview, architecture, api, module, guide, tutorial, reference",
+		}, nil
+	default:
+		data := sampleTemplateData(language)
+		return &data, nil
+	}
+}
+
+// sampleTemplateData is the TemplateData templates are previewed with
+func sampleTemplateData(language string) TemplateData {
+	server := ModuleData{
+		Name:        "server",
+		Path:        "internal/server",
+		Language:    "Go",
+		Description: "HTTP server and REST API",
+		Functions: []FunctionData{
+			{Name: "New", Signature: "func New(cfg *Config) (*Server, error)", Description: "New creates a server from the configuration."},
+		},
+		Types: []TypeData{{
+			Name:        "Server",
+			Signature:   "type Server struct",
+			Description: "Server serves the web interface and the API.",
+			Methods: []FunctionData{
+				{Name: "Start", Signature: "func (s *Server) Start() error", Description: "Start listens until the server is stopped."},
+			},
+		}},
+	}
+	return TemplateData{
+		ProjectName:     "example",
+		Description:     "An example project used to preview templates",
+		PrimaryLanguage: "Go",
+		License:         "MIT",
+		Language:        language,
+		Modules:         []ModuleData{server},
+		RepositoryURL:   "https://github.com/example/example",
+		Framework:       "gin",
+		Ref:             "v1.2.0",
+		CommitSHA:       "4f1c2a9d8e7b6a5c4d3e2f1a0b9c8d7e6f5a4b3c",
+		Vars:            map[string]string{"product": "Example Cloud"},
+		Page: PageData{
+			Title:       "internal/server",
+			Type:        "module",
+			Description: "How the HTTP server is built and started",
+			Parent:      "API Reference",
+			Children:    []string{"server.Server"},
+			Links:       []PageLink{{ID: models.PageID("api-reference", language), Title: "API Reference"}},
+		},
+	}
+}
+
+// templatePath returns the file of a template, rejecting names that are not plain file names
+func (tm *TemplateManager) templatePath(language, name string) (string, error) {
+	if !templateNamePattern.MatchString(language) {
+		return "", fmt.Errorf("invalid language %q", language)
+	}
+	if !templateNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid template name %q", name)
+	}
+	return filepath.Join(tm.config.TemplateDir, language, name+".md"), nil
+}
@@ -0,0 +1,306 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// templatePageTypes are the values accepted in the type field of the front matter
+var templatePageTypes = []models.PageType{
+	models.PageTypeOverview,
+	models.PageTypeArchitecture,
+	models.PageTypeAPI,
+	models.PageTypeModule,
+	models.PageTypeFunction,
+	models.PageTypeClass,
+	models.PageTypeTutorial,
+	models.PageTypeReference,
+	models.PageTypeChangelog,
+	models.PageTypeGuide,
+}
+
+// templateCategories are the values accepted in the category field, "" for repository pages
+var templateCategories = []string{"", TemplateCategoryTemplateDocs, TemplateCategoryOutline, TemplateCategoryModule}
+
+// TemplateValidationError lists everything wrong with a template
+type TemplateValidationError struct {
+	Name     string
+	Problems []string
+}
+
+func (e *TemplateValidationError) Error() string {
+	return fmt.Sprintf("invalid template %s: %s", e.Name, strings.Join(e.Problems, "; "))
+}
+
+// ValidateTemplate validates a template file: the front matter must be
+// present with known fields, a title, a known type and category and a
+// non-negative order, the declared variables must exist, and the body must
+// parse and only reference fields of the data the template is rendered with.
+// It returns a *TemplateValidationError listing all problems.
+func (tm *TemplateManager) ValidateTemplate(name, content string) error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	metadata, body, fields, err := parseStrictFrontMatter(content)
+	if err != nil {
+		return &TemplateValidationError{Name: name, Problems: []string{err.Error()}}
+	}
+
+	if strings.TrimSpace(metadata.Title) == "" {
+		addf("front matter: title is required")
+	}
+	if !fields["type"] {
+		addf("front matter: type is required")
+	} else if !validTemplateType(metadata.Type) {
+		addf("front matter: unknown type %q", metadata.Type)
+	}
+	if !fields["order"] {
+		addf("front matter: order is required")
+	} else if metadata.Order < 0 {
+		addf("front matter: order must not be negative")
+	}
+	if !containsString(templateCategories, metadata.Category) {
+		addf("front matter: unknown category %q", metadata.Category)
+	}
+
+	dataType := templateDataType(name, metadata)
+	for _, variable := range metadata.Variables {
+		if _, ok := lookupField(dataType, variable); !ok {
+			addf("front matter: variable %s does not exist on %s", variable, dataType.Name())
+		}
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		addf("%v", err)
+	} else if tmpl.Tree != nil {
+		checker := &fieldChecker{tree: tmpl.Tree, root: dataType}
+		checker.walk(tmpl.Tree.Root, dataType)
+		problems = append(problems, checker.problems...)
+	}
+
+	if len(problems) > 0 {
+		return &TemplateValidationError{Name: name, Problems: problems}
+	}
+	return nil
+}
+
+// parseStrictFrontMatter parses the front matter rejecting unknown fields, and
+// reports which fields are present so that zero values can be told from missing ones
+func parseStrictFrontMatter(content string) (TemplateMetadata, string, map[string]bool, error) {
+	var metadata TemplateMetadata
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(content, "---\n") {
+		return metadata, content, nil, fmt.Errorf("front matter is missing")
+	}
+	parts := strings.SplitN(content, "\n---\n", 2)
+	if len(parts) != 2 {
+		return metadata, content, nil, fmt.Errorf("front matter is not closed with ---")
+	}
+	frontMatter := strings.TrimPrefix(parts[0], "---\n")
+
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(frontMatter)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&metadata); err != nil {
+		return metadata, parts[1], nil, fmt.Errorf("front matter: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal([]byte(frontMatter), &raw); err != nil {
+		return metadata, parts[1], nil, fmt.Errorf("front matter: %w", err)
+	}
+	fields := make(map[string]bool, len(raw))
+	for key := range raw {
+		fields[key] = true
+	}
+	return metadata, parts[1], fields, nil
+}
+
+// templateDataType returns the type of the data a template is rendered with
+func templateDataType(name string, metadata TemplateMetadata) reflect.Type {
+	switch {
+	case metadata.Category == TemplateCategoryTemplateDocs:
+		return reflect.TypeOf(TemplateDocumentationData{})
+	case name == outlinePlanTemplate:
+		return reflect.TypeOf(OutlinePromptData{})
+	default:
+		return reflect.TypeOf(TemplateData{})
+	}
+}
+
+// fieldChecker walks a parsed template and checks every field reference
+// against the type of dot, following range and with into element types
+type fieldChecker struct {
+	tree     *parse.Tree
+	root     reflect.Type
+	problems []string
+}
+
+func (c *fieldChecker) walk(node parse.Node, dot reflect.Type) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, dot)
+		}
+	case *parse.ActionNode:
+		c.pipeType(n.Pipe, dot)
+	case *parse.IfNode:
+		c.pipeType(n.Pipe, dot)
+		c.walk(n.List, dot)
+		c.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		c.walk(n.List, elemType(c.pipeType(n.Pipe, dot)))
+		c.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		c.walk(n.List, c.pipeType(n.Pipe, dot))
+		c.walk(n.ElseList, dot)
+	case *parse.TemplateNode:
+		c.pipeType(n.Pipe, dot)
+	}
+}
+
+// pipeType checks the fields used in a pipeline and returns its type when it
+// is a single field or dot, nil when it cannot be known
+func (c *fieldChecker) pipeType(pipe *parse.PipeNode, dot reflect.Type) reflect.Type {
+	if pipe == nil {
+		return nil
+	}
+	var result reflect.Type
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			t := c.argType(arg, dot)
+			if len(pipe.Cmds) == 1 && len(cmd.Args) == 1 {
+				result = t
+			}
+		}
+	}
+	return result
+}
+
+func (c *fieldChecker) argType(arg parse.Node, dot reflect.Type) reflect.Type {
+	switch n := arg.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return c.resolve(n, dot, n.Ident)
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return c.resolve(n, c.root, n.Ident[1:])
+		}
+	case *parse.PipeNode:
+		return c.pipeType(n, dot)
+	case *parse.ChainNode:
+		if pipe, ok := n.Node.(*parse.PipeNode); ok {
+			c.pipeType(pipe, dot)
+		}
+	}
+	return nil
+}
+
+// resolve follows a chain of field or method names from t, recording a
+// problem for the first name that does not exist
+func (c *fieldChecker) resolve(node parse.Node, t reflect.Type, idents []string) reflect.Type {
+	for _, ident := range idents {
+		if t == nil {
+			return nil
+		}
+		next, ok := lookupField(t, ident)
+		if !ok {
+			location, _ := c.tree.ErrorContext(node)
+			c.problems = append(c.problems, fmt.Sprintf("%s: %s has no field %s", location, typeName(t), ident))
+			return nil
+		}
+		t = next
+	}
+	return t
+}
+
+// lookupField returns the type of field or method name of t. Maps and
+// interfaces accept any name, their result type is unknown (nil).
+func lookupField(t reflect.Type, name string) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		if method, ok := t.MethodByName(name); ok {
+			return methodResult(method), true
+		}
+		t = t.Elem()
+	}
+	if method, ok := t.MethodByName(name); ok {
+		return methodResult(method), true
+	}
+	if method, ok := reflect.PtrTo(t).MethodByName(name); ok {
+		return methodResult(method), true
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if field, ok := t.FieldByName(name); ok && field.IsExported() {
+			return field.Type, true
+		}
+		return nil, false
+	case reflect.Map:
+		return t.Elem(), true
+	case reflect.Interface:
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
+func methodResult(method reflect.Method) reflect.Type {
+	if method.Type.NumOut() == 0 {
+		return nil
+	}
+	return method.Type.Out(0)
+}
+
+// elemType returns the type range assigns to dot, nil when unknown
+func elemType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return t.Elem()
+	default:
+		return nil
+	}
+}
+
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+func validTemplateType(pageType string) bool {
+	for _, t := range templatePageTypes {
+		if string(t) == pageType {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,15 @@
 package generator
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/stcn52/kwiki/pkg/models"
@@ -14,10 +17,14 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// TemplateManager manages prompt templates
+// TemplateManager manages prompt templates. Parsed templates are cached until
+// Watch notices a change on disk or they are replaced with SaveTemplate.
+// Languages without a template fall back along FallbackChain.
 type TemplateManager struct {
-	templates map[string]*template.Template
+	mu        sync.RWMutex
+	cache     map[string]*TemplateInfo // Keyed by the language/name of the file
 	config    *GeneratorConfig
+	languages templateLanguages
 }
 
 // NewTemplateManager creates a new template manager
@@ -29,8 +36,9 @@ func NewTemplateManager(config *GeneratorConfig) *TemplateManager {
 		}
 	}
 	return &TemplateManager{
-		templates: make(map[string]*template.Template),
+		cache:     make(map[string]*TemplateInfo),
 		config:    config,
+		languages: loadTemplateLanguages(config.TemplateDir),
 	}
 }
 
@@ -42,19 +50,58 @@ type TemplateData struct {
 	License         string
 	Language        string
 	Modules         []ModuleData
+	RepositoryURL   string
+	Framework       string
+	Ref             string // Pinned branch, tag or commit; empty for the default branch
+	CommitSHA       string
+	Page            PageData          // The page being written when the outline was planned by the model
+	Vars            map[string]string // User-defined variables from settings.variables, e.g. {{.Vars.product}}
+}
+
+// PageData describes a page of a planned outline
+type PageData struct {
+	Title       string
+	Type        string
+	Description string
+	Parent      string     // Title of the parent page, empty for sections
+	Children    []string   // Titles of the child pages
+	Links       []PageLink // Related pages the page may link to
+}
+
+// PageLink is a link to another page of the wiki, written in Markdown as [Title](#page-ID)
+type PageLink struct {
+	ID    string
+	Title string
+}
+
+// Markdown returns the link in Markdown; the wiki viewer opens #page-<ID> links in place
+func (l PageLink) Markdown() string {
+	return fmt.Sprintf("[%s](#page-%s)", l.Title, l.ID)
 }
 
 // ModuleData represents module data for templates
 type ModuleData struct {
 	Name        string
+	Path        string
+	Language    string
 	Description string
 	Functions   []FunctionData
+	Types       []TypeData
 }
 
 // FunctionData represents function data for templates
 type FunctionData struct {
 	Name        string
+	Signature   string
+	Description string
+}
+
+// TypeData represents a type declared in a module, with its methods
+type TypeData struct {
+	Name        string
+	Signature   string
 	Description string
+	Methods     []FunctionData
 }
 
 // TemplateMetadata represents metadata from template front matter
@@ -69,8 +116,23 @@ type TemplateMetadata struct {
 	Variables   []string `yaml:"variables"`
 }
 
+// TemplateCategoryTemplateDocs marks templates that only document the template
+// system itself; they render TemplateDocumentationData and are never part of a
+// repository page plan
+const TemplateCategoryTemplateDocs = "template-docs"
+
+// TemplateCategoryOutline marks the templates used when the model plans the
+// outline: outline-plan asks for the outline, outline-page writes a planned page
+const TemplateCategoryOutline = "outline"
+
+// TemplateCategoryModule marks the template of module and type reference pages,
+// which are added below the API reference when settings.module_pages is enabled
+const TemplateCategoryModule = "module"
+
 // TemplateInfo combines template content with metadata
 type TemplateInfo struct {
+	Name     string // File name without .md, e.g. api-reference
+	Language string // Language of the file, another than the requested one when it fell back
 	Metadata TemplateMetadata
 	Content  string
 	Template *template.Template
@@ -78,31 +140,11 @@ type TemplateInfo struct {
 
 // LoadTemplate loads a template for a specific language and type
 func (tm *TemplateManager) LoadTemplate(language, templateType string) (*template.Template, error) {
-	key := fmt.Sprintf("%s/%s", language, templateType)
-
-	// Check if template is already loaded
-	if tmpl, exists := tm.templates[key]; exists {
-		return tmpl, nil
-	}
-
-	// Try to load from file system
-	templatePath := filepath.Join(tm.config.TemplateDir, language, templateType+".md")
-	content, err := os.ReadFile(templatePath)
+	info, err := tm.LoadTemplateWithMetadata(language, templateType)
 	if err != nil {
-		// Fallback to English if language not found
-		if language != "en" {
-			return tm.LoadTemplate("en", templateType)
-		}
-		return nil, fmt.Errorf("template not found: %s (path: %s)", key, templatePath)
-	}
-
-	tmpl, err := template.New(key).Parse(string(content))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse template %s: %w", key, err)
+		return nil, err
 	}
-
-	tm.templates[key] = tmpl
-	return tmpl, nil
+	return info.Template, nil
 }
 
 // RenderTemplate renders a template with the given data
@@ -128,13 +170,20 @@ func (tm *TemplateManager) PrepareTemplateData(repo *models.Repository, structur
 		PrimaryLanguage: tm.getPrimaryLanguage(repo),
 		License:         repo.License,
 		Language:        language,
-		Modules:         make([]ModuleData, 0, len(structure.Modules)),
+		Modules:         templateModules(structure),
 	}
 
-	// Convert modules
+	return data
+}
+
+// templateModules converts the analyzed modules to template data
+func templateModules(structure *models.CodeStructure) []ModuleData {
+	modules := make([]ModuleData, 0, len(structure.Modules))
 	for _, module := range structure.Modules {
 		moduleData := ModuleData{
 			Name:        module.Name,
+			Path:        module.Path,
+			Language:    module.Language,
 			Description: module.Description,
 			Functions:   make([]FunctionData, 0, len(module.Functions)),
 		}
@@ -150,6 +199,7 @@ func (tm *TemplateManager) PrepareTemplateData(repo *models.Repository, structur
 				if fn.Name == funcName && fn.Module == module.Name {
 					moduleData.Functions = append(moduleData.Functions, FunctionData{
 						Name:        fn.Name,
+						Signature:   fn.Signature,
 						Description: fn.Description,
 					})
 					break
@@ -157,10 +207,9 @@ func (tm *TemplateManager) PrepareTemplateData(repo *models.Repository, structur
 			}
 		}
 
-		data.Modules = append(data.Modules, moduleData)
+		modules = append(modules, moduleData)
 	}
-
-	return data
+	return modules
 }
 
 // getPrimaryLanguage gets the primary language from repository
@@ -171,52 +220,67 @@ func (tm *TemplateManager) getPrimaryLanguage(repo *models.Repository) string {
 	return "Unknown"
 }
 
-// GetAvailableTemplates returns available template types for a language
+// GetAvailableTemplates returns the template types available for a language:
+// those of every language of its fallback chain, sorted by name
 func (tm *TemplateManager) GetAvailableTemplates(language string) ([]string, error) {
 	var templates []string
-
-	// Check file system templates
-	templateDir := filepath.Join(tm.config.TemplateDir, language)
-	entries, err := os.ReadDir(templateDir)
-	if err != nil {
-		// Fallback to English
-		if language != "en" {
-			return tm.GetAvailableTemplates("en")
+	found := make(map[string]bool)
+	for _, lang := range tm.FallbackChain(language) {
+		entries, err := os.ReadDir(filepath.Join(tm.config.TemplateDir, lang))
+		if err != nil {
+			continue
 		}
-		return nil, fmt.Errorf("no templates found for language: %s (dir: %s)", language, templateDir)
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
-			templateName := strings.TrimSuffix(entry.Name(), ".md")
-			templates = append(templates, templateName)
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".md")
+			if entry.IsDir() || name == entry.Name() || found[name] {
+				continue
+			}
+			found[name] = true
+			templates = append(templates, name)
 		}
 	}
-
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no templates found for language: %s (tried %s)", language, strings.Join(tm.FallbackChain(language), ", "))
+	}
+	sort.Strings(templates)
 	return templates, nil
 }
 
-// GetSupportedLanguages returns list of supported languages
+// GetSupportedLanguages returns the languages declared in config.yaml, in order
 func (tm *TemplateManager) GetSupportedLanguages() []string {
-	return []string{"en", "zh", "ja", "ko", "es", "fr", "de", "ru", "pt", "it"}
+	return append([]string(nil), tm.languages.codes...)
 }
 
-// ValidateTemplate validates a template string
-func (tm *TemplateManager) ValidateTemplate(content string) error {
-	_, err := template.New("validation").Parse(content)
-	return err
+// LoadTemplateWithMetadata loads a template with its metadata from the first
+// language of the fallback chain that has it. The Language of the result tells
+// whether it fell back; see LanguageInstruction.
+func (tm *TemplateManager) LoadTemplateWithMetadata(language, templateType string) (*TemplateInfo, error) {
+	chain := tm.FallbackChain(language)
+	for _, lang := range chain {
+		info, err := tm.loadTemplateFile(lang, templateType)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return info, err
+	}
+	return nil, fmt.Errorf("template not found: %s (tried %s): %w", templateType, strings.Join(chain, ", "), fs.ErrNotExist)
 }
 
-// LoadTemplateWithMetadata loads a template with its metadata
-func (tm *TemplateManager) LoadTemplateWithMetadata(language, templateType string) (*TemplateInfo, error) {
+// loadTemplateFile loads and caches the template file of a language. A missing
+// file wraps fs.ErrNotExist.
+func (tm *TemplateManager) loadTemplateFile(language, templateType string) (*TemplateInfo, error) {
+	key := fmt.Sprintf("%s/%s", language, templateType)
+	tm.mu.RLock()
+	cached, ok := tm.cache[key]
+	tm.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
 	templatePath := filepath.Join(tm.config.TemplateDir, language, templateType+".md")
 	content, err := os.ReadFile(templatePath)
 	if err != nil {
-		// Fallback to English if language not found
-		if language != "en" {
-			return tm.LoadTemplateWithMetadata("en", templateType)
-		}
-		return nil, fmt.Errorf("template not found: %s (path: %s)", templateType, templatePath)
+		return nil, fmt.Errorf("failed to read template %s: %w", key, err)
 	}
 
 	// Parse front matter and content
@@ -226,16 +290,22 @@ func (tm *TemplateManager) LoadTemplateWithMetadata(language, templateType strin
 	}
 
 	// Create template
-	tmpl, err := template.New(templateType).Parse(templateContent)
+	tmpl, err := template.New(templateType).Funcs(templateFuncs).Option("missingkey=zero").Parse(templateContent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse template %s: %w", templateType, err)
 	}
 
-	return &TemplateInfo{
+	info := &TemplateInfo{
+		Name:     templateType,
+		Language: language,
 		Metadata: metadata,
 		Content:  templateContent,
 		Template: tmpl,
-	}, nil
+	}
+	tm.mu.Lock()
+	tm.cache[key] = info
+	tm.mu.Unlock()
+	return info, nil
 }
 
 // parseFrontMatter parses YAML front matter from template content
@@ -365,12 +435,12 @@ func (tm *TemplateManager) ScanTemplateDirectory() (*TemplateDocumentationData,
 	for _, langCode := range supportedLanguages {
 		langInfo := LanguageInfo{
 			Code:          langCode,
-			Name:          tm.getLanguageName(langCode),
+			Name:          tm.languageName(langCode),
 			TemplateCount: 0,
 			Available:     false,
 		}
 
-		// 获取该语言的所有模板
+		// 获取该语言的所有模板，回退到其他语言的模板不计入该语言
 		templates, err := tm.GetTemplatesWithMetadata(langCode)
 		if err != nil {
 			// 如果语言目录不存在，跳过
@@ -378,12 +448,12 @@ func (tm *TemplateManager) ScanTemplateDirectory() (*TemplateDocumentationData,
 			continue
 		}
 
-		langInfo.Available = true
-		langInfo.TemplateCount = len(templates)
-		docData.Statistics.TemplatesByLanguage[langCode] = len(templates)
-
 		// 处理每个模板，直接从模板元数据获取信息
 		for _, tmplInfo := range templates {
+			if tmplInfo.Language != langCode {
+				continue
+			}
+			langInfo.TemplateCount++
 			docInfo := TemplateDocInfo{
 				Name:        tmplInfo.Metadata.Title,
 				Title:       tmplInfo.Metadata.Title,
@@ -400,6 +470,10 @@ func (tm *TemplateManager) ScanTemplateDirectory() (*TemplateDocumentationData,
 			docData.Statistics.TemplatesByType[tmplInfo.Metadata.Type]++
 		}
 
+		langInfo.Available = langInfo.TemplateCount > 0
+		if langInfo.Available {
+			docData.Statistics.TemplatesByLanguage[langCode] = langInfo.TemplateCount
+		}
 		docData.Languages = append(docData.Languages, langInfo)
 	}
 
@@ -409,16 +483,3 @@ func (tm *TemplateManager) ScanTemplateDirectory() (*TemplateDocumentationData,
 
 	return docData, nil
 }
-
-// getLanguageName 获取语言代码对应的显示名称
-func (tm *TemplateManager) getLanguageName(code string) string {
-	// 简单映射，主要支持中英文
-	switch code {
-	case "zh":
-		return "中文"
-	case "en":
-		return "English"
-	default:
-		return code
-	}
-}
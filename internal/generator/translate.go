@@ -0,0 +1,650 @@
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+const (
+	translateChunkSize = 6000 // 每次请求翻译的最大字符数，按段落切分
+	translateAttempts  = 2    // 译文缺少占位符时的尝试次数
+)
+
+// ErrSameLanguage 目标语言与wiki的主语言相同
+var ErrSameLanguage = errors.New("target language is the primary language of the wiki")
+
+// ErrGeneratedLanguage wiki已经生成了目标语言的页面，翻译会与生成的页面重复
+var ErrGeneratedLanguage = errors.New("the wiki already has generated pages in the target language")
+
+// ErrNoTranslation wiki没有目标语言的翻译
+var ErrNoTranslation = errors.New("translation not found")
+
+// 翻译页面过期的原因
+const (
+	StaleChanged    = "changed"    // 源页面在翻译后修改过
+	StaleIncomplete = "incomplete" // 部分段落翻译失败，保留了原文
+	StaleMissing    = "missing"    // 源页面还没有翻译
+	StaleRemoved    = "removed"    // 源页面已删除
+	StaleUntracked  = "untracked"  // 翻译页面没有记录源页面
+)
+
+// TranslationStatus 一个翻译相对于当前主语言页面的状态
+type TranslationStatus struct {
+	Language  string      `json:"language"`
+	Pages     int         `json:"pages"` // 翻译页面数
+	Stale     []StalePage `json:"stale"` // 需要重新翻译或移除的页面
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// StalePage 一个过期的翻译页面
+type StalePage struct {
+	PageID          string    `json:"page_id,omitempty"`           // 翻译页面ID，源页面还没有翻译时为空
+	SourceID        string    `json:"source_id,omitempty"`         // 源页面ID，无法确定时为空
+	Reason          string    `json:"reason"`                      // 过期原因，见 Stale* 常量
+	SourceUpdatedAt time.Time `json:"source_updated_at,omitempty"` // 源页面当前的更新时间
+}
+
+// protectPattern 匹配翻译时原样保留的行内内容：行内代码、链接和图片的目标、尖括号链接和裸URL
+var protectPattern = regexp.MustCompile("`[^`\n]+`|\\]\\([^)\\s]*(?:\\s+\"[^\"]*\")?\\)|<https?://[^>\\s]+>|https?://[^\\s)<>]+")
+
+// placeholderPattern 匹配占位符，翻译前替换保留内容，翻译后还原
+var placeholderPattern = regexp.MustCompile(`⟦(\d+)⟧`)
+
+// numberedLinePattern 匹配标题批量翻译结果中的编号行
+var numberedLinePattern = regexp.MustCompile(`^\s*(\d+)\.\s*(.*)$`)
+
+// markdownSegment 页面内容的一段，verbatim 的段落原样保留
+type markdownSegment struct {
+	text     string
+	verbatim bool
+}
+
+// TranslateWiki 把wiki主语言的页面逐块翻译为目标语言，返回翻译结果，不修改wiki。
+// front matter、代码块（包括Mermaid图表）、行内代码和链接目标原样保留，页面之间的链接指向翻译后的页面；
+// glossary 中的术语以及设置中术语表的术语不翻译。翻译页面记录源页面的哈希和更新时间
+func (wg *WikiGenerator) TranslateWiki(ctx context.Context, wiki *models.Wiki, language string, glossary []string) (*models.WikiTrans, error) {
+	trans, _, err := wg.translateWiki(ctx, wiki, language, glossary, nil)
+	return trans, err
+}
+
+// RetranslateStale 只重新翻译过期的页面：源页面修改过、还没有翻译或没有记录源页面的页面重新翻译，
+// 源页面已删除的翻译页面被移除，其余页面保留原译文。返回新的翻译结果和重新翻译的页面数，不修改wiki；
+// 没有过期页面时返回原翻译
+func (wg *WikiGenerator) RetranslateStale(ctx context.Context, wiki *models.Wiki, language string, glossary []string) (*models.WikiTrans, int, error) {
+	previous := wiki.Translations[language]
+	if previous == nil {
+		return nil, 0, fmt.Errorf("%s: %w", language, ErrNoTranslation)
+	}
+	return wg.translateWiki(ctx, wiki, language, glossary, previous)
+}
+
+// TranslationStatuses 返回wiki每个翻译的状态，按语言排序
+func TranslationStatuses(wiki *models.Wiki) []TranslationStatus {
+	_, pages := translationSource(wiki)
+	statuses := []TranslationStatus{}
+	for language, trans := range wiki.Translations {
+		if trans == nil {
+			continue
+		}
+		statuses = append(statuses, TranslationStatus{
+			Language:  language,
+			Pages:     len(trans.Pages),
+			Stale:     stalePages(pages, trans),
+			UpdatedAt: trans.UpdatedAt,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Language < statuses[j].Language })
+	return statuses
+}
+
+// translationSource 返回wiki的主语言和要翻译的页面：只翻译主语言的页面，没有页面记录语言时翻译全部页面
+func translationSource(wiki *models.Wiki) (string, []models.WikiPage) {
+	source := wiki.Language
+	if source == "" {
+		source = wiki.Settings.Language
+	}
+	var pages []models.WikiPage
+	for _, page := range wiki.Pages {
+		if page.Language == source {
+			pages = append(pages, page)
+		}
+	}
+	if len(pages) == 0 {
+		pages = wiki.Pages
+	}
+	return source, pages
+}
+
+// stalePages 比较翻译页面记录的源页面哈希与当前的源页面，返回过期的页面
+func stalePages(sources []models.WikiPage, trans *models.WikiTrans) []StalePage {
+	current := upToDatePages(sources, trans)
+	stale := []StalePage{}
+	translated := make(map[string]bool, len(trans.Pages))
+	for _, page := range trans.Pages {
+		sourceID := sourcePageID(sources, page, trans.Language)
+		if sourceID != "" {
+			translated[sourceID] = true
+		}
+		if _, ok := current[sourceID]; ok && current[sourceID].ID == page.ID {
+			continue
+		}
+		entry := StalePage{PageID: page.ID, SourceID: sourceID}
+		switch src := findPage(sources, sourceID); {
+		case src == nil:
+			entry.Reason = StaleRemoved
+		case page.Source == nil:
+			entry.Reason, entry.SourceUpdatedAt = StaleUntracked, src.UpdatedAt
+		case page.Source.Hash == "":
+			entry.Reason, entry.SourceUpdatedAt = StaleIncomplete, src.UpdatedAt
+		default:
+			entry.Reason, entry.SourceUpdatedAt = StaleChanged, src.UpdatedAt
+		}
+		stale = append(stale, entry)
+	}
+	for _, src := range sources {
+		if !translated[src.ID] {
+			stale = append(stale, StalePage{SourceID: src.ID, Reason: StaleMissing, SourceUpdatedAt: src.UpdatedAt})
+		}
+	}
+	return stale
+}
+
+// upToDatePages 返回译文仍然有效的翻译页面，按源页面ID索引
+func upToDatePages(sources []models.WikiPage, trans *models.WikiTrans) map[string]models.WikiPage {
+	hashes := make(map[string]string, len(sources))
+	for _, page := range sources {
+		hashes[page.ID] = sourceHash(page)
+	}
+	current := make(map[string]models.WikiPage)
+	for _, page := range trans.Pages {
+		if page.Source != nil && page.Source.Hash != "" && hashes[page.Source.PageID] == page.Source.Hash {
+			current[page.Source.PageID] = page
+		}
+	}
+	return current
+}
+
+// sourcePageID 返回翻译页面的源页面ID：优先使用记录的源页面，没有记录时按页面ID推断
+func sourcePageID(sources []models.WikiPage, page models.WikiPage, language string) string {
+	if page.Source != nil {
+		return page.Source.PageID
+	}
+	for _, src := range sources {
+		if translatedPageID(src, language) == page.ID {
+			return src.ID
+		}
+	}
+	return ""
+}
+
+// findPage 按ID查找页面，不存在时返回nil
+func findPage(pages []models.WikiPage, id string) *models.WikiPage {
+	for i := range pages {
+		if id != "" && pages[i].ID == id {
+			return &pages[i]
+		}
+	}
+	return nil
+}
+
+// sourceHash 计算源页面标题和内容的哈希，忽略首尾空白，存储后重新加载的页面哈希不变
+func sourceHash(page models.WikiPage) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(page.Title) + "\n" + strings.TrimSpace(page.Content)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// translateWiki 翻译wiki。previous 不为空时保留其中仍然有效的页面，只翻译其余页面，
+// 返回翻译结果和翻译的页面数
+func (wg *WikiGenerator) translateWiki(ctx context.Context, wiki *models.Wiki, language string, glossary []string, previous *models.WikiTrans) (*models.WikiTrans, int, error) {
+	source, pages := translationSource(wiki)
+	if language == source {
+		return nil, 0, fmt.Errorf("%s: %w", language, ErrSameLanguage)
+	}
+	if containsString(wiki.Languages, language) {
+		return nil, 0, fmt.Errorf("%s: %w", language, ErrGeneratedLanguage)
+	}
+	if len(pages) == 0 {
+		return nil, 0, fmt.Errorf("wiki %s 没有可翻译的页面", wiki.ID)
+	}
+
+	// 保留仍然有效的译文，其余源页面需要翻译
+	var current map[string]models.WikiPage
+	if previous != nil {
+		if len(stalePages(pages, previous)) == 0 {
+			return previous, 0, nil
+		}
+		current = upToDatePages(pages, previous)
+	}
+	var pending []models.WikiPage
+	for _, page := range pages {
+		if _, ok := current[page.ID]; !ok {
+			pending = append(pending, page)
+		}
+	}
+
+	terms := append([]string(nil), glossary...)
+	for term := range wiki.Settings.Glossary {
+		if !containsString(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+	t := &translator{
+		wg:       wg,
+		wikiID:   wiki.ID,
+		settings: wiki.Settings,
+		source:   source,
+		language: language,
+		terms:    terms,
+		pageIDs:  make(map[string]string, len(pages)),
+	}
+	for _, page := range pages {
+		t.pageIDs[page.ID] = translatedPageID(page, language)
+	}
+
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:  wiki.ID,
+		Level:   models.LogLevelInfo,
+		Step:    models.LogStepTranslate,
+		Message: fmt.Sprintf("开始翻译: %s -> %s, %d/%d 个页面", source, language, len(pending), len(pages)),
+	})
+	start := time.Now()
+
+	// 标题、描述和图表说明一次批量翻译
+	texts := []string{wiki.Title, wiki.Description}
+	for _, page := range pending {
+		texts = append(texts, page.Title)
+	}
+	for _, diagram := range wiki.Diagrams {
+		texts = append(texts, diagram.Title, diagram.Description)
+	}
+	texts, err := t.translateLines(ctx, texts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("翻译标题失败: %w", err)
+	}
+
+	now := time.Now()
+	trans := &models.WikiTrans{
+		Language:    language,
+		Title:       texts[0],
+		Description: texts[1],
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if previous != nil && !previous.CreatedAt.IsZero() {
+		trans.CreatedAt = previous.CreatedAt
+	}
+	titles := make(map[string]string, len(pending))
+	for i, page := range pending {
+		titles[page.ID] = texts[2+i]
+	}
+	for _, page := range pages {
+		translated, ok := current[page.ID]
+		if !ok {
+			kept := t.kept
+			content, err := t.translateMarkdown(ctx, page.Content)
+			if err != nil {
+				return nil, 0, fmt.Errorf("翻译页面 %s 失败: %w", page.ID, err)
+			}
+			translated = page
+			translated.ID = t.pageIDs[page.ID]
+			translated.Key = pageKey(page)
+			translated.Language = language
+			translated.Title = titles[page.ID]
+			translated.Content = content
+			translated.WordCount = len(content)
+			translated.ReadingTime = wg.calculateReadingTime(content)
+			translated.CreatedAt = now
+			translated.UpdatedAt = now
+			translated.Source = &models.TranslationSource{PageID: page.ID, Hash: sourceHash(page), UpdatedAt: page.UpdatedAt}
+
+			if t.kept > kept {
+				// 不记录源页面哈希，页面保持过期，下次重新翻译过期页面时再翻译
+				translated.Source.Hash = ""
+				wg.sendLog(models.WikiLogEntry{
+					WikiID:  wiki.ID,
+					Level:   models.LogLevelWarning,
+					Step:    models.LogStepTranslate,
+					Message: fmt.Sprintf("页面翻译不完整: %s (%s), %d 段保留原文，页面保持过期", translated.Title, language, t.kept-kept),
+				})
+			} else {
+				wg.sendLog(models.WikiLogEntry{
+					WikiID:  wiki.ID,
+					Level:   models.LogLevelSuccess,
+					Step:    models.LogStepTranslate,
+					Message: fmt.Sprintf("页面翻译完成: %s (%s)", translated.Title, language),
+				})
+			}
+		}
+		// 层级按源页面的当前层级设置，保留的页面也可能被移动
+		translated.Type = page.Type
+		translated.Order = page.Order
+		translated.ParentID = t.pageID(page.ParentID)
+		translated.Children = make([]string, len(page.Children))
+		for j, child := range page.Children {
+			translated.Children[j] = t.pageID(child)
+		}
+		trans.Pages = append(trans.Pages, translated)
+	}
+
+	offset := 2 + len(pending)
+	for i, diagram := range wiki.Diagrams {
+		translated := diagram
+		translated.Title = texts[offset+2*i]
+		translated.Description = texts[offset+2*i+1]
+		translated.PageID = t.pageID(diagram.PageID)
+		translated.UpdatedAt = now
+		trans.Diagrams = append(trans.Diagrams, translated)
+	}
+
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:     wiki.ID,
+		Level:      models.LogLevelSuccess,
+		Step:       models.LogStepTranslate,
+		Message:    fmt.Sprintf("翻译完成: %s, 翻译 %d 个页面, 共 %d 个页面, %d 次请求", language, len(pending), len(trans.Pages), t.requests),
+		Duration:   time.Since(start).Round(time.Millisecond).String(),
+		TokensUsed: t.tokens,
+	})
+	return trans, len(pending), nil
+}
+
+// translator 保存一次翻译的设置和统计
+type translator struct {
+	wg       *WikiGenerator
+	wikiID   string
+	settings models.WikiSettings
+	source   string
+	language string
+	terms    []string
+	pageIDs  map[string]string // 主语言页面ID -> 翻译后的页面ID
+
+	requests int
+	tokens   int
+	kept     int // 翻译失败、保留原文的块数
+}
+
+// pageID 返回页面翻译后的ID，不在翻译范围内的页面保持原ID
+func (t *translator) pageID(id string) string {
+	if translated, ok := t.pageIDs[id]; ok {
+		return translated
+	}
+	return id
+}
+
+// translateMarkdown 翻译一个页面的Markdown内容：原样保留的段落不发送给模型，其余文本按段落分块翻译
+func (t *translator) translateMarkdown(ctx context.Context, content string) (string, error) {
+	var b strings.Builder
+	for _, segment := range splitMarkdown(content) {
+		if segment.verbatim || strings.TrimSpace(segment.text) == "" {
+			b.WriteString(segment.text)
+			continue
+		}
+		for _, chunk := range chunkMarkdown(segment.text, translateChunkSize) {
+			translated, err := t.translateChunk(ctx, chunk)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(translated)
+		}
+	}
+	return b.String(), nil
+}
+
+// translateChunk 翻译一块文本。行内代码和链接目标替换为占位符，译文缺少占位符时重试，
+// 仍然缺少时保留原文，避免丢失代码和链接，并记录警告日志
+func (t *translator) translateChunk(ctx context.Context, chunk string) (string, error) {
+	// 保留块首尾的空白，模型通常会去掉它们
+	body := strings.TrimSpace(chunk)
+	if body == "" {
+		return chunk, nil
+	}
+	leading := chunk[:len(chunk)-len(strings.TrimLeft(chunk, " \t\r\n"))]
+	trailing := chunk[len(leading)+len(body):]
+
+	protected, values := t.protect(body)
+	prompt := t.prompt("Translate the Markdown below", protected)
+	var lastErr error
+	for attempt := 1; attempt <= translateAttempts; attempt++ {
+		translated, err := t.generate(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		restored, err := restorePlaceholders(translated, values)
+		if err == nil {
+			return leading + restored + trailing, nil
+		}
+		lastErr = err
+		log.Printf("译文无效 (尝试 %d/%d): %v", attempt, translateAttempts, err)
+	}
+	log.Printf("保留原文: %v", lastErr)
+	t.kept++
+	t.wg.sendLog(models.WikiLogEntry{
+		WikiID:  t.wikiID,
+		Level:   models.LogLevelWarning,
+		Step:    models.LogStepTranslate,
+		Message: fmt.Sprintf("译文缺少占位符，保留原文 (%s)", t.language),
+		Error:   lastErr.Error(),
+	})
+	return chunk, nil
+}
+
+// translateLines 批量翻译短文本，空文本和模型漏掉的行保留原文
+func (t *translator) translateLines(ctx context.Context, texts []string) ([]string, error) {
+	result := append([]string(nil), texts...)
+	var b strings.Builder
+	for i, text := range texts {
+		if text = strings.TrimSpace(text); text != "" {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, strings.ReplaceAll(text, "\n", " "))
+		}
+	}
+	if b.Len() == 0 {
+		return result, nil
+	}
+
+	prompt := t.prompt("Translate each numbered line below. Return the same numbers, one line each, as `N. translation`", b.String())
+	translated, err := t.generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(translated, "\n") {
+		match := numberedLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(match[1])
+		if n >= 1 && n <= len(result) && strings.TrimSpace(texts[n-1]) != "" && strings.TrimSpace(match[2]) != "" {
+			result[n-1] = strings.TrimSpace(match[2])
+		}
+	}
+	return result, nil
+}
+
+// prompt 生成翻译提示词
+func (t *translator) prompt(task, text string) string {
+	names := t.wg.templateManager
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s from %s (%s) into %s (%s).\n\nRules:\n", task,
+		names.languageName(t.source), t.source, names.languageName(t.language), t.language)
+	b.WriteString("- Translate the prose only. Keep the Markdown structure: headings, lists, tables and emphasis.\n")
+	b.WriteString("- Keep every placeholder such as ⟦0⟧ exactly as it is; they stand for code and link targets.\n")
+	b.WriteString("- Keep code identifiers, file paths, commands and product names unchanged.\n")
+	if len(t.terms) > 0 {
+		fmt.Fprintf(&b, "- Do not translate these terms: %s.\n", strings.Join(t.terms, ", "))
+	}
+	b.WriteString("- Return only the translation, without notes and without wrapping it in a code block.\n\n")
+	b.WriteString(text)
+	return b.String()
+}
+
+// generate 调用模型并记录请求数和Token消耗
+func (t *translator) generate(ctx context.Context, prompt string) (string, error) {
+	content, stats, err := t.wg.generateContentWithAIStats(ctx, prompt, t.settings)
+	if err != nil {
+		return "", err
+	}
+	t.requests++
+	t.tokens += stats.TokensUsed
+	return unwrapCodeFence(content), nil
+}
+
+// protect 把行内代码和链接目标替换为占位符，返回替换后的文本和被替换的内容。
+// 指向主语言页面的链接改为指向翻译后的页面
+func (t *translator) protect(text string) (string, []string) {
+	var values []string
+	protected := protectPattern.ReplaceAllStringFunc(text, func(match string) string {
+		prefix := ""
+		if strings.HasPrefix(match, "](") {
+			prefix, match = "]", match[1:]
+			if target := strings.TrimPrefix(match, "(#page-"); target != match {
+				id, rest := target, ""
+				if i := strings.IndexAny(target, " )"); i >= 0 {
+					id, rest = target[:i], target[i:]
+				}
+				match = "(#page-" + t.pageID(id) + rest
+			}
+		}
+		values = append(values, match)
+		return fmt.Sprintf("%s⟦%d⟧", prefix, len(values)-1)
+	})
+	return protected, values
+}
+
+// restorePlaceholders 还原占位符，缺少或多出占位符时返回错误
+func restorePlaceholders(text string, values []string) (string, error) {
+	seen := make([]bool, len(values))
+	var unknown []string
+	restored := placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		n, _ := strconv.Atoi(placeholderPattern.FindStringSubmatch(match)[1])
+		if n >= len(values) {
+			unknown = append(unknown, match)
+			return match
+		}
+		seen[n] = true
+		return values[n]
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholders %s", strings.Join(unknown, ", "))
+	}
+	for n, ok := range seen {
+		if !ok {
+			return "", fmt.Errorf("placeholder ⟦%d⟧ for %q is missing", n, values[n])
+		}
+	}
+	return restored, nil
+}
+
+// splitMarkdown 把Markdown切分为需要翻译的文本和原样保留的 front matter 与围栏代码块（包括Mermaid图表）
+func splitMarkdown(content string) []markdownSegment {
+	lines := strings.SplitAfter(content, "\n")
+	var segments []markdownSegment
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			segments = append(segments, markdownSegment{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	i := 0
+	if len(lines) > 0 && strings.TrimRight(lines[0], "\r\n") == "---" {
+		for j := 1; j < len(lines); j++ {
+			if strings.TrimRight(lines[j], "\r\n") == "---" {
+				segments = append(segments, markdownSegment{text: strings.Join(lines[:j+1], ""), verbatim: true})
+				i = j + 1
+				break
+			}
+		}
+	}
+
+	for i < len(lines) {
+		fence := codeFenceMarker(lines[i])
+		if fence == "" {
+			text.WriteString(lines[i])
+			i++
+			continue
+		}
+		// 代码块到相同字符、长度不短于开头的围栏结束，没有结束围栏时保留到文末
+		flush()
+		end := len(lines)
+		for j := i + 1; j < len(lines); j++ {
+			closing := strings.TrimSpace(lines[j])
+			if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+				end = j + 1
+				break
+			}
+		}
+		segments = append(segments, markdownSegment{text: strings.Join(lines[i:end], ""), verbatim: true})
+		i = end
+	}
+	flush()
+	return segments
+}
+
+// codeFenceMarker 返回代码块开头的围栏（``` 或 ~~~，可以更长），不是围栏时返回空
+func codeFenceMarker(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return ""
+	}
+	for _, c := range []string{"`", "~"} {
+		n := len(trimmed) - len(strings.TrimLeft(trimmed, c))
+		if n >= 3 {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+// chunkMarkdown 按空行把文本切分为不超过 size 个字符的块，超长的段落单独成块
+func chunkMarkdown(text string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+	for _, paragraph := range strings.SplitAfter(text, "\n\n") {
+		if current.Len() > 0 && current.Len()+len(paragraph) > size {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		current.WriteString(paragraph)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// unwrapCodeFence 去掉模型给整个回答加上的代码块围栏
+func unwrapCodeFence(content string) string {
+	trimmed := strings.TrimSpace(content)
+	fence := codeFenceMarker(trimmed)
+	if fence == "" || !strings.HasSuffix(trimmed, fence) {
+		return content
+	}
+	first := strings.Index(trimmed, "\n")
+	if first < 0 || len(trimmed)-len(fence) <= first {
+		return content
+	}
+	return strings.TrimSpace(trimmed[first+1 : len(trimmed)-len(fence)])
+}
+
+// translatedPageID 返回页面翻译后的ID，与源页面共享同一个key
+func translatedPageID(page models.WikiPage, language string) string {
+	return models.PageID(pageKey(page), language)
+}
+
+// pageKey 返回页面的key，没有记录key的页面使用其ID
+func pageKey(page models.WikiPage) string {
+	if page.Key != "" {
+		return page.Key
+	}
+	return page.ID
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/stcn52/kwiki/internal/ai"
+	"github.com/stcn52/kwiki/internal/analyzer"
 	"github.com/stcn52/kwiki/internal/config"
 	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
 )
 
 // RepositoryInfo 仓库信息
@@ -20,6 +23,9 @@ type RepositoryInfo struct {
 	Description string
 	Topics      []string
 	Framework   string
+	Ref         string       // 固定的分支、标签或提交，空表示默认分支
+	CommitSHA   string       // 解析出的提交SHA
+	Modules     []ModuleData // 分析出的代码模块，未分析代码结构时为空
 }
 
 // RepositoryDocumentationData 仓库文档数据
@@ -36,6 +42,7 @@ type WikiGenerator struct {
 	aiManager       *ai.ProviderManager
 	templateManager *TemplateManager
 	progressChan    chan models.GenerationProgress
+	logChan         chan models.WikiLogEntry
 }
 
 // New 创建新的WikiGenerator实例
@@ -52,6 +59,7 @@ func New(cfg *config.Config, aiManager *ai.ProviderManager) *WikiGenerator {
 		aiManager:       aiManager,
 		templateManager: NewTemplateManager(generatorConfig),
 		progressChan:    make(chan models.GenerationProgress, 100),
+		logChan:         make(chan models.WikiLogEntry, 500),
 	}
 }
 
@@ -59,13 +67,53 @@ func New(cfg *config.Config, aiManager *ai.ProviderManager) *WikiGenerator {
 func (wg *WikiGenerator) GenerateWiki(ctx context.Context, req models.GenerationRequest) (*models.Wiki, error) {
 	log.Printf("开始生成wiki文档，仓库: %s", req.RepositoryURL)
 
+	req = prepareRequest(req)
+
+	wiki := wg.newWiki(req)
+
+	// 创建独立的上下文用于异步生成，不依赖于HTTP请求的上下文
+	backgroundCtx := context.Background()
+
+	// 启动异步生成过程
+	go wg.generateWikiAsync(backgroundCtx, wiki, req)
+
+	return wiki, nil
+}
+
+// GenerateWikiSync 同步生成wiki文档，生成结束（成功或失败）后返回，供命令行使用。
+// 进度和日志仍通过 GetProgressChannel / GetLogChannel 发送，ctx取消时生成中止
+func (wg *WikiGenerator) GenerateWikiSync(ctx context.Context, req models.GenerationRequest) (*models.Wiki, error) {
+	log.Printf("开始生成wiki文档，仓库: %s", req.RepositoryURL)
+
+	req = prepareRequest(req)
+
+	wiki := wg.newWiki(req)
+	wg.generateWikiAsync(ctx, wiki, req)
+
+	if wiki.Status == models.WikiStatusFailed {
+		return wiki, fmt.Errorf("wiki generation failed: %s", wiki.ID)
+	}
+	return wiki, nil
+}
+
+// newWiki 根据生成请求创建处于生成中状态的wiki实例
+func (wg *WikiGenerator) newWiki(req models.GenerationRequest) *models.Wiki {
 	// 生成基于包路径的目录结构
 	packagePath := generatePackagePath(req.RepositoryURL)
 
+	// 固定版本的Wiki以 包路径@版本 作为ID，同一仓库可以同时保存多个版本
+	ref := req.Ref
+	if ref == "" {
+		ref = req.Branch
+	}
+
 	// 自动生成title和description（如果未提供）
 	title := req.Title
 	if title == "" {
 		title = generateWikiTitle(req.RepositoryURL, packagePath)
+		if ref != "" {
+			title = fmt.Sprintf("%s (%s)", title, ref)
+		}
 	}
 
 	description := req.Description
@@ -75,7 +123,7 @@ func (wg *WikiGenerator) GenerateWiki(ctx context.Context, req models.Generation
 
 	// 创建wiki实例
 	wiki := &models.Wiki{
-		ID:           packagePath, // 使用包路径作为ID
+		ID:           utils.VersionedPackagePath(packagePath, ref), // 使用包路径（和版本）作为ID
 		RepositoryID: req.RepositoryURL,
 		PackagePath:  packagePath,
 		Title:        title,
@@ -95,16 +143,12 @@ func (wg *WikiGenerator) GenerateWiki(ctx context.Context, req models.Generation
 			Languages:     req.Languages,
 			PackagePath:   packagePath,
 			RepositoryURL: req.RepositoryURL,
+			Ref:           ref,
+			// 私有仓库的令牌只在本次生成中使用
+			RequiresAccessToken: req.AccessToken != "",
 		},
 	}
-
-	// 创建独立的上下文用于异步生成，不依赖于HTTP请求的上下文
-	backgroundCtx := context.Background()
-
-	// 启动异步生成过程
-	go wg.generateWikiAsync(backgroundCtx, wiki, req)
-
-	return wiki, nil
+	return wiki
 }
 
 // generateWikiAsync 异步生成wiki内容
@@ -113,6 +157,7 @@ func (wg *WikiGenerator) generateWikiAsync(ctx context.Context, wiki *models.Wik
 		if r := recover(); r != nil {
 			log.Printf("Wiki生成过程中发生panic: %v", r)
 			wiki.Status = models.WikiStatusFailed
+			wg.sendProgress(wiki.ID, models.WikiStatusFailed, wiki.Progress, "生成失败", "生成过程中发生内部错误", fmt.Errorf("panic: %v", r))
 		}
 	}()
 
@@ -127,6 +172,16 @@ func (wg *WikiGenerator) generateWikiAsync(ctx context.Context, wiki *models.Wik
 	}
 
 	wiki.Metadata.GenerationTime = time.Since(startTime)
+
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:     wiki.ID,
+		Level:      models.LogLevelInfo,
+		Step:       models.LogStepComplete,
+		Message:    fmt.Sprintf("生成结束，状态: %s，页面数: %d", wiki.Status, len(wiki.Pages)),
+		Duration:   wiki.Metadata.GenerationTime.Round(time.Millisecond).String(),
+		Progress:   wiki.Progress,
+		TokensUsed: wiki.Metadata.TokensUsed,
+	})
 }
 
 // generateTemplateDocumentation 生成模板系统文档
@@ -201,18 +256,85 @@ func (wg *WikiGenerator) generateRepositoryDocumentation(ctx context.Context, wi
 	// 发送初始进度
 	wg.sendProgress(wiki.ID, models.WikiStatusAnalyzing, 10, "分析仓库", "正在分析仓库结构...", nil)
 
+	// 解析固定的版本，记录生成时的提交SHA
+	analyzeStart := time.Now()
+	ref := wiki.Metadata.Ref
+	sha, err := analyzer.New(wg.config).ResolveRef(ctx, req.RepositoryURL, ref, req.AccessToken)
+	switch {
+	case err != nil && ref != "":
+		log.Printf("解析版本 %s 失败: %v", ref, err)
+		wiki.Status = models.WikiStatusFailed
+		wg.sendProgress(wiki.ID, models.WikiStatusFailed, 0, "分析失败", fmt.Sprintf("无法解析版本 %s", ref), err)
+		return
+	case err != nil:
+		// 未指定版本时解析失败不影响生成
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:  wiki.ID,
+			Level:   models.LogLevelWarning,
+			Step:    models.LogStepAnalyze,
+			Message: "无法解析默认分支的提交",
+			Error:   err.Error(),
+		})
+	default:
+		wiki.Metadata.CommitSHA = sha
+	}
+
+	// 合并仓库自带的 .kwiki.yaml，优先读取解析出的提交
+	configRef := ref
+	if sha != "" {
+		configRef = sha
+	}
+	wg.applyRepoConfig(ctx, wiki, &req, configRef)
+
 	// 分析仓库信息
-	repoInfo, err := wg.analyzeRepository(req.RepositoryURL)
+	repoInfo, err := wg.analyzeRepository(req.RepositoryURL, req.Settings)
 	if err != nil {
 		log.Printf("分析仓库失败: %v", err)
 		wiki.Status = models.WikiStatusFailed
 		wg.sendProgress(wiki.ID, models.WikiStatusFailed, 0, "分析失败", "仓库分析失败", err)
 		return
 	}
+	repoInfo.Ref = ref
+	repoInfo.CommitSHA = wiki.Metadata.CommitSHA
+
+	// 启用AI大纲或模块参考页面时分析代码结构，分析失败时只按模板规划页面
+	var structure *models.CodeStructure
+	if req.Settings.PlanOutline || req.Settings.ModulePages {
+		structure, err = wg.analyzeCodeStructure(ctx, req, configRef)
+		if err != nil {
+			log.Printf("分析代码结构失败: %v", err)
+			wg.sendLog(models.WikiLogEntry{
+				WikiID:  wiki.ID,
+				Level:   models.LogLevelWarning,
+				Step:    models.LogStepAnalyze,
+				Message: "代码结构分析失败，只按模板规划页面",
+				Error:   err.Error(),
+			})
+		} else {
+			repoInfo.Modules = templateModules(structure)
+			wg.sendLog(models.WikiLogEntry{
+				WikiID:     wiki.ID,
+				Level:      models.LogLevelInfo,
+				Step:       models.LogStepAnalyze,
+				Message:    fmt.Sprintf("代码结构分析完成: %d 个模块", len(structure.Modules)),
+				FilesCount: len(structure.Files),
+			})
+		}
+	}
 
 	log.Printf("仓库分析完成: %s (%s)", repoInfo.Name, repoInfo.Language)
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:   wiki.ID,
+		Level:    models.LogLevelSuccess,
+		Step:     models.LogStepAnalyze,
+		Message:  fmt.Sprintf("仓库分析完成: %s (%s)", repoInfo.Name, repoInfo.Language),
+		Duration: time.Since(analyzeStart).Round(time.Millisecond).String(),
+	})
 	wg.sendProgress(wiki.ID, models.WikiStatusGenerating, 30, "生成文档", "开始生成文档页面...", nil)
 
+	// AI大纲只按主语言规划一次，其他语言沿用相同的页面标识和层级
+	outline := wg.repositoryOutline(ctx, wiki, repoInfo, structure, wiki.Language, req.Settings)
+
 	// 为每种语言生成文档页面
 	totalLanguages := len(req.Languages)
 	for i, language := range req.Languages {
@@ -224,7 +346,7 @@ func (wg *WikiGenerator) generateRepositoryDocumentation(ctx context.Context, wi
 		progress := 30 + (60 * i / totalLanguages)
 		wg.sendProgress(wiki.ID, models.WikiStatusGenerating, progress, "生成页面", fmt.Sprintf("正在生成%s语言的页面", language), nil)
 
-		err := wg.generateRepositoryPagesForLanguage(ctx, wiki, repoInfo, language, req.Settings)
+		err := wg.generateRepositoryPagesForLanguage(ctx, wiki, repoInfo, structure, outline, language, req.Settings)
 		if err != nil {
 			log.Printf("生成%s语言仓库文档失败: %v", language, err)
 			wg.sendProgress(wiki.ID, models.WikiStatusGenerating, progress, "生成失败", fmt.Sprintf("生成%s语言失败", language), err)
@@ -273,15 +395,36 @@ func (wg *WikiGenerator) generatePagesForLanguage(ctx context.Context, wiki *mod
 	var allStats []*PageGenerationStats
 
 	for i, tmpl := range templates {
+		// 大纲规划和模块参考专用的模板需要代码结构，不生成页面
+		if tmpl.Metadata.Category == TemplateCategoryOutline || tmpl.Metadata.Category == TemplateCategoryModule {
+			continue
+		}
 		log.Printf("处理模板 %d/%d: %s (类型: %s)", i+1, len(templates), tmpl.Metadata.Title, tmpl.Metadata.Type)
 
 		page, stats, err := wg.generatePageFromTemplate(ctx, tmpl, templateData, language, settings)
 		if err != nil {
 			log.Printf("使用模板 %s 生成页面失败: %v", tmpl.Metadata.Title, err)
+			wg.sendLog(models.WikiLogEntry{
+				WikiID:  wiki.ID,
+				Level:   models.LogLevelError,
+				Step:    models.LogStepPage,
+				Message: fmt.Sprintf("页面生成失败: %s (%s)", tmpl.Metadata.Title, language),
+				Error:   err.Error(),
+			})
 			continue
 		}
 
 		wiki.Pages = append(wiki.Pages, *page)
+		wiki.Metadata.TokensUsed += stats.TokensUsed
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:     wiki.ID,
+			Level:      models.LogLevelSuccess,
+			Step:       models.LogStepPage,
+			Message:    fmt.Sprintf("页面生成完成: %s (%s)", page.Title, language),
+			Details:    fmt.Sprintf("model=%s finish_reason=%s chars=%d", stats.Model, stats.FinishReason, stats.ContentLength),
+			Duration:   stats.GenerationTime.Round(time.Millisecond).String(),
+			TokensUsed: stats.TokensUsed,
+		})
 		allStats = append(allStats, stats)
 		successCount++
 
@@ -340,21 +483,29 @@ func (wg *WikiGenerator) generatePageFromTemplate(ctx context.Context, tmpl *Tem
 		License:         "MIT",
 		Language:        language,
 		Modules:         []ModuleData{}, // 模板文档不需要代码模块信息
+		Vars:            settings.Variables,
 	}
 
 	log.Printf("模板数据准备完成: 项目名=%s, 描述=%s, 语言=%s",
 		templateData.ProjectName, templateData.Description, templateData.Language)
 
-	// 渲染模板生成AI提示词
+	// 渲染模板生成AI提示词，模板系统文档专用的模板使用完整的模板统计数据
 	log.Printf("开始渲染模板: %s", tmpl.Metadata.Title)
 	var promptBuilder strings.Builder
-	err := tmpl.Template.Execute(&promptBuilder, templateData)
-	if err != nil {
+	var promptData interface{} = templateData
+	if tmpl.Metadata.Category == TemplateCategoryTemplateDocs {
+		promptData = data
+	}
+	if err := tmpl.Template.Execute(&promptBuilder, promptData); err != nil {
 		log.Printf("渲染模板失败: %s, 错误: %v", tmpl.Metadata.Title, err)
 		return nil, nil, fmt.Errorf("渲染模板失败: %w", err)
 	}
 
-	prompt := promptBuilder.String()
+	prompt, err := applyCustomPrompts(promptBuilder.String(), settings.CustomPrompts, pagePromptKeys(tmpl.Metadata.Type, tmpl.Name), promptData)
+	if err != nil {
+		return nil, nil, err
+	}
+	prompt += wg.templateManager.LanguageInstruction(tmpl, language)
 	log.Printf("模板渲染完成: %s, 提示词长度: %d", tmpl.Metadata.Title, len(prompt))
 
 	// 使用AI生成内容并记录统计
@@ -367,7 +518,9 @@ func (wg *WikiGenerator) generatePageFromTemplate(ctx context.Context, tmpl *Tem
 
 	// 创建页面
 	page := &models.WikiPage{
-		ID:          fmt.Sprintf("%s_%s", tmpl.Metadata.Type, language),
+		ID:          models.PageID(tmpl.Name, language),
+		Key:         tmpl.Name,
+		Language:    language,
 		Title:       tmpl.Metadata.Title,
 		Content:     content,
 		Type:        wg.getPageType(tmpl.Metadata.Type),
@@ -610,11 +763,55 @@ func (wg *WikiGenerator) logLanguageStats(language string, stats []*PageGenerati
 	log.Printf("=== 统计结束 ===")
 }
 
+// Templates 返回生成器使用的模板管理器
+func (wg *WikiGenerator) Templates() *TemplateManager {
+	return wg.templateManager
+}
+
 // GetProgressChannel 返回进度通道
 func (wg *WikiGenerator) GetProgressChannel() <-chan models.GenerationProgress {
 	return wg.progressChan
 }
 
+// GetLogChannel 返回结构化日志通道
+func (wg *WikiGenerator) GetLogChannel() <-chan models.WikiLogEntry {
+	return wg.logChan
+}
+
+// sendLog 发送结构化日志
+func (wg *WikiGenerator) sendLog(entry models.WikiLogEntry) {
+	if wg.logChan == nil {
+		return
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.Level == "" {
+		entry.Level = models.LogLevelInfo
+	}
+
+	// 非阻塞发送
+	select {
+	case wg.logChan <- entry:
+	default:
+		log.Printf("Warning: Log channel is full, dropping entry")
+	}
+}
+
+// logStepForStatus 将生成状态映射为日志步骤
+func logStepForStatus(status models.WikiStatus) string {
+	switch status {
+	case models.WikiStatusPending:
+		return models.LogStepSetup
+	case models.WikiStatusAnalyzing:
+		return models.LogStepAnalyze
+	case models.WikiStatusCompleted, models.WikiStatusFailed:
+		return models.LogStepComplete
+	default:
+		return models.LogStepGenerate
+	}
+}
+
 // sendProgress 发送进度更新
 func (wg *WikiGenerator) sendProgress(wikiID string, status models.WikiStatus, progress int, step string, message string, err error) {
 	progressUpdate := models.GenerationProgress{
@@ -630,6 +827,23 @@ func (wg *WikiGenerator) sendProgress(wikiID string, status models.WikiStatus, p
 		progressUpdate.Error = err.Error()
 	}
 
+	// 普通的进度更新已由各步骤的日志记录，只有失败和错误需要补记一条结构化日志
+	if status == models.WikiStatusFailed || err != nil {
+		entry := models.WikiLogEntry{
+			WikiID:   wikiID,
+			Level:    models.LogLevelWarning,
+			Step:     logStepForStatus(status),
+			Message:  message,
+			Details:  step,
+			Progress: progress,
+			Error:    progressUpdate.Error,
+		}
+		if status == models.WikiStatusFailed {
+			entry.Level = models.LogLevelError
+		}
+		wg.sendLog(entry)
+	}
+
 	// 非阻塞发送
 	select {
 	case wg.progressChan <- progressUpdate:
@@ -647,6 +861,8 @@ func (wg *WikiGenerator) getPageType(templateType string) models.PageType {
 		return models.PageTypeGuide
 	case "reference":
 		return models.PageTypeReference
+	case "api":
+		return models.PageTypeAPI
 	case "architecture":
 		return models.PageTypeArchitecture
 	default:
@@ -686,23 +902,19 @@ func generatePackagePath(repositoryURL string) string {
 		return "template-docs/example"
 	}
 
-	// 解析GitHub/GitLab URL
-	if strings.Contains(repositoryURL, "github.com") {
-		// https://github.com/gin-gonic/gin -> github.com/gin-gonic/gin
-		parts := strings.Split(repositoryURL, "/")
-		if len(parts) >= 5 {
-			owner := parts[len(parts)-2]
-			repo := strings.TrimSuffix(parts[len(parts)-1], ".git")
-			return fmt.Sprintf("github.com/%s/%s", owner, repo)
-		}
-	} else if strings.Contains(repositoryURL, "gitlab.com") {
-		// https://gitlab.com/owner/repo -> gitlab.com/owner/repo
-		parts := strings.Split(repositoryURL, "/")
-		if len(parts) >= 5 {
-			owner := parts[len(parts)-2]
-			repo := strings.TrimSuffix(parts[len(parts)-1], ".git")
-			return fmt.Sprintf("gitlab.com/%s/%s", owner, repo)
+	// 本地目录使用go.mod中的模块路径，没有go.mod时使用 local/<目录名>
+	if dir, ok := analyzer.LocalPath(repositoryURL); ok {
+		if modulePath := analyzer.ReadModulePath(dir); modulePath != "" {
+			return modulePath
 		}
+		return "local/" + filepath.Base(dir)
+	}
+
+	// 解析Git远程地址：HTTPS、SSH（git@host:org/repo.git）、自建主机和嵌套分组
+	// https://github.com/gin-gonic/gin -> github.com/gin-gonic/gin
+	// git@gitlab.example.com:group/sub/repo.git -> gitlab.example.com/group/sub/repo
+	if remote, err := utils.ParseRepositoryURL(repositoryURL); err == nil {
+		return remote.PackagePath()
 	}
 
 	// 如果无法解析，使用URL的hash作为目录名
@@ -710,38 +922,32 @@ func generatePackagePath(repositoryURL string) string {
 }
 
 // analyzeRepository 分析仓库信息
-func (wg *WikiGenerator) analyzeRepository(repoURL string) (*RepositoryInfo, error) {
+// settings 中的包含/排除规则合并到 repository 配置
+func (wg *WikiGenerator) analyzeRepository(repoURL string, settings models.WikiSettings) (*RepositoryInfo, error) {
 	log.Printf("分析仓库: %s", repoURL)
 
+	// 本地目录直接遍历，不需要克隆
+	if dir, ok := analyzer.LocalPath(repoURL); ok {
+		return wg.analyzeLocalRepository(dir, settings)
+	}
+
 	// 从URL中提取仓库信息
 	repoInfo := &RepositoryInfo{
 		URL: repoURL,
 	}
 
-	// 解析GitHub/GitLab URL
-	if strings.Contains(repoURL, "github.com") {
-		parts := strings.Split(repoURL, "/")
-		if len(parts) >= 5 {
-			owner := parts[len(parts)-2]
-			repo := strings.TrimSuffix(parts[len(parts)-1], ".git")
-			repoInfo.Name = fmt.Sprintf("%s/%s", owner, repo)
-		}
-		repoInfo.Language = "Go" // 假设是Go项目
+	// 解析远程地址，支持任意Git主机和嵌套分组
+	remote, err := utils.ParseRepositoryURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("不支持的仓库类型: %s: %w", repoURL, err)
+	}
+	repoInfo.Name = remote.Path
+	repoInfo.Language = "Go" // 假设是Go项目
+	repoInfo.Framework = "Application"
+	if remote.Host == "github.com" {
 		repoInfo.Framework = "Web Framework"
-		repoInfo.Description = fmt.Sprintf("Documentation for %s", repoInfo.Name)
-	} else if strings.Contains(repoURL, "gitlab.com") {
-		parts := strings.Split(repoURL, "/")
-		if len(parts) >= 5 {
-			owner := parts[len(parts)-2]
-			repo := strings.TrimSuffix(parts[len(parts)-1], ".git")
-			repoInfo.Name = fmt.Sprintf("%s/%s", owner, repo)
-		}
-		repoInfo.Language = "Go"
-		repoInfo.Framework = "Application"
-		repoInfo.Description = fmt.Sprintf("Documentation for %s", repoInfo.Name)
-	} else {
-		return nil, fmt.Errorf("不支持的仓库类型: %s", repoURL)
 	}
+	repoInfo.Description = fmt.Sprintf("Documentation for %s", repoInfo.Name)
 
 	if repoInfo.Name == "" {
 		repoInfo.Name = "Unknown Repository"
@@ -751,33 +957,98 @@ func (wg *WikiGenerator) analyzeRepository(repoURL string) (*RepositoryInfo, err
 	return repoInfo, nil
 }
 
-// generateRepositoryPagesForLanguage 为指定语言生成仓库页面
-func (wg *WikiGenerator) generateRepositoryPagesForLanguage(ctx context.Context, wiki *models.Wiki, repoInfo *RepositoryInfo, language string, settings models.WikiSettings) error {
+// analyzeLocalRepository 分析本地目录，名称取自go.mod的模块路径
+func (wg *WikiGenerator) analyzeLocalRepository(dir string, settings models.WikiSettings) (*RepositoryInfo, error) {
+	cfg := *wg.config
+	cfg.Repository = analyzer.RepositoryConfig(wg.config.Repository, settings)
+	repo, err := analyzer.New(&cfg).AnalyzeLocalDirectory(context.Background(), dir)
+	if err != nil {
+		return nil, err
+	}
+
+	repoInfo := &RepositoryInfo{
+		Name:        generatePackagePath(dir),
+		URL:         repo.URL,
+		Language:    "Unknown",
+		Framework:   "Application",
+		Description: repo.Description,
+	}
+	if len(repo.Languages) > 0 {
+		repoInfo.Language = repo.Languages[0]
+	}
+	if analyzer.ReadModulePath(dir) != "" {
+		repoInfo.Language = "Go"
+		repoInfo.Framework = "Go Module"
+	}
+	if repoInfo.Description == "" {
+		repoInfo.Description = fmt.Sprintf("Documentation for %s", repoInfo.Name)
+	}
+
+	log.Printf("仓库分析完成: %s (本地目录 %s, %d 个文件)", repoInfo.Name, dir, repo.FileCount)
+	return repoInfo, nil
+}
+
+// generateRepositoryPagesForLanguage 为指定语言生成仓库页面，页面规划来自模板集或AI规划的大纲
+func (wg *WikiGenerator) generateRepositoryPagesForLanguage(ctx context.Context, wiki *models.Wiki, repoInfo *RepositoryInfo, structure *models.CodeStructure, outline *Outline, language string, settings models.WikiSettings) error {
 	log.Printf("开始为语言 %s 生成仓库页面", language)
 
-	// 定义要生成的页面类型
-	pageTypes := []struct {
-		Type  models.PageType
-		Title string
-		Order int
-	}{
-		{models.PageTypeOverview, getLocalizedTitle("项目概述", "Project Overview", language), 1},
-		{models.PageTypeGuide, getLocalizedTitle("快速开始", "Getting Started", language), 2},
-		{models.PageTypeGuide, getLocalizedTitle("安装指南", "Installation Guide", language), 3},
-		{models.PageTypeAPI, getLocalizedTitle("API参考", "API Reference", language), 4},
-		{models.PageTypeArchitecture, getLocalizedTitle("架构设计", "Architecture", language), 5},
+	plans, err := wg.pagePlans(wiki, structure, outline, language, settings)
+	if err != nil {
+		return err
+	}
+	titles := make([]string, 0, len(plans))
+	var fallbacks []string
+	for _, plan := range plans {
+		titles = append(titles, plan.Title)
+		if plan.Template.Language != language {
+			fallbacks = append(fallbacks, fmt.Sprintf("%s (%s)", plan.Template.Name, plan.Template.Language))
+		}
+	}
+	wg.sendLog(models.WikiLogEntry{
+		WikiID:  wiki.ID,
+		Level:   models.LogLevelInfo,
+		Step:    models.LogStepGenerate,
+		Message: fmt.Sprintf("页面规划 (%s): %d 个页面", language, len(plans)),
+		Details: strings.Join(titles, ", "),
+	})
+	// 没有该语言版本的模板使用回退语言的模板，并在提示词中要求用目标语言撰写
+	if len(fallbacks) > 0 {
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:  wiki.ID,
+			Level:   models.LogLevelInfo,
+			Step:    models.LogStepGenerate,
+			Message: fmt.Sprintf("%d 个页面没有 %s 模板，使用回退语言的模板", len(fallbacks), language),
+			Details: strings.Join(fallbacks, ", "),
+		})
 	}
 
-	// 为每种页面类型生成内容
+	// 按规划逐个生成页面
 	successCount := 0
-	for _, pageType := range pageTypes {
-		page, err := wg.generateRepositoryPage(ctx, repoInfo, pageType.Type, pageType.Title, language, pageType.Order, settings)
+	for _, plan := range plans {
+		page, stats, err := wg.generateRepositoryPage(ctx, repoInfo, plan, language, settings)
 		if err != nil {
-			log.Printf("生成页面失败: %s, 错误: %v", pageType.Title, err)
+			log.Printf("生成页面失败: %s, 错误: %v", plan.Title, err)
+			wg.sendLog(models.WikiLogEntry{
+				WikiID:  wiki.ID,
+				Level:   models.LogLevelError,
+				Step:    models.LogStepPage,
+				Message: fmt.Sprintf("页面生成失败: %s (%s)", plan.Title, language),
+				Error:   err.Error(),
+			})
 			continue
 		}
 
 		wiki.Pages = append(wiki.Pages, *page)
+		wiki.Metadata.TokensUsed += stats.TokensUsed
+		wg.sendLog(models.WikiLogEntry{
+			WikiID:     wiki.ID,
+			Level:      models.LogLevelSuccess,
+			Step:       models.LogStepPage,
+			Message:    fmt.Sprintf("页面生成完成: %s (%s)", page.Title, language),
+			Details:    fmt.Sprintf("template=%s model=%s finish_reason=%s chars=%d", plan.Template.Name, stats.Model, stats.FinishReason, len(page.Content)),
+			Duration:   stats.GenerationTime.Round(time.Millisecond).String(),
+			TokensUsed: stats.TokensUsed,
+		})
 		successCount++
 		log.Printf("页面生成成功: %s (%s)", page.Title, page.ID)
 	}
@@ -786,33 +1057,44 @@ func (wg *WikiGenerator) generateRepositoryPagesForLanguage(ctx context.Context,
 		return fmt.Errorf("语言 %s 的所有页面生成都失败了", language)
 	}
 
-	log.Printf("语言 %s 成功生成 %d/%d 个页面", language, successCount, len(pageTypes))
+	log.Printf("语言 %s 成功生成 %d/%d 个页面", language, successCount, len(plans))
 
 	return nil
 }
 
-// generateRepositoryPage 生成单个仓库页面
-func (wg *WikiGenerator) generateRepositoryPage(ctx context.Context, repoInfo *RepositoryInfo, pageType models.PageType, title, language string, order int, settings models.WikiSettings) (*models.WikiPage, error) {
-	log.Printf("生成页面: %s (%s)", title, pageType)
-
-	// 生成页面ID
-	pageID := fmt.Sprintf("%s_%s", strings.ToLower(strings.ReplaceAll(title, " ", "-")), language)
+// generateRepositoryPage 按页面规划生成单个仓库页面，提示词由规划中的模板渲染
+func (wg *WikiGenerator) generateRepositoryPage(ctx context.Context, repoInfo *RepositoryInfo, plan PagePlan, language string, settings models.WikiSettings) (*models.WikiPage, *AIGenerationStats, error) {
+	log.Printf("生成页面: %s (%s, 模板 %s)", plan.Title, plan.Type, plan.Template.Name)
 
-	// 根据页面类型生成提示词
-	prompt := wg.generateRepositoryPagePrompt(repoInfo, pageType, title, language)
+	// 渲染模板生成提示词
+	var promptBuilder strings.Builder
+	data := repositoryTemplateData(repoInfo, language, settings)
+	// 模块参考页面只介绍自己的模块
+	if len(plan.Modules) > 0 {
+		data.Modules = plan.Modules
+	}
+	data.Page = plan.Page
+	if err := plan.Template.Template.Execute(&promptBuilder, data); err != nil {
+		return nil, nil, fmt.Errorf("渲染模板 %s 失败: %w", plan.Template.Name, err)
+	}
+	prompt, err := applyCustomPrompts(promptBuilder.String(), settings.CustomPrompts, pagePromptKeys(string(plan.Type), plan.Template.Name), data)
+	if err != nil {
+		return nil, nil, err
+	}
+	prompt += wg.templateManager.LanguageInstruction(plan.Template, language) + writingGuidelines(settings, language)
 
 	// 使用AI生成内容，带重试机制
 	var content string
-	var err error
+	var stats *AIGenerationStats
 	maxRetries := 3
 
 	for retry := 0; retry < maxRetries; retry++ {
 		if retry > 0 {
-			log.Printf("第 %d 次重试生成页面: %s", retry+1, title)
+			log.Printf("第 %d 次重试生成页面: %s", retry+1, plan.Title)
 			time.Sleep(time.Duration(retry) * time.Second) // 递增延迟
 		}
 
-		content, _, err = wg.generateContentWithAIStats(ctx, prompt, settings)
+		content, stats, err = wg.generateContentWithAIStats(ctx, prompt, settings)
 		if err == nil {
 			break
 		}
@@ -821,85 +1103,47 @@ func (wg *WikiGenerator) generateRepositoryPage(ctx context.Context, repoInfo *R
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("AI生成内容失败 (已重试 %d 次): %w", maxRetries, err)
+		return nil, nil, fmt.Errorf("AI生成内容失败 (已重试 %d 次): %w", maxRetries, err)
+	}
+
+	title := plan.Title
+	if plan.TitleFromContent {
+		if heading := firstHeading(content); heading != "" {
+			title = heading
+		}
+	}
+	if plan.Footer != "" {
+		content = strings.TrimRight(content, "\n") + "\n\n" + plan.Footer
 	}
 
 	// 创建页面对象
 	page := &models.WikiPage{
-		ID:          pageID,
+		ID:          plan.ID,
+		Key:         plan.Key,
+		Language:    language,
 		Title:       title,
 		Content:     content,
-		Type:        pageType,
-		Order:       order,
+		Type:        plan.Type,
+		Order:       plan.Order,
+		ParentID:    plan.ParentID,
+		Children:    plan.Children,
 		WordCount:   len(content),
 		ReadingTime: wg.calculateReadingTime(content),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	return page, nil
-}
-
-// generateRepositoryPagePrompt 生成仓库页面的提示词
-func (wg *WikiGenerator) generateRepositoryPagePrompt(repoInfo *RepositoryInfo, pageType models.PageType, title, language string) string {
-	var prompt strings.Builder
-
-	// 根据语言设置基础提示
-	if language == "zh" {
-		prompt.WriteString("你是一个专业的技术文档编写专家。请为以下项目生成高质量的中文技术文档。\n\n")
-	} else {
-		prompt.WriteString("You are a professional technical documentation expert. Please generate high-quality English technical documentation for the following project.\n\n")
-	}
-
-	// 项目信息
-	prompt.WriteString("项目信息 / Project Information:\n")
-	prompt.WriteString(fmt.Sprintf("- 名称 / Name: %s\n", repoInfo.Name))
-	prompt.WriteString(fmt.Sprintf("- URL: %s\n", repoInfo.URL))
-	prompt.WriteString(fmt.Sprintf("- 语言 / Language: %s\n", repoInfo.Language))
-	prompt.WriteString(fmt.Sprintf("- 框架 / Framework: %s\n", repoInfo.Framework))
-	prompt.WriteString(fmt.Sprintf("- 描述 / Description: %s\n\n", repoInfo.Description))
-
-	// 页面类型提示
-	if language == "zh" {
-		prompt.WriteString(fmt.Sprintf("请生成一个详细的%s文档，标题为\"%s\"。\n", getPageTypeNameZh(pageType), title))
-	} else {
-		prompt.WriteString(fmt.Sprintf("Please generate a detailed %s document titled \"%s\".\n", getPageTypeNameEn(pageType), title))
-	}
-
-	prompt.WriteString("\n请使用Markdown格式，包含适当的标题、代码块、列表等格式。确保内容专业、准确、易于理解。")
-	prompt.WriteString("\nPlease use Markdown format with appropriate headings, code blocks, lists, etc. Ensure the content is professional, accurate, and easy to understand.")
-
-	return prompt.String()
+	return page, stats, nil
 }
 
-// getPageTypeNameZh 获取页面类型的中文名称
-func getPageTypeNameZh(pageType models.PageType) string {
-	nameMap := map[models.PageType]string{
-		models.PageTypeOverview:     "项目概述",
-		models.PageTypeGuide:        "使用指南",
-		models.PageTypeAPI:          "API参考",
-		models.PageTypeArchitecture: "架构设计",
-	}
-
-	if name, exists := nameMap[pageType]; exists {
-		return name
-	}
-	return "技术文档"
-}
-
-// getPageTypeNameEn 获取页面类型的英文名称
-func getPageTypeNameEn(pageType models.PageType) string {
-	nameMap := map[models.PageType]string{
-		models.PageTypeOverview:     "project overview",
-		models.PageTypeGuide:        "user guide",
-		models.PageTypeAPI:          "API reference",
-		models.PageTypeArchitecture: "architecture design",
-	}
-
-	if name, exists := nameMap[pageType]; exists {
-		return name
+// firstHeading 返回Markdown中第一个一级标题的文本，没有时返回空
+func firstHeading(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if heading, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+			return strings.TrimSpace(heading)
+		}
 	}
-	return "technical documentation"
+	return ""
 }
 
 // generateWikiTitle 从仓库URL和包路径生成wiki标题
@@ -924,11 +1168,3 @@ func generateWikiDescription(repositoryURL, packagePath string) string {
 	}
 	return fmt.Sprintf("Documentation for %s", packagePath)
 }
-
-// getLocalizedTitle 获取本地化标题
-func getLocalizedTitle(zhTitle, enTitle, language string) string {
-	if language == "zh" {
-		return zhTitle
-	}
-	return enTitle
-}
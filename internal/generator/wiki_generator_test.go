@@ -3,10 +3,15 @@ package generator
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/stcn52/kwiki/internal/ai"
@@ -252,3 +257,849 @@ func TestGeneratorConfig(t *testing.T) {
 		t.Errorf("Expected template dir 'templates/prompts', got %s", config.TemplateDir)
 	}
 }
+
+// TestLocalRepository 本地目录以go.mod中的模块路径作为Wiki ID
+func TestLocalRepository(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/acme/tool\n\ngo 1.22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{dir, "file://" + filepath.ToSlash(dir)} {
+		if got := generatePackagePath(input); got != "example.com/acme/tool" {
+			t.Errorf("generatePackagePath(%q) = %q, want module path", input, got)
+		}
+	}
+	if got := generatePackagePath("https://github.com/gin-gonic/gin"); got != "github.com/gin-gonic/gin" {
+		t.Errorf("remote URL package path = %q", got)
+	}
+
+	wg := New(config.Default(), ai.NewProviderManager())
+	info, err := wg.analyzeRepository(dir, models.WikiSettings{})
+	if err != nil {
+		t.Fatalf("analyzeRepository: %v", err)
+	}
+	if info.Name != "example.com/acme/tool" || info.Language != "Go" {
+		t.Errorf("repository info = %+v", info)
+	}
+
+	if _, err := wg.analyzeRepository(filepath.Join(dir, "missing"), models.WikiSettings{}); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+// TestPlanRepositoryPages 仓库页面的列表、顺序和提示词来自模板集
+func TestPlanRepositoryPages(t *testing.T) {
+	wg := &WikiGenerator{templateManager: NewTemplateManager(&GeneratorConfig{
+		ReadingSpeed: 200,
+		TemplateDir:  "../../templates/prompts",
+	})}
+
+	plans, err := wg.planRepositoryPages("zh", models.WikiSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, plan := range plans {
+		names = append(names, plan.Template.Name)
+	}
+	if got := strings.Join(names, ","); got != "readme,getting-started,installation,architecture,api-reference" {
+		t.Errorf("zh plan = %s, want template order without template-docs templates", got)
+	}
+	if plans[0].ID != "readme_zh" || plans[0].Title != "项目说明" || plans[4].Type != models.PageTypeAPI {
+		t.Errorf("plan pages = %+v, %+v", plans[0], plans[4])
+	}
+
+	plans, err = wg.planRepositoryPages("en", models.WikiSettings{Templates: []string{"api-reference", "readme.md"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 2 || plans[0].Template.Name != "readme" || plans[1].Template.Name != "api-reference" {
+		t.Errorf("selected plan = %+v, want readme then api-reference", plans)
+	}
+
+	var prompt strings.Builder
+	repoInfo := &RepositoryInfo{Name: "github.com/acme/tool", Language: "Go", Ref: "v1.2.0", CommitSHA: "abc1234",
+		Modules: templateModules(&models.CodeStructure{Modules: []models.Module{{Name: "httpserver", Path: "internal/server"}}})}
+	if err := plans[0].Template.Template.Execute(&prompt, repositoryTemplateData(repoInfo, "en", models.WikiSettings{})); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt.String(), "- Project Name: github.com/acme/tool") ||
+		!strings.Contains(prompt.String(), "- Version: v1.2.0 (commit abc1234)\n- Primary Language: Go") {
+		t.Errorf("rendered prompt lacks project or version:\n%s", prompt.String())
+	}
+	if !strings.Contains(prompt.String(), "- httpserver:") {
+		t.Errorf("rendered prompt lacks the analyzed modules:\n%s", prompt.String())
+	}
+
+	if _, err := wg.planRepositoryPages("en", models.WikiSettings{Templates: []string{"changelog"}}); err == nil {
+		t.Error("expected error for unknown template")
+	}
+}
+
+// TestApplyRepoConfig 仓库的 .kwiki.yaml 合并到设置，请求未指定语言时使用其中的语言
+func TestApplyRepoConfig(t *testing.T) {
+	dir := t.TempDir()
+	repoConfig := "pages: [readme]\naudience: operators\nglossary: {node: a cluster member}\nlanguages: [en, zh]\n" +
+		"diagrams:\n  - title: Topology\n    page: architecture\n    content: \"flowchart TD\\n  A --> B\"\n"
+	if err := os.WriteFile(filepath.Join(dir, ".kwiki.yaml"), []byte(repoConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := New(config.Default(), ai.NewProviderManager())
+	req := models.GenerationRequest{RepositoryURL: dir, Settings: models.WikiSettings{Tone: "casual"}}
+	wiki := wg.newWiki(req)
+	wg.applyRepoConfig(context.Background(), wiki, &req, "")
+	first := wiki
+
+	if strings.Join(wiki.Languages, ",") != "en,zh" || wiki.Language != "en" {
+		t.Errorf("languages = %v, primary %s", wiki.Languages, wiki.Language)
+	}
+	if len(wiki.Settings.Templates) != 1 || wiki.Settings.Audience != "operators" || wiki.Settings.Tone != "casual" {
+		t.Errorf("settings = %+v", wiki.Settings)
+	}
+	if len(wiki.Diagrams) != 1 || wiki.Diagrams[0].PageID != "architecture_en" || wiki.Diagrams[0].Type != models.DiagramTypeFlowchart {
+		t.Errorf("diagrams = %+v", wiki.Diagrams)
+	}
+
+	guidelines := writingGuidelines(req.Settings, "zh")
+	if !strings.Contains(guidelines, "- 目标读者: operators") || !strings.Contains(guidelines, "  - node: a cluster member") {
+		t.Errorf("guidelines = %s", guidelines)
+	}
+
+	// 请求中显式指定的语言优先
+	req = models.GenerationRequest{RepositoryURL: dir, Languages: []string{"zh"}, PrimaryLanguage: "zh"}
+	wiki = wg.newWiki(req)
+	wg.applyRepoConfig(context.Background(), wiki, &req, "")
+	if strings.Join(wiki.Languages, ",") != "zh" || wiki.Diagrams[0].PageID != "architecture_zh" {
+		t.Errorf("explicit languages = %v, diagram page %s", wiki.Languages, wiki.Diagrams[0].PageID)
+	}
+
+	// 重新生成时以请求设置为准重新合并，仓库配置的修改生效
+	requested := first.Metadata.RequestSettings
+	if requested == nil || requested.Audience != "" || requested.Tone != "casual" || len(requested.Glossary) != 0 || !first.Metadata.RepoConfigLanguages {
+		t.Fatalf("request settings = %+v", requested)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".kwiki.yaml"), []byte("pages: [readme, architecture]\naudience: developers\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req = models.GenerationRequest{RepositoryURL: dir, Settings: *requested}
+	wiki = wg.newWiki(req)
+	wg.applyRepoConfig(context.Background(), wiki, &req, "")
+	if len(wiki.Settings.Templates) != 2 || wiki.Settings.Audience != "developers" || len(wiki.Settings.Glossary) != 0 {
+		t.Errorf("regenerated settings = %+v", wiki.Settings)
+	}
+}
+
+// scriptedProvider 按提示词返回预设回复的AI提供商，并记录收到的提示词
+type scriptedProvider struct {
+	respond func(prompt string) string
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (p *scriptedProvider) GetName() string     { return "scripted" }
+func (p *scriptedProvider) GetModels() []string { return []string{"scripted"} }
+func (p *scriptedProvider) IsAvailable() bool   { return true }
+func (p *scriptedProvider) GetUsage() ai.Usage  { return ai.Usage{} }
+
+func (p *scriptedProvider) GenerateText(ctx context.Context, prompt string, options ai.GenerationOptions) (*ai.GenerationResponse, error) {
+	return &ai.GenerationResponse{Text: p.reply(prompt), TokensUsed: 10, Model: options.Model}, nil
+}
+
+func (p *scriptedProvider) GenerateStream(ctx context.Context, prompt string, options ai.GenerationOptions) (<-chan ai.StreamResponse, error) {
+	ch := make(chan ai.StreamResponse, 2)
+	ch <- ai.StreamResponse{Text: p.reply(prompt)}
+	ch <- ai.StreamResponse{Done: true, TokensUsed: 10}
+	close(ch)
+	return ch, nil
+}
+
+func (p *scriptedProvider) reply(prompt string) string {
+	p.mu.Lock()
+	p.prompts = append(p.prompts, prompt)
+	p.mu.Unlock()
+	return p.respond(prompt)
+}
+
+// newScriptedGenerator 创建使用仓库模板和脚本化AI提供商的生成器
+func newScriptedGenerator(provider *scriptedProvider) *WikiGenerator {
+	manager := ai.NewProviderManager()
+	manager.RegisterProvider("scripted", provider)
+	wg := New(config.Default(), manager)
+	wg.templateManager = NewTemplateManager(&GeneratorConfig{ReadingSpeed: 200, TemplateDir: "../../templates/prompts"})
+	return wg
+}
+
+// TestValidateOutline 大纲按格式校验，slug和类型被规范化
+func TestValidateOutline(t *testing.T) {
+	modules := map[string]ModuleData{"server": {Path: "server"}, "root": {Path: "root"}}
+	outline, err := parseOutline("Here is the outline:\n```json\n" + `{"sections": [
+		{"title": "Getting Started", "pages": [{"slug": "Install Guide", "title": "Install", "modules": ["root"]}]},
+		{"slug": "internals", "title": "Internals", "pages": [
+			{"slug": "server", "title": "Server", "type": "module", "modules": ["server"], "children": [
+				{"slug": "routing", "title": "Routing", "type": "guide"}]}]}]}` + "\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateOutline(outline, modules, 3, 10); err != nil {
+		t.Fatal(err)
+	}
+	if outline.Sections[0].Slug != "getting-started" || outline.Sections[0].Pages[0].Slug != "install-guide" ||
+		outline.Sections[0].Pages[0].Type != "guide" {
+		t.Errorf("normalized outline = %+v", outline.Sections[0])
+	}
+
+	plans := outlinePlans(outline, "en", nil, modules)
+	var ids []string
+	for _, plan := range plans {
+		ids = append(ids, plan.ID)
+	}
+	if strings.Join(ids, ",") != "getting-started_en,install-guide_en,internals_en,server_en,routing_en" {
+		t.Errorf("plan order = %v", ids)
+	}
+	if plans[3].ParentID != "internals_en" || strings.Join(plans[3].Children, ",") != "routing_en" ||
+		plans[4].ParentID != "server_en" || plans[4].Page.Parent != "Server" || len(plans[3].Modules) != 1 {
+		t.Errorf("hierarchy = %+v", plans[2:])
+	}
+	if strings.Join(plans[2].Children, ",") != "server_en" || plans[2].Type != models.PageTypeOverview || plans[4].Order != 4 {
+		t.Errorf("section plan = %+v", plans[2])
+	}
+
+	for name, outlineJSON := range map[string]string{
+		"unknown module": `{"sections": [{"title": "A", "pages": [{"title": "B", "modules": ["client"]}, {"title": "C"}]}]}`,
+		"duplicate slug": `{"sections": [{"title": "A", "pages": [{"title": "B"}, {"title": "b"}]}]}`,
+		"unknown type":   `{"sections": [{"title": "A", "pages": [{"title": "B", "type": "blog"}, {"title": "C"}]}]}`,
+		"too deep":       `{"sections": [{"title": "A", "pages": [{"title": "B", "children": [{"title": "C", "children": [{"title": "D"}]}]}]}]}`,
+		"too few pages":  `{"sections": [{"title": "A", "pages": [{"title": "B"}]}]}`,
+		"empty section":  `{"sections": [{"title": "A", "pages": []}, {"title": "B", "pages": [{"title": "C"}]}]}`,
+		"no slug":        `{"sections": [{"title": "概览", "pages": [{"title": "B"}, {"title": "C"}]}]}`,
+	} {
+		outline, err := parseOutline(outlineJSON)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := validateOutline(outline, modules, 3, 10); err == nil {
+			t.Errorf("%s: outline accepted", name)
+		}
+	}
+	if _, err := parseOutline("I cannot plan this project."); err == nil {
+		t.Error("expected error for a reply without JSON")
+	}
+}
+
+// TestPlanOutline 模型根据代码结构规划大纲，校验失败时带着错误重新规划，页面按层级生成。
+// 大纲只按主语言规划一次，其他语言沿用相同的页面标识和层级
+func TestPlanOutline(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":           "module example.com/acme/tool\n\ngo 1.22\n",
+		"main.go":          "package main\n\nfunc main() {}\n",
+		"server/server.go": "package server\n\ntype Server struct{}\n\nfunc NewServer(addr string) *Server { return nil }\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plans := 0
+	provider := &scriptedProvider{respond: func(prompt string) string {
+		if strings.Contains(prompt, "- 标题: ") {
+			return "# 页面"
+		}
+		if !strings.Contains(prompt, "Wiki Outline Planning Prompt") {
+			return "# Page"
+		}
+		plans++
+		if plans == 1 {
+			return `{"sections": [{"title": "Overview", "pages": [{"title": "Client", "modules": ["client"]}]}]}`
+		}
+		return `{"sections": [
+			{"slug": "start", "title": "Getting Started", "pages": [{"slug": "usage", "title": "Usage", "modules": ["root"]}]},
+			{"slug": "internals", "title": "Internals", "pages": [{"slug": "server", "title": "Server", "type": "module", "modules": ["server"]}]}]}`
+	}}
+	wg := newScriptedGenerator(provider)
+
+	wiki, err := wg.GenerateWikiSync(context.Background(), models.GenerationRequest{
+		RepositoryURL:   dir,
+		Languages:       []string{"en", "zh"},
+		PrimaryLanguage: "en",
+		Settings:        models.WikiSettings{AIProvider: "scripted", PlanOutline: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, page := range wiki.Pages {
+		ids = append(ids, page.ID)
+	}
+	if strings.Join(ids, ",") != "start_en,usage_en,internals_en,server_en,start_zh,usage_zh,internals_zh,server_zh" {
+		t.Fatalf("pages = %v", ids)
+	}
+	if wiki.Pages[3].ParentID != "internals_en" || strings.Join(wiki.Pages[2].Children, ",") != "server_en" {
+		t.Errorf("hierarchy: %+v", wiki.Pages)
+	}
+	if wiki.Pages[7].ParentID != "internals_zh" || strings.Join(wiki.Pages[6].Children, ",") != "server_zh" {
+		t.Errorf("zh hierarchy: %+v", wiki.Pages[4:])
+	}
+	// 主语言页面使用大纲的标题，其他语言的标题取自生成内容
+	if wiki.Pages[0].Title != "Getting Started" || wiki.Pages[4].Title != "页面" {
+		t.Errorf("titles = %q, %q", wiki.Pages[0].Title, wiki.Pages[4].Title)
+	}
+
+	if plans != 2 || !strings.Contains(provider.prompts[0], "- server (Go, 1 files, ") ||
+		!strings.Contains(provider.prompts[0], "NewServer") || !strings.Contains(provider.prompts[1], "previous outline was rejected") {
+		t.Errorf("planning prompts:\n%s", strings.Join(provider.prompts[:2], "\n----\n"))
+	}
+	serverPrompt := provider.prompts[5] // 两次规划之后的第4个英文页面
+	if !strings.Contains(serverPrompt, "- Title: Server") || !strings.Contains(serverPrompt, "- Part of: Internals") ||
+		!strings.Contains(serverPrompt, "`func NewServer(addr string) *Server`") {
+		t.Errorf("page prompt:\n%s", serverPrompt)
+	}
+}
+
+// TestModulePages 每个有导出声明的模块生成一个API参考的子页面，方法较多的类型单独成页，签名和链接原样附加
+func TestModulePages(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/acme/tool\n\ngo 1.22\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+		"client/client.go": "package client\n\n// Conn is a connection.\ntype Conn struct{}\n\n" +
+			"// Dial connects to addr.\nfunc Dial(addr string) (*Conn, error) {\n\treturn nil, nil\n}\n",
+		"server/server.go": "package server\n\ntype Server struct{}\n\nfunc NewServer(addr string) *Server { return nil }\n\n" +
+			"func (s *Server) Start() error { return nil }\nfunc (s *Server) Stop() {}\nfunc (s *Server) Addr() string { return \"\" }\n" +
+			"func (s *Server) Handle(path string) {}\nfunc (s *Server) Use(m func()) {}\nfunc (s *Server) reset() {}\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider := &scriptedProvider{respond: func(prompt string) string { return "# Page\n" }}
+	wg := newScriptedGenerator(provider)
+
+	wiki, err := wg.GenerateWikiSync(context.Background(), models.GenerationRequest{
+		RepositoryURL: dir,
+		Languages:     []string{"en"},
+		Settings: models.WikiSettings{
+			AIProvider:  "scripted",
+			Templates:   []string{"readme", "api-reference"},
+			ModulePages: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	pages := make(map[string]models.WikiPage)
+	for i, page := range wiki.Pages {
+		ids = append(ids, page.ID)
+		pages[page.ID] = page
+		if page.Order != i {
+			t.Errorf("page %s order = %d, want %d", page.ID, page.Order, i)
+		}
+	}
+	if strings.Join(ids, ",") != "readme_en,api-reference_en,module-client_en,module-server_en,type-server-server_en" {
+		t.Fatalf("pages = %v", ids)
+	}
+
+	api, server, serverType := pages["api-reference_en"], pages["module-server_en"], pages["type-server-server_en"]
+	if strings.Join(api.Children, ",") != "module-client_en,module-server_en" ||
+		server.ParentID != "api-reference_en" || server.Type != models.PageTypeModule ||
+		strings.Join(server.Children, ",") != "type-server-server_en" ||
+		serverType.ParentID != "module-server_en" || serverType.Type != models.PageTypeClass {
+		t.Errorf("hierarchy: %+v", wiki.Pages)
+	}
+
+	for _, want := range []string{
+		"## Declarations\n\n```go\ntype Server struct{}\nfunc (s *Server) Start() error\n",
+		"func NewServer(addr string) *Server\n```",
+		"- [API Reference](#page-api-reference_en)",
+		"- [server.Server](#page-type-server-server_en)",
+		"- [client](#page-module-client_en)",
+	} {
+		if !strings.Contains(server.Content, want) {
+			t.Errorf("server page misses %q:\n%s", want, server.Content)
+		}
+	}
+	if strings.Contains(server.Content, "reset") || !strings.Contains(serverType.Content, "- [server](#page-module-server_en)") {
+		t.Errorf("type page:\n%s", serverType.Content)
+	}
+
+	var apiPrompt, clientPrompt string
+	for _, prompt := range provider.prompts {
+		switch {
+		case strings.Contains(prompt, "API Reference Generation Prompt"):
+			apiPrompt = prompt
+		case strings.Contains(prompt, "Declarations of `client`"):
+			clientPrompt = prompt
+		}
+	}
+	if !strings.Contains(apiPrompt, "- [server](#page-module-server_en)") {
+		t.Errorf("API reference prompt:\n%s", apiPrompt)
+	}
+	if !strings.Contains(clientPrompt, "- `func Dial(addr string) (*Conn, error)`: Dial connects to addr.") ||
+		!strings.Contains(clientPrompt, "- `type Conn struct{}`: Conn is a connection.") {
+		t.Errorf("client prompt:\n%s", clientPrompt)
+	}
+}
+
+// TestCustomPrompts 自定义提示词按键追加或替换模板提示词，请求中的提示词追加到所有页面，变量和模板函数可用
+func TestCustomPrompts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &scriptedProvider{respond: func(prompt string) string { return "# Page\n" }}
+	wg := newScriptedGenerator(provider)
+
+	_, err := wg.GenerateWikiSync(context.Background(), models.GenerationRequest{
+		RepositoryURL: dir,
+		Languages:     []string{"en"},
+		CustomPrompts: []string{"Follow the house style guide."},
+		Settings: models.WikiSettings{
+			AIProvider: "scripted",
+			Templates:  []string{"readme", "api-reference"},
+			Variables:  map[string]string{"product": "Acme Cloud"},
+			CustomPrompts: map[string]string{
+				"*":              "Always call the product {{.Vars.product}}.",
+				"api":            "Start with {{\"Endpoints and handlers\" | truncate 10}}, then {{.Vars.missing}}the types.",
+				"readme:replace": "Write a README for {{.Vars.product}}.\n{{code \"sh\" \"go install ./...\"}}",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var readme, api string
+	for _, prompt := range provider.prompts {
+		switch {
+		case strings.HasPrefix(prompt, "Write a README"):
+			readme = prompt
+		case strings.Contains(prompt, "API Reference Generation Prompt"):
+			api = prompt
+		}
+	}
+	if !strings.HasPrefix(readme, "Write a README for Acme Cloud.\n```sh\ngo install ./...\n```\n\n"+
+		"Always call the product Acme Cloud.\n\nFollow the house style guide.\n") {
+		t.Errorf("readme prompt:\n%s", readme)
+	}
+	if !strings.Contains(api, "\n\nAlways call the product Acme Cloud.\n\nFollow the house style guide.\n\n"+
+		"Start with Endpoints…, then the types.\n") {
+		t.Errorf("api prompt:\n%s", api)
+	}
+
+	if _, err := applyCustomPrompts("prompt", map[string]string{"*": "{{.Missing"}, pagePromptKeys("api", "api-reference"), TemplateData{}); err == nil ||
+		!strings.Contains(err.Error(), "*") {
+		t.Errorf("invalid custom prompt error = %v", err)
+	}
+}
+
+// TestValidateTemplate 仓库自带的模板都能通过校验，front matter 和引用的字段有误时列出所有问题
+func TestValidateTemplate(t *testing.T) {
+	tm := NewTemplateManager(&GeneratorConfig{ReadingSpeed: 200, TemplateDir: "../../templates/prompts"})
+	files, err := tm.ListTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no templates found")
+	}
+	for _, file := range files {
+		if len(file.Problems) > 0 {
+			t.Errorf("%s/%s: %v", file.Language, file.Name, file.Problems)
+		}
+	}
+
+	valid := "---\ntitle: Usage\ntype: guide\norder: 3\nvariables: [ProjectName, Modules]\n---\n" +
+		"# {{.ProjectName}}\n{{range .Modules}}{{.Path}} {{$.Language}}{{range .Types}}{{.Name}}{{end}}{{end}}\n" +
+		"{{with .Page}}{{.Title}}{{range .Links}}{{.Markdown}}{{end}}{{end}}{{if eq .Page.Type \"class\"}}x{{end}}\n"
+	if err := tm.ValidateTemplate("usage", valid); err != nil {
+		t.Errorf("valid template: %v", err)
+	}
+	plan := "---\ntitle: Plan\ntype: guide\norder: 900\ncategory: outline\n---\n{{.Structure}} {{.MinPages}} {{.ProjectName}}\n"
+	if err := tm.ValidateTemplate(outlinePlanTemplate, plan); err != nil {
+		t.Errorf("outline plan template: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"no front matter":  "# {{.ProjectName}}\n",
+		"unknown key":      "---\ntitle: A\ntype: guide\norder: 1\nweight: 2\n---\nbody\n",
+		"unknown type":     "---\ntitle: A\ntype: blog\norder: 1\n---\nbody\n",
+		"missing order":    "---\ntitle: A\ntype: guide\n---\nbody\n",
+		"unknown category": "---\ntitle: A\ntype: guide\norder: 1\ncategory: misc\n---\nbody\n",
+		"unknown variable": "---\ntitle: A\ntype: guide\norder: 1\nvariables: [ProjectNmae]\n---\nbody\n",
+		"unknown field":    "---\ntitle: A\ntype: guide\norder: 1\n---\n{{.Projectname}}\n",
+		"nested field":     "---\ntitle: A\ntype: guide\norder: 1\n---\n{{.Page.Titel}}\n",
+		"field in range":   "---\ntitle: A\ntype: guide\norder: 1\n---\n{{range .Modules}}{{.Functions}}{{.Signature}}{{end}}\n",
+		"outline field":    "---\ntitle: A\ntype: guide\norder: 1\n---\n{{.Structure}}\n",
+		"parse error":      "---\ntitle: A\ntype: guide\norder: 1\n---\n{{if .ProjectName}}\n",
+	} {
+		err := tm.ValidateTemplate("page", content)
+		var invalid *TemplateValidationError
+		if !errors.As(err, &invalid) || len(invalid.Problems) == 0 {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+
+	err = tm.ValidateTemplate("page", "---\ntitle: A\ntype: guide\norder: 1\n---\n{{.Page.Titel}}\n{{range .Modules}}{{.Signature}}{{end}}\n")
+	if err == nil || !strings.Contains(err.Error(), "page:1:7: PageData has no field Titel") ||
+		!strings.Contains(err.Error(), "ModuleData has no field Signature") {
+		t.Errorf("problems = %v", err)
+	}
+}
+
+// TestTemplateFuncs indent和truncate拒绝负数，indent的宽度有上限
+func TestTemplateFuncs(t *testing.T) {
+	render := func(text string) (string, error) {
+		tmpl, err := template.New("t").Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		err = tmpl.Execute(&b, "a\nb")
+		return b.String(), err
+	}
+
+	if out, err := render(`{{indent 2 .}}|{{truncate 0 .}}|{{truncate 2 "abc"}}`); err != nil || out != "  a\n  b|a\nb|a…" {
+		t.Errorf("render = %q, %v", out, err)
+	}
+	if out, err := render(`{{indent 1000000000 .}}`); err != nil || out != strings.Repeat(" ", maxIndent)+"a\n"+strings.Repeat(" ", maxIndent)+"b" {
+		t.Errorf("huge indent = %d bytes, %v", len(out), err)
+	}
+	for _, text := range []string{`{{indent -1 .}}`, `{{truncate -1 .}}`} {
+		if _, err := render(text); err == nil {
+			t.Errorf("%s: negative argument accepted", text)
+		}
+	}
+}
+
+// TestTemplateWatch 模板文件修改后被重新加载，保存时校验并使缓存失效
+func TestTemplateWatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "en"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "en", "usage.md")
+	if err := os.WriteFile(path, []byte("---\ntitle: Usage\ntype: guide\norder: 1\n---\nv1 {{.ProjectName}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTemplateManager(&GeneratorConfig{ReadingSpeed: 200, TemplateDir: dir})
+	if info, err := tm.LoadTemplateWithMetadata("en", "usage"); err != nil || !strings.HasPrefix(info.Content, "v1") {
+		t.Fatalf("first load = %+v, %v", info, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tm.Watch(ctx, 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	if err := os.WriteFile(path, []byte("---\ntitle: Usage\ntype: guide\norder: 1\n---\nversion 2 {{.ProjectName}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := tm.LoadTemplateWithMetadata("en", "usage")
+		if err == nil && strings.HasPrefix(info.Content, "version 2") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("template not reloaded: %+v, %v", info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := tm.SaveTemplate("en", "usage", "---\ntitle: Usage\ntype: guide\norder: 1\n---\n{{.Nope}}\n", false); err == nil {
+		t.Error("invalid template saved")
+	}
+	if err := tm.SaveTemplate("en", "usage", "---\ntitle: Usage\ntype: guide\norder: 1\n---\nv3\n", true); !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("create existing = %v", err)
+	}
+	if err := tm.SaveTemplate("en", "../usage", "---\ntitle: Usage\ntype: guide\norder: 1\n---\nv3\n", false); err == nil {
+		t.Error("path traversal accepted")
+	}
+	if err := tm.SaveTemplate("en", "usage", "---\ntitle: Usage\ntype: guide\norder: 1\n---\nv3\n", false); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := tm.LoadTemplateWithMetadata("en", "usage"); err != nil || info.Content != "v3\n" {
+		t.Errorf("after save = %+v, %v", info, err)
+	}
+
+	prompt, err := tm.RenderSample(context.Background(), "en", "usage", "---\ntitle: Usage\ntype: guide\norder: 1\n---\n{{.ProjectName}} {{(index .Modules 0).Path}}\n", []byte(`{"ProjectName": "acme"}`))
+	if err != nil || prompt != "acme internal/server\n" {
+		t.Errorf("RenderSample = %q, %v", prompt, err)
+	}
+
+	// 输出过大、数字过大、数据过大或已取消的示例渲染被中止
+	front := "---\ntitle: Usage\ntype: guide\norder: 1\n---\n"
+	for text, data := range map[string]string{
+		"{{range 1000}}{{range 1000}}{{$.ProjectName}}{{end}}{{end}}":     "",
+		"{{range 1000000000}}{{end}}":                                     "",
+		"{{$n := 1000000000}}{{range $n}}{{end}}":                         "",
+		`{{define "loop"}}{{range 1e9}}{{end}}{{end}}{{template "loop"}}`: "",
+		"{{.ProjectName}}": `{"ProjectName": "` + strings.Repeat("x", sampleDataLimit) + `"}`,
+	} {
+		if _, err := tm.RenderSample(context.Background(), "en", "usage", front+text, []byte(data)); !errors.Is(err, ErrSampleTooLarge) {
+			t.Errorf("%s: %v, want ErrSampleTooLarge", text, err)
+		}
+	}
+	canceled, cancelRender := context.WithCancel(context.Background())
+	cancelRender()
+	if _, err := tm.RenderSample(canceled, "en", "usage", front+"{{range 1000}}{{$.ProjectName}}{{end}}\n", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled render = %v", err)
+	}
+}
+
+// TestTemplateFallback 缺少模板的语言沿回退链使用其他语言的模板，并要求模型用目标语言回答
+func TestTemplateFallback(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml":        "templates:\n  languages:\n    en: English\n    zh: 中文\n    ja: 日本語\n  defaults:\n    fallback_language: en\n",
+		"en/readme.md":       "---\ntitle: README\ntype: overview\norder: 1\n---\nen readme\n",
+		"en/architecture.md": "---\ntitle: Architecture\ntype: architecture\norder: 2\n---\nen architecture\n",
+		"zh/readme.md":       "---\ntitle: 说明\ntype: overview\norder: 1\n---\nzh readme\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tm := NewTemplateManager(&GeneratorConfig{ReadingSpeed: 200, TemplateDir: dir})
+
+	if got := strings.Join(tm.GetSupportedLanguages(), ","); got != "en,zh,ja" {
+		t.Errorf("supported languages = %s", got)
+	}
+	if got := strings.Join(tm.FallbackChain("zh-TW"), ","); got != "zh-TW,zh,en" {
+		t.Errorf("fallback chain = %s", got)
+	}
+	if got, err := tm.GetAvailableTemplates("zh"); err != nil || strings.Join(got, ",") != "architecture,readme" {
+		t.Errorf("zh templates = %v, %v", got, err)
+	}
+
+	readme, err := tm.LoadTemplateWithMetadata("zh-TW", "readme")
+	if err != nil || readme.Language != "zh" || !strings.Contains(tm.LanguageInstruction(readme, "zh-TW"), "(zh-TW)") {
+		t.Errorf("zh-TW readme = %+v, %v", readme, err)
+	}
+	if readme, err := tm.LoadTemplateWithMetadata("zh", "readme"); err != nil || tm.LanguageInstruction(readme, "zh") != "" {
+		t.Errorf("zh readme = %+v, %v", readme, err)
+	}
+	architecture, err := tm.LoadTemplateWithMetadata("ja", "architecture")
+	if err != nil || architecture.Language != "en" ||
+		!strings.Contains(tm.LanguageInstruction(architecture, "ja"), "Write the entire response in 日本語 (ja)") {
+		t.Errorf("ja architecture = %+v, %v", architecture, err)
+	}
+	if _, err := tm.LoadTemplateWithMetadata("ja", "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing template error = %v", err)
+	}
+
+	// 仓库自带的模板集没有日文模板，日文Wiki使用英文模板生成
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &scriptedProvider{respond: func(prompt string) string { return "# ページ\n" }}
+	wiki, err := newScriptedGenerator(provider).GenerateWikiSync(context.Background(), models.GenerationRequest{
+		RepositoryURL: repo,
+		Languages:     []string{"ja"},
+		Settings:      models.WikiSettings{AIProvider: "scripted", Templates: []string{"readme"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wiki.Pages) != 1 || wiki.Pages[0].ID != "readme_ja" || len(provider.prompts) != 1 ||
+		!strings.Contains(provider.prompts[0], "README Page Generation Prompt (English)") ||
+		!strings.Contains(provider.prompts[0], "Write the entire response in 日本語 (ja)") {
+		t.Errorf("ja wiki pages = %+v, prompts = %q", wiki.Pages, provider.prompts)
+	}
+}
+
+// TestTranslateWiki 翻译保留代码块、Mermaid图表、front matter和链接目标，链接指向翻译后的页面。
+// 缺少占位符的段落保留原文，页面记录警告并保持过期
+func TestTranslateWiki(t *testing.T) {
+	provider := &scriptedProvider{respond: func(prompt string) string {
+		_, text, _ := strings.Cut(prompt, "without wrapping it in a code block.\n\n")
+		if strings.Contains(prompt, "numbered line") {
+			var b strings.Builder
+			for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+				n, title, _ := strings.Cut(line, ". ")
+				fmt.Fprintf(&b, "%s. 訳 %s\n", n, title)
+			}
+			return b.String()
+		}
+		if strings.Contains(text, "Broken") {
+			return placeholderPattern.ReplaceAllString("壊れた "+text, "")
+		}
+		return "```markdown\n" + strings.ReplaceAll(text, "Hello", "こんにちは") + "\n```"
+	}}
+	wg := newScriptedGenerator(provider)
+
+	content := "---\nauthor: Hello\n---\n# Hello\n\nHello `Server.Start` and [setup](#page-setup_en \"Hello\").\n\n" +
+		"```mermaid\ngraph TD\n  Hello --> World\n```\n\nBroken `code` stays.\n"
+	wiki := &models.Wiki{
+		ID:       "example",
+		Title:    "Hello",
+		Language: "en",
+		Settings: models.WikiSettings{AIProvider: "scripted", Language: "en", Glossary: map[string]string{"Kwiki": "the project"}},
+		Pages: []models.WikiPage{
+			{ID: "overview_en", Key: "overview", Language: "en", Title: "Overview", Content: content, Children: []string{"setup_en"}},
+			{ID: "setup_en", Key: "setup", Language: "en", Title: "Setup", Content: "Hello\n", ParentID: "overview_en"},
+			{ID: "overview_zh", Key: "overview", Language: "zh", Title: "概述", Content: "你好\n"},
+		},
+		Diagrams: []models.WikiDiagram{{ID: "d1", Title: "Flow", PageID: "overview_en"}},
+	}
+
+	if _, err := wg.TranslateWiki(context.Background(), wiki, "en", nil); !errors.Is(err, ErrSameLanguage) {
+		t.Errorf("same language error = %v", err)
+	}
+	wiki.Languages = []string{"en", "zh"}
+	if _, err := wg.TranslateWiki(context.Background(), wiki, "zh", nil); !errors.Is(err, ErrGeneratedLanguage) {
+		t.Errorf("generated language error = %v", err)
+	}
+	trans, err := wg.TranslateWiki(context.Background(), wiki, "ja", []string{"Gin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trans.Title != "訳 Hello" || len(trans.Pages) != 2 || len(trans.Diagrams) != 1 ||
+		trans.Diagrams[0].PageID != "overview_ja" || trans.Diagrams[0].Title != "訳 Flow" {
+		t.Fatalf("translation = %+v", trans)
+	}
+	overview, setup := trans.Pages[0], trans.Pages[1]
+	if overview.ID != "overview_ja" || overview.Title != "訳 Overview" || strings.Join(overview.Children, ",") != "setup_ja" ||
+		setup.ID != "setup_ja" || setup.ParentID != "overview_ja" || setup.Content != "こんにちは\n" {
+		t.Errorf("pages = %+v", trans.Pages)
+	}
+	want := "---\nauthor: Hello\n---\n# こんにちは\n\nこんにちは `Server.Start` and [setup](#page-setup_ja \"Hello\").\n\n" +
+		"```mermaid\ngraph TD\n  Hello --> World\n```\n\nBroken `code` stays.\n"
+	if overview.Content != want {
+		t.Errorf("content =\n%s\nwant\n%s", overview.Content, want)
+	}
+	if overview.Source == nil || overview.Source.Hash != "" || setup.Source == nil || setup.Source.Hash != sourceHash(wiki.Pages[1]) {
+		t.Errorf("sources = %+v, %+v", overview.Source, setup.Source)
+	}
+	warnings := 0
+	for len(wg.logChan) > 0 {
+		if entry := <-wg.logChan; entry.Level == models.LogLevelWarning && entry.Step == models.LogStepTranslate {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("warnings = %d, want one for the chunk and one for the page", warnings)
+	}
+	if stale := stalePages(wiki.Pages[:2], trans); len(stale) != 1 || stale[0].SourceID != "overview_en" || stale[0].Reason != StaleIncomplete {
+		t.Errorf("stale = %+v", stale)
+	}
+	if wiki.Pages[0].ID != "overview_en" || wiki.Translations != nil {
+		t.Errorf("the wiki was modified: %+v", wiki.Pages[0])
+	}
+	for _, prompt := range provider.prompts {
+		if strings.Contains(prompt, "你好") || strings.Contains(prompt, "graph TD") || strings.Contains(prompt, "Server.Start") ||
+			!strings.Contains(prompt, "Do not translate these terms: Gin, Kwiki") {
+			t.Errorf("prompt:\n%s", prompt)
+		}
+	}
+}
+
+// TestRetranslateStale 主语言页面修改、新增和删除后只重新翻译过期的页面
+func TestRetranslateStale(t *testing.T) {
+	provider := &scriptedProvider{respond: func(prompt string) string {
+		_, text, _ := strings.Cut(prompt, "without wrapping it in a code block.\n\n")
+		if strings.Contains(prompt, "numbered line") {
+			var b strings.Builder
+			for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+				n, title, _ := strings.Cut(line, ". ")
+				fmt.Fprintf(&b, "%s. 訳 %s\n", n, title)
+			}
+			return b.String()
+		}
+		return "訳 " + text
+	}}
+	wg := newScriptedGenerator(provider)
+
+	wiki := &models.Wiki{
+		ID:       "example",
+		Language: "en",
+		Settings: models.WikiSettings{AIProvider: "scripted"},
+		Pages: []models.WikiPage{
+			{ID: "overview_en", Key: "overview", Language: "en", Title: "Overview", Content: "Overview text\n", Children: []string{"setup_en", "usage_en"}},
+			{ID: "setup_en", Key: "setup", Language: "en", Title: "Setup", Content: "Setup text\n", ParentID: "overview_en"},
+			{ID: "usage_en", Key: "usage", Language: "en", Title: "Usage", Content: "Usage text\n", ParentID: "overview_en"},
+		},
+	}
+	if _, _, err := wg.RetranslateStale(context.Background(), wiki, "ja", nil); !errors.Is(err, ErrNoTranslation) {
+		t.Errorf("missing translation error = %v", err)
+	}
+	trans, err := wg.TranslateWiki(context.Background(), wiki, "ja", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source := trans.Pages[1].Source; source == nil || source.PageID != "setup_en" || source.Hash != sourceHash(wiki.Pages[1]) {
+		t.Fatalf("source = %+v", source)
+	}
+	wiki.Translations = map[string]*models.WikiTrans{"ja": trans}
+	if statuses := TranslationStatuses(wiki); len(statuses) != 1 || statuses[0].Pages != 3 || len(statuses[0].Stale) != 0 {
+		t.Errorf("fresh statuses = %+v", statuses)
+	}
+	if _, n, err := wg.RetranslateStale(context.Background(), wiki, "ja", nil); n != 0 || err != nil {
+		t.Errorf("up-to-date retranslation = %d, %v", n, err)
+	}
+
+	// 重新生成主语言：修改 setup，删除 usage，新增 faq；trailing 空白的变化不算修改
+	wiki.Pages = []models.WikiPage{
+		{ID: "overview_en", Key: "overview", Language: "en", Title: "Overview", Content: "Overview text", Children: []string{"setup_en", "faq_en"}},
+		{ID: "setup_en", Key: "setup", Language: "en", Title: "Setup", Content: "New setup text\n", ParentID: "overview_en"},
+		{ID: "faq_en", Key: "faq", Language: "en", Title: "FAQ", Content: "FAQ text\n", ParentID: "overview_en"},
+	}
+	statuses := TranslationStatuses(wiki)
+	reasons := map[string]string{}
+	for _, stale := range statuses[0].Stale {
+		reasons[stale.SourceID] = stale.Reason
+	}
+	if len(reasons) != 3 || reasons["setup_en"] != StaleChanged || reasons["usage_en"] != StaleRemoved || reasons["faq_en"] != StaleMissing {
+		t.Errorf("stale pages = %+v", statuses[0].Stale)
+	}
+
+	provider.prompts = nil
+	updated, n, err := wg.RetranslateStale(context.Background(), wiki, "ja", nil)
+	if err != nil || n != 2 {
+		t.Fatalf("retranslation = %d, %v", n, err)
+	}
+	var ids []string
+	for _, page := range updated.Pages {
+		ids = append(ids, page.ID)
+	}
+	if strings.Join(ids, ",") != "overview_ja,setup_ja,faq_ja" || updated.Pages[0].Content != trans.Pages[0].Content ||
+		updated.Pages[1].Content != "訳 New setup text\n" || strings.Join(updated.Pages[0].Children, ",") != "setup_ja,faq_ja" ||
+		!updated.CreatedAt.Equal(trans.CreatedAt) {
+		t.Errorf("retranslated pages = %+v", updated.Pages)
+	}
+	for _, prompt := range provider.prompts {
+		if strings.Contains(prompt, "Overview text") {
+			t.Errorf("an up-to-date page was retranslated:\n%s", prompt)
+		}
+	}
+	wiki.Translations["ja"] = updated
+	if statuses := TranslationStatuses(wiki); len(statuses[0].Stale) != 0 {
+		t.Errorf("stale after retranslation = %+v", statuses[0].Stale)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/auth"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// groupMemberPrefix marks WikiAccess.Members keys that name a group
+const groupMemberPrefix = "group:"
+
+// wikiRole returns the role of principal on wiki, or "" if the principal may
+// not see it. Without authentication everyone owns every wiki; admins own all
+// wikis. Wikis without an owner stay editable by every principal with the
+// generate scope unless they are private.
+func (s *Server) wikiRole(principal *auth.Principal, wiki *models.Wiki) models.WikiRole {
+	if !s.config.Auth.Enabled || principal.Has(auth.ScopeAdmin) {
+		return models.WikiRoleOwner
+	}
+
+	access := wiki.Metadata.Access
+	var role models.WikiRole
+	if principal != nil {
+		if access.Owner != "" && strings.EqualFold(access.Owner, principal.Name) {
+			return models.WikiRoleOwner
+		}
+		for member, memberRole := range access.Members {
+			if isMember(principal, member) && memberRole.Includes(role) {
+				role = memberRole
+			}
+		}
+		if role == "" && access.Owner == "" && access.Visibility != models.VisibilityPrivate && principal.Has(auth.ScopeGenerate) {
+			role = models.WikiRoleEditor
+		}
+	}
+
+	if role == "" {
+		switch access.Visibility {
+		case "", models.VisibilityPublic:
+			role = models.WikiRoleViewer
+		case models.VisibilityInternal:
+			if principal != nil {
+				role = models.WikiRoleViewer
+			}
+		}
+	}
+	return role
+}
+
+// isMember reports whether a WikiAccess.Members key names the principal or one of its groups
+func isMember(principal *auth.Principal, member string) bool {
+	if group, ok := strings.CutPrefix(member, groupMemberPrefix); ok {
+		for _, g := range principal.Groups {
+			if strings.EqualFold(g, group) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.EqualFold(member, principal.Name)
+}
+
+// canAccess reports whether the caller has at least role on wiki
+func (s *Server) canAccess(c *gin.Context, wiki *models.Wiki, role models.WikiRole) bool {
+	return s.wikiRole(currentPrincipal(c), wiki).Includes(role)
+}
+
+// visibleWiki looks up a wiki the caller may see. Wikis the caller cannot
+// see are reported as missing so that their existence is not revealed.
+func (s *Server) visibleWiki(c *gin.Context, wikiID string) (*models.Wiki, bool) {
+	wiki, exists := s.getWiki(wikiID)
+	if !exists || !s.canAccess(c, wiki, models.WikiRoleViewer) {
+		return nil, false
+	}
+	return wiki, true
+}
+
+// authorizeWiki looks up a wiki on which the caller has at least role and
+// writes the error response if there is none
+func (s *Server) authorizeWiki(c *gin.Context, wikiID string, role models.WikiRole) (*models.Wiki, bool) {
+	wiki, exists := s.visibleWiki(c, wikiID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
+		return nil, false
+	}
+	if !s.canAccess(c, wiki, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s role required", role)})
+		return nil, false
+	}
+	return wiki, true
+}
+
+// visibleWikis returns the active wikis the caller may see
+func (s *Server) visibleWikis(c *gin.Context) []*models.Wiki {
+	active := s.activeWikiList()
+	wikis := make([]*models.Wiki, 0, len(active))
+	for _, wiki := range active {
+		if s.canAccess(c, wiki, models.WikiRoleViewer) {
+			wikis = append(wikis, wiki)
+		}
+	}
+	return wikis
+}
+
+// newWikiAccess returns the access settings of a newly generated wiki. Wikis
+// generated with an access token are private unless requested otherwise.
+func newWikiAccess(principal *auth.Principal, req models.GenerationRequest) models.WikiAccess {
+	access := models.WikiAccess{Visibility: req.Visibility}
+	if access.Visibility == "" && req.AccessToken != "" {
+		access.Visibility = models.VisibilityPrivate
+	}
+	if principal != nil {
+		access.Owner = principal.Name
+	}
+	return access
+}
+
+// handleSetAccess changes the visibility, owner and members of a wiki
+func (s *Server) handleSetAccess(c *gin.Context) {
+	wiki, ok := s.authorizeWiki(c, c.Param("id"), models.WikiRoleOwner)
+	if !ok {
+		return
+	}
+
+	var req models.WikiAccess
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Visibility.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown visibility %q (want public, internal or private)", req.Visibility)})
+		return
+	}
+	for member, role := range req.Members {
+		if strings.TrimSpace(member) == "" || member == groupMemberPrefix {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "member names must not be empty"})
+			return
+		}
+		if !role.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("member %s: unknown role %q (want owner, editor or viewer)", member, role)})
+			return
+		}
+	}
+	if req.Owner == "" {
+		req.Owner = wiki.Metadata.Access.Owner
+	}
+
+	wiki.Metadata.Access = req
+	if err := s.saveWikiToStorage(wiki); err != nil {
+		log.Printf("Warning: Failed to save access settings of wiki %s: %v", wiki.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wiki_id": wiki.ID, "access": wiki.Metadata.Access})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stcn52/kwiki/internal/auth"
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+func TestWikiRole(t *testing.T) {
+	s := &Server{config: &config.Config{Auth: config.AuthConfig{Enabled: true}}}
+
+	alice := &auth.Principal{Name: "alice", Scopes: []auth.Scope{auth.ScopeGenerate}}
+	bob := &auth.Principal{Name: "bob", Scopes: []auth.Scope{auth.ScopeRead}, Groups: []string{"backend"}}
+	carol := &auth.Principal{Name: "carol", Scopes: []auth.Scope{auth.ScopeGenerate}}
+	admin := &auth.Principal{Name: "root", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	sso := &auth.Principal{Name: "oidc:alice", DisplayName: "alice", Method: "session", Scopes: []auth.Scope{auth.ScopeGenerate}}
+
+	wiki := func(access models.WikiAccess) *models.Wiki {
+		return &models.Wiki{Metadata: models.WikiMetadata{Access: access}}
+	}
+	private := wiki(models.WikiAccess{
+		Visibility: models.VisibilityPrivate,
+		Owner:      "Alice",
+		Members:    map[string]models.WikiRole{"group:backend": models.WikiRoleEditor},
+	})
+	internal := wiki(models.WikiAccess{Visibility: models.VisibilityInternal, Owner: "alice"})
+	unowned := wiki(models.WikiAccess{})
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		wiki      *models.Wiki
+		want      models.WikiRole
+	}{
+		{"owner", alice, private, models.WikiRoleOwner},
+		{"group member", bob, private, models.WikiRoleEditor},
+		{"stranger on private", carol, private, ""},
+		{"single sign-on namesake of the owner", sso, private, ""},
+		{"anonymous on private", nil, private, ""},
+		{"admin on private", admin, private, models.WikiRoleOwner},
+		{"user on internal", carol, internal, models.WikiRoleViewer},
+		{"anonymous on internal", nil, internal, ""},
+		{"generator on unowned", carol, unowned, models.WikiRoleEditor},
+		{"reader on unowned", bob, unowned, models.WikiRoleViewer},
+		{"anonymous on unowned", nil, unowned, models.WikiRoleViewer},
+	}
+	for _, tt := range tests {
+		if got := s.wikiRole(tt.principal, tt.wiki); got != tt.want {
+			t.Errorf("%s: wikiRole() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	s.config.Auth.Enabled = false
+	if got := s.wikiRole(nil, private); got != models.WikiRoleOwner {
+		t.Errorf("without auth wikiRole() = %q, want owner", got)
+	}
+}
+
+func TestNewWikiAccess(t *testing.T) {
+	alice := &auth.Principal{Name: "alice"}
+	if access := newWikiAccess(alice, models.GenerationRequest{AccessToken: "ghp_x"}); access.Visibility != models.VisibilityPrivate || access.Owner != "alice" {
+		t.Errorf("private repository access = %+v, want private and owned by alice", access)
+	}
+	if access := newWikiAccess(nil, models.GenerationRequest{AccessToken: "ghp_x", Visibility: models.VisibilityInternal}); access.Visibility != models.VisibilityInternal || access.Owner != "" {
+		t.Errorf("explicit visibility access = %+v, want internal without owner", access)
+	}
+}
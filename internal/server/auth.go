@@ -0,0 +1,398 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/auth"
+	"github.com/stcn52/kwiki/internal/storage"
+)
+
+// principalKey is the gin context key of the authenticated *auth.Principal
+const principalKey = "auth.principal"
+
+// oidcStateCookie binds an OIDC login to the browser that started it
+const oidcStateCookie = "kwiki_oidc_state"
+
+// setupAuth creates the authenticators from the configuration
+func (s *Server) setupAuth() error {
+	cfg := s.config.Auth
+	if !cfg.Enabled {
+		if s.config.Server.OIDC.Enabled {
+			log.Printf("Warning: OIDC login is ignored because authentication is disabled")
+		}
+		return nil
+	}
+
+	tokenStore, _ := s.storage.(storage.TokenStorage)
+	tokens, err := auth.NewTokenAuthenticator(cfg.Tokens, tokenStore)
+	if err != nil {
+		return err
+	}
+	users, err := auth.NewUsers(cfg.Users)
+	if err != nil {
+		return err
+	}
+
+	s.tokens = tokens
+	s.users = users
+	s.sessions = auth.NewSessionManager(time.Duration(cfg.SessionTTL)*time.Hour, cfg.SecureCookie)
+	s.authenticator = auth.Chain{s.tokens, s.sessions}
+
+	if s.config.Server.OIDC.Enabled {
+		oidc, err := auth.NewOIDC(s.config.Server.OIDC, nil)
+		if err != nil {
+			return err
+		}
+		s.oidc = oidc
+	}
+
+	if len(cfg.Tokens) == 0 && len(cfg.Users) == 0 && tokenStore == nil && s.oidc == nil {
+		log.Printf("Warning: Authentication is enabled but no tokens or users are configured")
+	}
+	return nil
+}
+
+// authenticate resolves the principal of a request. Requests without
+// credentials continue anonymously; wrong credentials are rejected.
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := s.authenticator.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="kwiki"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if principal != nil {
+			c.Set(principalKey, principal)
+		}
+		c.Next()
+	}
+}
+
+// requireScope rejects requests whose principal lacks scope. Anonymous web
+// page requests are redirected to the login page.
+func (s *Server) requireScope(scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.Auth.Enabled {
+			c.Next()
+			return
+		}
+
+		principal := currentPrincipal(c)
+		if principal.Has(scope) || (principal == nil && scope == auth.ScopeRead && s.config.Auth.AnonymousRead) {
+			c.Next()
+			return
+		}
+
+		isPage := !strings.HasPrefix(c.Request.URL.Path, "/api/") && c.Request.Method == http.MethodGet
+		switch {
+		case principal == nil && isPage:
+			c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+			c.Abort()
+		case principal == nil:
+			c.Header("WWW-Authenticate", `Bearer realm="kwiki"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		case isPage:
+			c.HTML(http.StatusForbidden, "error.html", gin.H{
+				"title": "Access denied",
+				"error": fmt.Sprintf("This page requires the %s scope", scope),
+			})
+			c.Abort()
+		default:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s scope required", scope)})
+		}
+	}
+}
+
+// currentPrincipal returns the authenticated principal of a request, or nil
+func currentPrincipal(c *gin.Context) *auth.Principal {
+	if value, ok := c.Get(principalKey); ok {
+		return value.(*auth.Principal)
+	}
+	return nil
+}
+
+// handleLoginPage renders the web UI login form
+func (s *Server) handleLoginPage(c *gin.Context) {
+	if !s.config.Auth.Enabled {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+	c.HTML(http.StatusOK, "login.html", gin.H{
+		"title": "KWiki - Sign in",
+		"next":  safeRedirect(c.Query("next")),
+		"oidc":  s.oidc != nil,
+	})
+}
+
+// handleOIDCLogin redirects the browser to the OIDC provider
+func (s *Server) handleOIDCLogin(c *gin.Context) {
+	if s.oidc == nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"title": "Single sign-on disabled",
+			"error": "OIDC login is not configured",
+		})
+		return
+	}
+
+	authURL, state, err := s.oidc.AuthCodeURL(c.Request.Context(), safeRedirect(c.Query("next")))
+	if err != nil {
+		log.Printf("Failed to start OIDC login: %v", err)
+		c.HTML(http.StatusBadGateway, "error.html", gin.H{
+			"title": "Single sign-on unavailable",
+			"error": "The identity provider could not be reached",
+		})
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   s.config.Auth.SecureCookie,
+		SameSite: http.SameSiteLaxMode, // Sent on the top-level redirect back from the provider
+	})
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// handleOIDCCallback completes an OIDC login and starts a web UI session
+func (s *Server) handleOIDCCallback(c *gin.Context) {
+	if s.oidc == nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"title": "Single sign-on disabled",
+			"error": "OIDC login is not configured",
+		})
+		return
+	}
+
+	state, _ := c.Cookie(oidcStateCookie)
+	http.SetCookie(c.Writer, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	if providerError := c.Query("error"); providerError != "" {
+		c.HTML(http.StatusUnauthorized, "error.html", gin.H{
+			"title": "Sign in failed",
+			"error": fmt.Sprintf("The identity provider reported %s: %s", providerError, c.Query("error_description")),
+		})
+		return
+	}
+	if state == "" || c.Query("state") != state {
+		c.HTML(http.StatusBadRequest, "error.html", gin.H{
+			"title": "Sign in failed",
+			"error": "The login expired or was started in another browser, please sign in again",
+		})
+		return
+	}
+
+	principal, next, err := s.oidc.Exchange(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		log.Printf("Failed OIDC login from %s: %v", c.ClientIP(), err)
+		c.HTML(http.StatusForbidden, "error.html", gin.H{
+			"title": "Sign in failed",
+			"error": "Single sign-on did not grant access to KWiki",
+		})
+		return
+	}
+	if err := s.sessions.Login(c.Writer, principal); err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"title": "Sign in failed",
+			"error": err.Error(),
+		})
+		return
+	}
+
+	log.Printf("OIDC login of %s (%s)", principal.DisplayName, principal.Name)
+	c.Redirect(http.StatusFound, safeRedirect(next))
+}
+
+// handleLogin verifies a username and password and starts a web UI session
+func (s *Server) handleLogin(c *gin.Context) {
+	if !s.config.Auth.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "authentication is disabled"})
+		return
+	}
+
+	var req struct {
+		Username string `json:"username" form:"username"`
+		Password string `json:"password" form:"password"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal, err := s.users.Verify(req.Username, req.Password)
+	if err != nil {
+		log.Printf("Failed login for user %q from %s", req.Username, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+	if err := s.sessions.Login(c.Writer, principal); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, principal)
+}
+
+// handleLogout ends the web UI session
+func (s *Server) handleLogout(c *gin.Context) {
+	if s.sessions != nil {
+		s.sessions.Logout(c.Writer, c.Request)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// handleWhoAmI returns the authenticated principal
+func (s *Server) handleWhoAmI(c *gin.Context) {
+	principal := currentPrincipal(c)
+	if principal == nil {
+		c.JSON(http.StatusOK, gin.H{"authenticated": false, "auth_enabled": s.config.Auth.Enabled})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authenticated": true, "auth_enabled": true, "principal": principal})
+}
+
+// handleListTokens lists the API tokens created through the API
+func (s *Server) handleListTokens(c *gin.Context) {
+	if s.tokens == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "authentication is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, s.tokens.List())
+}
+
+// handleCreateToken creates an API token. The token is only returned in this response.
+func (s *Server) handleCreateToken(c *gin.Context) {
+	if s.tokens == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "authentication is disabled"})
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days,omitempty"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createdBy := ""
+	if principal := currentPrincipal(c); principal != nil {
+		createdBy = principal.Name
+	}
+	secret, token, err := s.tokens.Create(req.Name, scopes, time.Duration(req.ExpiresInDays)*24*time.Hour, createdBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	info := *token
+	info.Hash = ""
+	c.JSON(http.StatusCreated, gin.H{
+		"token":   secret,
+		"details": info,
+		"message": "Store this token now, it cannot be shown again",
+	})
+}
+
+// handleDeleteToken revokes an API token
+func (s *Server) handleDeleteToken(c *gin.Context) {
+	if s.tokens == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "authentication is disabled"})
+		return
+	}
+	if err := s.tokens.Revoke(c.Param("tokenId")); err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// corsMiddleware answers cross-origin requests from the origins in ServerConfig.CORSOrigins
+func (s *Server) corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if origin := c.GetHeader("Origin"); origin != "" {
+			c.Header("Vary", "Origin")
+			switch allowed := s.allowedOrigin(origin); {
+			case allowed == "*":
+				c.Header("Access-Control-Allow-Origin", "*")
+			case allowed != "":
+				c.Header("Access-Control-Allow-Origin", allowed)
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-API-Key")
+		}
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allowedOrigin returns origin if it is whitelisted, "*" if any origin is
+// allowed, or "" if the origin may not make cross-origin requests
+func (s *Server) allowedOrigin(origin string) string {
+	origin = strings.TrimSuffix(origin, "/")
+	wildcard := false
+	for _, allowed := range s.config.Server.CORSOrigins {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "*" {
+			wildcard = true
+		} else if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	if wildcard {
+		return "*"
+	}
+	return ""
+}
+
+// checkWebSocketOrigin allows same-origin and whitelisted WebSocket connections
+func (s *Server) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Not a browser
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return s.config.Server.EnableCORS && s.allowedOrigin(origin) != ""
+}
+
+// safeRedirect only allows redirects to local paths
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
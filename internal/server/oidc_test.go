@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/auth"
+	"github.com/stcn52/kwiki/internal/auth/oidctest"
+	"github.com/stcn52/kwiki/internal/config"
+)
+
+func TestOIDCLoginFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := oidctest.New("kwiki", "client-secret")
+	defer provider.Close()
+	provider.SetClaims(map[string]interface{}{
+		"sub":                "u-1",
+		"preferred_username": "alice",
+		"groups":             []string{"docs"},
+	})
+
+	router := gin.New()
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	s := &Server{config: &config.Config{Auth: config.AuthConfig{Enabled: true}}}
+	s.config.Server.OIDC = config.OIDCConfig{
+		Enabled:       true,
+		Issuer:        provider.URL,
+		ClientID:      "kwiki",
+		ClientSecret:  "client-secret",
+		RedirectURL:   ts.URL + "/auth/oidc/callback",
+		DefaultScopes: []string{"generate"},
+	}
+	oidc, err := auth.NewOIDC(s.config.Server.OIDC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.oidc = oidc
+	s.sessions = auth.NewSessionManager(time.Hour, false)
+	s.authenticator = s.sessions
+
+	router.GET("/auth/oidc/login", s.handleOIDCLogin)
+	router.GET("/auth/oidc/callback", s.handleOIDCCallback)
+	router.GET("/api/auth/me", s.authenticate(), s.handleWhoAmI)
+
+	// The browser follows kwiki -> provider -> kwiki callback -> next
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(ts.URL + "/auth/oidc/login?next=/wiki/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/wiki/x" {
+		t.Fatalf("login ended at %s, want /wiki/x", resp.Request.URL)
+	}
+
+	resp, err = browser.Get(ts.URL + "/api/auth/me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var me struct {
+		Authenticated bool           `json:"authenticated"`
+		Principal     auth.Principal `json:"principal"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&me); err != nil {
+		t.Fatal(err)
+	}
+	if !me.Authenticated || me.Principal.Name != "oidc:alice" || me.Principal.DisplayName != "alice" || me.Principal.Method != "session" ||
+		!me.Principal.Has(auth.ScopeGenerate) || len(me.Principal.Groups) != 1 {
+		t.Errorf("session principal = %+v", me)
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/analyzer"
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/scheduler"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// refreshCheckTimeout bounds a single ls-remote check
+const refreshCheckTimeout = 2 * time.Minute
+
+// refreshScheduler periodically checks wikis that have a refresh schedule and
+// regenerates them when the remote HEAD of their ref has moved
+type refreshScheduler struct {
+	server   *Server
+	analyzer *analyzer.CodeAnalyzer
+	interval time.Duration
+	jitter   time.Duration
+	limit    int
+
+	mu        sync.Mutex
+	running   map[string]bool // Wiki ID -> true once the check triggered a regeneration
+	schedules map[string]scheduler.Schedule
+}
+
+func newRefreshScheduler(s *Server, cfg config.RefreshConfig) *refreshScheduler {
+	interval := time.Duration(cfg.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	limit := cfg.MaxConcurrent
+	if limit <= 0 {
+		limit = 1
+	}
+	return &refreshScheduler{
+		server:    s,
+		analyzer:  analyzer.New(s.config),
+		interval:  interval,
+		jitter:    time.Duration(cfg.JitterSeconds) * time.Second,
+		limit:     limit,
+		running:   make(map[string]bool),
+		schedules: make(map[string]scheduler.Schedule),
+	}
+}
+
+// run checks for due wikis every interval, it never returns
+func (r *refreshScheduler) run() {
+	log.Printf("Refresh scheduler started, checking every %s (max %d concurrent)", r.interval, r.limit)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r.tick(now)
+	}
+}
+
+// tick starts refresh checks for all due wikis while the concurrency cap allows it
+func (r *refreshScheduler) tick(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Regenerations started by the scheduler hold their slot until they finish
+	for wikiID, regenerating := range r.running {
+		if wiki, exists := r.server.getWiki(wikiID); !exists || (regenerating && !isGenerating(wiki)) {
+			delete(r.running, wikiID)
+		}
+	}
+
+	for _, wiki := range r.server.activeWikiList() {
+		wikiID := wiki.ID
+		if _, busy := r.running[wikiID]; busy || wiki.Settings.RefreshSchedule == "" {
+			continue
+		}
+		if wiki.Metadata.RequiresAccessToken {
+			// A schedule from .kwiki.yaml; ls-remote would fail without the token
+			continue
+		}
+		schedule, err := r.schedule(wiki.Settings.RefreshSchedule)
+		if err != nil {
+			continue
+		}
+
+		if wiki.Metadata.NextRefreshAt == nil {
+			r.planNext(wiki, schedule, now)
+			if err := r.server.saveWikiToStorage(wiki); err != nil {
+				log.Printf("Warning: Failed to save wiki to storage: %v", err)
+			}
+			continue
+		}
+		if now.Before(*wiki.Metadata.NextRefreshAt) || isGenerating(wiki) {
+			continue
+		}
+		if len(r.running) >= r.limit {
+			return
+		}
+
+		r.running[wikiID] = false
+		go r.refresh(wikiID, wiki, schedule)
+	}
+}
+
+// schedule parses a schedule specification, caching the result
+func (r *refreshScheduler) schedule(spec string) (scheduler.Schedule, error) {
+	if schedule, ok := r.schedules[spec]; ok {
+		return schedule, nil
+	}
+	schedule, err := scheduler.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	r.schedules[spec] = schedule
+	return schedule, nil
+}
+
+// planNext sets the next refresh time of a wiki. The first run after startup
+// or a schedule change follows the last refresh (or update) time and starts
+// now when it is already overdue. Every run is delayed by a random part of the
+// jitter window, so wikis sharing a schedule don't refresh at once.
+func (r *refreshScheduler) planNext(wiki *models.Wiki, schedule scheduler.Schedule, now time.Time) {
+	base := wiki.UpdatedAt
+	if last := wiki.Metadata.LastRefreshAt; last != nil {
+		base = *last
+	}
+	next := schedule.Next(base)
+	if next.IsZero() {
+		wiki.Metadata.NextRefreshAt = nil
+		return
+	}
+	if next.Before(now) {
+		next = now
+	}
+	if r.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(r.jitter))))
+	}
+	wiki.Metadata.NextRefreshAt = &next
+}
+
+// plan sets the next refresh time of a wiki after its schedule changed
+func (r *refreshScheduler) plan(wiki *models.Wiki, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if schedule, err := r.schedule(wiki.Settings.RefreshSchedule); err == nil {
+		r.planNext(wiki, schedule, now)
+	}
+}
+
+// refresh compares the remote commit of a wiki's ref with the commit it was
+// generated from and regenerates the wiki if they differ
+func (r *refreshScheduler) refresh(wikiID string, wiki *models.Wiki, schedule scheduler.Schedule) {
+	regenerating := false
+	defer func() {
+		r.mu.Lock()
+		if regenerating {
+			r.running[wikiID] = true
+		} else {
+			delete(r.running, wikiID)
+		}
+		r.mu.Unlock()
+	}()
+
+	now := time.Now()
+	wiki.Metadata.LastRefreshAt = &now
+	r.mu.Lock()
+	r.planNext(wiki, schedule, now)
+	r.mu.Unlock()
+
+	repoURL := wiki.Metadata.RepositoryURL
+	if repoURL == "" {
+		repoURL = wiki.RepositoryID
+	}
+	ref := wiki.Metadata.Ref
+	current := wiki.Metadata.CommitSHA
+
+	var sha string
+	var err error
+	if isPinnedCommit(ref, current) {
+		// Pinned to a commit, there is nothing to refresh
+		sha = current
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshCheckTimeout)
+		sha, err = r.analyzer.ResolveRef(ctx, repoURL, ref, "")
+		cancel()
+	}
+
+	if err != nil {
+		log.Printf("Scheduled refresh of %s failed: %v", wikiID, err)
+		r.server.addWikiLog(wikiID, models.LogLevelWarning, models.LogStepSetup, fmt.Sprintf("Scheduled refresh failed to check remote: %v", err))
+	} else if sha != "" && sha != current {
+		regenerating = r.server.regenerateWiki(wikiID,
+			fmt.Sprintf("scheduled refresh, remote moved %s -> %s", shortSHA(current), shortSHA(sha)))
+		return
+	}
+
+	if err := r.server.saveWikiToStorage(wiki); err != nil {
+		log.Printf("Warning: Failed to save wiki to storage: %v", err)
+	}
+}
+
+// handleSetRefreshSchedule sets or clears the refresh schedule of a wiki
+// (PUT /api/wiki/:id/refresh with {"refresh_schedule": "0 3 * * *"})
+func (s *Server) handleSetRefreshSchedule(c *gin.Context) {
+	wikiID := getWikiIDFromParam(c, "id")
+
+	wiki, ok := s.authorizeWiki(c, wikiID, models.WikiRoleEditor)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		RefreshSchedule string `json:"refresh_schedule"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.RefreshSchedule = strings.TrimSpace(req.RefreshSchedule)
+	if req.RefreshSchedule != "" {
+		if wiki.Metadata.RequiresAccessToken {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": errNeedsAccessToken.Error()})
+			return
+		}
+		if _, err := scheduler.Parse(req.RefreshSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	wiki.Settings.RefreshSchedule = req.RefreshSchedule
+	if wiki.Metadata.RequestSettings != nil {
+		// Regeneration starts from the requested settings, so keep them in step
+		wiki.Metadata.RequestSettings.RefreshSchedule = req.RefreshSchedule
+	}
+	wiki.Metadata.NextRefreshAt = nil
+	if s.refresh != nil && req.RefreshSchedule != "" {
+		s.refresh.plan(wiki, time.Now())
+	}
+	if err := s.saveWikiToStorage(wiki); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wiki_id":          wiki.ID,
+		"refresh_schedule": wiki.Settings.RefreshSchedule,
+		"last_refresh_at":  wiki.Metadata.LastRefreshAt,
+		"next_refresh_at":  wiki.Metadata.NextRefreshAt,
+	})
+}
+
+// isPinnedCommit reports whether ref is a commit SHA, full or abbreviated, of
+// the current commit. Branch and tag names that happen to be hex, such as
+// "cafe", are shorter than an abbreviated SHA and still refresh.
+func isPinnedCommit(ref, current string) bool {
+	return analyzer.IsCommitSHA(ref) && strings.HasPrefix(current, strings.ToLower(ref))
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/scheduler"
+	"github.com/stcn52/kwiki/internal/storage"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+func TestIsPinnedCommit(t *testing.T) {
+	const current = "cafe1234deadbeef5678cafe1234deadbeef5678"
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"cafe1234deadbeef5678cafe1234deadbeef5678", true},
+		{"CAFE123", true},
+		{"cafe", false}, // a branch that is a hex prefix of the SHA
+		{"main", false},
+		{"", false},
+		{"beef567", false},
+	}
+	for _, tt := range tests {
+		if got := isPinnedCommit(tt.ref, current); got != tt.want {
+			t.Errorf("isPinnedCommit(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshSkipsWikisGeneratedWithToken(t *testing.T) {
+	private := &models.Wiki{
+		ID:       "private",
+		Status:   models.WikiStatusCompleted,
+		Settings: models.WikiSettings{RefreshSchedule: "6h"}, // From .kwiki.yaml
+		Metadata: models.WikiMetadata{RequiresAccessToken: true},
+	}
+	s := &Server{
+		config:      config.Default(),
+		storage:     storage.NewMarkdownStorage(t.TempDir()),
+		activeWikis: map[string]*models.Wiki{"private": private},
+	}
+	router := gin.New()
+	router.PUT("/api/wiki/:id/refresh", s.handleSetRefreshSchedule)
+	put := func(body string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/wiki/private/refresh", strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := put(`{"refresh_schedule": "0 3 * * *"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("schedule for token wiki = %d, want 422", code)
+	}
+	if private.Settings.RefreshSchedule != "6h" {
+		t.Errorf("rejected schedule was stored: %q", private.Settings.RefreshSchedule)
+	}
+
+	r := newRefreshScheduler(s, config.RefreshConfig{})
+	r.tick(time.Now())
+	if private.Metadata.NextRefreshAt != nil || len(r.running) != 0 {
+		t.Errorf("scheduler planned %v for a wiki it cannot check", private.Metadata.NextRefreshAt)
+	}
+
+	if code := put(`{"refresh_schedule": ""}`); code != http.StatusOK || private.Settings.RefreshSchedule != "" {
+		t.Errorf("clearing the schedule = %d (%q), want 200", code, private.Settings.RefreshSchedule)
+	}
+}
+
+func TestSetRefreshSchedulePlansNextRun(t *testing.T) {
+	updated := time.Now().Add(-time.Hour).Truncate(time.Second)
+	wiki := &models.Wiki{ID: "example", Status: models.WikiStatusCompleted, UpdatedAt: updated}
+	s := &Server{
+		config:      config.Default(),
+		storage:     storage.NewMarkdownStorage(t.TempDir()),
+		activeWikis: map[string]*models.Wiki{"example": wiki},
+	}
+	s.refresh = newRefreshScheduler(s, config.RefreshConfig{})
+	router := gin.New()
+	router.PUT("/api/wiki/:id/refresh", s.handleSetRefreshSchedule)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/wiki/example/refresh", strings.NewReader(`{"refresh_schedule": "6h"}`)))
+	var resp struct {
+		NextRefreshAt *time.Time `json:"next_refresh_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	if want := updated.Add(6 * time.Hour); resp.NextRefreshAt == nil || !resp.NextRefreshAt.Equal(want) {
+		t.Errorf("next_refresh_at = %v, want %v", resp.NextRefreshAt, want)
+	}
+}
+
+func TestPlanNextJitter(t *testing.T) {
+	r := &refreshScheduler{jitter: time.Minute}
+	now := time.Now()
+	schedule, _ := scheduler.Parse("1h")
+
+	// Upcoming runs keep their slot, spread by at most the jitter window
+	wiki := &models.Wiki{UpdatedAt: now.Add(-30 * time.Minute)}
+	r.planNext(wiki, schedule, now)
+	due := wiki.UpdatedAt.Add(time.Hour)
+	if next := *wiki.Metadata.NextRefreshAt; next.Before(due) || !next.Before(due.Add(time.Minute)) {
+		t.Errorf("upcoming run planned at %v, want within a minute after %v", next, due)
+	}
+
+	// Overdue runs start now, spread the same way
+	wiki = &models.Wiki{UpdatedAt: now.Add(-3 * time.Hour)}
+	r.planNext(wiki, schedule, now)
+	if next := *wiki.Metadata.NextRefreshAt; next.Before(now) || !next.Before(now.Add(time.Minute)) {
+		t.Errorf("overdue run planned at %v, want within a minute after now", next)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
@@ -10,8 +11,9 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,8 +21,12 @@ import (
 	"github.com/gorilla/websocket"
 
 	"github.com/stcn52/kwiki/internal/ai"
+	"github.com/stcn52/kwiki/internal/analyzer"
+	"github.com/stcn52/kwiki/internal/auth"
 	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/export"
 	"github.com/stcn52/kwiki/internal/generator"
+	"github.com/stcn52/kwiki/internal/scheduler"
 	"github.com/stcn52/kwiki/internal/storage"
 	"github.com/stcn52/kwiki/pkg/models"
 	"github.com/stcn52/kwiki/pkg/utils"
@@ -34,12 +40,30 @@ type Server struct {
 	wikiGenerator *generator.WikiGenerator
 	storage       storage.Storage
 	activeWikis   map[string]*models.Wiki
-	repoURLToWiki map[string]string   // Maps repository URL to wiki ID
-	wikiLogs      map[string][]string // Maps wiki ID to generation logs
+	repoURLToWiki map[string]string                // Maps repository URL to wiki ID
+	wikisMutex    sync.RWMutex                     // Guards activeWikis and repoURLToWiki, use the accessors below
+	wikiLogs      map[string][]models.WikiLogEntry // Maps wiki ID to its most recent generation logs
+	logsMutex     sync.RWMutex
 	wsUpgrader    websocket.Upgrader
 	wsConnections map[string]*websocket.Conn
+	wsMutex       sync.Mutex
+	regenQueue    *regenerationQueue // Debounced regeneration triggered by webhooks
+	refresh       *refreshScheduler  // nil when refresh.enabled is false
+
+	translating       map[string]bool // Running translations, keyed by wiki ID#language
+	translationsMutex sync.Mutex
+
+	// Authentication, nil when auth.enabled is false
+	authenticator auth.Authenticator
+	tokens        *auth.TokenAuthenticator
+	sessions      *auth.SessionManager
+	users         *auth.Users
+	oidc          *auth.OIDC // nil unless server.oidc.enabled
 }
 
+// maxRecentLogs is the number of log entries kept in memory per wiki for WebSocket replay
+const maxRecentLogs = 100
+
 // New creates a new server instance
 func New(cfg *config.Config) (*Server, error) {
 	// Set Gin mode
@@ -50,47 +74,7 @@ func New(cfg *config.Config) (*Server, error) {
 	}
 
 	// Initialize AI provider manager
-	aiManager := ai.NewProviderManager()
-
-	// Register AI providers
-	if openaiKey := cfg.AI.Providers["openai"].APIKey; openaiKey != "" {
-		openaiProvider := ai.NewOpenAIProvider(openaiKey, cfg.AI.Providers["openai"].BaseURL)
-		aiManager.RegisterProvider("openai", openaiProvider)
-	}
-
-	if geminiKey := cfg.AI.Providers["gemini"].APIKey; geminiKey != "" {
-		geminiProvider := ai.NewGeminiProvider(geminiKey)
-		aiManager.RegisterProvider("gemini", geminiProvider)
-	}
-
-	log.Printf("Checking DeepSeek configuration...")
-	log.Printf("Available providers in config: %+v", cfg.AI.Providers)
-	if deepseekProvider, exists := cfg.AI.Providers["deepseek"]; exists {
-		log.Printf("DeepSeek provider found in config: %+v", deepseekProvider)
-		if deepseekProvider.APIKey != "" {
-			log.Printf("Registering DeepSeek provider with API key: %s", deepseekProvider.APIKey[:4]+"****")
-			deepseekAI := ai.NewDeepSeekProvider(deepseekProvider.APIKey)
-			aiManager.RegisterProvider("deepseek", deepseekAI)
-		} else {
-			log.Printf("DeepSeek provider found but API key is empty")
-		}
-	} else {
-		log.Printf("DeepSeek provider not found in config")
-	}
-
-	// Always register Ollama provider (it will check availability)
-	ollamaHost := os.Getenv("OLLAMA_HOST")
-	if ollamaHost == "" {
-		// Use base_url from config if OLLAMA_HOST is not set
-		if ollamaConfig, exists := cfg.AI.Providers["ollama"]; exists && ollamaConfig.BaseURL != "" {
-			ollamaHost = ollamaConfig.BaseURL
-		}
-	}
-	ollamaProvider := ai.NewOllamaProvider(ollamaHost)
-	aiManager.RegisterProvider("ollama", ollamaProvider)
-
-	// Set default provider
-	aiManager.SetDefaultProvider(cfg.AI.DefaultProvider)
+	aiManager := ai.NewProviderManagerFromConfig(cfg)
 
 	// Initialize storage
 	dataDir := cfg.Server.DataDir
@@ -98,9 +82,11 @@ func New(cfg *config.Config) (*Server, error) {
 		dataDir = "./data" // Default data directory
 	}
 
-	// 使用新的Markdown存储
-	wikisDir := filepath.Join(dataDir, "wikis")
-	markdownStorage := storage.NewMarkdownStorage(wikisDir)
+	// 默认使用Markdown存储，可通过 storage_backend 切换为 sqlite
+	wikiStorage, err := storage.Open(cfg.Server.StorageBackend, dataDir, cfg.Server.DatabasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
 
 	// Initialize wiki generator
 	wikiGen := generator.New(cfg, aiManager)
@@ -109,27 +95,53 @@ func New(cfg *config.Config) (*Server, error) {
 		config:        cfg,
 		aiManager:     aiManager,
 		wikiGenerator: wikiGen,
-		storage:       markdownStorage,
+		storage:       wikiStorage,
 		activeWikis:   make(map[string]*models.Wiki),
 		repoURLToWiki: make(map[string]string),
-		wikiLogs:      make(map[string][]string),
-		wsUpgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for development
-			},
-		},
+		wikiLogs:      make(map[string][]models.WikiLogEntry),
 		wsConnections: make(map[string]*websocket.Conn),
 	}
+	server.wsUpgrader = websocket.Upgrader{CheckOrigin: server.checkWebSocketOrigin}
+
+	if err := server.setupAuth(); err != nil {
+		return nil, fmt.Errorf("failed to initialize authentication: %w", err)
+	}
+
+	debounce := time.Duration(cfg.Webhooks.DebounceSeconds) * time.Second
+	server.regenQueue = newRegenerationQueue(debounce, server.regenerateWiki)
 
 	server.setupRoutes()
 
+	// Check storage consistency before loading, corrupt wikis are quarantined
+	if checker, ok := wikiStorage.(storage.Checker); ok {
+		report, err := checker.Fsck()
+		if err != nil {
+			log.Printf("Warning: Storage check failed: %v", err)
+		} else if len(report.Quarantined) > 0 || report.TempFilesRemoved > 0 {
+			log.Printf("Storage check: %d wikis checked, %d quarantined %v, %d temp files removed",
+				report.Checked, len(report.Quarantined), report.Quarantined, report.TempFilesRemoved)
+		}
+	}
+
 	// Load existing wikis from storage
 	if err := server.loadWikisFromStorage(); err != nil {
 		log.Printf("Warning: Failed to load wikis from storage: %v", err)
 	}
 
-	// Start progress monitoring
+	// Start progress and log monitoring
 	go server.monitorProgress()
+	go server.monitorLogs()
+
+	// Reload prompt templates edited on disk
+	if interval := cfg.Generator.TemplateWatchInterval; interval > 0 {
+		go wikiGen.Templates().Watch(context.Background(), time.Duration(interval)*time.Second)
+	}
+
+	// Start scheduled refresh of wikis with a refresh schedule
+	if cfg.Refresh.Enabled {
+		server.refresh = newRefreshScheduler(server, cfg.Refresh)
+		go server.refresh.run()
+	}
 
 	return server, nil
 }
@@ -143,54 +155,135 @@ func (s *Server) loadWikisFromStorage() error {
 
 	// Load wikis into memory
 	for id, wiki := range wikis {
-		s.activeWikis[id] = wiki
+		// Pages stored before they had a key and language are migrated once
+		if models.MigratePageIdentity(wiki) {
+			if err := s.saveWikiToStorage(wiki); err != nil {
+				log.Printf("Warning: Failed to save migrated pages of wiki %s: %v", id, err)
+			} else {
+				log.Printf("Migrated page keys and languages of wiki %s", id)
+			}
+		}
 		// Rebuild repository URL mapping
+		repoURL := ""
 		if wiki.PackagePath != "" {
-			repoURL := utils.PackagePathToURL(wiki.PackagePath)
-			s.repoURLToWiki[repoURL] = id
-		}
-
-		// Load logs for this wiki
-		logs, err := s.storage.LoadLogs(id)
-		if err != nil {
-			log.Printf("Warning: Failed to load logs for wiki %s: %v", id, err)
-		} else {
-			s.wikiLogs[id] = logs
+			repoURL = strings.ToLower(utils.PackagePathToURL(wiki.PackagePath))
+			if wiki.Metadata.Ref != "" {
+				repoURL += "@" + wiki.Metadata.Ref
+			}
 		}
+		s.storeWiki(wiki, repoURL)
 	}
 
 	log.Printf("Loaded %d wikis from storage", len(wikis))
 	return nil
 }
 
+// getWiki returns an active wiki
+func (s *Server) getWiki(id string) (*models.Wiki, bool) {
+	s.wikisMutex.RLock()
+	defer s.wikisMutex.RUnlock()
+	wiki, exists := s.activeWikis[id]
+	return wiki, exists
+}
+
+// activeWikiList returns a snapshot of the active wikis that is safe to range
+// over while other goroutines add or remove wikis
+func (s *Server) activeWikiList() []*models.Wiki {
+	s.wikisMutex.RLock()
+	defer s.wikisMutex.RUnlock()
+	wikis := make([]*models.Wiki, 0, len(s.activeWikis))
+	for _, wiki := range s.activeWikis {
+		wikis = append(wikis, wiki)
+	}
+	return wikis
+}
+
+// wikiForRepo returns the active wiki registered for a repository key
+func (s *Server) wikiForRepo(repoKey string) (*models.Wiki, bool) {
+	s.wikisMutex.RLock()
+	defer s.wikisMutex.RUnlock()
+	wikiID, exists := s.repoURLToWiki[repoKey]
+	if !exists {
+		return nil, false
+	}
+	wiki, exists := s.activeWikis[wikiID]
+	return wiki, exists
+}
+
+// storeWiki makes a wiki active and, when repoKey is not empty, registers it for the repository key
+func (s *Server) storeWiki(wiki *models.Wiki, repoKey string) {
+	s.wikisMutex.Lock()
+	defer s.wikisMutex.Unlock()
+	s.activeWikis[wiki.ID] = wiki
+	if repoKey != "" {
+		s.repoURLToWiki[repoKey] = wiki.ID
+	}
+}
+
+// removeWiki removes a wiki and its repository keys
+func (s *Server) removeWiki(id string) {
+	s.wikisMutex.Lock()
+	defer s.wikisMutex.Unlock()
+	delete(s.activeWikis, id)
+	for repoURL, wikiID := range s.repoURLToWiki {
+		if wikiID == id {
+			delete(s.repoURLToWiki, repoURL)
+		}
+	}
+}
+
 // saveWikiToStorage saves a wiki to persistent storage
 func (s *Server) saveWikiToStorage(wiki *models.Wiki) error {
 	if err := s.storage.SaveWiki(wiki); err != nil {
 		return fmt.Errorf("failed to save wiki to storage: %w", err)
 	}
 
-	// Also save logs if they exist
-	if logs, exists := s.wikiLogs[wiki.ID]; exists {
-		if err := s.storage.SaveLogs(wiki.ID, logs); err != nil {
-			log.Printf("Warning: Failed to save logs for wiki %s: %v", wiki.ID, err)
-		}
-	}
-
 	return nil
 }
 
-// addWikiLog adds a log entry for a specific wiki
-func (s *Server) addWikiLog(wikiID, message string) {
-	if s.wikiLogs[wikiID] == nil {
-		s.wikiLogs[wikiID] = make([]string, 0)
+// addWikiLog records a server-side log entry for a specific wiki
+func (s *Server) addWikiLog(wikiID string, level models.LogLevel, step, message string) {
+	s.recordLog(models.WikiLogEntry{
+		WikiID:  wikiID,
+		Level:   level,
+		Step:    step,
+		Message: message,
+	})
+}
+
+// recordLog keeps a log entry in memory, appends it to storage and streams it to WebSocket clients
+func (s *Server) recordLog(entry models.WikiLogEntry) {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.Level == "" {
+		entry.Level = models.LogLevelInfo
+	}
+
+	s.logsMutex.Lock()
+	logs := append(s.wikiLogs[entry.WikiID], entry)
+	// Keep only the most recent entries; the full history lives in storage
+	if len(logs) > maxRecentLogs {
+		logs = logs[len(logs)-maxRecentLogs:]
 	}
-	timestamp := time.Now().Format("15:04:05")
-	logEntry := fmt.Sprintf("[%s] %s", timestamp, message)
-	s.wikiLogs[wikiID] = append(s.wikiLogs[wikiID], logEntry)
+	s.wikiLogs[entry.WikiID] = logs
+	s.logsMutex.Unlock()
 
-	// Keep only the last 100 log entries to prevent memory issues
-	if len(s.wikiLogs[wikiID]) > 100 {
-		s.wikiLogs[wikiID] = s.wikiLogs[wikiID][len(s.wikiLogs[wikiID])-100:]
+	if err := s.storage.AppendLog(entry.WikiID, entry); err != nil {
+		log.Printf("Warning: Failed to persist log for wiki %s: %v", entry.WikiID, err)
+	}
+
+	s.writeWebSocket(entry.WikiID, map[string]interface{}{
+		"type":    "log",
+		"wiki_id": entry.WikiID,
+		"entry":   entry,
+	})
+}
+
+// monitorLogs persists and streams structured logs emitted by the generator
+func (s *Server) monitorLogs() {
+	for entry := range s.wikiGenerator.GetLogChannel() {
+		s.recordLog(entry)
 	}
 }
 
@@ -200,20 +293,11 @@ func (s *Server) monitorProgress() {
 	log.Printf("Progress monitor started, listening for updates...")
 
 	for progress := range progressCh {
-		logMessage := fmt.Sprintf("Status: %s, Progress: %d%%, Step: %s",
-			progress.Status, progress.Progress, progress.CurrentStep)
-		if progress.Error != "" {
-			logMessage += fmt.Sprintf(", Error: %s", progress.Error)
-		}
-
-		// Add to wiki logs
-		s.addWikiLog(progress.WikiID, logMessage)
-
 		log.Printf("Received progress update: WikiID=%s, Status=%s, Progress=%d, Step=%s, Error=%s",
 			progress.WikiID, progress.Status, progress.Progress, progress.CurrentStep, progress.Error)
 
 		// Update the wiki in activeWikis
-		if wiki, exists := s.activeWikis[progress.WikiID]; exists {
+		if wiki, exists := s.getWiki(progress.WikiID); exists {
 			wiki.Status = progress.Status
 			wiki.Progress = progress.Progress
 			wiki.UpdatedAt = progress.UpdatedAt
@@ -236,20 +320,12 @@ func (s *Server) monitorProgress() {
 func (s *Server) setupRoutes() {
 	s.router = gin.Default()
 
-	// Enable CORS if configured
+	// Enable CORS for the whitelisted origins if configured
 	if s.config.Server.EnableCORS {
-		s.router.Use(func(c *gin.Context) {
-			c.Header("Access-Control-Allow-Origin", "*")
-			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-
-			if c.Request.Method == "OPTIONS" {
-				c.AbortWithStatus(204)
-				return
-			}
-
-			c.Next()
-		})
+		s.router.Use(s.corsMiddleware())
+	}
+	if s.authenticator != nil {
+		s.router.Use(s.authenticate())
 	}
 
 	// Serve static files
@@ -268,50 +344,105 @@ func (s *Server) setupRoutes() {
 	})
 	s.router.LoadHTMLGlob(s.config.Server.TemplateDir + "/*")
 
+	requireRead := s.requireScope(auth.ScopeRead)
+	requireGenerate := s.requireScope(auth.ScopeGenerate)
+	requireAdmin := s.requireScope(auth.ScopeAdmin)
+
+	// Login
+	s.router.GET("/login", s.handleLoginPage)
+	s.router.GET("/auth/oidc/login", s.handleOIDCLogin)
+	s.router.GET("/auth/oidc/callback", s.handleOIDCCallback)
+
 	// Web interface routes
-	s.router.GET("/", s.handleHome)
-	s.router.GET("/debug", s.handleDebug)
-	s.router.GET("/wiki/:id", s.handleWikiView)
-	s.router.GET("/wiki/:id/page/:pageId", s.handlePageView)
+	s.router.GET("/", requireRead, s.handleHome)
+	s.router.GET("/debug", requireAdmin, s.handleDebug)
+	s.router.GET("/wiki/:id", requireRead, s.handleWikiView)
+	s.router.GET("/wiki/:id/page/:pageId", requireRead, s.handlePageView)
 
 	// Package path routes (e.g., /pkg/github.com/gorilla/websocket)
-	s.router.GET("/pkg/*packagePath", s.handlePackageRoute)
+	s.router.GET("/pkg/*packagePath", requireRead, s.handlePackageRoute)
 
 	// API routes
 	api := s.router.Group("/api")
+	{
+		// Authentication
+		api.POST("/auth/login", s.handleLogin)
+		api.POST("/auth/logout", s.handleLogout)
+		api.GET("/auth/me", s.handleWhoAmI)
+
+		// Push webhooks, authenticated by their signature
+		api.POST("/hooks/github", s.handleGitHubWebhook)
+		api.POST("/hooks/gitlab", s.handleGitLabWebhook)
+		api.POST("/hooks/gitea", s.handleGiteaWebhook)
+	}
+
+	read := api.Group("", requireRead)
 	{
 		// System info
-		api.GET("/info", s.handleSystemInfo)
-		api.GET("/providers", s.handleGetProviders)
-		api.GET("/models", s.handleGetModels)
+		read.GET("/info", s.handleSystemInfo)
+		read.GET("/providers", s.handleGetProviders)
+		read.GET("/models", s.handleGetModels)
 
 		// Wiki management
-		api.POST("/wiki/generate", s.handleGenerateWiki)
-		api.GET("/wiki/:id", s.handleGetWiki)
-		api.GET("/wiki/:id/progress", s.handleGetProgress)
-		api.GET("/wiki/:id/logs", s.handleGetLogs)
-		api.GET("/wiki/logs", s.handleGetLogsQuery) // Alternative logs endpoint with query parameter
-		api.DELETE("/wiki/:id", s.handleDeleteWiki)
-		api.GET("/wikis", s.handleListWikis)
-		api.GET("/tags", s.handleGetTags)
-		api.GET("/wikis/by-tag/:tag", s.handleGetWikisByTag)
+		read.GET("/wiki/:id", s.handleGetWiki)
+		read.GET("/wiki/:id/progress", s.handleGetProgress)
+		read.GET("/wiki/:id/logs", s.handleGetLogs)
+		read.GET("/wiki/logs", s.handleGetLogsQuery) // Alternative logs endpoint with query parameter
+		read.GET("/wikis", s.handleListWikis)
+		read.GET("/tags", s.handleGetTags)
+		read.GET("/wikis/by-tag/:tag", s.handleGetWikisByTag)
+		read.GET("/versions/*packagePath", s.handleGetVersions)
 
 		// Wiki content
-		api.GET("/wiki/:id/pages", s.handleGetPages)
-		api.GET("/wiki/:id/page/:pageId", s.handleGetPage)
-		api.GET("/wiki/:id/diagrams", s.handleGetDiagrams)
-		api.GET("/wiki/:id/search", s.handleSearch)
+		read.GET("/wiki/:id/pages", s.handleGetPages)
+		read.GET("/wiki/:id/page/:pageId", s.handleGetPage)
+		read.GET("/wiki/:id/diagrams", s.handleGetDiagrams)
+		read.GET("/wiki/:id/search", s.handleSearch)
+		read.GET("/wiki/:id/translations", s.handleGetTranslations)
 
 		// Export
-		api.GET("/wiki/:id/export/:format", s.handleExport)
+		read.GET("/wiki/:id/export/:format", s.handleExport)
 
 		// RAG Chat
-		api.POST("/wiki/:id/chat", s.handleChat)
-		api.GET("/wiki/:id/chat/history", s.handleChatHistory)
+		read.GET("/wiki/:id/chat/history", s.handleChatHistory)
+
+		// Prompt templates
+		read.GET("/templates", s.handleListTemplates)
+		read.GET("/templates/:lang/:name", s.handleGetTemplate)
+
+		// Owner changes, authorized by the caller's role on the wiki
+		read.PUT("/wiki/:id/access", s.handleSetAccess)
+		read.DELETE("/wiki/:id", s.handleDeleteWiki)
+	}
+
+	// Everything that spends AI credits
+	generate := api.Group("", requireGenerate)
+	{
+		generate.POST("/wiki/generate", s.handleGenerateWiki)
+		generate.PUT("/wiki/:id/refresh", s.handleSetRefreshSchedule)
+		generate.POST("/wiki/:id/chat", s.handleChat)
+		generate.POST("/wiki/:id/translate", s.handleTranslateWiki)
+		generate.POST("/wiki/:id/translations/regenerate-stale", s.handleRegenerateStaleTranslations)
+
+		// Renders caller supplied templates with sample data; never calls the AI,
+		// but costs server time, so it is not open to read-only tokens
+		generate.POST("/templates/:lang/:name/render", s.handleRenderTemplate)
+	}
+
+	admin := api.Group("", requireAdmin)
+	{
+		// API tokens
+		admin.GET("/tokens", s.handleListTokens)
+		admin.POST("/tokens", s.handleCreateToken)
+		admin.DELETE("/tokens/:tokenId", s.handleDeleteToken)
+
+		// Prompt templates shared by all wikis
+		admin.POST("/templates/:lang", s.handleCreateTemplate)
+		admin.PUT("/templates/:lang/:name", s.handleUpdateTemplate)
 	}
 
 	// WebSocket for real-time updates
-	s.router.GET("/ws/:wikiId", s.handleWebSocket)
+	s.router.GET("/ws/:wikiId", requireRead, s.handleWebSocket)
 }
 
 // Start starts the server
@@ -455,6 +586,24 @@ func (s *Server) handleGenerateWiki(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "repository_url is required"})
 		return
 	}
+	if _, isLocal := analyzer.LocalPath(req.RepositoryURL); isLocal && !s.config.Repository.AllowLocalPaths {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "local repository paths are disabled (repository.allow_local_paths)"})
+		return
+	}
+	if schedule := req.Settings.RefreshSchedule; schedule != "" {
+		if req.AccessToken != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_schedule cannot be combined with access_token, the token is not stored"})
+			return
+		}
+		if _, err := scheduler.Parse(schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !req.Visibility.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown visibility %q (want public, internal or private)", req.Visibility)})
+		return
+	}
 
 	// Debug: 打印接收到的请求数据
 	log.Printf("接收到的生成请求:")
@@ -488,22 +637,40 @@ func (s *Server) handleGenerateWiki(c *gin.Context) {
 		return
 	}
 
+	// HTTPS and SSH remotes of the same repository share one key
+	if remote, err := utils.ParseRepositoryURL(req.RepositoryURL); err == nil {
+		normalizedURL = strings.ToLower(utils.PackagePathToURL(remote.PackagePath()))
+	}
+	// Each pinned ref is a separate wiki
+	if ref := req.Ref; ref != "" || req.Branch != "" {
+		if ref == "" {
+			ref = req.Branch
+		}
+		normalizedURL += "@" + ref
+	}
+
 	// Check if a wiki for this repository is already being generated
-	if existingWikiID, exists := s.repoURLToWiki[normalizedURL]; exists {
-		if existingWiki, wikiExists := s.activeWikis[existingWikiID]; wikiExists {
-			// Only block if the existing wiki is still in progress
-			if existingWiki.Status == models.WikiStatusPending ||
-				existingWiki.Status == models.WikiStatusAnalyzing ||
-				existingWiki.Status == models.WikiStatusGenerating {
-
-				c.JSON(http.StatusConflict, gin.H{
-					"error":            "A wiki for this repository is already being generated",
-					"existing_wiki_id": existingWiki.ID,
-					"status":           existingWiki.Status,
-					"repository_url":   req.RepositoryURL,
-				})
-				return
-			}
+	var existing *models.Wiki
+	if existingWiki, exists := s.wikiForRepo(normalizedURL); exists {
+		// Regenerating an existing wiki requires the editor role
+		if !s.canAccess(c, existingWiki, models.WikiRoleEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "A wiki for this repository exists and you may not regenerate it"})
+			return
+		}
+		existing = existingWiki
+
+		// Only block if the existing wiki is still in progress
+		if existingWiki.Status == models.WikiStatusPending ||
+			existingWiki.Status == models.WikiStatusAnalyzing ||
+			existingWiki.Status == models.WikiStatusGenerating {
+
+			c.JSON(http.StatusConflict, gin.H{
+				"error":            "A wiki for this repository is already being generated",
+				"existing_wiki_id": existingWiki.ID,
+				"status":           existingWiki.Status,
+				"repository_url":   req.RepositoryURL,
+			})
+			return
 		}
 	}
 
@@ -514,9 +681,19 @@ func (s *Server) handleGenerateWiki(c *gin.Context) {
 		return
 	}
 
+	// Regeneration keeps the translations and the access settings, only owners may change the visibility
+	if existing != nil {
+		wiki.Translations = existing.Translations
+		wiki.Metadata.Access = existing.Metadata.Access
+		if req.Visibility != "" && s.canAccess(c, existing, models.WikiRoleOwner) {
+			wiki.Metadata.Access.Visibility = req.Visibility
+		}
+	} else {
+		wiki.Metadata.Access = newWikiAccess(currentPrincipal(c), req)
+	}
+
 	// Store active wiki and repository URL mapping
-	s.activeWikis[wiki.ID] = wiki
-	s.repoURLToWiki[normalizedURL] = wiki.ID
+	s.storeWiki(wiki, normalizedURL)
 
 	// Save to persistent storage
 	if err := s.saveWikiToStorage(wiki); err != nil {
@@ -524,8 +701,8 @@ func (s *Server) handleGenerateWiki(c *gin.Context) {
 	}
 
 	// Add initial log entry
-	s.addWikiLog(wiki.ID, fmt.Sprintf("Wiki generation started for repository: %s", req.RepositoryURL))
-	s.addWikiLog(wiki.ID, fmt.Sprintf("Using AI provider: %s, Model: %s", req.Settings.AIProvider, req.Settings.Model))
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, fmt.Sprintf("Wiki generation started for repository: %s", req.RepositoryURL))
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, fmt.Sprintf("Using AI provider: %s, Model: %s", req.Settings.AIProvider, req.Settings.Model))
 
 	c.JSON(http.StatusOK, gin.H{
 		"wiki_id": wiki.ID,
@@ -578,21 +755,19 @@ func (s *Server) handleTemplateDocsGeneration(c *gin.Context, req models.Generat
 	templateDocsKey := fmt.Sprintf("template-docs-%s-%s", req.Settings.AIProvider, req.Settings.Model)
 
 	// Check if template docs are already being generated with same settings
-	if existingWikiID, exists := s.repoURLToWiki[templateDocsKey]; exists {
-		if existingWiki, wikiExists := s.activeWikis[existingWikiID]; wikiExists {
-			// Only block if the existing wiki is still in progress
-			if existingWiki.Status == models.WikiStatusPending ||
-				existingWiki.Status == models.WikiStatusAnalyzing ||
-				existingWiki.Status == models.WikiStatusGenerating {
-
-				c.JSON(http.StatusConflict, gin.H{
-					"error":            "Template documentation is already being generated with these settings",
-					"existing_wiki_id": existingWiki.ID,
-					"status":           existingWiki.Status,
-					"settings":         req.Settings,
-				})
-				return
-			}
+	if existingWiki, exists := s.wikiForRepo(templateDocsKey); exists {
+		// Only block if the existing wiki is still in progress
+		if existingWiki.Status == models.WikiStatusPending ||
+			existingWiki.Status == models.WikiStatusAnalyzing ||
+			existingWiki.Status == models.WikiStatusGenerating {
+
+			c.JSON(http.StatusConflict, gin.H{
+				"error":            "Template documentation is already being generated with these settings",
+				"existing_wiki_id": existingWiki.ID,
+				"status":           existingWiki.Status,
+				"settings":         req.Settings,
+			})
+			return
 		}
 	}
 
@@ -604,9 +779,10 @@ func (s *Server) handleTemplateDocsGeneration(c *gin.Context, req models.Generat
 		return
 	}
 
+	wiki.Metadata.Access = newWikiAccess(currentPrincipal(c), req)
+
 	// Store active wiki and mapping
-	s.activeWikis[wiki.ID] = wiki
-	s.repoURLToWiki[templateDocsKey] = wiki.ID
+	s.storeWiki(wiki, templateDocsKey)
 
 	// Save to persistent storage
 	if err := s.saveWikiToStorage(wiki); err != nil {
@@ -614,10 +790,10 @@ func (s *Server) handleTemplateDocsGeneration(c *gin.Context, req models.Generat
 	}
 
 	// Add initial log entries
-	s.addWikiLog(wiki.ID, "Template documentation generation started")
-	s.addWikiLog(wiki.ID, fmt.Sprintf("Target languages: %v", req.Languages))
-	s.addWikiLog(wiki.ID, fmt.Sprintf("Using AI provider: %s, Model: %s", req.Settings.AIProvider, req.Settings.Model))
-	s.addWikiLog(wiki.ID, fmt.Sprintf("Title: %s", req.Title))
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, "Template documentation generation started")
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, fmt.Sprintf("Target languages: %v", req.Languages))
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, fmt.Sprintf("Using AI provider: %s, Model: %s", req.Settings.AIProvider, req.Settings.Model))
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, fmt.Sprintf("Title: %s", req.Title))
 
 	log.Printf("Template docs generation started successfully, Wiki ID: %s", wiki.ID)
 
@@ -633,6 +809,10 @@ func (s *Server) handleTemplateDocsGeneration(c *gin.Context, req models.Generat
 // handleWebSocket handles WebSocket connections for real-time updates
 func (s *Server) handleWebSocket(c *gin.Context) {
 	wikiID := c.Param("wikiId")
+	if _, visible := s.visibleWiki(c, wikiID); !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
+		return
+	}
 
 	conn, err := s.wsUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -642,11 +822,13 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 	defer conn.Close()
 
 	// Store connection
+	s.wsMutex.Lock()
 	s.wsConnections[wikiID] = conn
+	s.wsMutex.Unlock()
 
 	// Send initial status
-	if wiki, exists := s.activeWikis[wikiID]; exists {
-		conn.WriteJSON(map[string]interface{}{
+	if wiki, exists := s.getWiki(wikiID); exists {
+		s.writeWebSocket(wikiID, map[string]interface{}{
 			"type":     "status",
 			"wiki_id":  wikiID,
 			"status":   wiki.Status,
@@ -654,6 +836,18 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 		})
 	}
 
+	// Replay recent logs so late subscribers see what already happened
+	s.logsMutex.RLock()
+	recent := append([]models.WikiLogEntry(nil), s.wikiLogs[wikiID]...)
+	s.logsMutex.RUnlock()
+	if len(recent) > 0 {
+		s.writeWebSocket(wikiID, map[string]interface{}{
+			"type":    "logs",
+			"wiki_id": wikiID,
+			"entries": recent,
+		})
+	}
+
 	// Keep connection alive and handle messages
 	for {
 		_, _, err := conn.ReadMessage()
@@ -664,29 +858,44 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 	}
 
 	// Clean up connection
-	delete(s.wsConnections, wikiID)
+	s.wsMutex.Lock()
+	if s.wsConnections[wikiID] == conn {
+		delete(s.wsConnections, wikiID)
+	}
+	s.wsMutex.Unlock()
 }
 
-// broadcastProgress broadcasts progress updates to WebSocket clients
-func (s *Server) broadcastProgress(wikiID string, progress models.GenerationProgress) {
+// writeWebSocket sends a JSON message to the WebSocket client watching a wiki.
+// Writes are serialized because progress and log monitors run concurrently.
+func (s *Server) writeWebSocket(wikiID string, payload interface{}) {
+	s.wsMutex.Lock()
+	defer s.wsMutex.Unlock()
+
 	if conn, exists := s.wsConnections[wikiID]; exists {
-		conn.WriteJSON(map[string]interface{}{
-			"type":         "progress",
-			"wiki_id":      progress.WikiID,
-			"status":       progress.Status,
-			"progress":     progress.Progress,
-			"current_step": progress.CurrentStep,
-			"message":      progress.Message,
-			"error":        progress.Error,
-		})
+		if err := conn.WriteJSON(payload); err != nil {
+			log.Printf("WebSocket write error for wiki %s: %v", wikiID, err)
+		}
 	}
 }
 
+// broadcastProgress broadcasts progress updates to WebSocket clients
+func (s *Server) broadcastProgress(wikiID string, progress models.GenerationProgress) {
+	s.writeWebSocket(wikiID, map[string]interface{}{
+		"type":         "progress",
+		"wiki_id":      progress.WikiID,
+		"status":       progress.Status,
+		"progress":     progress.Progress,
+		"current_step": progress.CurrentStep,
+		"message":      progress.Message,
+		"error":        progress.Error,
+	})
+}
+
 // handleGetWiki returns wiki information
 func (s *Server) handleGetWiki(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
@@ -699,7 +908,7 @@ func (s *Server) handleGetWiki(c *gin.Context) {
 func (s *Server) handleGetProgress(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
@@ -730,28 +939,7 @@ func getWikiIDFromParam(c *gin.Context, paramName string) string {
 
 // handleGetLogs returns the generation logs for a specific wiki
 func (s *Server) handleGetLogs(c *gin.Context) {
-	rawParam := c.Param("id")
-	wikiID := getWikiIDFromParam(c, "id")
-	log.Printf("handleGetLogs: rawParam='%s', decoded wikiID='%s'", rawParam, wikiID)
-
-	// First try to get logs from memory (for active generation)
-	logs, exists := s.wikiLogs[wikiID]
-
-	// If not in memory, try to read from storage
-	if !exists {
-		storageLogs, err := s.storage.LoadLogs(wikiID)
-		if err != nil {
-			log.Printf("Failed to read logs for wiki %s: %v", wikiID, err)
-			logs = []string{} // Return empty array if no logs exist
-		} else {
-			logs = storageLogs
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"wiki_id": wikiID,
-		"logs":    logs,
-	})
+	s.respondLogs(c, getWikiIDFromParam(c, "id"))
 }
 
 // handleGetLogsQuery returns the generation logs using query parameter
@@ -762,25 +950,67 @@ func (s *Server) handleGetLogsQuery(c *gin.Context) {
 		return
 	}
 
-	log.Printf("handleGetLogsQuery: wikiID='%s'", wikiID)
+	s.respondLogs(c, wikiID)
+}
 
-	// First try to get logs from memory (for active generation)
-	logs, exists := s.wikiLogs[wikiID]
+// respondLogs writes the filtered, paginated logs of a wiki.
+// Supported query parameters: level (comma separated), step, offset, limit.
+func (s *Server) respondLogs(c *gin.Context, wikiID string) {
+	if _, visible := s.visibleWiki(c, wikiID); !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
+		return
+	}
 
-	// If not in memory, try to read from storage
-	if !exists {
-		storageLogs, err := s.storage.LoadLogs(wikiID)
-		if err != nil {
-			log.Printf("Failed to read logs for wiki %s: %v", wikiID, err)
-			logs = []string{} // Return empty array if no logs exist
-		} else {
-			logs = storageLogs
+	logs, err := s.storage.LoadLogs(wikiID)
+	if err != nil {
+		log.Printf("Failed to read logs for wiki %s: %v", wikiID, err)
+
+		// Fall back to the in-memory tail
+		s.logsMutex.RLock()
+		logs = append([]models.WikiLogEntry(nil), s.wikiLogs[wikiID]...)
+		s.logsMutex.RUnlock()
+	}
+
+	levels := make(map[models.LogLevel]bool)
+	for _, level := range strings.Split(c.Query("level"), ",") {
+		if level = strings.TrimSpace(level); level != "" {
+			levels[models.LogLevel(level)] = true
+		}
+	}
+	step := c.Query("step")
+
+	filtered := make([]models.WikiLogEntry, 0, len(logs))
+	for _, entry := range logs {
+		if len(levels) > 0 && !levels[entry.Level] {
+			continue
+		}
+		if step != "" && entry.Step != step {
+			continue
 		}
+		filtered = append(filtered, entry)
 	}
 
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 200
+	} else if limit > 1000 {
+		limit = 1000
+	}
+
+	total := len(filtered)
+	start := utils.Min(offset, total)
+	end := utils.Min(start+limit, total)
+
 	c.JSON(http.StatusOK, gin.H{
 		"wiki_id": wikiID,
-		"logs":    logs,
+		"logs":    filtered[start:end],
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
 	})
 }
 
@@ -790,32 +1020,45 @@ func (s *Server) handleDeleteWiki(c *gin.Context) {
 
 	log.Printf("删除Wiki请求: %s", wikiID)
 
-	// 首先尝试从持久化存储中删除
-	if err := s.storage.DeleteWiki(wikiID); err != nil {
-		log.Printf("从存储中删除Wiki失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete wiki from storage: " + err.Error()})
+	// 只有所有者和管理员可以删除；仅存在于存储中的Wiki只有管理员可以删除
+	if _, exists := s.getWiki(wikiID); exists {
+		if _, ok := s.authorizeWiki(c, wikiID, models.WikiRoleOwner); !ok {
+			return
+		}
+	} else if s.config.Auth.Enabled && !currentPrincipal(c).Has(auth.ScopeAdmin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
 	}
 
-	// 从内存中删除
-	delete(s.activeWikis, wikiID)
-
-	// 清理仓库URL映射
-	for repoURL, id := range s.repoURLToWiki {
-		if id == wikiID {
-			delete(s.repoURLToWiki, repoURL)
-			break
+	// 首先尝试从持久化存储中删除
+	if err := s.storage.DeleteWiki(wikiID); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("从存储中删除Wiki失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete wiki from storage: " + err.Error()})
+			return
+		}
+		// 尚未持久化的Wiki只存在于内存中
+		if _, exists := s.getWiki(wikiID); !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
+			return
 		}
 	}
 
+	// 从内存和仓库URL映射中删除
+	s.removeWiki(wikiID)
+
 	// 清理日志
+	s.logsMutex.Lock()
 	delete(s.wikiLogs, wikiID)
+	s.logsMutex.Unlock()
 
 	// 关闭WebSocket连接
+	s.wsMutex.Lock()
 	if conn, exists := s.wsConnections[wikiID]; exists {
 		conn.Close()
 		delete(s.wsConnections, wikiID)
 	}
+	s.wsMutex.Unlock()
 
 	log.Printf("Wiki %s 删除成功", wikiID)
 	c.JSON(http.StatusOK, gin.H{"message": "Wiki deleted successfully"})
@@ -823,20 +1066,15 @@ func (s *Server) handleDeleteWiki(c *gin.Context) {
 
 // handleListWikis returns all wikis
 func (s *Server) handleListWikis(c *gin.Context) {
-	wikis := make([]*models.Wiki, 0, len(s.activeWikis))
-	for _, wiki := range s.activeWikis {
-		wikis = append(wikis, wiki)
-	}
-
-	c.JSON(http.StatusOK, wikis)
+	c.JSON(http.StatusOK, s.visibleWikis(c))
 }
 
 // handleGetTags returns all unique tags from all wikis
 func (s *Server) handleGetTags(c *gin.Context) {
 	tagSet := make(map[string]int) // tag -> count
 
-	// Collect tags from all wikis
-	for _, wiki := range s.activeWikis {
+	// Collect tags from all wikis the caller may see
+	for _, wiki := range s.visibleWikis(c) {
 		// Wiki-level tags
 		for _, tag := range wiki.Tags {
 			tagSet[tag]++
@@ -875,9 +1113,25 @@ func (s *Server) handleGetWikisByTag(c *gin.Context) {
 		return
 	}
 
+	// Backends with native queries avoid scanning every wiki in memory
+	if querier, ok := s.storage.(storage.WikiQuerier); ok {
+		wikis, err := querier.FindWikisByTag(tag)
+		if err == nil {
+			visible := make([]*models.Wiki, 0, len(wikis))
+			for _, wiki := range wikis {
+				if s.canAccess(c, wiki, models.WikiRoleViewer) {
+					visible = append(visible, wiki)
+				}
+			}
+			c.JSON(http.StatusOK, visible)
+			return
+		}
+		log.Printf("Failed to query wikis by tag %s: %v", tag, err)
+	}
+
 	var filteredWikis []*models.Wiki
 
-	for _, wiki := range s.activeWikis {
+	for _, wiki := range s.visibleWikis(c) {
 		// Check wiki-level tags
 		hasTag := false
 		for _, wikiTag := range wiki.Tags {
@@ -914,13 +1168,39 @@ func (s *Server) handleGetWikisByTag(c *gin.Context) {
 func (s *Server) handleGetPages(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, wiki.Pages)
+	// ?lang= narrows the generated and translated pages to one language
+	language := c.Query("lang")
+	if language == "" {
+		c.JSON(http.StatusOK, wiki.Pages)
+		return
+	}
+	pages := []models.WikiPage{}
+	for _, page := range wiki.AllPages() {
+		if page.Language == language {
+			pages = append(pages, page)
+		}
+	}
+	c.JSON(http.StatusOK, pages)
+}
+
+// lookupPage finds a page by ID, or by its canonical key in the ?lang= language
+// (the primary language when omitted), so /page/overview?lang=ja resolves
+// to the Japanese overview
+func lookupPage(c *gin.Context, wiki *models.Wiki, pageID string) *models.WikiPage {
+	if page := wiki.FindPage(pageID); page != nil {
+		return page
+	}
+	language := c.Query("lang")
+	if language == "" {
+		language = wiki.Language
+	}
+	return wiki.PageInLanguage(pageID, language)
 }
 
 // handleGetPage returns a specific page
@@ -928,17 +1208,15 @@ func (s *Server) handleGetPage(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 	pageID := getWikiIDFromParam(c, "pageId")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
 	}
 
-	for _, page := range wiki.Pages {
-		if page.ID == pageID {
-			c.JSON(http.StatusOK, page)
-			return
-		}
+	if page := lookupPage(c, wiki, pageID); page != nil {
+		c.JSON(http.StatusOK, page)
+		return
 	}
 
 	c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
@@ -948,7 +1226,7 @@ func (s *Server) handleGetPage(c *gin.Context) {
 func (s *Server) handleGetDiagrams(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
@@ -967,12 +1245,24 @@ func (s *Server) handleSearch(c *gin.Context) {
 		return
 	}
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
 	}
 
+	// Let the backend narrow the candidate pages when it can
+	if querier, ok := s.storage.(storage.WikiQuerier); ok {
+		pages, err := querier.SearchPages(wikiID, query, 100)
+		if err == nil {
+			narrowed := *wiki
+			narrowed.Pages = pages
+			wiki = &narrowed
+		} else {
+			log.Printf("Failed to search wiki %s: %v", wikiID, err)
+		}
+	}
+
 	results := s.performSearch(wiki, query)
 	c.JSON(http.StatusOK, results)
 }
@@ -1067,7 +1357,7 @@ func (s *Server) calculateSearchScore(title, content, query string) float64 {
 func (s *Server) handleWikiView(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
 			"title": "Wiki Not Found",
@@ -1077,8 +1367,10 @@ func (s *Server) handleWikiView(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "wiki.html", gin.H{
-		"title": wiki.Title,
-		"wiki":  wiki,
+		"title":    wiki.Title,
+		"wiki":     wiki,
+		"pages":    wiki.AllPages(),
+		"versions": s.packageVersions(c, wiki.PackagePath),
 	})
 }
 
@@ -1086,28 +1378,18 @@ func (s *Server) handleWikiView(c *gin.Context) {
 func (s *Server) handlePackageRoute(c *gin.Context) {
 	packagePath := strings.TrimPrefix(c.Param("packagePath"), "/")
 	log.Printf("handlePackageRoute: 请求包路径: %s", packagePath)
-	log.Printf("handlePackageRoute: 当前活跃wikis数量: %d", len(s.activeWikis))
-
-	for id, wiki := range s.activeWikis {
-		log.Printf("handlePackageRoute: Wiki ID=%s, PackagePath=%s", id, wiki.PackagePath)
-	}
+	log.Printf("handlePackageRoute: 当前活跃wikis数量: %d", len(s.activeWikiList()))
 
 	// Check if this is a page request (ends with /page/pageId)
 	if strings.Contains(packagePath, "/page/") {
 		// Extract package path and page ID
 		parts := strings.Split(packagePath, "/page/")
 		if len(parts) == 2 {
-			actualPackagePath := parts[0]
+			actualPackagePath, ref := utils.SplitPackageRef(parts[0])
 			pageID := parts[1]
 
-			// Find wiki by package path
-			var foundWiki *models.Wiki
-			for _, wiki := range s.activeWikis {
-				if wiki.PackagePath == actualPackagePath {
-					foundWiki = wiki
-					break
-				}
-			}
+			// Find wiki by package path and optional @ref
+			foundWiki := s.findPackageWiki(c, actualPackagePath, ref)
 
 			if foundWiki == nil {
 				c.HTML(http.StatusNotFound, "error.html", gin.H{
@@ -1118,14 +1400,7 @@ func (s *Server) handlePackageRoute(c *gin.Context) {
 			}
 
 			// Find the specific page
-			var foundPage *models.WikiPage
-			for _, page := range foundWiki.Pages {
-				if page.ID == pageID {
-					foundPage = &page
-					break
-				}
-			}
-
+			foundPage := lookupPage(c, foundWiki, pageID)
 			if foundPage == nil {
 				c.HTML(http.StatusNotFound, "error.html", gin.H{
 					"title": "Page Not Found",
@@ -1135,23 +1410,20 @@ func (s *Server) handlePackageRoute(c *gin.Context) {
 			}
 
 			c.HTML(http.StatusOK, "wiki.html", gin.H{
-				"title": foundPage.Title,
-				"wiki":  foundWiki,
-				"page":  foundPage,
+				"title":    foundPage.Title,
+				"wiki":     foundWiki,
+				"pages":    foundWiki.AllPages(),
+				"page":     foundPage,
+				"versions": s.packageVersions(c, foundWiki.PackagePath),
 			})
 			return
 		}
 	}
 
 	// This is a wiki request
-	// Find wiki by package path
-	var foundWiki *models.Wiki
-	for _, wiki := range s.activeWikis {
-		if wiki.PackagePath == packagePath {
-			foundWiki = wiki
-			break
-		}
-	}
+	// Find wiki by package path and optional @ref (e.g. /pkg/github.com/gin-gonic/gin@v1.9.1)
+	packagePath, ref := utils.SplitPackageRef(packagePath)
+	foundWiki := s.findPackageWiki(c, packagePath, ref)
 
 	if foundWiki == nil {
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
@@ -1162,8 +1434,10 @@ func (s *Server) handlePackageRoute(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "wiki.html", gin.H{
-		"title": foundWiki.Title,
-		"wiki":  foundWiki,
+		"title":    foundWiki.Title,
+		"wiki":     foundWiki,
+		"pages":    foundWiki.AllPages(),
+		"versions": s.packageVersions(c, foundWiki.PackagePath),
 	})
 }
 
@@ -1172,7 +1446,7 @@ func (s *Server) handlePageView(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 	pageID := getWikiIDFromParam(c, "pageId")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
 			"title": "Wiki Not Found",
@@ -1181,14 +1455,7 @@ func (s *Server) handlePageView(c *gin.Context) {
 		return
 	}
 
-	var page *models.WikiPage
-	for _, p := range wiki.Pages {
-		if p.ID == pageID {
-			page = &p
-			break
-		}
-	}
-
+	page := lookupPage(c, wiki, pageID)
 	if page == nil {
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
 			"title": "Page Not Found",
@@ -1209,146 +1476,24 @@ func (s *Server) handleExport(c *gin.Context) {
 	wikiID := getWikiIDFromParam(c, "id")
 	format := c.Param("format")
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
 	}
 
-	switch format {
-	case "markdown":
-		s.exportMarkdown(c, wiki)
-	case "json":
-		s.exportJSON(c, wiki)
-	case "html":
-		s.exportHTML(c, wiki)
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format"})
-	}
-}
-
-// exportMarkdown exports wiki as markdown
-func (s *Server) exportMarkdown(c *gin.Context, wiki *models.Wiki) {
-	var content strings.Builder
-
-	// Write title and description
-	content.WriteString(fmt.Sprintf("# %s\n\n", wiki.Title))
-	if wiki.Description != "" {
-		content.WriteString(fmt.Sprintf("%s\n\n", wiki.Description))
-	}
-
-	// Write table of contents
-	content.WriteString("## Table of Contents\n\n")
-	for _, page := range wiki.Pages {
-		content.WriteString(fmt.Sprintf("- [%s](#%s)\n", page.Title, strings.ToLower(strings.ReplaceAll(page.Title, " ", "-"))))
-	}
-	content.WriteString("\n")
-
-	// Write pages
-	for _, page := range wiki.Pages {
-		content.WriteString(fmt.Sprintf("## %s\n\n", page.Title))
-		content.WriteString(fmt.Sprintf("%s\n\n", page.Content))
-	}
-
-	// Write diagrams
-	if len(wiki.Diagrams) > 0 {
-		content.WriteString("## Diagrams\n\n")
-		for _, diagram := range wiki.Diagrams {
-			content.WriteString(fmt.Sprintf("### %s\n\n", diagram.Title))
-			if diagram.Description != "" {
-				content.WriteString(fmt.Sprintf("%s\n\n", diagram.Description))
-			}
-			content.WriteString("```mermaid\n")
-			content.WriteString(diagram.Content)
-			content.WriteString("\n```\n\n")
-		}
-	}
-
-	filename := fmt.Sprintf("%s-wiki.md", strings.ReplaceAll(wiki.Title, " ", "-"))
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.Header("Content-Type", "text/markdown")
-	c.String(http.StatusOK, content.String())
-}
-
-// exportJSON exports wiki as JSON
-func (s *Server) exportJSON(c *gin.Context, wiki *models.Wiki) {
-	filename := fmt.Sprintf("%s-wiki.json", strings.ReplaceAll(wiki.Title, " ", "-"))
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.JSON(http.StatusOK, wiki)
-}
-
-// exportHTML exports wiki as HTML
-func (s *Server) exportHTML(c *gin.Context, wiki *models.Wiki) {
-	var content strings.Builder
-
-	// HTML header
-	content.WriteString(`<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>` + wiki.Title + `</title>
-    <script src="https://cdn.jsdelivr.net/npm/mermaid/dist/mermaid.min.js"></script>
-    <style>
-        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
-        h1, h2, h3 { color: #333; }
-        pre { background: #f5f5f5; padding: 15px; border-radius: 5px; overflow-x: auto; }
-        code { background: #f5f5f5; padding: 2px 4px; border-radius: 3px; }
-        .mermaid { text-align: center; }
-    </style>
-</head>
-<body>`)
-
-	// Title and description
-	content.WriteString(fmt.Sprintf("<h1>%s</h1>", wiki.Title))
-	if wiki.Description != "" {
-		content.WriteString(fmt.Sprintf("<p>%s</p>", wiki.Description))
-	}
-
-	// Table of contents
-	content.WriteString("<h2>Table of Contents</h2><ul>")
-	for _, page := range wiki.Pages {
-		anchor := strings.ToLower(strings.ReplaceAll(page.Title, " ", "-"))
-		content.WriteString(fmt.Sprintf(`<li><a href="#%s">%s</a></li>`, anchor, page.Title))
-	}
-	content.WriteString("</ul>")
-
-	// Pages (convert markdown to HTML - simplified)
-	for _, page := range wiki.Pages {
-		anchor := strings.ToLower(strings.ReplaceAll(page.Title, " ", "-"))
-		content.WriteString(fmt.Sprintf(`<h2 id="%s">%s</h2>`, anchor, page.Title))
-
-		// Simple markdown to HTML conversion
-		htmlContent := strings.ReplaceAll(page.Content, "\n", "<br>")
-		htmlContent = strings.ReplaceAll(htmlContent, "**", "<strong>")
-		htmlContent = strings.ReplaceAll(htmlContent, "**", "</strong>")
-		content.WriteString(fmt.Sprintf("<div>%s</div>", htmlContent))
-	}
-
-	// Diagrams
-	if len(wiki.Diagrams) > 0 {
-		content.WriteString("<h2>Diagrams</h2>")
-		for _, diagram := range wiki.Diagrams {
-			content.WriteString(fmt.Sprintf("<h3>%s</h3>", diagram.Title))
-			if diagram.Description != "" {
-				content.WriteString(fmt.Sprintf("<p>%s</p>", diagram.Description))
-			}
-			content.WriteString(fmt.Sprintf(`<div class="mermaid">%s</div>`, diagram.Content))
+	result, err := export.Render(wiki, models.ExportFormat(format))
+	if err != nil {
+		if errors.Is(err, export.ErrUnsupportedFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format"})
+			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// HTML footer
-	content.WriteString(`
-    <script>
-        mermaid.initialize({ startOnLoad: true });
-    </script>
-</body>
-</html>`)
-
-	filename := fmt.Sprintf("%s-wiki.html", strings.ReplaceAll(wiki.Title, " ", "-"))
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, content.String())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", result.Filename))
+	c.Data(http.StatusOK, result.ContentType, result.Content)
 }
 
 // handleChat handles RAG chat requests
@@ -1364,7 +1509,7 @@ func (s *Server) handleChat(c *gin.Context) {
 		return
 	}
 
-	wiki, exists := s.activeWikis[wikiID]
+	wiki, exists := s.visibleWiki(c, wikiID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
 		return
@@ -1375,6 +1520,14 @@ func (s *Server) handleChat(c *gin.Context) {
 		return
 	}
 
+	s.saveChatMessage(&models.ChatMessage{
+		ID:        utils.GenerateID(),
+		WikiID:    wikiID,
+		Role:      models.MessageRoleUser,
+		Content:   req.Message,
+		Timestamp: time.Now(),
+	})
+
 	// Simple RAG implementation - find relevant content
 	context := s.findRelevantContent(wiki, req.Message)
 
@@ -1410,10 +1563,22 @@ Please provide a helpful and accurate answer based on the documentation provided
 		Timestamp:  time.Now(),
 		TokensUsed: response.TokensUsed,
 	}
+	s.saveChatMessage(&chatMessage)
 
 	c.JSON(http.StatusOK, chatMessage)
 }
 
+// saveChatMessage persists a chat message when the storage backend supports it
+func (s *Server) saveChatMessage(msg *models.ChatMessage) {
+	chatStorage, ok := s.storage.(storage.ChatStorage)
+	if !ok {
+		return
+	}
+	if err := chatStorage.SaveChatMessage(msg); err != nil {
+		log.Printf("Failed to save chat message for wiki %s: %v", msg.WikiID, err)
+	}
+}
+
 // findRelevantContent finds relevant content for RAG
 func (s *Server) findRelevantContent(wiki *models.Wiki, query string) []string {
 	var relevantContent []string
@@ -1440,11 +1605,26 @@ func (s *Server) findRelevantContent(wiki *models.Wiki, query string) []string {
 	return relevantContent
 }
 
-// handleChatHistory returns chat history (placeholder)
+// handleChatHistory returns chat history; backends without chat persistence return an empty history
 func (s *Server) handleChatHistory(c *gin.Context) {
-	_ = getWikiIDFromParam(c, "id") // wikiID for future use
+	wikiID := getWikiIDFromParam(c, "id")
+	if _, visible := s.visibleWiki(c, wikiID); !visible {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
+		return
+	}
+
+	chatStorage, ok := s.storage.(storage.ChatStorage)
+	if !ok {
+		c.JSON(http.StatusOK, []models.ChatMessage{})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	messages, err := chatStorage.LoadChatHistory(wikiID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load chat history"})
+		return
+	}
 
-	// In a real implementation, this would retrieve chat history from storage
-	// For now, return empty history
-	c.JSON(http.StatusOK, []models.ChatMessage{})
+	c.JSON(http.StatusOK, messages)
 }
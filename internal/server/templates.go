@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/auth"
+	"github.com/stcn52/kwiki/internal/generator"
+)
+
+// templateRenderTimeout bounds a sample render, which runs user supplied templates
+const templateRenderTimeout = 5 * time.Second
+
+// templateRequest is the body of template create, update and render requests
+type templateRequest struct {
+	Name    string          `json:"name"`    // Template name, only used when creating
+	Content string          `json:"content"` // The whole file, front matter included
+	Data    json.RawMessage `json:"data"`    // Render only: fields merged over the sample data
+}
+
+// handleListTemplates lists the prompt templates with their validation
+// problems, of the language given in ?lang= or of all languages
+func (s *Server) handleListTemplates(c *gin.Context) {
+	templates, err := s.wikiGenerator.Templates().ListTemplates(c.Query("lang"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// handleGetTemplate returns a template file
+func (s *Server) handleGetTemplate(c *gin.Context) {
+	file, err := s.wikiGenerator.Templates().ReadTemplate(c.Param("lang"), c.Param("name"))
+	if err != nil {
+		s.templateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// handleCreateTemplate validates and creates a template
+func (s *Server) handleCreateTemplate(c *gin.Context) {
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.saveTemplate(c, c.Param("lang"), req.Name, req.Content, true)
+}
+
+// handleUpdateTemplate validates and replaces a template
+func (s *Server) handleUpdateTemplate(c *gin.Context) {
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.saveTemplate(c, c.Param("lang"), c.Param("name"), req.Content, false)
+}
+
+func (s *Server) saveTemplate(c *gin.Context, language, name, content string, create bool) {
+	templates := s.wikiGenerator.Templates()
+	if err := templates.SaveTemplate(language, name, content, create); err != nil {
+		s.templateError(c, err)
+		return
+	}
+	file, err := templates.ReadTemplate(language, name)
+	if err != nil {
+		s.templateError(c, err)
+		return
+	}
+	status := http.StatusOK
+	if create {
+		status = http.StatusCreated
+	}
+	c.JSON(status, file)
+}
+
+// handleRenderTemplate renders a template with sample data without calling
+// the AI. The body may carry unsaved content to preview (admin scope) and data
+// fields to merge over the sample data; validation problems are reported alongside.
+func (s *Server) handleRenderTemplate(c *gin.Context) {
+	var req templateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Unsaved content is arbitrary template code; only admins, who may save
+	// templates anyway, can run it. Others preview the saved templates.
+	if req.Content != "" && s.config.Auth.Enabled && !currentPrincipal(c).Has(auth.ScopeAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin scope required to render unsaved template content"})
+		return
+	}
+
+	templates := s.wikiGenerator.Templates()
+	language, name := c.Param("lang"), c.Param("name")
+	content := req.Content
+	if content == "" {
+		file, err := templates.ReadTemplate(language, name)
+		if err != nil {
+			s.templateError(c, err)
+			return
+		}
+		content = file.Content
+	}
+
+	var problems []string
+	var invalid *generator.TemplateValidationError
+	if err := templates.ValidateTemplate(name, content); errors.As(err, &invalid) {
+		problems = invalid.Problems
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), templateRenderTimeout)
+	defer cancel()
+	prompt, err := templates.RenderSample(ctx, language, name, content, req.Data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "problems": problems})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prompt": prompt, "problems": problems})
+}
+
+// templateError maps template errors to HTTP responses
+func (s *Server) templateError(c *gin.Context, err error) {
+	var invalid *generator.TemplateValidationError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "problems": invalid.Problems})
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+	case errors.Is(err, generator.ErrTemplateExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
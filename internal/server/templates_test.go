@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/ai"
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/generator"
+)
+
+func TestTemplateAPI(t *testing.T) {
+	// The generator reads templates/prompts relative to the working directory
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "templates", "prompts", "en"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	readme := "---\ntitle: README\ntype: overview\norder: 1\n---\n# {{.ProjectName}}\n"
+	if err := os.WriteFile(filepath.Join(dir, "templates", "prompts", "en", "readme.md"), []byte(readme), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{config: config.Default(), wikiGenerator: generator.New(config.Default(), ai.NewProviderManager())}
+	router := gin.New()
+	router.GET("/api/templates", s.handleListTemplates)
+	router.GET("/api/templates/:lang/:name", s.handleGetTemplate)
+	router.POST("/api/templates/:lang/:name/render", s.handleRenderTemplate)
+	router.POST("/api/templates/:lang", s.handleCreateTemplate)
+	router.PUT("/api/templates/:lang/:name", s.handleUpdateTemplate)
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	body := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	if code, resp := do("GET", "/api/templates?lang=en", ""); code != http.StatusOK || len(resp["templates"].([]interface{})) != 1 {
+		t.Fatalf("list = %d %v", code, resp)
+	}
+	if code, resp := do("GET", "/api/templates/en/readme", ""); code != http.StatusOK || resp["content"] != readme {
+		t.Errorf("get = %d %v", code, resp)
+	}
+	if code, _ := do("GET", "/api/templates/en/missing", ""); code != http.StatusNotFound {
+		t.Errorf("get missing = %d", code)
+	}
+
+	usage := "---\ntitle: Usage\ntype: guide\norder: 2\n---\nHow to use {{.ProjectName}}\n"
+	if code, resp := do("POST", "/api/templates/en", body(map[string]string{"name": "usage", "content": usage})); code != http.StatusCreated {
+		t.Fatalf("create = %d %v", code, resp)
+	}
+	if code, _ := do("POST", "/api/templates/en", body(map[string]string{"name": "usage", "content": usage})); code != http.StatusConflict {
+		t.Errorf("create existing = %d", code)
+	}
+	code, resp := do("PUT", "/api/templates/en/usage", body(map[string]string{"content": "---\ntitle: Usage\ntype: guide\norder: 2\n---\n{{.Projekt}}\n"}))
+	if code != http.StatusBadRequest || len(resp["problems"].([]interface{})) != 1 {
+		t.Errorf("invalid update = %d %v", code, resp)
+	}
+	if code, _ := do("PUT", "/api/templates/en/nope", body(map[string]string{"content": usage})); code != http.StatusNotFound {
+		t.Errorf("update missing = %d", code)
+	}
+
+	if code, resp := do("POST", "/api/templates/en/usage/render", ""); code != http.StatusOK || resp["prompt"] != "How to use example\n" {
+		t.Errorf("render = %d %v", code, resp)
+	}
+	code, resp = do("POST", "/api/templates/en/usage/render", body(map[string]interface{}{
+		"content": "---\ntitle: Usage\ntype: guide\norder: 2\n---\n{{.ProjectName}} {{.Nope}}\n",
+		"data":    map[string]string{"ProjectName": "acme"},
+	}))
+	if code != http.StatusUnprocessableEntity || len(resp["problems"].([]interface{})) != 1 {
+		t.Errorf("render invalid = %d %v", code, resp)
+	}
+
+	// With authentication, unsaved content needs the admin scope; saved templates still render
+	s.config.Auth.Enabled = true
+	if code, resp := do("POST", "/api/templates/en/usage/render", body(map[string]string{"content": usage})); code != http.StatusForbidden {
+		t.Errorf("render content without admin = %d %v", code, resp)
+	}
+	if code, resp := do("POST", "/api/templates/en/usage/render", body(map[string]interface{}{"data": map[string]string{"ProjectName": "acme"}})); code != http.StatusOK || resp["prompt"] != "How to use acme\n" {
+		t.Errorf("render saved without admin = %d %v", code, resp)
+	}
+}
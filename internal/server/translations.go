@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/generator"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// languageCodePattern accepts language codes such as ja, pt-BR or zh_TW
+var languageCodePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})?$`)
+
+// translateRequest is the optional body of a translation request
+type translateRequest struct {
+	Glossary []string `json:"glossary"` // Terms kept untranslated, in addition to the keys of settings.glossary
+}
+
+// handleTranslateWiki translates the primary-language pages of a wiki into
+// ?lang= in the background and stores the result in wiki.Translations
+// (POST /api/wiki/:id/translate?lang=ja, optional body {"glossary": ["Gin"]}).
+// Languages the wiki was generated in are rejected. Progress is reported in
+// the wiki logs.
+func (s *Server) handleTranslateWiki(c *gin.Context) {
+	wikiID := getWikiIDFromParam(c, "id")
+
+	wiki, ok := s.authorizeWiki(c, wikiID, models.WikiRoleEditor)
+	if !ok {
+		return
+	}
+
+	language := strings.TrimSpace(c.Query("lang"))
+	if !languageCodePattern.MatchString(language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid language %q", language)})
+		return
+	}
+	var req translateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if language == wiki.Language || (wiki.Language == "" && language == wiki.Settings.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": generator.ErrSameLanguage.Error()})
+		return
+	}
+	for _, generated := range wiki.Languages {
+		if language == generated {
+			c.JSON(http.StatusBadRequest, gin.H{"error": generator.ErrGeneratedLanguage.Error()})
+			return
+		}
+	}
+	if isGenerating(wiki) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The wiki is being generated", "status": wiki.Status})
+		return
+	}
+	if !s.startTranslation(wiki.ID, language) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The wiki is already being translated into %s", language)})
+		return
+	}
+
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepTranslate, fmt.Sprintf("Translation into %s started", language))
+	go s.translateWiki(wiki, language, req.Glossary, false)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"wiki_id":  wiki.ID,
+		"language": language,
+		"message":  "Wiki translation started",
+	})
+}
+
+// handleGetTranslations reports the translations of a wiki and their stale
+// pages: pages whose source page changed, was removed or has no translation
+// yet (GET /api/wiki/:id/translations)
+func (s *Server) handleGetTranslations(c *gin.Context) {
+	wikiID := getWikiIDFromParam(c, "id")
+
+	wiki, exists := s.visibleWiki(c, wikiID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"wiki_id":      wiki.ID,
+		"language":     wiki.Language,
+		"translations": generator.TranslationStatuses(wiki),
+	})
+}
+
+// handleRegenerateStaleTranslations retranslates only the stale pages of the
+// translation ?lang=, or of every translation with stale pages when lang is
+// omitted, in the background (POST /api/wiki/:id/translations/regenerate-stale).
+// Up-to-date pages keep their translation.
+func (s *Server) handleRegenerateStaleTranslations(c *gin.Context) {
+	wikiID := getWikiIDFromParam(c, "id")
+
+	wiki, ok := s.authorizeWiki(c, wikiID, models.WikiRoleEditor)
+	if !ok {
+		return
+	}
+
+	var req translateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if isGenerating(wiki) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The wiki is being generated", "status": wiki.Status})
+		return
+	}
+
+	language := strings.TrimSpace(c.Query("lang"))
+	if language != "" && wiki.Translations[language] == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("The wiki has no %s translation", language)})
+		return
+	}
+	var stale []string
+	for _, status := range generator.TranslationStatuses(wiki) {
+		if len(status.Stale) > 0 && (language == "" || status.Language == language) {
+			stale = append(stale, status.Language)
+		}
+	}
+	if len(stale) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"wiki_id":   wiki.ID,
+			"languages": []string{},
+			"message":   "All translations are up to date",
+		})
+		return
+	}
+
+	var started []string
+	for _, lang := range stale {
+		if s.startTranslation(wiki.ID, lang) {
+			started = append(started, lang)
+		}
+	}
+	if len(started) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The stale translations are already being translated"})
+		return
+	}
+
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepTranslate, fmt.Sprintf("Retranslation of stale pages started: %s", strings.Join(started, ", ")))
+	go func() {
+		for _, lang := range started {
+			s.translateWiki(wiki, lang, req.Glossary, true)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"wiki_id":   wiki.ID,
+		"languages": started,
+		"message":   "Retranslation of stale pages started",
+	})
+}
+
+// translateWiki runs a translation and stores it on the current version of the
+// wiki; with staleOnly only the stale pages of the existing translation are
+// translated. The translation must have been started with startTranslation.
+func (s *Server) translateWiki(wiki *models.Wiki, language string, glossary []string, staleOnly bool) {
+	defer s.finishTranslation(wiki.ID, language)
+
+	var trans *models.WikiTrans
+	var err error
+	translated := -1
+	if staleOnly {
+		trans, translated, err = s.wikiGenerator.RetranslateStale(context.Background(), wiki, language, glossary)
+	} else {
+		trans, err = s.wikiGenerator.TranslateWiki(context.Background(), wiki, language, glossary)
+	}
+	if err != nil {
+		log.Printf("Translation of %s into %s failed: %v", wiki.ID, language, err)
+		s.addWikiLog(wiki.ID, models.LogLevelError, models.LogStepTranslate, fmt.Sprintf("Translation into %s failed: %v", language, err))
+		return
+	}
+	if translated == 0 {
+		s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepTranslate, fmt.Sprintf("The %s translation is up to date", language))
+		return
+	}
+
+	// The wiki may have been regenerated meanwhile, the translation belongs to its current version
+	current, exists := s.getWiki(wiki.ID)
+	if !exists {
+		return
+	}
+	if previous := current.Translations[language]; previous != nil && !previous.CreatedAt.IsZero() {
+		trans.CreatedAt = previous.CreatedAt
+	}
+	translations := make(map[string]*models.WikiTrans, len(current.Translations)+1)
+	for lang, existing := range current.Translations {
+		translations[lang] = existing
+	}
+	translations[language] = trans
+	current.Translations = translations
+
+	if err := s.saveWikiToStorage(current); err != nil {
+		log.Printf("Warning: Failed to save wiki to storage: %v", err)
+		s.addWikiLog(wiki.ID, models.LogLevelError, models.LogStepTranslate, fmt.Sprintf("Failed to save the %s translation: %v", language, err))
+		return
+	}
+	message := fmt.Sprintf("Translation into %s saved: %d pages", language, len(trans.Pages))
+	if staleOnly {
+		message = fmt.Sprintf("Translation into %s saved: %d of %d pages retranslated", language, translated, len(trans.Pages))
+	}
+	s.addWikiLog(wiki.ID, models.LogLevelSuccess, models.LogStepTranslate, message)
+}
+
+// startTranslation marks a translation as running, false when it already is
+func (s *Server) startTranslation(wikiID, language string) bool {
+	s.translationsMutex.Lock()
+	defer s.translationsMutex.Unlock()
+	if s.translating == nil {
+		s.translating = make(map[string]bool)
+	}
+	key := wikiID + "#" + language
+	if s.translating[key] {
+		return false
+	}
+	s.translating[key] = true
+	return true
+}
+
+func (s *Server) finishTranslation(wikiID, language string) {
+	s.translationsMutex.Lock()
+	delete(s.translating, wikiID+"#"+language)
+	s.translationsMutex.Unlock()
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/ai"
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/generator"
+	"github.com/stcn52/kwiki/internal/storage"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// echoProvider "translates" by prefixing the text after the translation rules
+type echoProvider struct{}
+
+func (echoProvider) GetName() string     { return "echo" }
+func (echoProvider) GetModels() []string { return []string{"echo"} }
+func (echoProvider) IsAvailable() bool   { return true }
+func (echoProvider) GetUsage() ai.Usage  { return ai.Usage{} }
+
+func (echoProvider) GenerateText(ctx context.Context, prompt string, options ai.GenerationOptions) (*ai.GenerationResponse, error) {
+	_, text, _ := strings.Cut(prompt, "without wrapping it in a code block.\n\n")
+	return &ai.GenerationResponse{Text: "JA " + text}, nil
+}
+
+func (p echoProvider) GenerateStream(ctx context.Context, prompt string, options ai.GenerationOptions) (<-chan ai.StreamResponse, error) {
+	resp, _ := p.GenerateText(ctx, prompt, options)
+	ch := make(chan ai.StreamResponse, 2)
+	ch <- ai.StreamResponse{Text: resp.Text}
+	ch <- ai.StreamResponse{Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func TestTranslationAPI(t *testing.T) {
+	manager := ai.NewProviderManager()
+	manager.RegisterProvider("echo", echoProvider{})
+	s := &Server{
+		config:        config.Default(),
+		wikiGenerator: generator.New(config.Default(), manager),
+		storage:       storage.NewMarkdownStorage(t.TempDir()),
+		wikiLogs:      make(map[string][]models.WikiLogEntry),
+		activeWikis: map[string]*models.Wiki{"example": {
+			ID:        "example",
+			Title:     "Example",
+			Status:    models.WikiStatusCompleted,
+			Language:  "en",
+			Languages: []string{"en", "zh"},
+			Settings:  models.WikiSettings{AIProvider: "echo", Language: "en"},
+			Pages: []models.WikiPage{
+				{ID: "overview_en", Key: "overview", Language: "en", Title: "Overview", Content: "Overview text\n"},
+				{ID: "setup_en", Key: "setup", Language: "en", Title: "Setup", Content: "Setup text\n"},
+			},
+		}},
+	}
+	router := gin.New()
+	router.POST("/api/wiki/:id/translate", s.handleTranslateWiki)
+	router.GET("/api/wiki/:id/translations", s.handleGetTranslations)
+	router.POST("/api/wiki/:id/translations/regenerate-stale", s.handleRegenerateStaleTranslations)
+	router.GET("/api/wiki/:id/page/:pageId", s.handleGetPage)
+
+	do := func(method, path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	wait := func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			s.translationsMutex.Lock()
+			running := len(s.translating)
+			s.translationsMutex.Unlock()
+			if running == 0 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("translation did not finish")
+	}
+	stale := func() []interface{} {
+		code, resp := do("GET", "/api/wiki/example/translations")
+		translations := resp["translations"].([]interface{})
+		if code != http.StatusOK || len(translations) != 1 {
+			t.Fatalf("translations = %d %v", code, resp)
+		}
+		return translations[0].(map[string]interface{})["stale"].([]interface{})
+	}
+
+	if code, _ := do("POST", "/api/wiki/example/translate?lang=en"); code != http.StatusBadRequest {
+		t.Errorf("same language = %d", code)
+	}
+	if code, _ := do("POST", "/api/wiki/example/translate?lang=zh"); code != http.StatusBadRequest {
+		t.Errorf("generated language = %d", code)
+	}
+	if code, _ := do("POST", "/api/wiki/example/translate?lang=../x"); code != http.StatusBadRequest {
+		t.Errorf("invalid language = %d", code)
+	}
+	if code, _ := do("POST", "/api/wiki/example/translations/regenerate-stale?lang=ja"); code != http.StatusNotFound {
+		t.Errorf("stale of a missing translation = %d", code)
+	}
+	if code, resp := do("POST", "/api/wiki/example/translate?lang=ja"); code != http.StatusAccepted {
+		t.Fatalf("translate = %d %v", code, resp)
+	}
+	wait()
+
+	wiki := s.activeWikis["example"]
+	trans := wiki.Translations["ja"]
+	if trans == nil || len(trans.Pages) != 2 || trans.Pages[1].Content != "JA Setup text\n" {
+		t.Fatalf("translation = %+v", trans)
+	}
+	if len(stale()) != 0 {
+		t.Errorf("fresh translation is stale: %v", stale())
+	}
+	// A translated page is found by its ID or by its key and language
+	for _, path := range []string{"/api/wiki/example/page/setup_ja", "/api/wiki/example/page/setup?lang=ja"} {
+		if code, page := do("GET", path); code != http.StatusOK || page["key"] != "setup" || page["language"] != "ja" {
+			t.Errorf("GET %s = %d %v", path, code, page)
+		}
+	}
+	if code, resp := do("POST", "/api/wiki/example/translations/regenerate-stale"); code != http.StatusOK || len(resp["languages"].([]interface{})) != 0 {
+		t.Errorf("regenerate up-to-date = %d %v", code, resp)
+	}
+
+	// The primary language is regenerated with a changed setup page
+	wiki.Pages[1].Content = "New setup text\n"
+	if pages := stale(); len(pages) != 1 || pages[0].(map[string]interface{})["reason"] != generator.StaleChanged {
+		t.Fatalf("stale pages = %v", pages)
+	}
+	if code, resp := do("POST", "/api/wiki/example/translations/regenerate-stale"); code != http.StatusAccepted {
+		t.Fatalf("regenerate stale = %d %v", code, resp)
+	}
+	wait()
+
+	updated := wiki.Translations["ja"]
+	if updated.Pages[0].Content != trans.Pages[0].Content || updated.Pages[1].Content != "JA New setup text\n" || len(stale()) != 0 {
+		t.Errorf("retranslated pages = %+v", updated.Pages)
+	}
+	loaded, err := s.storage.LoadWiki("example")
+	if err != nil || loaded.Translations["ja"] == nil || loaded.Translations["ja"].Pages[1].Source == nil {
+		t.Errorf("stored translation = %+v, %v", loaded, err)
+	}
+}
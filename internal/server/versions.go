@@ -0,0 +1,157 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/mod/semver"
+
+	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// wikiVersion describes one generated ref of a package for the version switcher
+type wikiVersion struct {
+	Ref       string            `json:"ref"` // empty for the default branch
+	Label     string            `json:"label"`
+	WikiID    string            `json:"wiki_id"`
+	CommitSHA string            `json:"commit_sha,omitempty"`
+	Status    models.WikiStatus `json:"status"`
+	UpdatedAt string            `json:"updated_at"`
+	URL       string            `json:"url"`
+	Default   bool              `json:"default"`
+}
+
+// packageVersions lists the wikis generated for a package path that the
+// caller may see. The default version comes first, then semantic versions
+// newest first, then other refs by update time.
+func (s *Server) packageVersions(c *gin.Context, packagePath string) []wikiVersion {
+	wikis := s.packageWikis(c, packagePath)
+
+	defaultWiki := defaultVersion(wikis)
+	sort.Slice(wikis, func(i, j int) bool {
+		a, b := wikis[i], wikis[j]
+		if (a == defaultWiki) != (b == defaultWiki) {
+			return a == defaultWiki
+		}
+		va, vb := semverOf(a.Metadata.Ref), semverOf(b.Metadata.Ref)
+		if va != "" && vb != "" && semver.Compare(va, vb) != 0 {
+			return semver.Compare(va, vb) > 0
+		}
+		if (va != "") != (vb != "") {
+			return va != ""
+		}
+		return a.UpdatedAt.After(b.UpdatedAt)
+	})
+
+	versions := make([]wikiVersion, 0, len(wikis))
+	for _, wiki := range wikis {
+		label := wiki.Metadata.Ref
+		if label == "" {
+			label = "default"
+		}
+		if sha := wiki.Metadata.CommitSHA; len(sha) >= 7 && !strings.HasPrefix(sha, wiki.Metadata.Ref) {
+			label += " (" + sha[:7] + ")"
+		}
+		versions = append(versions, wikiVersion{
+			Ref:       wiki.Metadata.Ref,
+			Label:     label,
+			WikiID:    wiki.ID,
+			CommitSHA: wiki.Metadata.CommitSHA,
+			Status:    wiki.Status,
+			UpdatedAt: wiki.UpdatedAt.Format("2006-01-02 15:04"),
+			URL:       "/pkg/" + utils.VersionedPackagePath(packagePath, wiki.Metadata.Ref),
+			Default:   wiki == defaultWiki,
+		})
+	}
+	return versions
+}
+
+// packageWikis returns the wikis of a package path that the caller may see
+func (s *Server) packageWikis(c *gin.Context, packagePath string) []*models.Wiki {
+	var wikis []*models.Wiki
+	for _, wiki := range s.visibleWikis(c) {
+		if wiki.PackagePath == packagePath {
+			wikis = append(wikis, wiki)
+		}
+	}
+	return wikis
+}
+
+// findPackageWiki finds the wiki for a package at ref. An empty ref selects the
+// default version; a commit SHA prefix matches the resolved commit of any ref.
+func (s *Server) findPackageWiki(c *gin.Context, packagePath, ref string) *models.Wiki {
+	candidates := s.packageWikis(c, packagePath)
+
+	if ref == "" {
+		return defaultVersion(candidates)
+	}
+	for _, wiki := range candidates {
+		if wiki.Metadata.Ref == ref {
+			return wiki
+		}
+	}
+	if len(ref) >= 7 {
+		for _, wiki := range candidates {
+			if strings.HasPrefix(wiki.Metadata.CommitSHA, strings.ToLower(ref)) {
+				return wiki
+			}
+		}
+	}
+	return nil
+}
+
+// defaultVersion picks the unpinned wiki if there is one, otherwise the most
+// recently updated completed wiki, otherwise the most recently updated one
+func defaultVersion(wikis []*models.Wiki) *models.Wiki {
+	var latest, latestCompleted *models.Wiki
+	for _, wiki := range wikis {
+		if wiki.Metadata.Ref == "" {
+			return wiki
+		}
+		if latest == nil || wiki.UpdatedAt.After(latest.UpdatedAt) {
+			latest = wiki
+		}
+		if wiki.Status == models.WikiStatusCompleted &&
+			(latestCompleted == nil || wiki.UpdatedAt.After(latestCompleted.UpdatedAt)) {
+			latestCompleted = wiki
+		}
+	}
+	if latestCompleted != nil {
+		return latestCompleted
+	}
+	return latest
+}
+
+// semverOf returns ref as a canonical semantic version, or "" if it is not one
+func semverOf(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	if !strings.HasPrefix(ref, "v") {
+		ref = "v" + ref
+	}
+	if !semver.IsValid(ref) {
+		return ""
+	}
+	return ref
+}
+
+// handleGetVersions lists the generated versions of a package
+// (e.g. GET /api/versions/github.com/gin-gonic/gin)
+func (s *Server) handleGetVersions(c *gin.Context) {
+	packagePath, _ := utils.SplitPackageRef(strings.Trim(c.Param("packagePath"), "/"))
+
+	versions := s.packageVersions(c, packagePath)
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No wiki found for package: " + packagePath})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"package_path": packagePath,
+		"versions":     versions,
+	})
+}
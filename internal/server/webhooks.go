@@ -0,0 +1,460 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+// maxWebhookBody limits the size of webhook payloads
+const maxWebhookBody = 5 << 20
+
+var (
+	errWebhookNoSecret  = errors.New("no webhook secret configured for repository")
+	errWebhookSignature = errors.New("invalid webhook signature")
+	// errNeedsAccessToken rejects automatic regeneration of wikis generated with
+	// an access token, the token was only used for that generation and is not stored
+	errNeedsAccessToken = errors.New("wiki was generated with an access token, which is not stored; regenerate it through the API with the token")
+)
+
+// pushEvent is the provider independent part of a push webhook
+type pushEvent struct {
+	RepoURLs      []string // Clone and web URLs of the pushed repository
+	Ref           string   // Full ref, e.g. refs/heads/main or refs/tags/v1.0.0
+	After         string   // Commit SHA after the push
+	DefaultBranch string
+	Deleted       bool
+}
+
+// branch returns the short branch or tag name of the pushed ref
+func (e *pushEvent) branch() string {
+	ref := strings.TrimPrefix(e.Ref, "refs/heads/")
+	return strings.TrimPrefix(ref, "refs/tags/")
+}
+
+// packagePath returns the package path of the pushed repository, or "" if none of its URLs parse
+func (e *pushEvent) packagePath() string {
+	for _, raw := range e.RepoURLs {
+		if raw == "" {
+			continue
+		}
+		if remote, err := utils.ParseRepositoryURL(raw); err == nil {
+			return strings.ToLower(remote.PackagePath())
+		}
+	}
+	return ""
+}
+
+// githubPush is the subset of the GitHub and Gitea push payload used by kwiki
+type githubPush struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		CloneURL      string `json:"clone_url"`
+		SSHURL        string `json:"ssh_url"`
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+func (p *githubPush) event() *pushEvent {
+	return &pushEvent{
+		RepoURLs:      []string{p.Repository.CloneURL, p.Repository.HTMLURL, p.Repository.SSHURL},
+		Ref:           p.Ref,
+		After:         p.After,
+		DefaultBranch: p.Repository.DefaultBranch,
+		Deleted:       p.Deleted || isZeroSHA(p.After),
+	}
+}
+
+// gitlabPush is the subset of the GitLab push and tag push payload used by kwiki
+type gitlabPush struct {
+	Ref         string `json:"ref"`
+	After       string `json:"after"`
+	CheckoutSHA string `json:"checkout_sha"`
+	Project     struct {
+		GitHTTPURL    string `json:"git_http_url"`
+		GitSSHURL     string `json:"git_ssh_url"`
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+func (p *gitlabPush) event() *pushEvent {
+	after := p.CheckoutSHA
+	if after == "" {
+		after = p.After
+	}
+	return &pushEvent{
+		RepoURLs:      []string{p.Project.GitHTTPURL, p.Project.WebURL, p.Project.GitSSHURL},
+		Ref:           p.Ref,
+		After:         after,
+		DefaultBranch: p.Project.DefaultBranch,
+		Deleted:       isZeroSHA(p.After),
+	}
+}
+
+// isZeroSHA reports whether sha is the all-zero SHA sent for deleted refs
+func isZeroSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+// handleGitHubWebhook handles GitHub push webhooks (POST /api/hooks/github)
+func (s *Server) handleGitHubWebhook(c *gin.Context) {
+	body, ok := readWebhookBody(c)
+	if !ok {
+		return
+	}
+
+	switch event := c.GetHeader("X-GitHub-Event"); event {
+	case "ping":
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
+		return
+	case "push":
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "ignored event: " + event})
+		return
+	}
+
+	var payload githubPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	push := payload.event()
+
+	signature := strings.TrimPrefix(c.GetHeader("X-Hub-Signature-256"), "sha256=")
+	s.handlePush(c, push, func(secret string) bool {
+		return verifyHMAC(body, secret, signature)
+	})
+}
+
+// handleGitLabWebhook handles GitLab push and tag push webhooks (POST /api/hooks/gitlab)
+func (s *Server) handleGitLabWebhook(c *gin.Context) {
+	body, ok := readWebhookBody(c)
+	if !ok {
+		return
+	}
+
+	if event := c.GetHeader("X-Gitlab-Event"); event != "Push Hook" && event != "Tag Push Hook" {
+		c.JSON(http.StatusOK, gin.H{"message": "ignored event: " + event})
+		return
+	}
+
+	var payload gitlabPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	push := payload.event()
+
+	// GitLab sends the secret token itself instead of a signature
+	token := c.GetHeader("X-Gitlab-Token")
+	s.handlePush(c, push, func(secret string) bool {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	})
+}
+
+// handleGiteaWebhook handles Gitea (and Gogs) push webhooks (POST /api/hooks/gitea)
+func (s *Server) handleGiteaWebhook(c *gin.Context) {
+	body, ok := readWebhookBody(c)
+	if !ok {
+		return
+	}
+
+	event := c.GetHeader("X-Gitea-Event")
+	if event == "" {
+		event = c.GetHeader("X-Gogs-Event")
+	}
+	if event != "push" {
+		c.JSON(http.StatusOK, gin.H{"message": "ignored event: " + event})
+		return
+	}
+
+	var payload githubPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	push := payload.event()
+
+	signature := c.GetHeader("X-Gitea-Signature")
+	if signature == "" {
+		signature = c.GetHeader("X-Gogs-Signature")
+	}
+	s.handlePush(c, push, func(secret string) bool {
+		return verifyHMAC(body, secret, signature)
+	})
+}
+
+// readWebhookBody reads the raw request body, which is needed for signature verification
+func readWebhookBody(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read payload: " + err.Error()})
+		return nil, false
+	}
+	if len(body) > maxWebhookBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "payload too large"})
+		return nil, false
+	}
+	return body, true
+}
+
+// handlePush verifies a parsed push event and queues regeneration of the wikis tracking the pushed ref
+func (s *Server) handlePush(c *gin.Context, push *pushEvent, verify func(secret string) bool) {
+	packagePath := push.packagePath()
+	if packagePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payload does not contain a repository URL"})
+		return
+	}
+
+	if err := s.verifyWebhook(packagePath, verify); err != nil {
+		log.Printf("Rejected webhook for %s: %v", packagePath, err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if push.Deleted {
+		c.JSON(http.StatusOK, gin.H{"message": "ref deleted, nothing to regenerate"})
+		return
+	}
+
+	wikiIDs := s.wikisForPush(packagePath, push)
+	if len(wikiIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("no wiki tracks %s@%s", packagePath, push.branch()),
+		})
+		return
+	}
+
+	var queued, skipped []string
+	for _, wikiID := range wikiIDs {
+		if wiki, exists := s.getWiki(wikiID); exists && wiki.Metadata.RequiresAccessToken {
+			log.Printf("Ignoring push to %s for %s: %v", push.branch(), wikiID, errNeedsAccessToken)
+			skipped = append(skipped, wikiID)
+			continue
+		}
+		s.regenQueue.enqueue(wikiID, fmt.Sprintf("push to %s (%s)", push.branch(), shortSHA(push.After)))
+		queued = append(queued, wikiID)
+	}
+	if len(queued) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    errNeedsAccessToken.Error(),
+			"wiki_ids": skipped,
+		})
+		return
+	}
+
+	response := gin.H{
+		"message":  "regeneration queued",
+		"wiki_ids": queued,
+		"debounce": s.regenQueue.delay.String(),
+	}
+	if len(skipped) > 0 {
+		response["skipped"] = gin.H{"wiki_ids": skipped, "reason": errNeedsAccessToken.Error()}
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// verifyWebhook checks a webhook against the secret of packagePath, falling back to the global secret
+func (s *Server) verifyWebhook(packagePath string, verify func(secret string) bool) error {
+	secret := s.config.Webhooks.Secret
+	for pkg, repoSecret := range s.config.Webhooks.Secrets {
+		if strings.EqualFold(pkg, packagePath) {
+			secret = repoSecret
+			break
+		}
+	}
+	if secret == "" {
+		return errWebhookNoSecret
+	}
+	if !verify(secret) {
+		return errWebhookSignature
+	}
+	return nil
+}
+
+// wikisForPush returns the wikis that follow the pushed ref: wikis pinned to the
+// pushed branch or tag, and the unpinned wiki when the default branch was pushed.
+// Wikis pinned to a commit never change and are not regenerated.
+func (s *Server) wikisForPush(packagePath string, push *pushEvent) []string {
+	base := strings.ToLower(utils.PackagePathToURL(packagePath))
+	branch := push.branch()
+
+	keys := []string{base + "@" + branch}
+	if strings.HasPrefix(push.Ref, "refs/heads/") && (push.DefaultBranch == "" || push.DefaultBranch == branch) {
+		keys = append(keys, base)
+	}
+
+	var wikiIDs []string
+	for _, key := range keys {
+		if wiki, exists := s.wikiForRepo(key); exists {
+			wikiIDs = append(wikiIDs, wiki.ID)
+		}
+	}
+	return wikiIDs
+}
+
+// verifyHMAC checks a hex encoded HMAC-SHA256 signature of body
+func verifyHMAC(body []byte, secret, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// shortSHA abbreviates a commit SHA for log messages
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// regenerationQueue debounces regeneration requests per wiki: every request
+// restarts the wiki's timer, so a burst of pushes results in a single run
+type regenerationQueue struct {
+	delay     time.Duration
+	run       func(wikiID, reason string) bool // returns false when the wiki is busy and must be retried
+	afterFunc func(d time.Duration, f func()) queueTimer
+	mu        sync.Mutex
+	timers    map[string]queueTimer
+	reason    map[string]string
+}
+
+// queueTimer is the part of *time.Timer the queue uses, replaced in tests
+type queueTimer interface {
+	Reset(d time.Duration) bool
+}
+
+func newRegenerationQueue(delay time.Duration, run func(wikiID, reason string) bool) *regenerationQueue {
+	return &regenerationQueue{
+		delay:     delay,
+		run:       run,
+		afterFunc: func(d time.Duration, f func()) queueTimer { return time.AfterFunc(d, f) },
+		timers:    make(map[string]queueTimer),
+		reason:    make(map[string]string),
+	}
+}
+
+// enqueue schedules wikiID for regeneration after the debounce delay
+func (q *regenerationQueue) enqueue(wikiID, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.reason[wikiID] = reason
+	if timer, exists := q.timers[wikiID]; exists {
+		timer.Reset(q.delay)
+		return
+	}
+	q.timers[wikiID] = q.afterFunc(q.delay, func() { q.fire(wikiID) })
+}
+
+// fire runs a due regeneration, retrying later if the wiki is still generating
+func (q *regenerationQueue) fire(wikiID string) {
+	q.mu.Lock()
+	reason := q.reason[wikiID]
+	delete(q.timers, wikiID)
+	delete(q.reason, wikiID)
+	q.mu.Unlock()
+
+	if !q.run(wikiID, reason) {
+		q.enqueue(wikiID, reason)
+	}
+}
+
+// regenerateWiki starts an update generation of an existing wiki with its
+// original repository, ref and settings. It returns false without doing
+// anything if the wiki is currently being generated. Wikis generated with an
+// access token are skipped, the token was not stored.
+func (s *Server) regenerateWiki(wikiID, reason string) bool {
+	existing, exists := s.getWiki(wikiID)
+	if !exists {
+		log.Printf("Skipping regeneration of %s: wiki no longer exists", wikiID)
+		return true
+	}
+	if isGenerating(existing) {
+		return false
+	}
+	if existing.Metadata.RequiresAccessToken {
+		log.Printf("Skipping regeneration of %s: %v", wikiID, errNeedsAccessToken)
+		s.addWikiLog(wikiID, models.LogLevelWarning, models.LogStepSetup, fmt.Sprintf("Regeneration skipped (%s): %v", reason, errNeedsAccessToken))
+		return true
+	}
+
+	repoURL := existing.Metadata.RepositoryURL
+	if repoURL == "" {
+		repoURL = existing.RepositoryID
+	}
+	// The settings of the original request, .kwiki.yaml is merged again from
+	// the current commit; wikis stored before they were recorded keep the merged settings
+	settings := existing.Settings
+	if existing.Metadata.RequestSettings != nil {
+		settings = *existing.Metadata.RequestSettings
+	}
+	languages, primary := existing.Languages, existing.Language
+	if existing.Metadata.RepoConfigLanguages {
+		languages, primary = nil, ""
+	} else if len(languages) == 0 {
+		languages = []string{"zh"}
+	}
+	req := models.GenerationRequest{
+		RepositoryURL:   repoURL,
+		Ref:             existing.Metadata.Ref,
+		Settings:        settings,
+		Title:           existing.Title,
+		Description:     existing.Description,
+		Languages:       languages,
+		PrimaryLanguage: primary,
+	}
+
+	wiki, err := s.wikiGenerator.GenerateWiki(context.Background(), req)
+	if err != nil {
+		log.Printf("Failed to regenerate wiki %s: %v", wikiID, err)
+		s.addWikiLog(wikiID, models.LogLevelError, models.LogStepSetup, fmt.Sprintf("Regeneration failed: %v", err))
+		return true
+	}
+	wiki.CreatedAt = existing.CreatedAt
+	wiki.Tags = existing.Tags
+	wiki.Metadata.LastRefreshAt = existing.Metadata.LastRefreshAt
+	wiki.Metadata.NextRefreshAt = existing.Metadata.NextRefreshAt
+	wiki.Metadata.Access = existing.Metadata.Access
+	// Translations are kept and become stale where the primary pages changed
+	wiki.Translations = existing.Translations
+
+	s.storeWiki(wiki, "")
+	if err := s.saveWikiToStorage(wiki); err != nil {
+		log.Printf("Warning: Failed to save wiki to storage: %v", err)
+	}
+
+	s.addWikiLog(wiki.ID, models.LogLevelInfo, models.LogStepSetup, fmt.Sprintf("Wiki regeneration started: %s", reason))
+	return true
+}
+
+// isGenerating reports whether a wiki generation is in progress
+func isGenerating(wiki *models.Wiki) bool {
+	return wiki.Status == models.WikiStatusPending ||
+		wiki.Status == models.WikiStatusAnalyzing ||
+		wiki.Status == models.WikiStatusGenerating
+}
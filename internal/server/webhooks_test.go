@@ -0,0 +1,194 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stcn52/kwiki/internal/config"
+	"github.com/stcn52/kwiki/internal/storage"
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+func TestVerifyHMAC(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	if !verifyHMAC(body, "s3cret", signature) {
+		t.Error("valid signature rejected")
+	}
+	if verifyHMAC(body, "other", signature) {
+		t.Error("signature with wrong secret accepted")
+	}
+	if verifyHMAC(append(body, ' '), "s3cret", signature) {
+		t.Error("signature of modified body accepted")
+	}
+	if verifyHMAC(body, "s3cret", "") {
+		t.Error("empty signature accepted")
+	}
+}
+
+func TestWikisForPush(t *testing.T) {
+	s := &Server{
+		config: &config.Config{Webhooks: config.WebhookConfig{
+			Secret:  "global",
+			Secrets: map[string]string{"github.com/Owner/Repo": "repo"},
+		}},
+		activeWikis: map[string]*models.Wiki{
+			"github.com/owner/repo":        {ID: "github.com/owner/repo"},
+			"github.com/owner/repo@dev":    {ID: "github.com/owner/repo@dev"},
+			"github.com/owner/repo@v1.0.0": {ID: "github.com/owner/repo@v1.0.0"},
+		},
+		repoURLToWiki: map[string]string{
+			"https://github.com/owner/repo":        "github.com/owner/repo",
+			"https://github.com/owner/repo@dev":    "github.com/owner/repo@dev",
+			"https://github.com/owner/repo@v1.0.0": "github.com/owner/repo@v1.0.0",
+		},
+	}
+
+	tests := []struct {
+		ref  string
+		want []string
+	}{
+		{"refs/heads/main", []string{"github.com/owner/repo"}},
+		{"refs/heads/dev", []string{"github.com/owner/repo@dev"}},
+		{"refs/tags/v1.0.0", []string{"github.com/owner/repo@v1.0.0"}},
+		{"refs/heads/feature", nil},
+	}
+	for _, tt := range tests {
+		push := &pushEvent{
+			RepoURLs:      []string{"git@github.com:Owner/Repo.git"},
+			Ref:           tt.ref,
+			DefaultBranch: "main",
+		}
+		got := s.wikisForPush(push.packagePath(), push)
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("wikisForPush(%s) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+
+	// The per-repository secret takes precedence over the global one
+	accept := func(want string) func(string) bool {
+		return func(secret string) bool { return secret == want }
+	}
+	if err := s.verifyWebhook("github.com/owner/repo", accept("repo")); err != nil {
+		t.Errorf("per-repository secret: %v", err)
+	}
+	if err := s.verifyWebhook("github.com/owner/repo", accept("global")); err != errWebhookSignature {
+		t.Errorf("global secret for configured repository: %v, want errWebhookSignature", err)
+	}
+	if err := s.verifyWebhook("github.com/other/repo", accept("global")); err != nil {
+		t.Errorf("global secret: %v", err)
+	}
+}
+
+func TestPushSkipsWikisGeneratedWithToken(t *testing.T) {
+	s := &Server{
+		config:   &config.Config{Webhooks: config.WebhookConfig{Secret: "global"}},
+		storage:  storage.NewMarkdownStorage(t.TempDir()),
+		wikiLogs: make(map[string][]models.WikiLogEntry),
+		activeWikis: map[string]*models.Wiki{
+			"github.com/owner/private":     {ID: "github.com/owner/private", Status: models.WikiStatusCompleted, Metadata: models.WikiMetadata{RequiresAccessToken: true}},
+			"github.com/owner/private@dev": {ID: "github.com/owner/private@dev", Status: models.WikiStatusCompleted},
+		},
+		repoURLToWiki: map[string]string{
+			"https://github.com/owner/private":     "github.com/owner/private",
+			"https://github.com/owner/private@dev": "github.com/owner/private@dev",
+		},
+	}
+	var queued []string
+	s.regenQueue = newRegenerationQueue(time.Minute, s.regenerateWiki)
+	s.regenQueue.afterFunc = func(d time.Duration, f func()) queueTimer {
+		return &fakeTimer{fire: f}
+	}
+
+	push := func(ref string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		event := &pushEvent{RepoURLs: []string{"https://github.com/owner/private"}, Ref: ref, DefaultBranch: "main"}
+		s.handlePush(c, event, func(string) bool { return true })
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := push("refs/heads/main")
+	if code != http.StatusUnprocessableEntity || resp["error"] != errNeedsAccessToken.Error() {
+		t.Errorf("push for token wiki = %d %v, want 422 with errNeedsAccessToken", code, resp)
+	}
+	code, resp = push("refs/heads/dev")
+	if code != http.StatusAccepted || resp["skipped"] != nil {
+		t.Errorf("push for public wiki = %d %v, want 202", code, resp)
+	}
+	for wikiID := range s.regenQueue.timers {
+		queued = append(queued, wikiID)
+	}
+	if len(queued) != 1 || queued[0] != "github.com/owner/private@dev" {
+		t.Errorf("queued %v, want only the wiki without a token", queued)
+	}
+
+	// Regenerations queued before the wiki needed a token are skipped as well,
+	// without reaching the generator
+	if !s.regenerateWiki("github.com/owner/private", "test") {
+		t.Error("regenerateWiki() = false, want the skipped run to be done")
+	}
+	if logs := s.wikiLogs["github.com/owner/private"]; len(logs) != 1 || logs[0].Level != models.LogLevelWarning {
+		t.Errorf("logs = %+v, want a warning about the missing token", logs)
+	}
+}
+
+// fakeTimer is a queueTimer fired by the test instead of the clock
+type fakeTimer struct {
+	fire   func()
+	resets int
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.resets++
+	return true
+}
+
+func TestRegenerationQueueDebounce(t *testing.T) {
+	runs := map[string]int{}
+	busy := true
+	queue := newRegenerationQueue(time.Minute, func(wikiID, reason string) bool {
+		// The first attempt finds the wiki busy and is retried
+		if busy {
+			busy = false
+			return false
+		}
+		runs[wikiID]++
+		return true
+	})
+	var timers []*fakeTimer
+	queue.afterFunc = func(d time.Duration, f func()) queueTimer {
+		timer := &fakeTimer{fire: f}
+		timers = append(timers, timer)
+		return timer
+	}
+
+	for i := 0; i < 5; i++ {
+		queue.enqueue("wiki", "push")
+	}
+	if len(timers) != 1 || timers[0].resets != 4 {
+		t.Fatalf("burst scheduled %d timers, first reset %d times, want 1 timer reset 4 times", len(timers), timers[0].resets)
+	}
+
+	timers[0].fire()
+	if len(timers) != 2 || runs["wiki"] != 0 {
+		t.Fatalf("busy wiki: %d timers, %d runs, want a retry timer and no run", len(timers), runs["wiki"])
+	}
+	timers[1].fire()
+	if runs["wiki"] != 1 || len(timers) != 2 {
+		t.Errorf("runs = %d with %d timers, want 1 run", runs["wiki"], len(timers))
+	}
+}
@@ -0,0 +1,629 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// conformanceBackend 描述一个需要通过一致性测试的存储后端
+type conformanceBackend struct {
+	name string
+	open func(t *testing.T) Storage
+}
+
+// conformanceBackends 所有Storage实现都必须在这里注册
+var conformanceBackends = []conformanceBackend{
+	{
+		name: "markdown",
+		open: func(t *testing.T) Storage {
+			return NewMarkdownStorage(filepath.Join(t.TempDir(), "wikis"))
+		},
+	},
+	{
+		name: "file",
+		open: func(t *testing.T) Storage {
+			store, err := NewFileStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileStorage: %v", err)
+			}
+			return store
+		},
+	},
+	{
+		name: "sqlite",
+		open: func(t *testing.T) Storage {
+			store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "kwiki.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStorage: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	},
+}
+
+// TestStorageConformance 对每个后端运行同一套一致性测试
+func TestStorageConformance(t *testing.T) {
+	for _, backend := range conformanceBackends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			runConformance(t, backend)
+		})
+	}
+}
+
+// runConformance 运行完整的一致性测试
+func runConformance(t *testing.T, backend conformanceBackend) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		store := backend.open(t)
+		want := newFixtureWiki("github.com/example/roundtrip", "Round Trip")
+		mustSave(t, store, want)
+
+		got := mustLoad(t, store, want.ID)
+		assertWikiEqual(t, want, got)
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		store := backend.open(t)
+		wiki := newFixtureWiki("github.com/example/overwrite", "Overwrite")
+		mustSave(t, store, wiki)
+
+		wiki.Title = "Overwrite v2"
+		wiki.Status = models.WikiStatusFailed
+		wiki.Tags = []string{"second"}
+		wiki.Pages = wiki.Pages[:1]
+		wiki.Pages[0].Content = "Replaced content."
+		mustSave(t, store, wiki)
+
+		got := mustLoad(t, store, wiki.ID)
+		assertWikiEqual(t, wiki, got)
+	})
+
+	t.Run("LoadAllWikis", func(t *testing.T) {
+		store := backend.open(t)
+		first := newFixtureWiki("github.com/example/first", "First")
+		second := newFixtureWiki("gitlab.com/group/sub/second", "Second")
+		mustSave(t, store, first)
+		mustSave(t, store, second)
+
+		all, err := store.LoadAllWikis()
+		if err != nil {
+			t.Fatalf("LoadAllWikis: %v", err)
+		}
+		if len(all) != 2 {
+			t.Fatalf("LoadAllWikis returned %d wikis, want 2", len(all))
+		}
+		for _, want := range []*models.Wiki{first, second} {
+			got, ok := all[want.ID]
+			if !ok {
+				t.Fatalf("LoadAllWikis missing %s", want.ID)
+			}
+			assertWikiEqual(t, want, got)
+		}
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		// 同一个包的默认分支和固定版本是不同的Wiki，互不覆盖
+		store := backend.open(t)
+		latest := newFixtureWiki("github.com/example/versions", "Latest")
+		latest.Metadata.Ref = ""
+		pinned := newFixtureWiki("github.com/example/versions@v1.0.0", "Pinned")
+		pinned.PackagePath = latest.PackagePath
+		pinned.Metadata.Ref = "v1.0.0"
+		branch := newFixtureWiki("github.com/example/versions@feature%2Fx", "Branch")
+		branch.PackagePath = latest.PackagePath
+		branch.Metadata.Ref = "feature/x"
+		for _, wiki := range []*models.Wiki{pinned, latest, branch} {
+			mustSave(t, store, wiki)
+		}
+
+		all, err := store.LoadAllWikis()
+		if err != nil {
+			t.Fatalf("LoadAllWikis: %v", err)
+		}
+		if len(all) != 3 {
+			t.Fatalf("LoadAllWikis returned %d wikis, want 3", len(all))
+		}
+		for _, want := range []*models.Wiki{latest, pinned, branch} {
+			assertWikiEqual(t, want, all[want.ID])
+			assertWikiEqual(t, want, mustLoad(t, store, want.ID))
+		}
+
+		// 删除默认分支的Wiki不影响固定版本
+		if err := store.DeleteWiki(latest.ID); err != nil {
+			t.Fatalf("DeleteWiki: %v", err)
+		}
+		assertWikiEqual(t, pinned, mustLoad(t, store, pinned.ID))
+		assertWikiEqual(t, branch, mustLoad(t, store, branch.ID))
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := backend.open(t)
+		if _, err := store.LoadWiki("github.com/example/missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("LoadWiki(missing) error = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteWiki("github.com/example/missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteWiki(missing) error = %v, want ErrNotFound", err)
+		}
+		logs, err := store.LoadLogs("github.com/example/missing")
+		if err != nil || len(logs) != 0 {
+			t.Errorf("LoadLogs(missing) = %d entries, %v; want none", len(logs), err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := backend.open(t)
+		wiki := newFixtureWiki("github.com/example/delete", "Delete")
+		keep := newFixtureWiki("github.com/example/keep", "Keep")
+		mustSave(t, store, wiki)
+		mustSave(t, store, keep)
+		if err := store.AppendLog(wiki.ID, newLogEntry(wiki.ID, 0)); err != nil {
+			t.Fatalf("AppendLog: %v", err)
+		}
+
+		if err := store.DeleteWiki(wiki.ID); err != nil {
+			t.Fatalf("DeleteWiki: %v", err)
+		}
+		if _, err := store.LoadWiki(wiki.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("LoadWiki after delete error = %v, want ErrNotFound", err)
+		}
+		if logs, _ := store.LoadLogs(wiki.ID); len(logs) != 0 {
+			t.Errorf("LoadLogs after delete returned %d entries, want 0", len(logs))
+		}
+
+		all, err := store.LoadAllWikis()
+		if err != nil {
+			t.Fatalf("LoadAllWikis: %v", err)
+		}
+		if _, ok := all[wiki.ID]; ok {
+			t.Errorf("LoadAllWikis still contains deleted wiki")
+		}
+		if _, ok := all[keep.ID]; !ok {
+			t.Errorf("LoadAllWikis lost unrelated wiki %s", keep.ID)
+		}
+	})
+
+	t.Run("Logs", func(t *testing.T) {
+		store := backend.open(t)
+		wiki := newFixtureWiki("github.com/example/logs", "Logs")
+		mustSave(t, store, wiki)
+
+		var want []models.WikiLogEntry
+		for i := 0; i < 3; i++ {
+			entry := newLogEntry(wiki.ID, i)
+			want = append(want, entry)
+			if err := store.AppendLog(wiki.ID, entry); err != nil {
+				t.Fatalf("AppendLog: %v", err)
+			}
+		}
+		got, err := store.LoadLogs(wiki.ID)
+		if err != nil {
+			t.Fatalf("LoadLogs: %v", err)
+		}
+		assertJSONEqual(t, "appended logs", want, got)
+
+		replaced := []models.WikiLogEntry{newLogEntry(wiki.ID, 9)}
+		if err := store.SaveLogs(wiki.ID, replaced); err != nil {
+			t.Fatalf("SaveLogs: %v", err)
+		}
+		got, err = store.LoadLogs(wiki.ID)
+		if err != nil {
+			t.Fatalf("LoadLogs: %v", err)
+		}
+		assertJSONEqual(t, "replaced logs", replaced, got)
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		store := backend.open(t)
+		shared := newFixtureWiki("github.com/example/shared", "Shared")
+		mustSave(t, store, shared)
+
+		const writers, rounds = 8, 5
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*rounds*2)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				wiki := newFixtureWiki(fmt.Sprintf("github.com/example/writer%d", w), fmt.Sprintf("Writer %d", w))
+				for r := 0; r < rounds; r++ {
+					wiki.Progress = r
+					if err := store.SaveWiki(wiki); err != nil {
+						errs <- err
+					}
+					if err := store.AppendLog(shared.ID, newLogEntry(shared.ID, w*rounds+r)); err != nil {
+						errs <- err
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("concurrent write: %v", err)
+		}
+
+		all, err := store.LoadAllWikis()
+		if err != nil {
+			t.Fatalf("LoadAllWikis: %v", err)
+		}
+		if len(all) != writers+1 {
+			t.Errorf("LoadAllWikis returned %d wikis, want %d", len(all), writers+1)
+		}
+		for w := 0; w < writers; w++ {
+			wiki, ok := all[fmt.Sprintf("github.com/example/writer%d", w)]
+			if !ok || wiki.Progress != rounds-1 {
+				t.Errorf("writer %d wiki missing or stale", w)
+			}
+		}
+		logs, err := store.LoadLogs(shared.ID)
+		if err != nil {
+			t.Fatalf("LoadLogs: %v", err)
+		}
+		if len(logs) != writers*rounds {
+			t.Errorf("LoadLogs returned %d entries, want %d", len(logs), writers*rounds)
+		}
+	})
+
+	t.Run("ConcurrentSameWiki", func(t *testing.T) {
+		store := backend.open(t)
+		wiki := newFixtureWiki("github.com/example/contended", "Contended")
+		mustSave(t, store, wiki)
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				contender := newFixtureWiki(wiki.ID, "Contended")
+				contender.Progress = w
+				for r := 0; r < 5; r++ {
+					if err := store.SaveWiki(contender); err != nil {
+						t.Errorf("SaveWiki: %v", err)
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		// 无论哪个写入者最后完成，结果都必须是一个完整的Wiki
+		got := mustLoad(t, store, wiki.ID)
+		want := newFixtureWiki(wiki.ID, "Contended")
+		want.Progress = got.Progress
+		assertWikiEqual(t, want, got)
+	})
+
+	t.Run("Unicode", func(t *testing.T) {
+		store := backend.open(t)
+		wiki := newFixtureWiki("gitee.com/示例/维基文档", "维基文档 — Überblick 🚀")
+		wiki.Description = "中文描述，包含日本語とemoji ✨"
+		wiki.Tags = []string{"中文", "日本語", "émoji-✨"}
+		wiki.Pages[0].Title = "概览 Überblick"
+		wiki.Pages[0].Content = "# 标题\n\n你好，世界！こんにちは 🌏"
+		mustSave(t, store, wiki)
+
+		got := mustLoad(t, store, wiki.ID)
+		assertWikiEqual(t, wiki, got)
+
+		entry := newLogEntry(wiki.ID, 0)
+		entry.Message = "生成页面: 概览 ✅"
+		if err := store.AppendLog(wiki.ID, entry); err != nil {
+			t.Fatalf("AppendLog: %v", err)
+		}
+		logs, err := store.LoadLogs(wiki.ID)
+		if err != nil {
+			t.Fatalf("LoadLogs: %v", err)
+		}
+		assertJSONEqual(t, "unicode logs", []models.WikiLogEntry{entry}, logs)
+	})
+
+	t.Run("Chat", func(t *testing.T) {
+		store := backend.open(t)
+		chatStore, ok := store.(ChatStorage)
+		if !ok {
+			t.Skip("backend does not implement ChatStorage")
+		}
+		wiki := newFixtureWiki("github.com/example/chat", "Chat")
+		mustSave(t, store, wiki)
+
+		var want []models.ChatMessage
+		for i := 0; i < 3; i++ {
+			msg := models.ChatMessage{
+				ID:         fmt.Sprintf("msg-%d", i),
+				WikiID:     wiki.ID,
+				Role:       models.MessageRoleUser,
+				Content:    fmt.Sprintf("问题 %d", i),
+				Context:    []string{"context"},
+				Sources:    []string{"main.go"},
+				Timestamp:  fixtureTime.Add(time.Duration(i) * time.Second),
+				TokensUsed: i,
+			}
+			want = append(want, msg)
+			if err := chatStore.SaveChatMessage(&msg); err != nil {
+				t.Fatalf("SaveChatMessage: %v", err)
+			}
+		}
+
+		got, err := chatStore.LoadChatHistory(wiki.ID, 2)
+		if err != nil {
+			t.Fatalf("LoadChatHistory: %v", err)
+		}
+		assertJSONEqual(t, "latest chat", want[1:], got)
+
+		if err := store.DeleteWiki(wiki.ID); err != nil {
+			t.Fatalf("DeleteWiki: %v", err)
+		}
+		if got, _ := chatStore.LoadChatHistory(wiki.ID, 0); len(got) != 0 {
+			t.Errorf("chat history survived delete: %d messages", len(got))
+		}
+	})
+}
+
+// TestTokenStorageConformance 验证实现TokenStorage的后端行为一致
+func TestTokenStorageConformance(t *testing.T) {
+	for _, backend := range conformanceBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			tokenStore, ok := backend.open(t).(TokenStorage)
+			if !ok {
+				t.Skip("backend does not implement TokenStorage")
+			}
+
+			expires := fixtureTime.Add(24 * time.Hour)
+			token := models.APIToken{
+				ID:        "tok-1",
+				Name:      "CI 令牌",
+				Hash:      "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+				Scopes:    []string{"read", "generate"},
+				CreatedBy: "admin",
+				CreatedAt: fixtureTime,
+				ExpiresAt: &expires,
+			}
+			if err := tokenStore.SaveToken(&token); err != nil {
+				t.Fatalf("SaveToken: %v", err)
+			}
+
+			// 再次保存同一ID时替换原记录
+			used := fixtureTime.Add(time.Hour)
+			token.LastUsedAt = &used
+			if err := tokenStore.SaveToken(&token); err != nil {
+				t.Fatalf("SaveToken (update): %v", err)
+			}
+
+			got, err := tokenStore.LoadTokens()
+			if err != nil {
+				t.Fatalf("LoadTokens: %v", err)
+			}
+			assertJSONEqual(t, "tokens", []models.APIToken{token}, got)
+
+			if err := tokenStore.DeleteToken(token.ID); err != nil {
+				t.Fatalf("DeleteToken: %v", err)
+			}
+			if err := tokenStore.DeleteToken(token.ID); !errors.Is(err, ErrTokenNotFound) {
+				t.Errorf("DeleteToken (missing) error = %v, want ErrTokenNotFound", err)
+			}
+			if got, _ := tokenStore.LoadTokens(); len(got) != 0 {
+				t.Errorf("tokens after delete = %d, want 0", len(got))
+			}
+		})
+	}
+}
+
+// fixtureTime 固定时间，精确到秒（Markdown前置元数据只保存到秒）
+var fixtureTime = time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+
+// newFixtureWiki 构造填充了所有字段的Wiki
+func newFixtureWiki(id, title string) *models.Wiki {
+	return &models.Wiki{
+		ID:           id,
+		RepositoryID: "https://" + id,
+		PackagePath:  id,
+		Title:        title,
+		Description:  "Documentation for " + title,
+		Status:       models.WikiStatusCompleted,
+		Progress:     100,
+		Tags:         []string{"go", "library"},
+		CreatedAt:    fixtureTime,
+		UpdatedAt:    fixtureTime.Add(time.Hour),
+		GeneratedBy:  "ollama",
+		Model:        "qwen2.5",
+		Language:     "en",
+		Languages:    []string{"en", "zh"},
+		Pages: []models.WikiPage{
+			{
+				ID:          "overview_en",
+				Key:         "overview",
+				Language:    "en",
+				Title:       "Overview",
+				Content:     "# Overview\n\nThe project overview.\n\n```go\nfunc main() {}\n```",
+				Type:        models.PageTypeOverview,
+				Order:       1,
+				Children:    []string{"api_en"},
+				Tags:        []string{"intro"},
+				CreatedAt:   fixtureTime,
+				UpdatedAt:   fixtureTime.Add(time.Minute),
+				WordCount:   7,
+				ReadingTime: 1,
+			},
+			{
+				ID:          "api_en",
+				Key:         "api",
+				Language:    "en",
+				Title:       "API Reference",
+				Content:     "# API\n\n- `New()` creates a client.",
+				Type:        models.PageTypeReference,
+				Order:       2,
+				ParentID:    "overview_en",
+				Tags:        []string{"api", "reference"},
+				CreatedAt:   fixtureTime,
+				UpdatedAt:   fixtureTime.Add(2 * time.Minute),
+				WordCount:   6,
+				ReadingTime: 1,
+			},
+		},
+		Diagrams: []models.WikiDiagram{
+			{
+				ID:          "architecture",
+				Title:       "Architecture",
+				Type:        models.DiagramTypeFlowchart,
+				Content:     "graph TD\n    A[Client] --> B[Server]",
+				Description: "High level architecture\nwith \"two\" tiers",
+				PageID:      "overview_en",
+				CreatedAt:   fixtureTime,
+				UpdatedAt:   fixtureTime.Add(time.Minute),
+			},
+		},
+		Settings: models.WikiSettings{
+			AIProvider:      "ollama",
+			Model:           "qwen2.5",
+			Temperature:     0.5,
+			MaxTokens:       4000,
+			EnableDiagrams:  true,
+			EnableRAG:       true,
+			Language:        "en",
+			Theme:           "dark",
+			CustomPrompts:   map[string]string{"overview": "Be brief."},
+			ExcludePatterns: []string{"vendor"},
+			IncludePatterns: []string{"*.go"},
+		},
+		Metadata: models.WikiMetadata{
+			GenerationTime:    90 * time.Second,
+			TokensUsed:        1234,
+			FilesProcessed:    42,
+			PagesGenerated:    2,
+			DiagramsGenerated: 1,
+			Languages:         []string{"Go"},
+			Complexity:        "medium",
+			Quality:           0.8,
+			Tags:              []string{"meta"},
+			Categories:        []string{"library"},
+			Statistics:        map[string]int{"go": 42},
+			PackagePath:       id,
+			RepositoryURL:     "https://" + id,
+			Ref:               "v1.2.3",
+			CommitSHA:         "0123456789abcdef0123456789abcdef01234567",
+		},
+		Translations: map[string]*models.WikiTrans{
+			"zh": {
+				Language:    "zh",
+				Title:       title + "（中文）",
+				Description: "中文文档",
+				Pages: []models.WikiPage{
+					{
+						ID:          "overview_zh",
+						Key:         "overview",
+						Language:    "zh",
+						Title:       "概览",
+						Content:     "# 概览\n\n项目概览。",
+						Type:        models.PageTypeOverview,
+						Order:       1,
+						CreatedAt:   fixtureTime,
+						UpdatedAt:   fixtureTime,
+						WordCount:   3,
+						ReadingTime: 1,
+						Source: &models.TranslationSource{
+							PageID:    "overview_en",
+							Hash:      "3f2a9c1d5e7b8a40",
+							UpdatedAt: fixtureTime,
+						},
+					},
+				},
+				Diagrams: []models.WikiDiagram{
+					{
+						ID:        "architecture",
+						Title:     "架构",
+						Type:      models.DiagramTypeFlowchart,
+						Content:   "graph TD\n    A[客户端] --> B[服务端]",
+						CreatedAt: fixtureTime,
+						UpdatedAt: fixtureTime,
+					},
+				},
+				CreatedAt: fixtureTime,
+				UpdatedAt: fixtureTime.Add(time.Hour),
+			},
+		},
+	}
+}
+
+// newLogEntry 构造日志条目
+func newLogEntry(wikiID string, i int) models.WikiLogEntry {
+	return models.WikiLogEntry{
+		WikiID:     wikiID,
+		Timestamp:  fixtureTime.Add(time.Duration(i) * time.Second),
+		Level:      models.LogLevelSuccess,
+		Step:       models.LogStepPage,
+		Message:    fmt.Sprintf("page %d generated", i),
+		Details:    "details",
+		Duration:   "1.5s",
+		Progress:   i,
+		FilesCount: 3,
+		TokensUsed: 100 + i,
+		Error:      "",
+	}
+}
+
+// mustSave 保存Wiki，失败时终止测试
+func mustSave(t *testing.T, store Storage, wiki *models.Wiki) {
+	t.Helper()
+	if err := store.SaveWiki(wiki); err != nil {
+		t.Fatalf("SaveWiki(%s): %v", wiki.ID, err)
+	}
+}
+
+// mustLoad 加载Wiki，失败时终止测试
+func mustLoad(t *testing.T, store Storage, id string) *models.Wiki {
+	t.Helper()
+	wiki, err := store.LoadWiki(id)
+	if err != nil {
+		t.Fatalf("LoadWiki(%s): %v", id, err)
+	}
+	if wiki == nil {
+		t.Fatalf("LoadWiki(%s) returned nil", id)
+	}
+	return wiki
+}
+
+// assertWikiEqual 分部分比较Wiki，便于定位不一致的部分
+func assertWikiEqual(t *testing.T, want, got *models.Wiki) {
+	t.Helper()
+
+	wantFields, gotFields := *want, *got
+	wantFields.Pages, gotFields.Pages = nil, nil
+	wantFields.Diagrams, gotFields.Diagrams = nil, nil
+	wantFields.Translations, gotFields.Translations = nil, nil
+	assertJSONEqual(t, "wiki fields", wantFields, gotFields)
+	assertJSONEqual(t, "pages", sortedPages(want.Pages), sortedPages(got.Pages))
+	assertJSONEqual(t, "diagrams", want.Diagrams, got.Diagrams)
+	assertJSONEqual(t, "translations", want.Translations, got.Translations)
+}
+
+// sortedPages 按ID排序页面
+func sortedPages(pages []models.WikiPage) []models.WikiPage {
+	result := make([]models.WikiPage, len(pages))
+	copy(result, pages)
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// assertJSONEqual 通过JSON序列化比较两个值
+func assertJSONEqual(t *testing.T, what string, want, got interface{}) {
+	t.Helper()
+	wantJSON, err := json.MarshalIndent(want, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal %s: %v", what, err)
+	}
+	gotJSON, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal %s: %v", what, err)
+	}
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("%s mismatch\nwant: %s\ngot:  %s", what, wantJSON, gotJSON)
+	}
+}
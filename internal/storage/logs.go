@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// encodeLogLines encodes log entries as JSON lines
+func encodeLogLines(logs []models.WikiLogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range logs {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeLogLines decodes JSON lines into log entries, skipping malformed lines
+func decodeLogLines(data []byte) []models.WikiLogEntry {
+	logs := []models.WikiLogEntry{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry models.WikiLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A crash mid-append can leave a truncated last line
+			continue
+		}
+		logs = append(logs, entry)
+	}
+
+	return logs
+}
+
+// appendLogLine appends a single log entry to a JSON lines file
+func appendLogLine(path string, entry models.WikiLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append log entry: %w", err)
+	}
+
+	return nil
+}
+
+// legacyLogEntries converts plain "[15:04:05] message" log lines into structured entries
+func legacyLogEntries(wikiID string, lines []string) []models.WikiLogEntry {
+	logs := make([]models.WikiLogEntry, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		level := models.LogLevelInfo
+		if strings.Contains(line, "Error:") || strings.Contains(line, "错误") {
+			level = models.LogLevelError
+		}
+
+		logs = append(logs, models.WikiLogEntry{
+			WikiID:  wikiID,
+			Level:   level,
+			Step:    "legacy",
+			Message: line,
+		})
+	}
+	return logs
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// chatFileName 聊天记录文件，每行一个ChatMessage
+const chatFileName = "chat.jsonl"
+
+// SaveChatMessage 追加一条聊天消息（实现ChatStorage接口）
+func (ms *MarkdownStorage) SaveChatMessage(msg *models.ChatMessage) error {
+	lock := ms.wikiLock(msg.WikiID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	wikiDir := ms.resolveWikiDir(msg.WikiID)
+	if err := os.MkdirAll(wikiDir, 0755); err != nil {
+		return fmt.Errorf("创建Wiki目录失败: %w", err)
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化聊天消息失败: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(wikiDir, chatFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开聊天记录失败: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入聊天记录失败: %w", err)
+	}
+	return nil
+}
+
+// LoadChatHistory 按时间顺序返回最近的limit条聊天消息，limit<=0时返回全部
+func (ms *MarkdownStorage) LoadChatHistory(wikiID string, limit int) ([]models.ChatMessage, error) {
+	lock := ms.wikiLock(wikiID)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(ms.resolveWikiDir(wikiID), chatFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.ChatMessage{}, nil
+		}
+		return nil, fmt.Errorf("读取聊天记录失败: %w", err)
+	}
+
+	// 同一ID多次保存时以最后一次为准，位置保持首次出现的位置
+	messages := []models.ChatMessage{}
+	index := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg models.ChatMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue // 跳过写入中断导致的残缺行
+		}
+		if i, ok := index[msg.ID]; ok {
+			messages[i] = msg
+			continue
+		}
+		index[msg.ID] = len(messages)
+		messages = append(messages, msg)
+	}
+
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
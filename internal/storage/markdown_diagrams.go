@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// diagramExt Mermaid图表文件扩展名
+const diagramExt = ".mmd"
+
+// saveDiagrams 将图表保存为带前置元数据的.mmd文件，并删除本次未写入的旧图表
+func (ms *MarkdownStorage) saveDiagrams(diagramsDir string, diagrams []models.WikiDiagram) error {
+	if err := os.MkdirAll(diagramsDir, 0755); err != nil {
+		return fmt.Errorf("创建diagrams目录失败: %w", err)
+	}
+
+	written := make(map[string]bool)
+	for i, diagram := range diagrams {
+		filename := ms.slugify(diagram.ID) + diagramExt
+		path := filepath.Join(diagramsDir, filename)
+		if err := writeFileAtomic(path, []byte(ms.generateDiagramContent(&diagram, i)), 0644); err != nil {
+			return fmt.Errorf("写入图表文件 %s 失败: %w", filename, err)
+		}
+		written[filename] = true
+	}
+
+	// 只清理当前目录下的图表，子目录属于翻译
+	entries, err := os.ReadDir(diagramsDir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), diagramExt) || written[entry.Name()] {
+			continue
+		}
+		os.Remove(filepath.Join(diagramsDir, entry.Name()))
+	}
+
+	return nil
+}
+
+// generateDiagramContent 生成.mmd文件内容，Mermaid会忽略未知的前置元数据字段
+func (ms *MarkdownStorage) generateDiagramContent(diagram *models.WikiDiagram, order int) string {
+	var content strings.Builder
+
+	content.WriteString("---\n")
+	content.WriteString(fmt.Sprintf("id: %s\n", ms.frontMatterValue(diagram.ID)))
+	content.WriteString(fmt.Sprintf("title: %s\n", ms.frontMatterValue(diagram.Title)))
+	content.WriteString(fmt.Sprintf("type: %s\n", diagram.Type))
+	content.WriteString(fmt.Sprintf("order: %d\n", order))
+	if diagram.Description != "" {
+		content.WriteString(fmt.Sprintf("description: %s\n", ms.frontMatterValue(diagram.Description)))
+	}
+	if diagram.PageID != "" {
+		content.WriteString(fmt.Sprintf("page_id: %s\n", ms.frontMatterValue(diagram.PageID)))
+	}
+	content.WriteString(fmt.Sprintf("created_at: %s\n", diagram.CreatedAt.Format(time.RFC3339)))
+	content.WriteString(fmt.Sprintf("updated_at: %s\n", diagram.UpdatedAt.Format(time.RFC3339)))
+	content.WriteString("---\n\n")
+	content.WriteString(diagram.Content)
+
+	return content.String()
+}
+
+// loadDiagrams 加载目录下的所有.mmd图表（不含子目录），按保存时的顺序返回
+func (ms *MarkdownStorage) loadDiagrams(diagramsDir string) ([]models.WikiDiagram, error) {
+	entries, err := os.ReadDir(diagramsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取diagrams目录失败: %w", err)
+	}
+
+	type orderedDiagram struct {
+		order   int
+		diagram models.WikiDiagram
+	}
+	var loaded []orderedDiagram
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), diagramExt) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(diagramsDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取图表文件失败: %w", err)
+		}
+
+		frontMatter, body := ms.splitFrontMatter(string(data))
+		metadata := ms.parseFrontMatter(frontMatter)
+
+		id := metadata["id"]
+		if id == "" {
+			id = strings.TrimSuffix(entry.Name(), diagramExt)
+		}
+
+		loaded = append(loaded, orderedDiagram{
+			order: ms.parseInt(metadata["order"], len(loaded)),
+			diagram: models.WikiDiagram{
+				ID:          id,
+				Title:       metadata["title"],
+				Type:        models.DiagramType(metadata["type"]),
+				Content:     body,
+				Description: metadata["description"],
+				PageID:      metadata["page_id"],
+				CreatedAt:   ms.parseTime(metadata["created_at"]),
+				UpdatedAt:   ms.parseTime(metadata["updated_at"]),
+			},
+		})
+	}
+
+	sort.SliceStable(loaded, func(i, j int) bool { return loaded[i].order < loaded[j].order })
+
+	var diagrams []models.WikiDiagram
+	for _, item := range loaded {
+		diagrams = append(diagrams, item.diagram)
+	}
+	return diagrams, nil
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// quarantineDirName 损坏的Wiki目录被移动到这里，保留原有相对路径
+const quarantineDirName = ".quarantine"
+
+// Fsck 检查存储目录：清理中断写入留下的临时文件，并隔离元数据损坏的Wiki目录
+func (ms *MarkdownStorage) Fsck() (*FsckReport, error) {
+	report := &FsckReport{}
+	if _, err := os.Stat(ms.baseDir); os.IsNotExist(err) {
+		return report, nil
+	}
+
+	corrupt := make(map[string]string) // 目录 -> 原因
+	err := filepath.WalkDir(ms.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ms.skipHiddenDir(path, d) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if isTempFile(d.Name()) {
+			if err := os.Remove(path); err == nil {
+				report.TempFilesRemoved++
+			}
+			return nil
+		}
+
+		switch d.Name() {
+		case "meta.json":
+			report.Checked++
+			if reason := ms.checkMetadataFile(path); reason != "" {
+				corrupt[filepath.Dir(path)] = reason
+			}
+		case translationMetaFileName:
+			if reason := checkJSONFile(path, &translationMetadata{}); reason != "" {
+				// 翻译属于上一级的Wiki目录
+				corrupt[filepath.Dir(filepath.Dir(path))] = "translation: " + reason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("遍历存储目录失败: %w", err)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	for dir, reason := range corrupt {
+		rel, err := filepath.Rel(ms.baseDir, dir)
+		if err != nil {
+			continue
+		}
+		target := filepath.Join(ms.baseDir, quarantineDirName, stamp, rel)
+		if err := ms.quarantine(dir, target); err != nil {
+			log.Printf("隔离损坏的Wiki目录失败: %s, 错误: %v", rel, err)
+			continue
+		}
+		log.Printf("已隔离损坏的Wiki目录: %s (%s) -> %s", rel, reason, target)
+		report.Quarantined = append(report.Quarantined, rel)
+	}
+
+	return report, nil
+}
+
+// checkMetadataFile 检查meta.json能否解析，返回空字符串表示正常
+func (ms *MarkdownStorage) checkMetadataFile(path string) string {
+	var metadata WikiMetadata
+	if reason := checkJSONFile(path, &metadata); reason != "" {
+		return reason
+	}
+	if metadata.ID == "" {
+		return "missing id"
+	}
+	return ""
+}
+
+// checkJSONFile 检查JSON文件是否完整
+func checkJSONFile(path string, v interface{}) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err.Error()
+	}
+	if len(data) == 0 {
+		return "empty file"
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// quarantine 将Wiki目录移动到隔离区，嵌套在其中的其他Wiki（子包）保留在原处
+func (ms *MarkdownStorage) quarantine(dir, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if !ms.containsNestedWiki(dir) {
+		return os.Rename(dir, target)
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() && ms.containsWiki(path) {
+			continue
+		}
+		if err := os.Rename(path, filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsNestedWiki 判断目录的子目录中是否还有其他Wiki
+func (ms *MarkdownStorage) containsNestedWiki(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && ms.containsWiki(filepath.Join(dir, entry.Name())) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWiki 判断目录本身或其子目录中是否有meta.json
+func (ms *MarkdownStorage) containsWiki(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name() == "meta.json" {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
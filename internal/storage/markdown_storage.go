@@ -5,17 +5,31 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/stcn52/kwiki/pkg/models"
+	"github.com/stcn52/kwiki/pkg/utils"
+)
+
+const (
+	logsFileName       = "generation.jsonl" // 结构化日志，每行一个WikiLogEntry
+	legacyLogsFileName = "generation.log"   // 旧版纯文本日志
+	versionsDirName    = "@v"               // 固定版本的Wiki存放在包目录下的 @v/<转义的ref>
 )
 
 // MarkdownStorage 基于Markdown文件的存储实现
 type MarkdownStorage struct {
 	baseDir string
+	locks   sync.Map // wikiID -> *sync.RWMutex，保证同一Wiki的读写互斥
+
+	tokensMu sync.Mutex // 保护API令牌文件
 }
 
 // WikiMetadata Wiki的元数据结构
@@ -29,10 +43,14 @@ type WikiMetadata struct {
 	Progress     int                 `json:"progress"`
 	CreatedAt    time.Time           `json:"created_at"`
 	UpdatedAt    time.Time           `json:"updated_at"`
+	GeneratedBy  string              `json:"generated_by,omitempty"`
+	Model        string              `json:"model,omitempty"`
+	Language     string              `json:"language,omitempty"`
 	Languages    []string            `json:"languages"`
 	Settings     models.WikiSettings `json:"settings"`
 	Metadata     models.WikiMetadata `json:"metadata"`
 	Tags         []string            `json:"tags"`
+	Version      int64               `json:"version"` // 每次保存递增
 }
 
 // NewMarkdownStorage 创建新的Markdown存储实例
@@ -42,11 +60,23 @@ func NewMarkdownStorage(baseDir string) *MarkdownStorage {
 	}
 }
 
+// wikiLock 获取指定Wiki的读写锁
+func (ms *MarkdownStorage) wikiLock(wikiID string) *sync.RWMutex {
+	lock, _ := ms.locks.LoadOrStore(wikiID, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+// skipHiddenDir 遍历时跳过隐藏目录（如隔离区 .quarantine）
+func (ms *MarkdownStorage) skipHiddenDir(path string, d fs.DirEntry) bool {
+	return d.IsDir() && path != ms.baseDir && strings.HasPrefix(d.Name(), ".")
+}
+
 // getWikiPath 根据Wiki信息生成存储路径
 func (ms *MarkdownStorage) getWikiPath(wiki *models.Wiki) string {
-	// 如果有PackagePath，使用包路径
+	// 如果有PackagePath，使用包路径；固定版本的Wiki（ID为 包路径@ref，见 Metadata.Ref）放在其下的版本目录
 	if wiki.PackagePath != "" {
-		return ms.sanitizePath(wiki.PackagePath)
+		_, ref := utils.SplitPackageRef(wiki.ID)
+		return ms.versionedPath(wiki.PackagePath, ref)
 	}
 
 	// 如果有RepositoryID，尝试从中提取路径
@@ -63,6 +93,15 @@ func (ms *MarkdownStorage) getWikiPath(wiki *models.Wiki) string {
 	return ms.sanitizePath(wiki.ID)
 }
 
+// versionedPath 返回包某个版本的Wiki目录：默认分支为包路径，固定版本为 <包路径>/@v/<转义的ref>，
+// 同一个包的各个版本互不覆盖
+func (ms *MarkdownStorage) versionedPath(packagePath, ref string) string {
+	if ref == "" {
+		return ms.sanitizePath(packagePath)
+	}
+	return ms.sanitizePath(packagePath + "/" + versionsDirName + "/" + url.PathEscape(ref))
+}
+
 // extractPathFromRepository 从仓库URL中提取路径
 func (ms *MarkdownStorage) extractPathFromRepository(repoURL string) string {
 	// 移除协议前缀
@@ -104,12 +143,21 @@ func (ms *MarkdownStorage) sanitizePath(path string) string {
 	path = strings.ReplaceAll(path, ">", "_")
 	path = strings.ReplaceAll(path, "|", "_")
 	path = strings.ReplaceAll(path, "\"", "_")
-
-	// 移除多余的斜杠
-	path = strings.ReplaceAll(path, "//", "/")
-	path = strings.Trim(path, "/")
-
-	return path
+	path = strings.ReplaceAll(path, "\\", "_")
+
+	// 移除空段，"." 和 ".." 替换掉，路径不能跳出存储目录
+	segments := strings.Split(path, "/")
+	kept := segments[:0]
+	for _, segment := range segments {
+		switch segment {
+		case "":
+			continue
+		case ".", "..":
+			segment = "_"
+		}
+		kept = append(kept, segment)
+	}
+	return strings.Join(kept, "/")
 }
 
 // findWikiPath 查找Wiki的实际存储路径
@@ -121,6 +169,9 @@ func (ms *MarkdownStorage) findWikiPath(wikiID string) string {
 		if err != nil {
 			return nil // 忽略错误，继续搜索
 		}
+		if ms.skipHiddenDir(path, d) {
+			return filepath.SkipDir
+		}
 
 		// 只检查meta.json文件
 		if !d.IsDir() && d.Name() == "meta.json" {
@@ -153,7 +204,12 @@ func (ms *MarkdownStorage) findWikiPath(wikiID string) string {
 }
 
 // SaveWiki 保存Wiki到Markdown文件结构
+// 所有文件先写临时文件再重命名，meta.json最后写入作为提交点
 func (ms *MarkdownStorage) SaveWiki(wiki *models.Wiki) error {
+	lock := ms.wikiLock(wiki.ID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// 使用包路径或仓库路径作为目录结构
 	wikiPath := ms.getWikiPath(wiki)
 	wikiDir := filepath.Join(ms.baseDir, wikiPath)
@@ -163,15 +219,11 @@ func (ms *MarkdownStorage) SaveWiki(wiki *models.Wiki) error {
 		return fmt.Errorf("创建Wiki目录失败: %w", err)
 	}
 
-	// 保存元数据
-	if err := ms.saveMetadata(wikiDir, wiki); err != nil {
-		return fmt.Errorf("保存元数据失败: %w", err)
-	}
-
 	// 按语言组织页面
-	pagesByLanguage := ms.groupPagesByLanguage(wiki.Pages)
+	pagesByLanguage := ms.groupPagesByLanguage(wiki.Pages, wiki.Language)
 
 	// 为每种语言创建目录并保存页面
+	written := make(map[string]bool)
 	for language, pages := range pagesByLanguage {
 		langDir := filepath.Join(wikiDir, language)
 		if err := os.MkdirAll(langDir, 0755); err != nil {
@@ -183,22 +235,85 @@ func (ms *MarkdownStorage) SaveWiki(wiki *models.Wiki) error {
 				log.Printf("保存页面失败: %s/%s, 错误: %v", language, page.Title, err)
 				continue
 			}
+			written[filepath.Join(langDir, ms.generateFilename(&page))] = true
 		}
 	}
 
-	// 创建assets目录
+	// 保存翻译（语言目录下的translation子目录）
+	if err := ms.saveTranslations(wikiDir, wiki.Translations, written); err != nil {
+		return fmt.Errorf("保存翻译失败: %w", err)
+	}
+
+	// 清理已不存在的页面文件，避免重新加载时出现旧页面
+	ms.removeStalePages(wikiDir, written)
+
+	// 创建assets目录并保存图表
 	assetsDir := filepath.Join(wikiDir, "assets")
 	if err := os.MkdirAll(filepath.Join(assetsDir, "images"), 0755); err != nil {
 		return fmt.Errorf("创建assets目录失败: %w", err)
 	}
-	if err := os.MkdirAll(filepath.Join(assetsDir, "diagrams"), 0755); err != nil {
-		return fmt.Errorf("创建diagrams目录失败: %w", err)
+	if err := ms.saveDiagrams(filepath.Join(assetsDir, "diagrams"), wiki.Diagrams); err != nil {
+		return fmt.Errorf("保存图表失败: %w", err)
+	}
+
+	// 最后保存元数据
+	if err := ms.saveMetadata(wikiDir, wiki); err != nil {
+		return fmt.Errorf("保存元数据失败: %w", err)
+	}
+
+	// 旧版本把固定版本的Wiki存在包目录或以ID命名的目录，迁移后删除旧副本
+	for _, legacy := range []string{ms.sanitizePath(wiki.PackagePath), ms.sanitizePath(wiki.ID)} {
+		legacyDir := filepath.Join(ms.baseDir, legacy)
+		if legacy == "" || legacyDir == wikiDir {
+			continue
+		}
+		if metadata, err := ms.loadMetadata(legacyDir); err == nil && metadata.ID == wiki.ID {
+			if err := ms.removeWikiFiles(legacyDir); err != nil {
+				log.Printf("删除旧的Wiki目录失败: %s, 错误: %v", legacyDir, err)
+			}
+		}
 	}
 
 	log.Printf("Wiki %s 保存成功，目录: %s", wiki.ID, wikiDir)
 	return nil
 }
 
+// removeStalePages 删除语言目录中本次保存未写入的页面文件
+func (ms *MarkdownStorage) removeStalePages(wikiDir string, written map[string]bool) {
+	entries, err := os.ReadDir(wikiDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "assets" {
+			continue
+		}
+
+		filepath.WalkDir(filepath.Join(wikiDir, entry.Name()), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && ms.isWikiDir(path) {
+				return filepath.SkipDir // 嵌套的其他Wiki（如子包）
+			}
+			if d.IsDir() || !strings.HasSuffix(path, ".md") || written[path] {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				log.Printf("删除旧页面失败: %s, 错误: %v", path, err)
+			}
+			return nil
+		})
+	}
+}
+
+// isWikiDir 判断目录是否为一个Wiki根目录（包含meta.json）
+func (ms *MarkdownStorage) isWikiDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "meta.json"))
+	return err == nil
+}
+
 // saveMetadata 保存Wiki元数据
 func (ms *MarkdownStorage) saveMetadata(wikiDir string, wiki *models.Wiki) error {
 	metadata := WikiMetadata{
@@ -211,11 +326,23 @@ func (ms *MarkdownStorage) saveMetadata(wikiDir string, wiki *models.Wiki) error
 		Progress:     wiki.Progress,
 		CreatedAt:    wiki.CreatedAt,
 		UpdatedAt:    wiki.UpdatedAt,
-		Languages:    ms.extractLanguages(wiki.Pages),
+		GeneratedBy:  wiki.GeneratedBy,
+		Model:        wiki.Model,
+		Language:     wiki.Language,
+		Languages:    wiki.Languages,
 		Settings:     wiki.Settings,
 		Metadata:     wiki.Metadata,
 		Tags:         wiki.Tags,
 	}
+	if len(metadata.Languages) == 0 {
+		metadata.Languages = ms.extractLanguages(wiki.Pages, wiki.Language)
+	}
+
+	// 版本号在上一次保存的基础上递增
+	metadata.Version = 1
+	if existing, err := ms.loadMetadata(wikiDir); err == nil {
+		metadata.Version = existing.Version + 1
+	}
 
 	metaFile := filepath.Join(wikiDir, "meta.json")
 	data, err := json.MarshalIndent(metadata, "", "  ")
@@ -223,49 +350,42 @@ func (ms *MarkdownStorage) saveMetadata(wikiDir string, wiki *models.Wiki) error
 		return fmt.Errorf("序列化元数据失败: %w", err)
 	}
 
-	if err := os.WriteFile(metaFile, data, 0644); err != nil {
+	if err := writeFileAtomic(metaFile, data, 0644); err != nil {
 		return fmt.Errorf("写入元数据文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// groupPagesByLanguage 按语言分组页面
-func (ms *MarkdownStorage) groupPagesByLanguage(pages []models.WikiPage) map[string][]models.WikiPage {
+// groupPagesByLanguage 按页面的语言分组页面，没有记录语言的页面归入wiki的主语言
+func (ms *MarkdownStorage) groupPagesByLanguage(pages []models.WikiPage, defaultLanguage string) map[string][]models.WikiPage {
 	result := make(map[string][]models.WikiPage)
 
 	for _, page := range pages {
-		// 从页面ID中提取语言信息，格式通常是 "type_language"
-		language := ms.extractLanguageFromPageID(page.ID)
-		if language == "" {
-			language = "zh" // 默认中文
-		}
-
+		language := ms.pageLanguage(page, defaultLanguage)
 		result[language] = append(result[language], page)
 	}
 
 	return result
 }
 
-// extractLanguageFromPageID 从页面ID中提取语言
-func (ms *MarkdownStorage) extractLanguageFromPageID(pageID string) string {
-	parts := strings.Split(pageID, "_")
-	if len(parts) >= 2 {
-		return parts[len(parts)-1] // 取最后一部分作为语言
+// pageLanguage 返回页面的语言，没有记录时使用默认语言，默认中文
+func (ms *MarkdownStorage) pageLanguage(page models.WikiPage, defaultLanguage string) string {
+	if page.Language != "" {
+		return page.Language
+	}
+	if defaultLanguage != "" {
+		return defaultLanguage
 	}
-	return ""
+	return "zh"
 }
 
 // extractLanguages 从页面中提取所有语言
-func (ms *MarkdownStorage) extractLanguages(pages []models.WikiPage) []string {
+func (ms *MarkdownStorage) extractLanguages(pages []models.WikiPage, defaultLanguage string) []string {
 	languageSet := make(map[string]bool)
 
 	for _, page := range pages {
-		language := ms.extractLanguageFromPageID(page.ID)
-		if language == "" {
-			language = "zh"
-		}
-		languageSet[language] = true
+		languageSet[ms.pageLanguage(page, defaultLanguage)] = true
 	}
 
 	var languages []string
@@ -286,7 +406,7 @@ func (ms *MarkdownStorage) savePage(langDir string, page *models.WikiPage) error
 	content := ms.generateMarkdownContent(page)
 
 	// 写入文件
-	if err := os.WriteFile(filepath, []byte(content), 0644); err != nil {
+	if err := writeFileAtomic(filepath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("写入页面文件失败: %w", err)
 	}
 
@@ -294,20 +414,14 @@ func (ms *MarkdownStorage) savePage(langDir string, page *models.WikiPage) error
 	return nil
 }
 
-// generateFilename 根据页面标题生成文件名
+// generateFilename 根据页面的key生成文件名。key在同一语言内唯一且与标题的语言无关，
+// 标题相同的页面不会互相覆盖，各语言的同一页面文件名相同
 func (ms *MarkdownStorage) generateFilename(page *models.WikiPage) string {
-	// 直接使用标题生成文件名，不硬编码
-	filename := ms.slugify(page.Title)
-
-	// 如果是overview类型且标题包含"说明"、"readme"等，使用README
-	if page.Type == models.PageTypeOverview &&
-		(strings.Contains(strings.ToLower(page.Title), "readme") ||
-			strings.Contains(page.Title, "说明") ||
-			strings.Contains(page.Title, "项目")) {
-		filename = "README"
+	key := page.Key
+	if key == "" {
+		key = page.ID
 	}
-
-	return filename + ".md"
+	return ms.slugify(key) + ".md"
 }
 
 // slugify 将标题转换为适合文件名的格式
@@ -347,13 +461,35 @@ func (ms *MarkdownStorage) generateMarkdownContent(page *models.WikiPage) string
 
 	// 添加前置元数据
 	content.WriteString("---\n")
-	content.WriteString(fmt.Sprintf("title: %s\n", page.Title))
+	content.WriteString(fmt.Sprintf("id: %s\n", ms.frontMatterValue(page.ID)))
+	if page.Key != "" {
+		content.WriteString(fmt.Sprintf("key: %s\n", ms.frontMatterValue(page.Key)))
+	}
+	if page.Language != "" {
+		content.WriteString(fmt.Sprintf("language: %s\n", page.Language))
+	}
+	content.WriteString(fmt.Sprintf("title: %s\n", ms.frontMatterValue(page.Title)))
 	content.WriteString(fmt.Sprintf("type: %s\n", page.Type))
 	content.WriteString(fmt.Sprintf("order: %d\n", page.Order))
+	if page.ParentID != "" {
+		content.WriteString(fmt.Sprintf("parent_id: %s\n", ms.frontMatterValue(page.ParentID)))
+	}
+	if len(page.Children) > 0 {
+		content.WriteString(fmt.Sprintf("children: %s\n", ms.frontMatterList(page.Children)))
+	}
+	if len(page.Tags) > 0 {
+		content.WriteString(fmt.Sprintf("tags: %s\n", ms.frontMatterList(page.Tags)))
+	}
 	content.WriteString(fmt.Sprintf("word_count: %d\n", page.WordCount))
 	content.WriteString(fmt.Sprintf("reading_time: %d\n", page.ReadingTime))
 	content.WriteString(fmt.Sprintf("created_at: %s\n", page.CreatedAt.Format(time.RFC3339)))
 	content.WriteString(fmt.Sprintf("updated_at: %s\n", page.UpdatedAt.Format(time.RFC3339)))
+	if page.Source != nil {
+		// 翻译页面记录翻译时的源页面，用于判断翻译是否过期
+		content.WriteString(fmt.Sprintf("source_id: %s\n", ms.frontMatterValue(page.Source.PageID)))
+		content.WriteString(fmt.Sprintf("source_hash: %s\n", page.Source.Hash))
+		content.WriteString(fmt.Sprintf("source_updated_at: %s\n", page.Source.UpdatedAt.Format(time.RFC3339)))
+	}
 	content.WriteString("---\n\n")
 
 	// 添加页面内容
@@ -364,24 +500,14 @@ func (ms *MarkdownStorage) generateMarkdownContent(page *models.WikiPage) string
 
 // LoadWiki 从Markdown文件结构加载Wiki
 func (ms *MarkdownStorage) LoadWiki(wikiID string) (*models.Wiki, error) {
-	log.Printf("LoadWiki: 尝试加载wiki ID: %s", wikiID)
-
-	// 首先尝试直接使用wikiID作为路径
-	wikiDir := filepath.Join(ms.baseDir, wikiID)
-	log.Printf("LoadWiki: 尝试路径: %s", wikiDir)
+	lock := ms.wikiLock(wikiID)
+	lock.RLock()
+	defer lock.RUnlock()
 
-	// 如果直接路径不存在，尝试查找
-	if _, err := os.Stat(wikiDir); os.IsNotExist(err) {
-		log.Printf("LoadWiki: 直接路径不存在，尝试查找: %s", wikiID)
-		foundPath := ms.findWikiPath(wikiID)
-		if foundPath == "" {
-			log.Printf("LoadWiki: 未找到wiki路径: %s", wikiID)
-			return nil, fmt.Errorf("wiki %s 不存在", wikiID)
-		}
-		log.Printf("LoadWiki: 找到路径: %s", foundPath)
-		wikiDir = filepath.Join(ms.baseDir, foundPath)
-	} else {
-		log.Printf("LoadWiki: 直接路径存在: %s", wikiDir)
+	// 先尝试直接使用wikiID作为路径，再按meta.json中的ID查找
+	wikiDir := ms.resolveWikiDir(wikiID)
+	if _, err := os.Stat(filepath.Join(wikiDir, "meta.json")); os.IsNotExist(err) {
+		return nil, fmt.Errorf("wiki %s: %w", wikiID, ErrNotFound)
 	}
 
 	// 加载元数据
@@ -396,6 +522,16 @@ func (ms *MarkdownStorage) LoadWiki(wikiID string) (*models.Wiki, error) {
 		return nil, fmt.Errorf("加载页面失败: %w", err)
 	}
 
+	// 加载图表和翻译
+	diagrams, err := ms.loadDiagrams(filepath.Join(wikiDir, "assets", "diagrams"))
+	if err != nil {
+		return nil, fmt.Errorf("加载图表失败: %w", err)
+	}
+	translations, err := ms.loadTranslations(wikiDir)
+	if err != nil {
+		return nil, fmt.Errorf("加载翻译失败: %w", err)
+	}
+
 	// 自动修复空的title和description
 	title := metadata.Title
 	if title == "" && metadata.PackagePath != "" {
@@ -409,18 +545,25 @@ func (ms *MarkdownStorage) LoadWiki(wikiID string) (*models.Wiki, error) {
 
 	// 构建Wiki对象
 	wiki := &models.Wiki{
-		ID:          metadata.ID,
-		Title:       title,
-		Description: description,
-		PackagePath: metadata.PackagePath, // 设置包路径
-		Status:      metadata.Status,
-		Progress:    metadata.Progress,
-		CreatedAt:   metadata.CreatedAt,
-		UpdatedAt:   metadata.UpdatedAt,
-		Settings:    metadata.Settings,
-		Metadata:    metadata.Metadata,
-		Tags:        metadata.Tags,
-		Pages:       pages,
+		ID:           metadata.ID,
+		RepositoryID: metadata.RepositoryID,
+		Title:        title,
+		Description:  description,
+		PackagePath:  metadata.PackagePath, // 设置包路径
+		Status:       metadata.Status,
+		Progress:     metadata.Progress,
+		CreatedAt:    metadata.CreatedAt,
+		UpdatedAt:    metadata.UpdatedAt,
+		GeneratedBy:  metadata.GeneratedBy,
+		Model:        metadata.Model,
+		Language:     metadata.Language,
+		Languages:    metadata.Languages,
+		Settings:     metadata.Settings,
+		Metadata:     metadata.Metadata,
+		Tags:         metadata.Tags,
+		Pages:        pages,
+		Diagrams:     diagrams,
+		Translations: translations,
 	}
 
 	return wiki, nil
@@ -460,6 +603,9 @@ func (ms *MarkdownStorage) loadAllPages(wikiDir string) ([]models.WikiPage, erro
 
 		language := entry.Name()
 		langDir := filepath.Join(wikiDir, language)
+		if ms.isWikiDir(langDir) {
+			continue // 嵌套的其他Wiki（如子包），不是语言目录
+		}
 
 		// 加载该语言的所有页面
 		langPages, err := ms.loadLanguagePages(langDir, language)
@@ -471,7 +617,18 @@ func (ms *MarkdownStorage) loadAllPages(wikiDir string) ([]models.WikiPage, erro
 		pages = append(pages, langPages...)
 	}
 
-	return pages, nil
+	return ms.sortPages(pages), nil
+}
+
+// sortPages 按Order排序页面，Order相同时按ID排序，保证加载顺序稳定
+func (ms *MarkdownStorage) sortPages(pages []models.WikiPage) []models.WikiPage {
+	sort.SliceStable(pages, func(i, j int) bool {
+		if pages[i].Order != pages[j].Order {
+			return pages[i].Order < pages[j].Order
+		}
+		return pages[i].ID < pages[j].ID
+	})
+	return pages
 }
 
 // loadLanguagePages 加载指定语言的所有页面
@@ -482,6 +639,9 @@ func (ms *MarkdownStorage) loadLanguagePages(langDir, language string) ([]models
 		if err != nil {
 			return err
 		}
+		if d.IsDir() && path != langDir && (ms.isWikiDir(path) || d.Name() == translationDirName) {
+			return filepath.SkipDir // 嵌套的其他Wiki或翻译目录
+		}
 
 		// 只处理.md文件
 		if d.IsDir() || !strings.HasSuffix(path, ".md") {
@@ -529,23 +689,41 @@ func (ms *MarkdownStorage) parseMarkdownContent(content, filePath, language stri
 	// 解析前置元数据
 	metadata := ms.parseFrontMatter(frontMatter)
 
+	// 页面的语言优先使用前置元数据，旧文件没有记录时使用所在目录的语言
+	if metadata["language"] != "" {
+		language = metadata["language"]
+	}
+
 	// 生成页面ID
 	filename := filepath.Base(filePath)
-	pageID := ms.generatePageID(filename, language, metadata)
+	pageID, key := ms.generatePageID(filename, language, metadata)
 
 	// 创建页面对象
 	page := &models.WikiPage{
 		ID:          pageID,
+		Key:         key,
+		Language:    language,
 		Title:       metadata["title"],
 		Content:     markdownContent,
 		Type:        ms.parsePageType(metadata["type"]),
 		Order:       ms.parseInt(metadata["order"], 999),
-		WordCount:   len(markdownContent),
+		WordCount:   ms.parseInt(metadata["word_count"], len(markdownContent)),
 		ReadingTime: ms.parseInt(metadata["reading_time"], ms.calculateReadingTime(markdownContent)),
+		ParentID:    metadata["parent_id"],
+		Children:    ms.parseList(metadata["children"]),
+		Tags:        ms.parseList(metadata["tags"]),
 		CreatedAt:   ms.parseTime(metadata["created_at"]),
 		UpdatedAt:   ms.parseTime(metadata["updated_at"]),
 	}
 
+	if metadata["source_id"] != "" {
+		page.Source = &models.TranslationSource{
+			PageID:    metadata["source_id"],
+			Hash:      metadata["source_hash"],
+			UpdatedAt: ms.parseTime(metadata["source_updated_at"]),
+		}
+	}
+
 	// 如果没有标题，从文件名生成
 	if page.Title == "" {
 		page.Title = ms.generateTitleFromFilename(filename)
@@ -603,16 +781,58 @@ func (ms *MarkdownStorage) splitFrontMatter(content string) (map[string]string,
 
 // parseFrontMatter 解析前置元数据
 func (ms *MarkdownStorage) parseFrontMatter(frontMatter map[string]string) map[string]string {
-	// 清理值中的引号
+	// 清理值中的引号，带转义的双引号字符串按Go语法还原
 	for key, value := range frontMatter {
+		if strings.HasPrefix(value, "\"") {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				frontMatter[key] = unquoted
+				continue
+			}
+		}
 		value = strings.Trim(value, "\"'")
 		frontMatter[key] = value
 	}
 	return frontMatter
 }
 
-// generatePageID 生成页面ID
-func (ms *MarkdownStorage) generatePageID(filename, language string, metadata map[string]string) string {
+// frontMatterValue 格式化前置元数据的值，包含换行、首尾空白或引号时加引号转义
+func (ms *MarkdownStorage) frontMatterValue(value string) string {
+	if strings.ContainsAny(value, "\r\n") || strings.TrimSpace(value) != value ||
+		strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'") ||
+		strings.HasSuffix(value, "\"") || strings.HasSuffix(value, "'") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// frontMatterList 将列表格式化为JSON数组（同时也是合法的YAML流式序列）
+func (ms *MarkdownStorage) frontMatterList(values []string) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// parseList 解析frontMatterList写入的列表
+func (ms *MarkdownStorage) parseList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(value), &values); err != nil {
+		return nil
+	}
+	return values
+}
+
+// generatePageID 生成页面ID和key。优先使用前置元数据中保存的ID和key，
+// 旧文件没有保存key时key为空，由 models.MigratePageIdentity 补全
+func (ms *MarkdownStorage) generatePageID(filename, language string, metadata map[string]string) (string, string) {
+	if id := metadata["id"]; id != "" {
+		return id, metadata["key"]
+	}
+
 	// 移除.md扩展名
 	name := strings.TrimSuffix(filename, ".md")
 
@@ -626,20 +846,17 @@ func (ms *MarkdownStorage) generatePageID(filename, language string, metadata ma
 		pageID = "overview"
 	}
 
-	return fmt.Sprintf("%s_%s", pageID, language)
+	return models.PageID(pageID, language), pageID
 }
 
 // parsePageType 解析页面类型
 func (ms *MarkdownStorage) parsePageType(typeStr string) models.PageType {
-	switch typeStr {
-	case "overview":
-		return models.PageTypeOverview
-	case "guide":
-		return models.PageTypeGuide
-	case "api":
-		return models.PageTypeAPI
-	case "architecture":
-		return models.PageTypeArchitecture
+	switch models.PageType(typeStr) {
+	case models.PageTypeOverview, models.PageTypeArchitecture, models.PageTypeAPI,
+		models.PageTypeModule, models.PageTypeFunction, models.PageTypeClass,
+		models.PageTypeTutorial, models.PageTypeReference, models.PageTypeChangelog,
+		models.PageTypeGuide:
+		return models.PageType(typeStr)
 	default:
 		return models.PageTypeGuide
 	}
@@ -719,6 +936,9 @@ func (ms *MarkdownStorage) ListWikis() ([]models.Wiki, error) {
 		if err != nil {
 			return nil // 忽略错误，继续搜索
 		}
+		if ms.skipHiddenDir(path, d) {
+			return filepath.SkipDir
+		}
 
 		// 只处理meta.json文件
 		if !d.IsDir() && d.Name() == "meta.json" {
@@ -757,15 +977,17 @@ func (ms *MarkdownStorage) ListWikis() ([]models.Wiki, error) {
 
 // DeleteWiki 删除Wiki
 func (ms *MarkdownStorage) DeleteWiki(wikiID string) error {
+	lock := ms.wikiLock(wikiID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// 查找Wiki的实际路径
-	wikiPath := ms.findWikiPath(wikiID)
-	if wikiPath == "" {
-		return fmt.Errorf("wiki %s 不存在", wikiID)
+	wikiDir := ms.resolveWikiDir(wikiID)
+	if _, err := os.Stat(filepath.Join(wikiDir, "meta.json")); os.IsNotExist(err) {
+		return fmt.Errorf("wiki %s: %w", wikiID, ErrNotFound)
 	}
 
-	wikiDir := filepath.Join(ms.baseDir, wikiPath)
-
-	if err := os.RemoveAll(wikiDir); err != nil {
+	if err := ms.removeWikiFiles(wikiDir); err != nil {
 		return fmt.Errorf("删除Wiki目录失败: %w", err)
 	}
 
@@ -773,6 +995,28 @@ func (ms *MarkdownStorage) DeleteWiki(wikiID string) error {
 	return nil
 }
 
+// removeWikiFiles 删除Wiki目录，嵌套在其中的其他Wiki（子包和固定版本）保留在原处
+func (ms *MarkdownStorage) removeWikiFiles(dir string) error {
+	if !ms.containsNestedWiki(dir) {
+		return os.RemoveAll(dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() && ms.containsWiki(path) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // UpdateWiki 更新Wiki
 func (ms *MarkdownStorage) UpdateWiki(wiki *models.Wiki) error {
 	// 更新就是重新保存
@@ -796,104 +1040,88 @@ func (ms *MarkdownStorage) LoadAllWikis() (map[string]*models.Wiki, error) {
 	return result, nil
 }
 
-// SaveLogs 保存Wiki日志
-func (ms *MarkdownStorage) SaveLogs(wikiID string, logs []string) error {
-	// 查找Wiki的实际路径
-	wikiPath := ms.findWikiPath(wikiID)
-	if wikiPath == "" {
-		// 如果找不到，使用wikiID作为路径（可能是新创建的）
-		wikiPath = wikiID
+// resolveWikiDir 根据wikiID解析Wiki目录，找不到时回退到由wikiID得出的目录（可能是新创建的）
+func (ms *MarkdownStorage) resolveWikiDir(wikiID string) string {
+	packagePath, ref := utils.SplitPackageRef(wikiID)
+	directDir := filepath.Join(ms.baseDir, ms.versionedPath(packagePath, ref))
+	if metadata, err := ms.loadMetadata(directDir); err == nil && metadata.ID == wikiID {
+		return directDir
 	}
 
-	wikiDir := filepath.Join(ms.baseDir, wikiPath)
-	logsFile := filepath.Join(wikiDir, "generation.log")
+	if wikiPath := ms.findWikiPath(wikiID); wikiPath != "" {
+		return filepath.Join(ms.baseDir, wikiPath)
+	}
+
+	return directDir
+}
+
+// SaveLogs 覆盖保存Wiki日志（JSON Lines格式）
+func (ms *MarkdownStorage) SaveLogs(wikiID string, logs []models.WikiLogEntry) error {
+	lock := ms.wikiLock(wikiID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	wikiDir := ms.resolveWikiDir(wikiID)
 
 	// 确保目录存在
 	if err := os.MkdirAll(wikiDir, 0755); err != nil {
 		return fmt.Errorf("创建Wiki目录失败: %w", err)
 	}
 
-	// 将日志转换为文本格式
-	var content strings.Builder
-	for _, logEntry := range logs {
-		content.WriteString(logEntry)
-		content.WriteString("\n")
+	data, err := encodeLogLines(logs)
+	if err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(logsFile, []byte(content.String()), 0644); err != nil {
+	if err := writeFileAtomic(filepath.Join(wikiDir, logsFileName), data, 0644); err != nil {
 		return fmt.Errorf("写入日志文件失败: %w", err)
 	}
 
 	return nil
 }
 
-// LoadLogs 加载Wiki日志
-func (ms *MarkdownStorage) LoadLogs(wikiID string) ([]string, error) {
-	// 查找Wiki的实际路径
-	wikiPath := ms.findWikiPath(wikiID)
-	if wikiPath == "" {
-		wikiPath = wikiID // 回退到直接使用wikiID
-	}
+// LoadLogs 加载Wiki日志，兼容旧的纯文本generation.log
+func (ms *MarkdownStorage) LoadLogs(wikiID string) ([]models.WikiLogEntry, error) {
+	lock := ms.wikiLock(wikiID)
+	lock.RLock()
+	defer lock.RUnlock()
 
-	logsFile := filepath.Join(ms.baseDir, wikiPath, "generation.log")
+	wikiDir := ms.resolveWikiDir(wikiID)
 
-	// 检查文件是否存在
-	if _, err := os.Stat(logsFile); os.IsNotExist(err) {
-		return []string{}, nil // 返回空日志
+	data, err := os.ReadFile(filepath.Join(wikiDir, logsFileName))
+	if err == nil {
+		return decodeLogLines(data), nil
 	}
-
-	data, err := os.ReadFile(logsFile)
-	if err != nil {
+	if !os.IsNotExist(err) {
 		return nil, fmt.Errorf("读取日志文件失败: %w", err)
 	}
 
-	// 按行分割日志内容
-	content := strings.TrimSpace(string(data))
-	if content == "" {
-		return []string{}, nil
-	}
-
-	logs := strings.Split(content, "\n")
-
-	// 过滤空行
-	var filteredLogs []string
-	for _, log := range logs {
-		if strings.TrimSpace(log) != "" {
-			filteredLogs = append(filteredLogs, log)
+	// 回退到旧格式的纯文本日志
+	data, err = os.ReadFile(filepath.Join(wikiDir, legacyLogsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.WikiLogEntry{}, nil // 返回空日志
 		}
+		return nil, fmt.Errorf("读取日志文件失败: %w", err)
 	}
 
-	return filteredLogs, nil
+	return legacyLogEntries(wikiID, strings.Split(string(data), "\n")), nil
 }
 
 // AppendLog 追加单条日志到文件
-func (ms *MarkdownStorage) AppendLog(wikiID, logEntry string) error {
-	// 查找Wiki的实际路径
-	wikiPath := ms.findWikiPath(wikiID)
-	if wikiPath == "" {
-		wikiPath = wikiID // 回退到直接使用wikiID
-	}
+func (ms *MarkdownStorage) AppendLog(wikiID string, entry models.WikiLogEntry) error {
+	lock := ms.wikiLock(wikiID)
+	lock.Lock()
+	defer lock.Unlock()
 
-	wikiDir := filepath.Join(ms.baseDir, wikiPath)
-	logsFile := filepath.Join(wikiDir, "generation.log")
+	wikiDir := ms.resolveWikiDir(wikiID)
 
 	// 确保目录存在
 	if err := os.MkdirAll(wikiDir, 0755); err != nil {
 		return fmt.Errorf("创建Wiki目录失败: %w", err)
 	}
 
-	// 追加日志到文件
-	file, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("打开日志文件失败: %w", err)
-	}
-	defer file.Close()
-
-	// 添加时间戳
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logLine := fmt.Sprintf("[%s] %s\n", timestamp, logEntry)
-
-	if _, err := file.WriteString(logLine); err != nil {
+	if err := appendLogLine(filepath.Join(wikiDir, logsFileName), entry); err != nil {
 		return fmt.Errorf("写入日志失败: %w", err)
 	}
 
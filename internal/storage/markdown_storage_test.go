@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// TestMarkdownFsckQuarantinesCorruptWiki 截断的meta.json应被隔离，嵌套的子包Wiki不受影响
+func TestMarkdownFsckQuarantinesCorruptWiki(t *testing.T) {
+	baseDir := filepath.Join(t.TempDir(), "wikis")
+	store := NewMarkdownStorage(baseDir)
+
+	parent := newFixtureWiki("github.com/example/parent", "Parent")
+	child := newFixtureWiki("github.com/example/parent/child", "Child")
+	mustSave(t, store, parent)
+	mustSave(t, store, child)
+
+	// 模拟写入中断：截断的元数据和残留的临时文件
+	parentDir := filepath.Join(baseDir, "github.com/example/parent")
+	if err := os.WriteFile(filepath.Join(parentDir, "meta.json"), []byte(`{"id": "github.com/exa`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parentDir, tempFilePrefix+"meta.json-123"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := store.Fsck()
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if report.Checked != 2 || report.TempFilesRemoved != 1 {
+		t.Errorf("report = %+v, want 2 checked and 1 temp file removed", report)
+	}
+	if len(report.Quarantined) != 1 || report.Quarantined[0] != filepath.FromSlash("github.com/example/parent") {
+		t.Fatalf("quarantined = %v, want the parent wiki only", report.Quarantined)
+	}
+
+	if _, err := store.LoadWiki(parent.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LoadWiki(parent) error = %v, want ErrNotFound", err)
+	}
+	mustLoad(t, store, child.ID)
+
+	all, err := store.LoadAllWikis()
+	if err != nil {
+		t.Fatalf("LoadAllWikis: %v", err)
+	}
+	if len(all) != 1 {
+		t.Errorf("LoadAllWikis returned %d wikis, want only the child", len(all))
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(baseDir, quarantineDirName, "*", "github.com", "example", "parent", "meta.json"))
+	if len(matches) != 1 {
+		t.Errorf("quarantined meta.json not found")
+	}
+}
+
+// TestMarkdownMetadataVersion 每次保存元数据版本号递增
+func TestMarkdownMetadataVersion(t *testing.T) {
+	baseDir := filepath.Join(t.TempDir(), "wikis")
+	store := NewMarkdownStorage(baseDir)
+	wiki := newFixtureWiki("github.com/example/version", "Version")
+
+	for i := 0; i < 3; i++ {
+		mustSave(t, store, wiki)
+	}
+
+	data, err := os.ReadFile(filepath.Join(baseDir, wiki.PackagePath, "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata WikiMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Version != 3 {
+		t.Errorf("version = %d, want 3", metadata.Version)
+	}
+}
+
+// TestMarkdownLegacyPageIdentity 旧版本按标题命名、没有key和language的页面文件
+// 迁移后补全key和语言，再次保存时改用key命名
+func TestMarkdownLegacyPageIdentity(t *testing.T) {
+	baseDir := filepath.Join(t.TempDir(), "wikis")
+	store := NewMarkdownStorage(baseDir)
+	wiki := newFixtureWiki("github.com/example/legacy", "Legacy")
+	wiki.Pages = wiki.Pages[:1]
+	wiki.Pages[0].Children = nil
+	wiki.Translations = nil
+	mustSave(t, store, wiki)
+
+	langDir := filepath.Join(baseDir, wiki.PackagePath, "en")
+	if err := os.Remove(filepath.Join(langDir, "overview.md")); err != nil {
+		t.Fatal(err)
+	}
+	legacy := "---\nid: overview_en\ntitle: Overview\ntype: overview\n---\n\n# Overview\n"
+	if err := os.WriteFile(filepath.Join(langDir, "project-overview.md"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := mustLoad(t, store, wiki.ID)
+	if len(loaded.Pages) != 1 || loaded.Pages[0].Language != "en" {
+		t.Fatalf("pages = %+v", loaded.Pages)
+	}
+	if !models.MigratePageIdentity(loaded) || loaded.Pages[0].Key != "overview" {
+		t.Fatalf("migrated page = %+v", loaded.Pages[0])
+	}
+
+	mustSave(t, store, loaded)
+	if _, err := os.Stat(filepath.Join(langDir, "overview.md")); err != nil {
+		t.Errorf("page not renamed to its key: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(langDir, "project-overview.md")); !os.IsNotExist(err) {
+		t.Errorf("legacy file kept: %v", err)
+	}
+	if page := mustLoad(t, store, wiki.ID).Pages[0]; page.Key != "overview" || page.ID != "overview_en" {
+		t.Errorf("reloaded page = %+v", page)
+	}
+}
+
+// TestMarkdownPinnedWikiMovesOutOfPackageDir 旧版本存放在包目录的固定版本Wiki，
+// 再次保存时移到版本目录，旧副本被删除
+func TestMarkdownPinnedWikiMovesOutOfPackageDir(t *testing.T) {
+	baseDir := filepath.Join(t.TempDir(), "wikis")
+	store := NewMarkdownStorage(baseDir)
+	pinned := newFixtureWiki("github.com/example/moved@v1.0.0", "Pinned")
+	pinned.PackagePath = "github.com/example/moved"
+
+	// 模拟旧版本的目录布局：固定版本写在包目录
+	legacy := *pinned
+	legacy.ID = "github.com/example/moved"
+	mustSave(t, store, &legacy)
+	data, err := os.ReadFile(filepath.Join(baseDir, "github.com/example/moved", "meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata WikiMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	metadata.ID = pinned.ID
+	if data, err = json.Marshal(metadata); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, "github.com/example/moved", "meta.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mustSave(t, store, pinned)
+	if _, err := os.Stat(filepath.Join(baseDir, "github.com/example/moved", "@v", "v1.0.0", "meta.json")); err != nil {
+		t.Errorf("pinned wiki not in its version directory: %v", err)
+	}
+	all, err := store.LoadAllWikis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[pinned.ID] == nil {
+		t.Errorf("LoadAllWikis = %v, want only %s", len(all), pinned.ID)
+	}
+}
+
+// TestMarkdownWikiPathStaysInBaseDir 包路径中的 "." 和 ".." 段不能让Wiki目录跳出存储目录
+func TestMarkdownWikiPathStaysInBaseDir(t *testing.T) {
+	store := NewMarkdownStorage(filepath.Join(t.TempDir(), "wikis"))
+	for path, want := range map[string]string{
+		"evil.com/a/../../../../tmp/victim": "evil.com/a/_/_/_/_/tmp/victim",
+		"/./example.com//repo/.":            "_/example.com/repo/_",
+		`example.com\..\repo`:               "example.com_.._repo",
+	} {
+		if got := store.sanitizePath(path); got != want {
+			t.Errorf("sanitizePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// tokensFile API令牌文件，位于隐藏目录中，遍历Wiki时会被跳过
+const tokensFile = ".auth/tokens.json"
+
+// SaveToken 保存API令牌，ID相同时替换（实现TokenStorage接口）
+func (ms *MarkdownStorage) SaveToken(token *models.APIToken) error {
+	ms.tokensMu.Lock()
+	defer ms.tokensMu.Unlock()
+
+	tokens, err := ms.loadTokens()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range tokens {
+		if tokens[i].ID == token.ID {
+			tokens[i] = *token
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		tokens = append(tokens, *token)
+	}
+	return ms.writeTokens(tokens)
+}
+
+// LoadTokens 返回所有API令牌
+func (ms *MarkdownStorage) LoadTokens() ([]models.APIToken, error) {
+	ms.tokensMu.Lock()
+	defer ms.tokensMu.Unlock()
+
+	return ms.loadTokens()
+}
+
+// DeleteToken 删除API令牌
+func (ms *MarkdownStorage) DeleteToken(id string) error {
+	ms.tokensMu.Lock()
+	defer ms.tokensMu.Unlock()
+
+	tokens, err := ms.loadTokens()
+	if err != nil {
+		return err
+	}
+	for i := range tokens {
+		if tokens[i].ID == id {
+			return ms.writeTokens(append(tokens[:i], tokens[i+1:]...))
+		}
+	}
+	return fmt.Errorf("token %s: %w", id, ErrTokenNotFound)
+}
+
+// loadTokens 读取令牌文件，调用方需持有tokensMu
+func (ms *MarkdownStorage) loadTokens() ([]models.APIToken, error) {
+	data, err := os.ReadFile(filepath.Join(ms.baseDir, tokensFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.APIToken{}, nil
+		}
+		return nil, fmt.Errorf("读取令牌文件失败: %w", err)
+	}
+
+	var tokens []models.APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("解析令牌文件失败: %w", err)
+	}
+	return tokens, nil
+}
+
+// writeTokens 原子写入令牌文件，仅所有者可读
+func (ms *MarkdownStorage) writeTokens(tokens []models.APIToken) error {
+	path := filepath.Join(ms.baseDir, tokensFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建令牌目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化令牌失败: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("写入令牌文件失败: %w", err)
+	}
+	return nil
+}
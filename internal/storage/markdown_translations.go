@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// 翻译存放在各语言目录下：
+//
+//	<lang>/translation.json      翻译元数据（标题、描述、时间）
+//	<lang>/translation/*.md      翻译后的页面
+//	assets/diagrams/<lang>/*.mmd 翻译后的图表
+const (
+	translationMetaFileName = "translation.json"
+	translationDirName      = "translation"
+)
+
+// translationMetadata 翻译元数据
+type translationMetadata struct {
+	Language    string    `json:"language"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// saveTranslations 保存所有翻译，written记录写入的页面文件供清理旧页面使用
+func (ms *MarkdownStorage) saveTranslations(wikiDir string, translations map[string]*models.WikiTrans, written map[string]bool) error {
+	for language, trans := range translations {
+		if trans == nil {
+			continue
+		}
+		if !ms.isValidLanguageDir(language) {
+			log.Printf("跳过无效的翻译语言: %q", language)
+			continue
+		}
+
+		langDir := filepath.Join(wikiDir, language)
+		transDir := filepath.Join(langDir, translationDirName)
+		if err := os.MkdirAll(transDir, 0755); err != nil {
+			return fmt.Errorf("创建翻译目录 %s 失败: %w", language, err)
+		}
+
+		meta := translationMetadata{
+			Language:    language,
+			Title:       trans.Title,
+			Description: trans.Description,
+			CreatedAt:   trans.CreatedAt,
+			UpdatedAt:   trans.UpdatedAt,
+		}
+		data, err := json.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return fmt.Errorf("序列化翻译元数据失败: %w", err)
+		}
+		if err := writeFileAtomic(filepath.Join(langDir, translationMetaFileName), data, 0644); err != nil {
+			return fmt.Errorf("写入翻译元数据失败: %w", err)
+		}
+
+		for _, page := range trans.Pages {
+			if err := ms.savePage(transDir, &page); err != nil {
+				log.Printf("保存翻译页面失败: %s/%s, 错误: %v", language, page.Title, err)
+				continue
+			}
+			written[filepath.Join(transDir, ms.generateFilename(&page))] = true
+		}
+
+		if err := ms.saveDiagrams(filepath.Join(wikiDir, "assets", "diagrams", language), trans.Diagrams); err != nil {
+			return fmt.Errorf("保存翻译图表 %s 失败: %w", language, err)
+		}
+	}
+
+	// 删除已不存在的翻译
+	entries, err := os.ReadDir(wikiDir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "assets" {
+			continue
+		}
+		if _, keep := translations[entry.Name()]; keep {
+			continue
+		}
+		langDir := filepath.Join(wikiDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(langDir, translationMetaFileName)); err != nil {
+			continue
+		}
+		os.Remove(filepath.Join(langDir, translationMetaFileName))
+		os.RemoveAll(filepath.Join(langDir, translationDirName))
+		os.RemoveAll(filepath.Join(wikiDir, "assets", "diagrams", entry.Name()))
+	}
+
+	return nil
+}
+
+// loadTranslations 加载所有语言目录下的翻译
+func (ms *MarkdownStorage) loadTranslations(wikiDir string) (map[string]*models.WikiTrans, error) {
+	entries, err := os.ReadDir(wikiDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取Wiki目录失败: %w", err)
+	}
+
+	var translations map[string]*models.WikiTrans
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "assets" {
+			continue
+		}
+
+		langDir := filepath.Join(wikiDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(langDir, translationMetaFileName))
+		if err != nil {
+			continue // 该语言目录没有翻译
+		}
+
+		var meta translationMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			log.Printf("解析翻译元数据失败: %s, 错误: %v", langDir, err)
+			continue
+		}
+		if meta.Language == "" {
+			meta.Language = entry.Name()
+		}
+
+		pages, err := ms.loadLanguagePages(filepath.Join(langDir, translationDirName), meta.Language)
+		if err != nil {
+			return nil, fmt.Errorf("加载翻译页面 %s 失败: %w", meta.Language, err)
+		}
+		diagrams, err := ms.loadDiagrams(filepath.Join(wikiDir, "assets", "diagrams", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("加载翻译图表 %s 失败: %w", meta.Language, err)
+		}
+
+		if translations == nil {
+			translations = make(map[string]*models.WikiTrans)
+		}
+		translations[meta.Language] = &models.WikiTrans{
+			Language:    meta.Language,
+			Title:       meta.Title,
+			Description: meta.Description,
+			Pages:       ms.sortPages(pages),
+			Diagrams:    diagrams,
+			CreatedAt:   meta.CreatedAt,
+			UpdatedAt:   meta.UpdatedAt,
+		}
+	}
+
+	return translations, nil
+}
+
+// isValidLanguageDir 语言代码将作为目录名使用，不能包含路径分隔符
+func (ms *MarkdownStorage) isValidLanguageDir(language string) bool {
+	return language != "" && language != "assets" && language != "." && language != ".." &&
+		!strings.ContainsAny(language, `/\`)
+}
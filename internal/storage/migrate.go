@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// MigrateResult summarizes a migration between two backends
+type MigrateResult struct {
+	Wikis  int      `json:"wikis"`
+	Logs   int      `json:"logs"`
+	Chat   int      `json:"chat"`
+	Failed []string `json:"failed,omitempty"`
+}
+
+// Migrate copies every wiki, its logs and (when both sides support it) its
+// chat history from src to dst. Wikis that fail are recorded and skipped so
+// a single broken directory does not abort the whole import.
+func Migrate(src, dst Storage) (*MigrateResult, error) {
+	wikis, err := src.LoadAllWikis()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source wikis: %w", err)
+	}
+
+	srcChat, srcHasChat := src.(ChatStorage)
+	dstChat, dstHasChat := dst.(ChatStorage)
+
+	result := &MigrateResult{}
+	for id, wiki := range wikis {
+		// Pages stored before they had a key and language get them on the way
+		models.MigratePageIdentity(wiki)
+		if err := dst.SaveWiki(wiki); err != nil {
+			log.Printf("Failed to migrate wiki %s: %v", id, err)
+			result.Failed = append(result.Failed, id)
+			continue
+		}
+		result.Wikis++
+
+		logs, err := src.LoadLogs(id)
+		if err != nil {
+			log.Printf("Failed to load logs for wiki %s: %v", id, err)
+		} else if len(logs) > 0 {
+			if err := dst.SaveLogs(id, logs); err != nil {
+				log.Printf("Failed to migrate logs for wiki %s: %v", id, err)
+			} else {
+				result.Logs += len(logs)
+			}
+		}
+
+		if !srcHasChat || !dstHasChat {
+			continue
+		}
+		messages, err := srcChat.LoadChatHistory(id, 0)
+		if err != nil {
+			log.Printf("Failed to load chat history for wiki %s: %v", id, err)
+			continue
+		}
+		for i := range messages {
+			if err := dstChat.SaveChatMessage(&messages[i]); err != nil {
+				log.Printf("Failed to migrate chat message %s: %v", messages[i].ID, err)
+				continue
+			}
+			result.Chat++
+		}
+	}
+
+	return result, nil
+}
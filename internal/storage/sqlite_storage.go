@@ -0,0 +1,892 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver, no CGO required
+
+	"github.com/stcn52/kwiki/pkg/models"
+)
+
+// sqliteSchema creates all tables used by SQLiteStorage.
+// Pages and diagrams carry a translation column: "" for the primary content,
+// otherwise the language code of the WikiTrans they belong to.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS wikis (
+	id            TEXT PRIMARY KEY,
+	repository_id TEXT NOT NULL DEFAULT '',
+	package_path  TEXT NOT NULL DEFAULT '',
+	title         TEXT NOT NULL DEFAULT '',
+	description   TEXT NOT NULL DEFAULT '',
+	status        TEXT NOT NULL DEFAULT '',
+	progress      INTEGER NOT NULL DEFAULT 0,
+	created_at    TEXT NOT NULL DEFAULT '',
+	updated_at    TEXT NOT NULL DEFAULT '',
+	generated_by  TEXT NOT NULL DEFAULT '',
+	model         TEXT NOT NULL DEFAULT '',
+	language      TEXT NOT NULL DEFAULT '',
+	languages     TEXT NOT NULL DEFAULT '[]',
+	settings      TEXT NOT NULL DEFAULT '{}',
+	metadata      TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS wiki_tags (
+	wiki_id  TEXT NOT NULL,
+	tag      TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (wiki_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_wiki_tags_tag ON wiki_tags(tag);
+
+CREATE TABLE IF NOT EXISTS pages (
+	wiki_id      TEXT NOT NULL,
+	translation  TEXT NOT NULL DEFAULT '',
+	id           TEXT NOT NULL,
+	page_key     TEXT NOT NULL DEFAULT '',
+	language     TEXT NOT NULL DEFAULT '',
+	position     INTEGER NOT NULL,
+	title        TEXT NOT NULL DEFAULT '',
+	content      TEXT NOT NULL DEFAULT '',
+	type         TEXT NOT NULL DEFAULT '',
+	page_order   INTEGER NOT NULL DEFAULT 0,
+	parent_id    TEXT NOT NULL DEFAULT '',
+	children     TEXT NOT NULL DEFAULT '[]',
+	tags         TEXT NOT NULL DEFAULT '[]',
+	created_at   TEXT NOT NULL DEFAULT '',
+	updated_at   TEXT NOT NULL DEFAULT '',
+	word_count   INTEGER NOT NULL DEFAULT 0,
+	reading_time INTEGER NOT NULL DEFAULT 0,
+	source       TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (wiki_id, translation, id)
+);
+
+CREATE TABLE IF NOT EXISTS translations (
+	wiki_id     TEXT NOT NULL,
+	language    TEXT NOT NULL,
+	title       TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TEXT NOT NULL DEFAULT '',
+	updated_at  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (wiki_id, language)
+);
+
+CREATE TABLE IF NOT EXISTS diagrams (
+	wiki_id     TEXT NOT NULL,
+	translation TEXT NOT NULL DEFAULT '',
+	id          TEXT NOT NULL,
+	position    INTEGER NOT NULL,
+	title       TEXT NOT NULL DEFAULT '',
+	type        TEXT NOT NULL DEFAULT '',
+	content     TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	page_id     TEXT NOT NULL DEFAULT '',
+	created_at  TEXT NOT NULL DEFAULT '',
+	updated_at  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (wiki_id, translation, id)
+);
+
+CREATE TABLE IF NOT EXISTS logs (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	wiki_id     TEXT NOT NULL,
+	timestamp   TEXT NOT NULL DEFAULT '',
+	level       TEXT NOT NULL DEFAULT '',
+	step        TEXT NOT NULL DEFAULT '',
+	message     TEXT NOT NULL DEFAULT '',
+	details     TEXT NOT NULL DEFAULT '',
+	duration    TEXT NOT NULL DEFAULT '',
+	progress    INTEGER NOT NULL DEFAULT 0,
+	files_count INTEGER NOT NULL DEFAULT 0,
+	tokens_used INTEGER NOT NULL DEFAULT 0,
+	error       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_logs_wiki ON logs(wiki_id, seq);
+
+CREATE TABLE IF NOT EXISTS chat_messages (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	id          TEXT NOT NULL UNIQUE,
+	wiki_id     TEXT NOT NULL,
+	role        TEXT NOT NULL DEFAULT '',
+	content     TEXT NOT NULL DEFAULT '',
+	context     TEXT NOT NULL DEFAULT '[]',
+	sources     TEXT NOT NULL DEFAULT '[]',
+	timestamp   TEXT NOT NULL DEFAULT '',
+	tokens_used INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_chat_wiki ON chat_messages(wiki_id, seq);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id           TEXT PRIMARY KEY,
+	name         TEXT NOT NULL DEFAULT '',
+	hash         TEXT NOT NULL UNIQUE,
+	scopes       TEXT NOT NULL DEFAULT '[]',
+	created_by   TEXT NOT NULL DEFAULT '',
+	created_at   TEXT NOT NULL DEFAULT '',
+	expires_at   TEXT NOT NULL DEFAULT '',
+	last_used_at TEXT NOT NULL DEFAULT ''
+);
+`
+
+// SQLiteStorage implements Storage on top of a single SQLite database file
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorage opens (and creates if needed) a SQLite database at dbPath
+func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", dbPath)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// SQLite allows a single writer; serializing connections avoids SQLITE_BUSY under load
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+	if err := addMissingColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStorage{db: db}, nil
+}
+
+// sqliteAddedColumns are columns added after the first schema, keyed by
+// table; CREATE TABLE IF NOT EXISTS does not add them to existing databases
+var sqliteAddedColumns = map[string][]string{
+	"pages": {
+		"source TEXT NOT NULL DEFAULT ''",
+		"page_key TEXT NOT NULL DEFAULT ''",
+		"language TEXT NOT NULL DEFAULT ''",
+	},
+}
+
+// addMissingColumns adds the columns of sqliteAddedColumns that an existing database lacks
+func addMissingColumns(db *sql.DB) error {
+	for table, columns := range sqliteAddedColumns {
+		existing := make(map[string]bool)
+		rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+		if err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to inspect table %s: %w", table, err)
+			}
+			existing[name] = true
+		}
+		rows.Close()
+
+		for _, column := range columns {
+			name, _, _ := strings.Cut(column, " ")
+			if existing[name] {
+				continue
+			}
+			if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column); err != nil {
+				return fmt.Errorf("failed to add column %s.%s: %w", table, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database
+func (ss *SQLiteStorage) Close() error {
+	return ss.db.Close()
+}
+
+// SaveWiki saves a wiki and all of its pages, diagrams and translations
+func (ss *SQLiteStorage) SaveWiki(wiki *models.Wiki) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO wikis (id, repository_id, package_path, title, description, status, progress,
+		created_at, updated_at, generated_by, model, language, languages, settings, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			repository_id = excluded.repository_id, package_path = excluded.package_path,
+			title = excluded.title, description = excluded.description, status = excluded.status,
+			progress = excluded.progress, created_at = excluded.created_at, updated_at = excluded.updated_at,
+			generated_by = excluded.generated_by, model = excluded.model, language = excluded.language,
+			languages = excluded.languages, settings = excluded.settings, metadata = excluded.metadata`,
+		wiki.ID, wiki.RepositoryID, wiki.PackagePath, wiki.Title, wiki.Description, string(wiki.Status), wiki.Progress,
+		formatTime(wiki.CreatedAt), formatTime(wiki.UpdatedAt), wiki.GeneratedBy, wiki.Model, wiki.Language,
+		mustJSON(wiki.Languages), mustJSON(wiki.Settings), mustJSON(wiki.Metadata))
+	if err != nil {
+		return fmt.Errorf("failed to save wiki: %w", err)
+	}
+
+	// Child rows are replaced wholesale; a wiki is always saved as a unit
+	for _, table := range []string{"wiki_tags", "pages", "diagrams", "translations"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE wiki_id = ?", wiki.ID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+
+	for i, tag := range wiki.Tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO wiki_tags (wiki_id, tag, position) VALUES (?, ?, ?)`, wiki.ID, tag, i); err != nil {
+			return fmt.Errorf("failed to save tag: %w", err)
+		}
+	}
+
+	if err := insertPages(tx, wiki.ID, "", wiki.Pages); err != nil {
+		return err
+	}
+	if err := insertDiagrams(tx, wiki.ID, "", wiki.Diagrams); err != nil {
+		return err
+	}
+
+	for language, trans := range wiki.Translations {
+		if trans == nil {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO translations (wiki_id, language, title, description, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			wiki.ID, language, trans.Title, trans.Description, formatTime(trans.CreatedAt), formatTime(trans.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to save translation %s: %w", language, err)
+		}
+		if err := insertPages(tx, wiki.ID, language, trans.Pages); err != nil {
+			return err
+		}
+		if err := insertDiagrams(tx, wiki.ID, language, trans.Diagrams); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit wiki: %w", err)
+	}
+	return nil
+}
+
+// insertPages inserts pages for a wiki or one of its translations
+func insertPages(tx *sql.Tx, wikiID, translation string, pages []models.WikiPage) error {
+	for i, page := range pages {
+		_, err := tx.Exec(`INSERT INTO pages (wiki_id, translation, id, page_key, language, position, title, content,
+			type, page_order, parent_id, children, tags, created_at, updated_at, word_count, reading_time, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			wikiID, translation, page.ID, page.Key, page.Language, i, page.Title, page.Content, string(page.Type), page.Order,
+			page.ParentID, mustJSON(page.Children), mustJSON(page.Tags),
+			formatTime(page.CreatedAt), formatTime(page.UpdatedAt), page.WordCount, page.ReadingTime,
+			formatSource(page.Source))
+		if err != nil {
+			return fmt.Errorf("failed to save page %s: %w", page.ID, err)
+		}
+	}
+	return nil
+}
+
+// insertDiagrams inserts diagrams for a wiki or one of its translations
+func insertDiagrams(tx *sql.Tx, wikiID, translation string, diagrams []models.WikiDiagram) error {
+	for i, diagram := range diagrams {
+		_, err := tx.Exec(`INSERT INTO diagrams (wiki_id, translation, id, position, title, type, content,
+			description, page_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			wikiID, translation, diagram.ID, i, diagram.Title, string(diagram.Type), diagram.Content,
+			diagram.Description, diagram.PageID, formatTime(diagram.CreatedAt), formatTime(diagram.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to save diagram %s: %w", diagram.ID, err)
+		}
+	}
+	return nil
+}
+
+// LoadWiki loads a wiki with all of its content
+func (ss *SQLiteStorage) LoadWiki(id string) (*models.Wiki, error) {
+	row := ss.db.QueryRow(`SELECT `+wikiColumns+` FROM wikis WHERE id = ?`, id)
+	wiki, err := scanWiki(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("wiki %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wiki: %w", err)
+	}
+
+	if wiki.Tags, err = ss.loadTags(wiki.ID); err != nil {
+		return nil, err
+	}
+	if err := ss.loadWikiContent(wiki); err != nil {
+		return nil, err
+	}
+	return wiki, nil
+}
+
+// LoadAllWikis loads all wikis with their content
+func (ss *SQLiteStorage) LoadAllWikis() (map[string]*models.Wiki, error) {
+	wikis, err := ss.queryWikis(`SELECT ` + wikiColumns + ` FROM wikis`)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*models.Wiki, len(wikis))
+	for _, wiki := range wikis {
+		if err := ss.loadWikiContent(wiki); err != nil {
+			return nil, err
+		}
+		result[wiki.ID] = wiki
+	}
+	return result, nil
+}
+
+// ListWikiSummaries returns all wikis without pages, diagrams or translations
+func (ss *SQLiteStorage) ListWikiSummaries() ([]*models.Wiki, error) {
+	return ss.queryWikis(`SELECT ` + wikiColumns + ` FROM wikis ORDER BY updated_at DESC`)
+}
+
+// FindWikisByTag returns wikis carrying the tag at wiki level or on any page
+func (ss *SQLiteStorage) FindWikisByTag(tag string) ([]*models.Wiki, error) {
+	wikis, err := ss.queryWikis(`SELECT `+wikiColumns+` FROM wikis WHERE id IN (
+			SELECT wiki_id FROM wiki_tags WHERE tag = ?
+			UNION
+			SELECT p.wiki_id FROM pages p, json_each(p.tags) t WHERE p.translation = '' AND t.value = ?
+		) ORDER BY updated_at DESC`, tag, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, wiki := range wikis {
+		if err := ss.loadWikiContent(wiki); err != nil {
+			return nil, err
+		}
+	}
+	return wikis, nil
+}
+
+// SearchPages performs a case-insensitive substring search over the primary pages of a wiki
+func (ss *SQLiteStorage) SearchPages(wikiID, query string, limit int) ([]models.WikiPage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	// SQLite's lower() only folds ASCII, non-ASCII queries are matched in Go
+	if !isASCII(query) {
+		return ss.searchPagesFolded(wikiID, query, limit)
+	}
+
+	pattern := "%" + escapeLike(strings.ToLower(query)) + "%"
+	rows, err := ss.db.Query(`SELECT `+pageColumns+` FROM pages
+		WHERE wiki_id = ? AND translation = ''
+			AND (lower(title) LIKE ? ESCAPE '\' OR lower(content) LIKE ? ESCAPE '\')
+		ORDER BY position LIMIT ?`, wikiID, pattern, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search pages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPages(rows)
+}
+
+// searchPagesFolded searches the primary pages of a wiki with Unicode case folding
+func (ss *SQLiteStorage) searchPagesFolded(wikiID, query string, limit int) ([]models.WikiPage, error) {
+	rows, err := ss.db.Query(`SELECT `+pageColumns+` FROM pages
+		WHERE wiki_id = ? AND translation = '' ORDER BY position`, wikiID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search pages: %w", err)
+	}
+	defer rows.Close()
+
+	pages, err := scanPages(rows)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	matches := []models.WikiPage{}
+	for _, page := range pages {
+		if strings.Contains(strings.ToLower(page.Title), query) || strings.Contains(strings.ToLower(page.Content), query) {
+			matches = append(matches, page)
+			if len(matches) == limit {
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteWiki deletes a wiki together with its logs and chat history
+func (ss *SQLiteStorage) DeleteWiki(id string) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM wikis WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete wiki: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("wiki %s: %w", id, ErrNotFound)
+	}
+
+	for _, table := range []string{"wiki_tags", "pages", "diagrams", "translations", "logs", "chat_messages"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE wiki_id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
+	}
+	return nil
+}
+
+// SaveLogs replaces the logs for a wiki
+func (ss *SQLiteStorage) SaveLogs(wikiID string, logs []models.WikiLogEntry) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM logs WHERE wiki_id = ?`, wikiID); err != nil {
+		return fmt.Errorf("failed to clear logs: %w", err)
+	}
+	for _, entry := range logs {
+		if err := insertLog(tx, wikiID, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit logs: %w", err)
+	}
+	return nil
+}
+
+// AppendLog appends a single log entry for a wiki
+func (ss *SQLiteStorage) AppendLog(wikiID string, entry models.WikiLogEntry) error {
+	return insertLog(ss.db, wikiID, entry)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertLog inserts one log row
+func insertLog(db execer, wikiID string, entry models.WikiLogEntry) error {
+	_, err := db.Exec(`INSERT INTO logs (wiki_id, timestamp, level, step, message, details, duration,
+		progress, files_count, tokens_used, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		wikiID, formatTime(entry.Timestamp), string(entry.Level), entry.Step, entry.Message, entry.Details,
+		entry.Duration, entry.Progress, entry.FilesCount, entry.TokensUsed, entry.Error)
+	if err != nil {
+		return fmt.Errorf("failed to save log entry: %w", err)
+	}
+	return nil
+}
+
+// LoadLogs loads logs for a wiki in insertion order
+func (ss *SQLiteStorage) LoadLogs(wikiID string) ([]models.WikiLogEntry, error) {
+	rows, err := ss.db.Query(`SELECT wiki_id, timestamp, level, step, message, details, duration,
+		progress, files_count, tokens_used, error FROM logs WHERE wiki_id = ? ORDER BY seq`, wikiID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []models.WikiLogEntry{}
+	for rows.Next() {
+		var entry models.WikiLogEntry
+		var timestamp, level string
+		if err := rows.Scan(&entry.WikiID, &timestamp, &level, &entry.Step, &entry.Message, &entry.Details,
+			&entry.Duration, &entry.Progress, &entry.FilesCount, &entry.TokensUsed, &entry.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan log entry: %w", err)
+		}
+		entry.Timestamp = parseTime(timestamp)
+		entry.Level = models.LogLevel(level)
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
+
+// SaveChatMessage stores a chat message
+func (ss *SQLiteStorage) SaveChatMessage(msg *models.ChatMessage) error {
+	_, err := ss.db.Exec(`INSERT INTO chat_messages (id, wiki_id, role, content, context, sources, timestamp, tokens_used)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET content = excluded.content, context = excluded.context,
+			sources = excluded.sources, tokens_used = excluded.tokens_used`,
+		msg.ID, msg.WikiID, string(msg.Role), msg.Content, mustJSON(msg.Context), mustJSON(msg.Sources),
+		formatTime(msg.Timestamp), msg.TokensUsed)
+	if err != nil {
+		return fmt.Errorf("failed to save chat message: %w", err)
+	}
+	return nil
+}
+
+// LoadChatHistory returns the latest chat messages of a wiki in chronological order.
+// A non-positive limit returns the full history.
+func (ss *SQLiteStorage) LoadChatHistory(wikiID string, limit int) ([]models.ChatMessage, error) {
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+
+	rows, err := ss.db.Query(`SELECT id, wiki_id, role, content, context, sources, timestamp, tokens_used FROM (
+			SELECT * FROM chat_messages WHERE wiki_id = ? ORDER BY seq DESC LIMIT ?
+		) ORDER BY seq`, wikiID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat history: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.ChatMessage{}
+	for rows.Next() {
+		var msg models.ChatMessage
+		var role, context, sources, timestamp string
+		if err := rows.Scan(&msg.ID, &msg.WikiID, &role, &msg.Content, &context, &sources, &timestamp, &msg.TokensUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		msg.Role = models.MessageRole(role)
+		msg.Timestamp = parseTime(timestamp)
+		if err := json.Unmarshal([]byte(context), &msg.Context); err != nil {
+			return nil, fmt.Errorf("failed to decode context of chat message %s: %w", msg.ID, err)
+		}
+		if err := json.Unmarshal([]byte(sources), &msg.Sources); err != nil {
+			return nil, fmt.Errorf("failed to decode sources of chat message %s: %w", msg.ID, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// SaveToken inserts or replaces an API token
+func (ss *SQLiteStorage) SaveToken(token *models.APIToken) error {
+	_, err := ss.db.Exec(`INSERT INTO api_tokens (id, name, hash, scopes, created_by, created_at, expires_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name, hash = excluded.hash, scopes = excluded.scopes,
+			expires_at = excluded.expires_at, last_used_at = excluded.last_used_at`,
+		token.ID, token.Name, token.Hash, mustJSON(token.Scopes), token.CreatedBy, formatTime(token.CreatedAt),
+		formatOptionalTime(token.ExpiresAt), formatOptionalTime(token.LastUsedAt))
+	if err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	return nil
+}
+
+// LoadTokens returns all API tokens ordered by creation time
+func (ss *SQLiteStorage) LoadTokens() ([]models.APIToken, error) {
+	rows, err := ss.db.Query(`SELECT id, name, hash, scopes, created_by, created_at, expires_at, last_used_at
+		FROM api_tokens ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		var token models.APIToken
+		var scopes, createdAt, expiresAt, lastUsedAt string
+		if err := rows.Scan(&token.ID, &token.Name, &token.Hash, &scopes, &token.CreatedBy,
+			&createdAt, &expiresAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		if err := json.Unmarshal([]byte(scopes), &token.Scopes); err != nil {
+			return nil, fmt.Errorf("failed to decode scopes of token %s: %w", token.ID, err)
+		}
+		token.CreatedAt = parseTime(createdAt)
+		token.ExpiresAt = parseOptionalTime(expiresAt)
+		token.LastUsedAt = parseOptionalTime(lastUsedAt)
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken deletes an API token
+func (ss *SQLiteStorage) DeleteToken(id string) error {
+	result, err := ss.db.Exec(`DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("token %s: %w", id, ErrTokenNotFound)
+	}
+	return nil
+}
+
+const wikiColumns = `id, repository_id, package_path, title, description, status, progress, created_at, updated_at,
+	generated_by, model, language, languages, settings, metadata`
+
+const pageColumns = `id, page_key, language, title, content, type, page_order, parent_id, children, tags, created_at, updated_at,
+	word_count, reading_time, source`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWiki scans a wikis row
+func scanWiki(row rowScanner) (*models.Wiki, error) {
+	var wiki models.Wiki
+	var status, createdAt, updatedAt, languages, settings, metadata string
+	err := row.Scan(&wiki.ID, &wiki.RepositoryID, &wiki.PackagePath, &wiki.Title, &wiki.Description, &status,
+		&wiki.Progress, &createdAt, &updatedAt, &wiki.GeneratedBy, &wiki.Model, &wiki.Language,
+		&languages, &settings, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	wiki.Status = models.WikiStatus(status)
+	wiki.CreatedAt = parseTime(createdAt)
+	wiki.UpdatedAt = parseTime(updatedAt)
+	if err := json.Unmarshal([]byte(languages), &wiki.Languages); err != nil {
+		return nil, fmt.Errorf("failed to decode languages: %w", err)
+	}
+	if err := json.Unmarshal([]byte(settings), &wiki.Settings); err != nil {
+		return nil, fmt.Errorf("failed to decode settings: %w", err)
+	}
+	if err := json.Unmarshal([]byte(metadata), &wiki.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return &wiki, nil
+}
+
+// queryWikis runs a query returning wiki rows, without loading their content
+func (ss *SQLiteStorage) queryWikis(query string, args ...interface{}) ([]*models.Wiki, error) {
+	rows, err := ss.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wikis: %w", err)
+	}
+	defer rows.Close()
+
+	var wikis []*models.Wiki
+	for rows.Next() {
+		wiki, err := scanWiki(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wiki: %w", err)
+		}
+		wikis = append(wikis, wiki)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Tags are loaded here because summaries need them too
+	for _, wiki := range wikis {
+		if wiki.Tags, err = ss.loadTags(wiki.ID); err != nil {
+			return nil, err
+		}
+	}
+	return wikis, nil
+}
+
+// loadTags loads wiki-level tags in their original order
+func (ss *SQLiteStorage) loadTags(wikiID string) ([]string, error) {
+	rows, err := ss.db.Query(`SELECT tag FROM wiki_tags WHERE wiki_id = ? ORDER BY position`, wikiID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// loadWikiContent loads pages, diagrams and translations into a wiki
+func (ss *SQLiteStorage) loadWikiContent(wiki *models.Wiki) error {
+	var err error
+	if wiki.Pages, err = ss.loadPages(wiki.ID, ""); err != nil {
+		return err
+	}
+	if wiki.Diagrams, err = ss.loadDiagrams(wiki.ID, ""); err != nil {
+		return err
+	}
+
+	rows, err := ss.db.Query(`SELECT language, title, description, created_at, updated_at
+		FROM translations WHERE wiki_id = ? ORDER BY language`, wiki.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load translations: %w", err)
+	}
+	var translations []*models.WikiTrans
+	for rows.Next() {
+		var trans models.WikiTrans
+		var createdAt, updatedAt string
+		if err := rows.Scan(&trans.Language, &trans.Title, &trans.Description, &createdAt, &updatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan translation: %w", err)
+		}
+		trans.CreatedAt = parseTime(createdAt)
+		trans.UpdatedAt = parseTime(updatedAt)
+		translations = append(translations, &trans)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, trans := range translations {
+		if trans.Pages, err = ss.loadPages(wiki.ID, trans.Language); err != nil {
+			return err
+		}
+		if trans.Diagrams, err = ss.loadDiagrams(wiki.ID, trans.Language); err != nil {
+			return err
+		}
+		if wiki.Translations == nil {
+			wiki.Translations = make(map[string]*models.WikiTrans)
+		}
+		wiki.Translations[trans.Language] = trans
+	}
+	return nil
+}
+
+// loadPages loads the pages of a wiki or one of its translations
+func (ss *SQLiteStorage) loadPages(wikiID, translation string) ([]models.WikiPage, error) {
+	rows, err := ss.db.Query(`SELECT `+pageColumns+` FROM pages
+		WHERE wiki_id = ? AND translation = ? ORDER BY position`, wikiID, translation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPages(rows)
+}
+
+// scanPages scans rows selected with pageColumns
+func scanPages(rows *sql.Rows) ([]models.WikiPage, error) {
+	pages := []models.WikiPage{}
+	for rows.Next() {
+		var page models.WikiPage
+		var pageType, children, tags, createdAt, updatedAt, source string
+		if err := rows.Scan(&page.ID, &page.Key, &page.Language, &page.Title, &page.Content, &pageType, &page.Order, &page.ParentID,
+			&children, &tags, &createdAt, &updatedAt, &page.WordCount, &page.ReadingTime, &source); err != nil {
+			return nil, fmt.Errorf("failed to scan page: %w", err)
+		}
+		page.Type = models.PageType(pageType)
+		page.CreatedAt = parseTime(createdAt)
+		page.UpdatedAt = parseTime(updatedAt)
+		if err := json.Unmarshal([]byte(children), &page.Children); err != nil {
+			return nil, fmt.Errorf("failed to decode children of page %s: %w", page.ID, err)
+		}
+		if err := json.Unmarshal([]byte(tags), &page.Tags); err != nil {
+			return nil, fmt.Errorf("failed to decode tags of page %s: %w", page.ID, err)
+		}
+		if source != "" {
+			if err := json.Unmarshal([]byte(source), &page.Source); err != nil {
+				return nil, fmt.Errorf("failed to decode source of page %s: %w", page.ID, err)
+			}
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+// loadDiagrams loads the diagrams of a wiki or one of its translations
+func (ss *SQLiteStorage) loadDiagrams(wikiID, translation string) ([]models.WikiDiagram, error) {
+	rows, err := ss.db.Query(`SELECT id, title, type, content, description, page_id, created_at, updated_at
+		FROM diagrams WHERE wiki_id = ? AND translation = ? ORDER BY position`, wikiID, translation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load diagrams: %w", err)
+	}
+	defer rows.Close()
+
+	diagrams := []models.WikiDiagram{}
+	for rows.Next() {
+		var diagram models.WikiDiagram
+		var diagramType, createdAt, updatedAt string
+		if err := rows.Scan(&diagram.ID, &diagram.Title, &diagramType, &diagram.Content, &diagram.Description,
+			&diagram.PageID, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan diagram: %w", err)
+		}
+		diagram.Type = models.DiagramType(diagramType)
+		diagram.CreatedAt = parseTime(createdAt)
+		diagram.UpdatedAt = parseTime(updatedAt)
+		diagrams = append(diagrams, diagram)
+	}
+	return diagrams, rows.Err()
+}
+
+// formatTime formats a timestamp for storage; the zero time is stored as an empty string
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime parses a stored timestamp; invalid or empty values yield the zero time
+func parseTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// formatOptionalTime formats a nullable timestamp, nil is stored as ""
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
+
+// parseOptionalTime parses a nullable timestamp, "" yields nil
+func parseOptionalTime(value string) *time.Time {
+	t := parseTime(value)
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// formatSource encodes the source of a translated page, nil is stored as ""
+func formatSource(source *models.TranslationSource) string {
+	if source == nil {
+		return ""
+	}
+	return mustJSON(source)
+}
+
+// mustJSON encodes a value that is known to be serializable
+func mustJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
+
+// escapeLike escapes LIKE wildcards using backslash
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func openTestSQLite(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "kwiki.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteSearchPagesFoldsNonASCII(t *testing.T) {
+	store := openTestSQLite(t)
+	wiki := newFixtureWiki("github.com/example/search", "Search")
+	wiki.Pages[1].Content = "Die ÜBERSICHT der API."
+	mustSave(t, store, wiki)
+
+	for _, query := range []string{"übersicht", "api reference"} {
+		pages, err := store.SearchPages(wiki.ID, query, 10)
+		if err != nil {
+			t.Fatalf("SearchPages(%q): %v", query, err)
+		}
+		if len(pages) != 1 || pages[0].ID != "api_en" {
+			t.Errorf("SearchPages(%q) = %+v", query, pages)
+		}
+	}
+}
+
+func TestSQLiteCorruptPageJSON(t *testing.T) {
+	store := openTestSQLite(t)
+	wiki := newFixtureWiki("github.com/example/corrupt", "Corrupt")
+	mustSave(t, store, wiki)
+
+	if _, err := store.db.Exec(`UPDATE pages SET tags = '[' WHERE wiki_id = ? AND id = 'api_en'`, wiki.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.LoadWiki(wiki.ID); err == nil {
+		t.Error("LoadWiki succeeded with corrupt page tags")
+	}
+}
@@ -2,9 +2,11 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,14 +15,81 @@ import (
 	"github.com/stcn52/kwiki/pkg/models"
 )
 
+// ErrNotFound is returned (wrapped) by LoadWiki and DeleteWiki when the wiki does not exist
+var ErrNotFound = errors.New("wiki not found")
+
 // Storage interface defines the storage operations
 type Storage interface {
 	SaveWiki(wiki *models.Wiki) error
 	LoadWiki(id string) (*models.Wiki, error)
 	LoadAllWikis() (map[string]*models.Wiki, error)
 	DeleteWiki(id string) error
-	SaveLogs(wikiID string, logs []string) error
-	LoadLogs(wikiID string) ([]string, error)
+	SaveLogs(wikiID string, logs []models.WikiLogEntry) error
+	LoadLogs(wikiID string) ([]models.WikiLogEntry, error)
+	AppendLog(wikiID string, entry models.WikiLogEntry) error
+}
+
+// ChatStorage is implemented by backends that persist chat history
+type ChatStorage interface {
+	SaveChatMessage(msg *models.ChatMessage) error
+	LoadChatHistory(wikiID string, limit int) ([]models.ChatMessage, error)
+}
+
+// WikiQuerier is implemented by backends that can answer listing, tag and
+// search queries without loading every wiki into memory
+type WikiQuerier interface {
+	ListWikiSummaries() ([]*models.Wiki, error)
+	FindWikisByTag(tag string) ([]*models.Wiki, error)
+	SearchPages(wikiID, query string, limit int) ([]models.WikiPage, error)
+}
+
+// TokenStorage is implemented by backends that persist API tokens. Tokens are
+// saved with their hash only; SaveToken inserts or replaces by ID.
+type TokenStorage interface {
+	SaveToken(token *models.APIToken) error
+	LoadTokens() ([]models.APIToken, error)
+	DeleteToken(id string) error
+}
+
+// ErrTokenNotFound is returned (wrapped) by DeleteToken when the token does not exist
+var ErrTokenNotFound = errors.New("token not found")
+
+// Checker is implemented by backends that can verify and repair their data at startup
+type Checker interface {
+	Fsck() (*FsckReport, error)
+}
+
+// FsckReport summarizes a startup consistency check
+type FsckReport struct {
+	Checked          int      `json:"checked"`
+	Quarantined      []string `json:"quarantined,omitempty"`
+	TempFilesRemoved int      `json:"temp_files_removed"`
+}
+
+// Storage backends selectable via ServerConfig.StorageBackend
+const (
+	BackendMarkdown = "markdown"
+	BackendSQLite   = "sqlite"
+	BackendFile     = "file"
+)
+
+// Open creates the storage backend by name. dataDir is the server data
+// directory; dbPath is only used by the SQLite backend and defaults to
+// <dataDir>/kwiki.db.
+func Open(backend, dataDir, dbPath string) (Storage, error) {
+	switch strings.ToLower(backend) {
+	case "", BackendMarkdown:
+		return NewMarkdownStorage(filepath.Join(dataDir, "wikis")), nil
+	case BackendSQLite:
+		if dbPath == "" {
+			dbPath = filepath.Join(dataDir, "kwiki.db")
+		}
+		return NewSQLiteStorage(dbPath)
+	case BackendFile:
+		return NewFileStorage(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
 }
 
 // FileStorage implements Storage interface using JSON files
@@ -48,6 +117,13 @@ func NewFileStorage(dataDir string) (*FileStorage, error) {
 		return nil, fmt.Errorf("failed to create logs directory: %w", err)
 	}
 
+	// Files written before IDs were escaped use the raw ID as their path
+	for _, dir := range []string{wikisDir, logsDir} {
+		if err := migrateUnescapedFiles(dir); err != nil {
+			return nil, fmt.Errorf("failed to migrate file names in %s: %w", dir, err)
+		}
+	}
+
 	return &FileStorage{
 		dataDir: dataDir,
 	}, nil
@@ -58,14 +134,14 @@ func (fs *FileStorage) SaveWiki(wiki *models.Wiki) error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
-	filePath := filepath.Join(fs.dataDir, "wikis", fmt.Sprintf("%s.json", wiki.ID))
+	filePath := fs.wikiPath(wiki.ID)
 
 	data, err := json.MarshalIndent(wiki, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal wiki: %w", err)
 	}
 
-	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(filePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write wiki file: %w", err)
 	}
 
@@ -77,12 +153,15 @@ func (fs *FileStorage) LoadWiki(id string) (*models.Wiki, error) {
 	fs.mutex.RLock()
 	defer fs.mutex.RUnlock()
 
-	filePath := filepath.Join(fs.dataDir, "wikis", fmt.Sprintf("%s.json", id))
+	return fs.loadWiki(id)
+}
 
-	data, err := ioutil.ReadFile(filePath)
+// loadWiki reads a wiki file; the caller must hold the mutex
+func (fs *FileStorage) loadWiki(id string) (*models.Wiki, error) {
+	data, err := ioutil.ReadFile(fs.wikiPath(id))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil // Wiki not found
+			return nil, fmt.Errorf("wiki %s: %w", id, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to read wiki file: %w", err)
 	}
@@ -110,15 +189,17 @@ func (fs *FileStorage) LoadAllWikis() (map[string]*models.Wiki, error) {
 
 	for _, file := range files {
 		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
-			wikiID := strings.TrimSuffix(file.Name(), ".json")
-			wiki, err := fs.LoadWiki(wikiID)
+			wikiID, err := url.PathUnescape(strings.TrimSuffix(file.Name(), ".json"))
 			if err != nil {
-				log.Printf("Failed to load wiki %s: %v", wikiID, err)
+				log.Printf("Skipping wiki file %s: %v", file.Name(), err)
 				continue
 			}
-			if wiki != nil {
-				wikis[wikiID] = wiki
+			wiki, err := fs.loadWiki(wikiID)
+			if err != nil {
+				log.Printf("Failed to load wiki %s: %v", wikiID, err)
+				continue
 			}
+			wikis[wiki.ID] = wiki
 		}
 	}
 
@@ -130,59 +211,142 @@ func (fs *FileStorage) DeleteWiki(id string) error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
-	filePath := filepath.Join(fs.dataDir, "wikis", fmt.Sprintf("%s.json", id))
-
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(fs.wikiPath(id)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("wiki %s: %w", id, ErrNotFound)
+		}
 		return fmt.Errorf("failed to delete wiki file: %w", err)
 	}
 
-	// Also delete logs
-	logsPath := filepath.Join(fs.dataDir, "logs", fmt.Sprintf("%s.json", id))
-	if err := os.Remove(logsPath); err != nil && !os.IsNotExist(err) {
-		log.Printf("Failed to delete logs for wiki %s: %v", id, err)
+	// Also delete logs, including the legacy format
+	for _, logsPath := range []string{fs.logsPath(id), fs.legacyLogsPath(id)} {
+		if err := os.Remove(logsPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete logs for wiki %s: %v", id, err)
+		}
 	}
 
 	return nil
 }
 
-// SaveLogs saves logs for a wiki
-func (fs *FileStorage) SaveLogs(wikiID string, logs []string) error {
+// SaveLogs replaces the logs for a wiki
+func (fs *FileStorage) SaveLogs(wikiID string, logs []models.WikiLogEntry) error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 
-	filePath := filepath.Join(fs.dataDir, "logs", fmt.Sprintf("%s.json", wikiID))
-
-	data, err := json.MarshalIndent(logs, "", "  ")
+	data, err := encodeLogLines(logs)
 	if err != nil {
-		return fmt.Errorf("failed to marshal logs: %w", err)
+		return err
 	}
 
-	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(fs.logsPath(wikiID), data, 0644); err != nil {
 		return fmt.Errorf("failed to write logs file: %w", err)
 	}
 
 	return nil
 }
 
+// AppendLog appends a single log entry for a wiki
+func (fs *FileStorage) AppendLog(wikiID string, entry models.WikiLogEntry) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return appendLogLine(fs.logsPath(wikiID), entry)
+}
+
 // LoadLogs loads logs for a wiki
-func (fs *FileStorage) LoadLogs(wikiID string) ([]string, error) {
+func (fs *FileStorage) LoadLogs(wikiID string) ([]models.WikiLogEntry, error) {
 	fs.mutex.RLock()
 	defer fs.mutex.RUnlock()
 
-	filePath := filepath.Join(fs.dataDir, "logs", fmt.Sprintf("%s.json", wikiID))
+	data, err := ioutil.ReadFile(fs.logsPath(wikiID))
+	if err == nil {
+		return decodeLogLines(data), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read logs file: %w", err)
+	}
 
-	data, err := ioutil.ReadFile(filePath)
+	// Fall back to the legacy JSON array of plain strings
+	data, err = ioutil.ReadFile(fs.legacyLogsPath(wikiID))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return []string{}, nil // No logs found
+			return []models.WikiLogEntry{}, nil // No logs found
 		}
 		return nil, fmt.Errorf("failed to read logs file: %w", err)
 	}
 
-	var logs []string
-	if err := json.Unmarshal(data, &logs); err != nil {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal logs: %w", err)
 	}
 
-	return logs, nil
+	return legacyLogEntries(wikiID, lines), nil
+}
+
+// wikiPath returns the JSON file for a wiki. IDs are package paths containing
+// slashes, so they are escaped into a single file name.
+func (fs *FileStorage) wikiPath(wikiID string) string {
+	return filepath.Join(fs.dataDir, "wikis", url.PathEscape(wikiID)+".json")
+}
+
+// logsPath returns the JSON lines log file for a wiki
+func (fs *FileStorage) logsPath(wikiID string) string {
+	return filepath.Join(fs.dataDir, "logs", url.PathEscape(wikiID)+".jsonl")
+}
+
+// legacyLogsPath returns the legacy JSON array log file for a wiki
+func (fs *FileStorage) legacyLogsPath(wikiID string) string {
+	return filepath.Join(fs.dataDir, "logs", url.PathEscape(wikiID)+".json")
+}
+
+// migrateUnescapedFiles renames files named after the raw wiki ID, e.g.
+// wikis/github.com/owner/repo.json, to the escaped single file name used by
+// wikiPath and logsPath. Empty directories left behind are removed.
+func migrateUnescapedFiles(dir string) error {
+	var legacy []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(rel)
+		if ext != ".json" && ext != ".jsonl" {
+			return nil
+		}
+		// Names that round-trip through escaping are already migrated
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ext))
+		if id, err := url.PathUnescape(name); err == nil && url.PathEscape(id) == name {
+			return nil
+		}
+		legacy = append(legacy, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range legacy {
+		ext := filepath.Ext(rel)
+		id := filepath.ToSlash(strings.TrimSuffix(rel, ext))
+		target := filepath.Join(dir, url.PathEscape(id)+ext)
+		if _, err := os.Stat(target); err == nil {
+			log.Printf("Skipping legacy file %s: %s already exists", rel, target)
+			continue
+		}
+		if err := os.Rename(filepath.Join(dir, rel), target); err != nil {
+			return err
+		}
+		log.Printf("Renamed legacy file %s to %s", rel, filepath.Base(target))
+
+		// Remove the directories of the raw ID that are now empty
+		for parent := filepath.Dir(filepath.Join(dir, rel)); parent != dir; parent = filepath.Dir(parent) {
+			if os.Remove(parent) != nil {
+				break
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStorageMigratesUnescapedNames(t *testing.T) {
+	dir := t.TempDir()
+	legacy := map[string]string{
+		"wikis/github.com/example/repo@v1.json": `{"id": "github.com/example/repo@v1", "title": "Repo"}`,
+		"wikis/plain.json":                      `{"id": "plain", "title": "Plain"}`,
+		"logs/github.com/example/repo@v1.jsonl": `{"wiki_id": "github.com/example/repo@v1", "message": "done"}` + "\n",
+	}
+	for name, content := range legacy {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	wikis, err := store.LoadAllWikis()
+	if err != nil || len(wikis) != 2 || wikis["github.com/example/repo@v1"] == nil {
+		t.Fatalf("LoadAllWikis = %v, %v", wikis, err)
+	}
+	if logs, err := store.LoadLogs("github.com/example/repo@v1"); err != nil || len(logs) != 1 {
+		t.Errorf("LoadLogs = %v, %v", logs, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "wikis", "github.com")); !os.IsNotExist(err) {
+		t.Errorf("legacy directory kept: %v", err)
+	}
+}
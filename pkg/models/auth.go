@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// APIToken is an API token created through the admin API. Only the SHA-256
+// hash of the secret is stored; the secret itself is shown once on creation.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash,omitempty"` // hex encoded SHA-256 of the token
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WikiVisibility controls who can see a wiki when authentication is enabled
+type WikiVisibility string
+
+const (
+	VisibilityPublic   WikiVisibility = "public"   // Everyone who may read, including anonymous readers
+	VisibilityInternal WikiVisibility = "internal" // Any authenticated user
+	VisibilityPrivate  WikiVisibility = "private"  // Only the owner and members
+)
+
+// Valid reports whether v is a known visibility; empty means public
+func (v WikiVisibility) Valid() bool {
+	switch v {
+	case "", VisibilityPublic, VisibilityInternal, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// WikiRole is a user's role on a single wiki. Roles are ordered: owner
+// includes editor, editor includes viewer.
+type WikiRole string
+
+const (
+	WikiRoleViewer WikiRole = "viewer" // Read the wiki, its search and chat
+	WikiRoleEditor WikiRole = "editor" // Regenerate and change the refresh schedule
+	WikiRoleOwner  WikiRole = "owner"  // Delete and manage access
+)
+
+// wikiRoleLevel orders roles, unknown roles grant nothing
+var wikiRoleLevel = map[WikiRole]int{
+	WikiRoleViewer: 1,
+	WikiRoleEditor: 2,
+	WikiRoleOwner:  3,
+}
+
+// Valid reports whether r is a known role
+func (r WikiRole) Valid() bool {
+	_, ok := wikiRoleLevel[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the permissions of other
+func (r WikiRole) Includes(other WikiRole) bool {
+	return r.Valid() && wikiRoleLevel[r] >= wikiRoleLevel[other]
+}
+
+// WikiAccess describes who can see and change a wiki. Member keys are
+// usernames or "group:<name>" for everyone in a group.
+type WikiAccess struct {
+	Visibility WikiVisibility      `json:"visibility,omitempty"` // empty means public
+	Owner      string              `json:"owner,omitempty"`
+	Members    map[string]WikiRole `json:"members,omitempty"`
+}
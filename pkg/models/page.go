@@ -0,0 +1,130 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// regionalLanguagePattern matches regional language codes such as pt-BR at the end of legacy page IDs
+var regionalLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}-[A-Za-z0-9]{2,8}$`)
+
+// PageID returns the ID of the page with a canonical key in a language. IDs
+// are only built here; the key and language of a page are read from its
+// Key and Language fields, never parsed back from the ID.
+func PageID(key, language string) string {
+	return key + "_" + language
+}
+
+// AllPages returns the generated pages followed by the pages of the
+// translations, ordered by language
+func (w *Wiki) AllPages() []WikiPage {
+	pages := append(make([]WikiPage, 0, len(w.Pages)), w.Pages...)
+	languages := make([]string, 0, len(w.Translations))
+	for language, trans := range w.Translations {
+		if trans != nil {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		pages = append(pages, w.Translations[language].Pages...)
+	}
+	return pages
+}
+
+// FindPage returns the generated or translated page with an ID, nil when there is none
+func (w *Wiki) FindPage(id string) *WikiPage {
+	for i := range w.Pages {
+		if w.Pages[i].ID == id {
+			return &w.Pages[i]
+		}
+	}
+	for _, trans := range w.Translations {
+		if trans == nil {
+			continue
+		}
+		for i := range trans.Pages {
+			if trans.Pages[i].ID == id {
+				return &trans.Pages[i]
+			}
+		}
+	}
+	return nil
+}
+
+// PageInLanguage returns the page with a canonical key in a language, preferring
+// a generated page over a translation; nil when there is none
+func (w *Wiki) PageInLanguage(key, language string) *WikiPage {
+	for i := range w.Pages {
+		if w.Pages[i].Key == key && w.Pages[i].Language == language {
+			return &w.Pages[i]
+		}
+	}
+	if trans := w.Translations[language]; trans != nil {
+		for i := range trans.Pages {
+			if trans.Pages[i].Key == key {
+				return &trans.Pages[i]
+			}
+		}
+	}
+	return nil
+}
+
+// MigratePageIdentity fills the Key and Language of pages stored before they
+// were recorded. The language of a generated page is taken from the suffix of
+// its <key>_<language> ID, falling back to the primary language of the wiki;
+// translated pages are in the language of their translation. It reports
+// whether any page changed.
+func MigratePageIdentity(wiki *Wiki) bool {
+	primary := wiki.Language
+	if primary == "" {
+		primary = wiki.Settings.Language
+	}
+
+	changed := false
+	for i := range wiki.Pages {
+		page := &wiki.Pages[i]
+		if page.Language == "" {
+			page.Language = legacyPageLanguage(page.ID, wiki.Languages, primary)
+			changed = true
+		}
+		if page.Key == "" {
+			page.Key = strings.TrimSuffix(page.ID, "_"+page.Language)
+			changed = true
+		}
+	}
+	for language, trans := range wiki.Translations {
+		if trans == nil {
+			continue
+		}
+		for i := range trans.Pages {
+			page := &trans.Pages[i]
+			if page.Language == "" {
+				page.Language = language
+				changed = true
+			}
+			if page.Key == "" {
+				page.Key = strings.TrimSuffix(page.ID, "_"+page.Language)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// legacyPageLanguage derives the language of a page from an ID of the form <key>_<language>
+func legacyPageLanguage(id string, languages []string, primary string) string {
+	if i := strings.LastIndex(id, "_"); i > 0 {
+		suffix := id[i+1:]
+		for _, language := range languages {
+			if suffix == language {
+				return suffix
+			}
+		}
+		if _, ok := SupportedLanguages[suffix]; ok || regionalLanguagePattern.MatchString(suffix) {
+			return suffix
+		}
+	}
+	return primary
+}
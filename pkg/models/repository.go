@@ -12,6 +12,7 @@ type Repository struct {
 	Owner       string    `json:"owner"`
 	Provider    string    `json:"provider"` // github, gitlab, bitbucket
 	Branch      string    `json:"branch"`
+	CommitSHA   string    `json:"commit_sha,omitempty"` // Resolved commit of the analyzed ref
 	LocalPath   string    `json:"local_path"`
 	Size        int64     `json:"size"`
 	FileCount   int       `json:"file_count"`
@@ -102,6 +103,7 @@ type Function struct {
 	EndLine     int         `json:"end_line"`
 	Language    string      `json:"language"`
 	Signature   string      `json:"signature"`
+	Receiver    string      `json:"receiver,omitempty"` // Type a method belongs to, e.g. Server for func (s *Server) Start()
 	Parameters  []Parameter `json:"parameters"`
 	ReturnType  string      `json:"return_type,omitempty"`
 	Description string      `json:"description,omitempty"`
@@ -130,6 +132,7 @@ type Class struct {
 	StartLine   int        `json:"start_line"`
 	EndLine     int        `json:"end_line"`
 	Language    string     `json:"language"`
+	Signature   string     `json:"signature,omitempty"`
 	Description string     `json:"description,omitempty"`
 	Methods     []Function `json:"methods"`
 	Properties  []Property `json:"properties"`
@@ -49,6 +49,16 @@ const (
 	LogLevelDebug   LogLevel = "debug"
 )
 
+// Log steps used in WikiLogEntry.Step
+const (
+	LogStepSetup     = "setup"     // Request accepted, wiki created
+	LogStepAnalyze   = "analyze"   // Repository analysis
+	LogStepGenerate  = "generate"  // Page generation loop
+	LogStepPage      = "page"      // A single page finished or failed
+	LogStepComplete  = "complete"  // Generation finished (completed or failed)
+	LogStepTranslate = "translate" // Translation of an existing wiki
+)
+
 // WikiTrans represents a translation of a wiki
 type WikiTrans struct {
 	Language    string        `json:"language"`    // Language code (e.g., "en", "zh", "ja")
@@ -76,6 +86,7 @@ var SupportedLanguages = map[string]string{
 
 // WikiLogEntry represents a detailed log entry
 type WikiLogEntry struct {
+	WikiID     string    `json:"wiki_id,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 	Level      LogLevel  `json:"level"`
 	Step       string    `json:"step"`
@@ -90,7 +101,9 @@ type WikiLogEntry struct {
 
 // WikiPage represents a page in the wiki
 type WikiPage struct {
-	ID          string    `json:"id"`
+	ID          string    `json:"id"`       // <key>_<language>, see PageID
+	Key         string    `json:"key"`      // Canonical key shared by the page in every language, e.g. readme
+	Language    string    `json:"language"` // Language of the content
 	Title       string    `json:"title"`
 	Content     string    `json:"content"`
 	Type        PageType  `json:"type"`
@@ -102,6 +115,16 @@ type WikiPage struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	WordCount   int       `json:"word_count"`
 	ReadingTime int       `json:"reading_time"` // in minutes
+
+	Source *TranslationSource `json:"source,omitempty"` // Source page of a translated page, nil for generated pages
+}
+
+// TranslationSource records the primary-language page a translated page was
+// translated from, to detect translations that are older than their source
+type TranslationSource struct {
+	PageID    string    `json:"page_id"`    // ID of the source page
+	Hash      string    `json:"hash"`       // Hash of the source title and content when translated
+	UpdatedAt time.Time `json:"updated_at"` // UpdatedAt of the source page when translated
 }
 
 // PageType represents the type of wiki page
@@ -156,9 +179,17 @@ type WikiSettings struct {
 	EnableRAG       bool              `json:"enable_rag"`
 	Language        string            `json:"language"`
 	Theme           string            `json:"theme"`
-	CustomPrompts   map[string]string `json:"custom_prompts,omitempty"`
+	CustomPrompts   map[string]string `json:"custom_prompts,omitempty"` // Keyed by "*", page type or template name; appended to the template prompt, "<key>:replace" replaces it
 	ExcludePatterns []string          `json:"exclude_patterns,omitempty"`
 	IncludePatterns []string          `json:"include_patterns,omitempty"`
+	RefreshSchedule string            `json:"refresh_schedule,omitempty"` // Cron expression or interval (e.g. "0 3 * * *", "6h") for scheduled refresh
+	Templates       []string          `json:"templates,omitempty"`        // Prompt templates to generate pages from (e.g. ["readme", "api-reference"]); all when empty
+	Audience        string            `json:"audience,omitempty"`         // Intended readers, e.g. "plugin authors"
+	Tone            string            `json:"tone,omitempty"`             // Writing tone, e.g. "concise"
+	Glossary        map[string]string `json:"glossary,omitempty"`         // Project terms and their meaning
+	PlanOutline     bool              `json:"plan_outline,omitempty"`     // Let the model plan the page outline from the analyzed code structure
+	ModulePages     bool              `json:"module_pages,omitempty"`     // Add a reference page per analyzed module below the API reference
+	Variables       map[string]string `json:"variables,omitempty"`        // User-defined values exposed to templates and custom prompts as {{.Vars.name}}
 }
 
 // WikiMetadata represents additional metadata about the wiki
@@ -174,22 +205,36 @@ type WikiMetadata struct {
 	Tags              []string       `json:"tags"`
 	Categories        []string       `json:"categories"`
 	Statistics        map[string]int `json:"statistics"`
-	PackagePath       string         `json:"package_path"`   // 包路径，如 github.com/gin-gonic/gin
-	RepositoryURL     string         `json:"repository_url"` // 原始仓库URL
+	PackagePath       string         `json:"package_path"`              // 包路径，如 github.com/gin-gonic/gin
+	RepositoryURL     string         `json:"repository_url"`            // 原始仓库URL
+	Ref               string         `json:"ref,omitempty"`             // 固定的分支、标签或提交，空表示默认分支
+	CommitSHA         string         `json:"commit_sha,omitempty"`      // 生成时解析出的提交SHA
+	LastRefreshAt     *time.Time     `json:"last_refresh_at,omitempty"` // 定时刷新最近一次检查远程HEAD的时间
+	NextRefreshAt     *time.Time     `json:"next_refresh_at,omitempty"` // 定时刷新下一次检查的时间
+	Access            WikiAccess     `json:"access"`                    // 可见性、所有者和成员角色
+	// RequestSettings 是生成请求中指定的设置，不含 .kwiki.yaml 合并进来的值。
+	// 重新生成时以它为请求设置，再重新合并仓库当前的 .kwiki.yaml
+	RequestSettings     *WikiSettings `json:"request_settings,omitempty"`
+	RepoConfigLanguages bool          `json:"repo_config_languages,omitempty"` // 语言取自 .kwiki.yaml，重新生成时重新读取
+	// RequiresAccessToken 表示生成时使用了访问令牌。令牌不会保存，
+	// 因此 webhook 和定时刷新无法重新生成这个 wiki
+	RequiresAccessToken bool `json:"requires_access_token,omitempty"`
 }
 
 // GenerationRequest represents a request to generate a wiki
 type GenerationRequest struct {
-	RepositoryURL    string       `json:"repository_url"`
-	Branch           string       `json:"branch,omitempty"`
-	AccessToken      string       `json:"access_token,omitempty"`
-	Settings         WikiSettings `json:"settings"`
-	Title            string       `json:"title,omitempty"`
-	Description      string       `json:"description,omitempty"`
-	CustomPrompts    []string     `json:"custom_prompts,omitempty"`
-	Languages        []string     `json:"languages,omitempty"`          // Languages to generate (e.g., ["en", "zh"])
-	PrimaryLanguage  string       `json:"primary_language,omitempty"`   // Primary language (default: "en")
-	GenerateAllLangs bool         `json:"generate_all_langs,omitempty"` // Generate all supported languages
+	RepositoryURL    string         `json:"repository_url"`
+	Branch           string         `json:"branch,omitempty"`
+	Ref              string         `json:"ref,omitempty"` // Branch, tag or commit SHA to pin; Branch is used when empty
+	AccessToken      string         `json:"access_token,omitempty"`
+	Visibility       WikiVisibility `json:"visibility,omitempty"` // Defaults to private when AccessToken is set, public otherwise
+	Settings         WikiSettings   `json:"settings"`
+	Title            string         `json:"title,omitempty"`
+	Description      string         `json:"description,omitempty"`
+	CustomPrompts    []string       `json:"custom_prompts,omitempty"`     // Appended to the prompt of every page, after Settings.CustomPrompts["*"]
+	Languages        []string       `json:"languages,omitempty"`          // Languages to generate (e.g., ["en", "zh"])
+	PrimaryLanguage  string         `json:"primary_language,omitempty"`   // Primary language (default: "en")
+	GenerateAllLangs bool           `json:"generate_all_langs,omitempty"` // Generate all supported languages
 }
 
 // GenerationProgress represents the progress of wiki generation
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RepositoryURL is a parsed git remote. It covers HTTP(S), ssh://, git:// and
+// scp-like (git@host:org/repo.git) remotes on any host, including nested
+// GitLab groups such as gitlab.example.com/group/subgroup/repo.
+type RepositoryURL struct {
+	Scheme string // https, http, ssh or git
+	User   string // user for SSH remotes, usually "git"
+	Host   string // host name without port
+	Port   string
+	Path   string // full repository path without .git, e.g. group/subgroup/repo
+	Owner  string // everything before the repository name, e.g. group/subgroup
+	Name   string // repository name
+}
+
+// ParseRepositoryURL parses a git remote URL. URLs without a scheme such as
+// "github.com/owner/repo" are treated as HTTPS.
+func ParseRepositoryURL(raw string) (*RepositoryURL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("empty repository URL")
+	}
+
+	repo := &RepositoryURL{}
+	var path string
+
+	switch {
+	case strings.Contains(raw, "://"):
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid repository URL %q: %w", raw, err)
+		}
+		switch parsed.Scheme {
+		case "https", "http", "ssh", "git":
+		case "git+ssh", "ssh+git":
+			parsed.Scheme = "ssh"
+		default:
+			return nil, fmt.Errorf("unsupported repository URL scheme %q", parsed.Scheme)
+		}
+		repo.Scheme = parsed.Scheme
+		repo.Host = parsed.Hostname()
+		repo.Port = parsed.Port()
+		if parsed.User != nil && repo.Scheme == "ssh" {
+			repo.User = parsed.User.Username()
+		}
+		path = parsed.Path
+	case isSCPLike(raw):
+		// user@host:path, no port allowed in this form
+		at := strings.Index(raw, "@")
+		colon := strings.Index(raw, ":")
+		repo.Scheme = "ssh"
+		repo.User = raw[:at]
+		repo.Host = raw[at+1 : colon]
+		path = raw[colon+1:]
+	default:
+		slash := strings.Index(raw, "/")
+		if slash <= 0 || !strings.Contains(raw[:slash], ".") {
+			return nil, fmt.Errorf("invalid repository URL %q", raw)
+		}
+		repo.Scheme = "https"
+		repo.Host = raw[:slash]
+		path = raw[slash:]
+	}
+
+	repo.Host = strings.ToLower(repo.Host)
+	if repo.Host == "" {
+		return nil, fmt.Errorf("repository URL %q has no host", raw)
+	}
+
+	path = strings.Trim(path, "/")
+	path = trimWebSuffix(repo.Host, path)
+	path = strings.TrimSuffix(path, ".git")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("repository URL %q has no repository path", raw)
+	}
+	// The path names wikis and directories on disk, so it must not escape them
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("repository URL %q has an invalid path segment %q", raw, segment)
+		}
+	}
+
+	repo.Path = path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		repo.Owner = path[:i]
+		repo.Name = path[i+1:]
+	} else {
+		repo.Name = path
+	}
+	return repo, nil
+}
+
+// PackagePath returns the host-qualified path used as wiki ID and storage directory,
+// e.g. gitlab.example.com/group/subgroup/repo
+func (r *RepositoryURL) PackagePath() string {
+	return r.Host + "/" + r.Path
+}
+
+// IsSSH reports whether the remote uses the SSH transport
+func (r *RepositoryURL) IsSSH() bool {
+	return r.Scheme == "ssh"
+}
+
+// isSCPLike reports whether raw has the scp-like form user@host:path
+func isSCPLike(raw string) bool {
+	at := strings.Index(raw, "@")
+	colon := strings.Index(raw, ":")
+	slash := strings.Index(raw, "/")
+	return at > 0 && colon > at+1 && (slash < 0 || colon < slash)
+}
+
+// trimWebSuffix strips browser paths pasted instead of the clone URL,
+// e.g. /-/tree/main on GitLab or /tree/main, /blob/... on GitHub and Gitea
+func trimWebSuffix(host, path string) string {
+	if i := strings.Index(path, "/-/"); i >= 0 {
+		return path[:i]
+	}
+	if host == "github.com" || host == "bitbucket.org" {
+		// Repositories on these hosts are always owner/repo
+		if parts := strings.SplitN(path, "/", 3); len(parts) == 3 {
+			return parts[0] + "/" + parts[1]
+		}
+		return path
+	}
+	for _, marker := range []string{"/src/branch/", "/src/commit/", "/tree/", "/blob/"} {
+		if i := strings.Index(path, marker); i >= 0 {
+			return path[:i]
+		}
+	}
+	return path
+}
+
+// VersionedPackagePath returns the wiki ID for a package pinned to a ref,
+// e.g. github.com/gin-gonic/gin@v1.9.1. The ref is path-escaped so branches
+// such as feature/x stay a single path segment. An empty ref returns packagePath.
+func VersionedPackagePath(packagePath, ref string) string {
+	if ref == "" {
+		return packagePath
+	}
+	return packagePath + "@" + url.PathEscape(ref)
+}
+
+// SplitPackageRef splits "path@ref" into the package path and the unescaped ref.
+// Package paths never contain "@", so everything after the first one is the ref.
+func SplitPackageRef(s string) (packagePath, ref string) {
+	i := strings.Index(s, "@")
+	if i < 0 {
+		return s, ""
+	}
+	ref = s[i+1:]
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		ref = unescaped
+	}
+	return s[:i], ref
+}
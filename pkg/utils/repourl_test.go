@@ -0,0 +1,82 @@
+package utils
+
+import "testing"
+
+func TestParseRepositoryURL(t *testing.T) {
+	tests := []struct {
+		raw         string
+		packagePath string
+		owner, name string
+		ssh         bool
+	}{
+		{"https://github.com/gin-gonic/gin", "github.com/gin-gonic/gin", "gin-gonic", "gin", false},
+		{"https://github.com/gin-gonic/gin.git", "github.com/gin-gonic/gin", "gin-gonic", "gin", false},
+		{"https://github.com/gin-gonic/gin/tree/master/binding", "github.com/gin-gonic/gin", "gin-gonic", "gin", false},
+		{"github.com/gorilla/websocket", "github.com/gorilla/websocket", "gorilla", "websocket", false},
+		{"https://gitlab.example.com/group/subgroup/repo.git", "gitlab.example.com/group/subgroup/repo", "group/subgroup", "repo", false},
+		{"https://gitlab.example.com/group/subgroup/repo/-/tree/main", "gitlab.example.com/group/subgroup/repo", "group/subgroup", "repo", false},
+		{"https://git.example.com:3000/org/repo/src/branch/main", "git.example.com/org/repo", "org", "repo", false},
+		{"git@github.com:stcn52/kwiki.git", "github.com/stcn52/kwiki", "stcn52", "kwiki", true},
+		{"git@gitlab.example.com:group/sub/repo.git", "gitlab.example.com/group/sub/repo", "group/sub", "repo", true},
+		{"ssh://git@git.example.com:2222/org/repo.git", "git.example.com/org/repo", "org", "repo", true},
+		{"git://git.example.com/repo.git", "git.example.com/repo", "", "repo", false},
+	}
+
+	for _, tt := range tests {
+		remote, err := ParseRepositoryURL(tt.raw)
+		if err != nil {
+			t.Errorf("ParseRepositoryURL(%q): %v", tt.raw, err)
+			continue
+		}
+		if got := remote.PackagePath(); got != tt.packagePath {
+			t.Errorf("%q: package path = %q, want %q", tt.raw, got, tt.packagePath)
+		}
+		if remote.Owner != tt.owner || remote.Name != tt.name {
+			t.Errorf("%q: owner/name = %q/%q, want %q/%q", tt.raw, remote.Owner, remote.Name, tt.owner, tt.name)
+		}
+		if remote.IsSSH() != tt.ssh {
+			t.Errorf("%q: IsSSH = %v, want %v", tt.raw, remote.IsSSH(), tt.ssh)
+		}
+	}
+
+	for _, raw := range []string{
+		"", "not a url", "ftp://example.com/repo", "https://example.com/",
+		"https://evil.com/a/../../../../tmp/victim",
+		"https://example.com/org/./repo",
+		"https://example.com/org//repo",
+		"https://example.com/org/%2e%2e/repo",
+		"git@example.com:../repo.git",
+		"example.com/org/../../repo",
+		"https://example.com/..",
+	} {
+		if _, err := ParseRepositoryURL(raw); err == nil {
+			t.Errorf("ParseRepositoryURL(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestVersionedPackagePath(t *testing.T) {
+	tests := []struct {
+		path, ref, id string
+	}{
+		{"github.com/gin-gonic/gin", "", "github.com/gin-gonic/gin"},
+		{"github.com/gin-gonic/gin", "v1.9.1", "github.com/gin-gonic/gin@v1.9.1"},
+		{"gitlab.example.com/group/sub/repo", "feature/x", "gitlab.example.com/group/sub/repo@feature%2Fx"},
+	}
+
+	for _, tt := range tests {
+		id := VersionedPackagePath(tt.path, tt.ref)
+		if id != tt.id {
+			t.Errorf("VersionedPackagePath(%q, %q) = %q, want %q", tt.path, tt.ref, id, tt.id)
+		}
+		path, ref := SplitPackageRef(id)
+		if path != tt.path || ref != tt.ref {
+			t.Errorf("SplitPackageRef(%q) = %q, %q", id, path, ref)
+		}
+	}
+
+	// Route paths are already unescaped
+	if path, ref := SplitPackageRef("github.com/a/b@feature/x"); path != "github.com/a/b" || ref != "feature/x" {
+		t.Errorf("SplitPackageRef unescaped = %q, %q", path, ref)
+	}
+}
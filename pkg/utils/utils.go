@@ -304,7 +304,12 @@ func DefaultInt(i, defaultValue int) int {
 
 // URLToPackagePath converts a repository URL to a package path
 // Example: https://github.com/gorilla/websocket -> github.com/gorilla/websocket
+// Example: git@gitlab.example.com:group/sub/repo.git -> gitlab.example.com/group/sub/repo
 func URLToPackagePath(repoURL string) string {
+	if parsed, err := ParseRepositoryURL(repoURL); err == nil {
+		return parsed.PackagePath()
+	}
+
 	// Remove protocol
 	repoURL = strings.TrimPrefix(repoURL, "https://")
 	repoURL = strings.TrimPrefix(repoURL, "http://")
@@ -340,8 +345,13 @@ func SanitizePackagePath(packagePath string) string {
 	return strings.ToLower(packagePath)
 }
 
-// ExtractRepositoryInfo extracts owner and repo name from a repository URL
+// ExtractRepositoryInfo extracts owner and repo name from a repository URL.
+// For nested groups the owner is the full group path, e.g. group/subgroup.
 func ExtractRepositoryInfo(repoURL string) (owner, repo string) {
+	if parsed, err := ParseRepositoryURL(repoURL); err == nil && parsed.Owner != "" {
+		return parsed.Owner, parsed.Name
+	}
+
 	packagePath := URLToPackagePath(repoURL)
 
 	// Split by / and get the last two parts